@@ -25,6 +25,7 @@ import (
 	"github.com/DeFiCh/rosetta-defichain/defichain"
 
 	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/coinbase/rosetta-sdk-go/storage/encoder"
 	"github.com/coinbase/rosetta-sdk-go/types"
 )
@@ -48,6 +49,14 @@ const (
 	// Testnet is the DeFiChain Testnet3.
 	Testnet string = "TESTNET"
 
+	// Regtest is a local DeFiChain regression
+	// test network.
+	Regtest string = "REGTEST"
+
+	// Devnet is a private DeFiChain network
+	// that shares the testnet address encoding.
+	Devnet string = "DEVNET"
+
 	// mainnetConfigPath is the path of the DeFiChain
 	// configuration file for mainnet.
 	mainnetConfigPath = "/app/defichain-mainnet.conf"
@@ -56,6 +65,14 @@ const (
 	// configuration file for testnet.
 	testnetConfigPath = "/app/defichain-testnet.conf"
 
+	// regtestConfigPath is the path of the DeFiChain
+	// configuration file for regtest.
+	regtestConfigPath = "/app/defichain-regtest.conf"
+
+	// devnetConfigPath is the path of the DeFiChain
+	// configuration file for devnet.
+	devnetConfigPath = "/app/defichain-devnet.conf"
+
 	// Zstandard compression dictionaries
 	transactionNamespace         = "transaction"
 	testnetTransactionDictionary = "/app/testnet-transaction.zstd"
@@ -63,6 +80,8 @@ const (
 
 	mainnetRPCPort = 8554
 	testnetRPCPort = 18554
+	regtestRPCPort = 19554
+	devnetRPCPort  = 20554
 
 	// min prune depth is 288:
 	// https://github.com/bitcoin/bitcoin/blob/ad2952d17a2af419a04256b10b53c7377f826a27/src/validation.h#L84
@@ -98,6 +117,17 @@ const (
 	// read to determine the port for the Rosetta
 	// implementation.
 	PortEnv = "PORT"
+
+	// GenesisHashEnv is the environment variable
+	// read to determine the genesis block hash of
+	// a DEVNET (which has no well-known genesis).
+	GenesisHashEnv = "GENESIS_HASH"
+
+	// ExemptionsPathEnv is the environment variable
+	// read to determine the path of a JSON file of
+	// exemptions that replaces the exemptions of
+	// the network (optional).
+	ExemptionsPathEnv = "EXEMPTIONS_PATH"
 )
 
 // PruningConfiguration is the configuration to
@@ -122,6 +152,8 @@ type Configuration struct {
 	IndexerPath            string
 	DefidPath              string
 	Compressors            []*encoder.CompressorEntry
+	Exemptions             []*defichain.Exemption
+	Policy                 *PolicyConfiguration
 }
 
 // LoadConfiguration attempts to create a new Configuration
@@ -167,6 +199,7 @@ func LoadConfiguration(baseDirectory string) (*Configuration, error) {
 		config.Currency = defichain.MainnetCurrency
 		config.ConfigPath = mainnetConfigPath
 		config.RPCPort = mainnetRPCPort
+		config.Exemptions = mainnetExemptions
 		config.Compressors = []*encoder.CompressorEntry{
 			{
 				Namespace:      transactionNamespace,
@@ -183,12 +216,51 @@ func LoadConfiguration(baseDirectory string) (*Configuration, error) {
 		config.Currency = defichain.TestnetCurrency
 		config.ConfigPath = testnetConfigPath
 		config.RPCPort = testnetRPCPort
+		config.Exemptions = testnetExemptions
 		config.Compressors = []*encoder.CompressorEntry{
 			{
 				Namespace:      transactionNamespace,
 				DictionaryPath: testnetTransactionDictionary,
 			},
 		}
+	case Regtest:
+		config.Network = &types.NetworkIdentifier{
+			Blockchain: defichain.Blockchain,
+			Network:    defichain.RegtestNetwork,
+		}
+		config.GenesisBlockIdentifier = defichain.RegtestGenesisBlockIdentifier
+		config.Params = defichain.RegtestParams
+		config.Currency = defichain.RegtestCurrency
+		config.ConfigPath = regtestConfigPath
+		config.RPCPort = regtestRPCPort
+
+		// Private networks are short-lived, so we don't
+		// train a compression dictionary for them.
+		config.Compressors = []*encoder.CompressorEntry{}
+		config.Exemptions = []*defichain.Exemption{}
+	case Devnet:
+		genesisHash, err := loadGenesisHash()
+		if err != nil {
+			return nil, err
+		}
+
+		config.Network = &types.NetworkIdentifier{
+			Blockchain: defichain.Blockchain,
+			Network:    defichain.DevnetNetwork,
+		}
+		params := *defichain.DevnetParams
+		params.GenesisHash = genesisHash
+
+		config.GenesisBlockIdentifier = &types.BlockIdentifier{
+			Hash:  genesisHash.String(),
+			Index: 0,
+		}
+		config.Params = &params
+		config.Currency = defichain.DevnetCurrency
+		config.ConfigPath = devnetConfigPath
+		config.RPCPort = devnetRPCPort
+		config.Compressors = []*encoder.CompressorEntry{}
+		config.Exemptions = []*defichain.Exemption{}
 	case "":
 		return nil, errors.New("NETWORK must be populated")
 	default:
@@ -206,9 +278,44 @@ func LoadConfiguration(baseDirectory string) (*Configuration, error) {
 	}
 	config.Port = port
 
+	if exemptionsPath := os.Getenv(ExemptionsPathEnv); len(exemptionsPath) > 0 {
+		exemptions, err := loadExemptions(exemptionsPath)
+		if err != nil {
+			return nil, err
+		}
+
+		config.Exemptions = exemptions
+	}
+
+	policy, err := loadPolicy(config.Params)
+	if err != nil {
+		return nil, err
+	}
+	config.Policy = policy
+
 	return config, nil
 }
 
+// loadGenesisHash parses the genesis block
+// hash of a devnet from GenesisHashEnv.
+func loadGenesisHash() (*chainhash.Hash, error) {
+	genesisHash := os.Getenv(GenesisHashEnv)
+	if len(genesisHash) == 0 {
+		return nil, fmt.Errorf("%s must be populated", GenesisHashEnv)
+	}
+
+	if len(genesisHash) != defichain.TransactionHashLength {
+		return nil, fmt.Errorf("genesis hash %s is not length 64", genesisHash)
+	}
+
+	hash, err := chainhash.NewHashFromStr(genesisHash)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unable to parse genesis hash %s", err, genesisHash)
+	}
+
+	return hash, nil
+}
+
 // ensurePathsExist directories along
 // a path if they do not exist.
 func ensurePathExists(path string) error {
@@ -16,22 +16,64 @@ package configuration
 
 import (
 	"errors"
+	"io/ioutil"
 	"os"
 	"path"
 	"testing"
 
 	"github.com/DeFiCh/rosetta-defichain/defichain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/coinbase/rosetta-sdk-go/storage/encoder"
 	"github.com/coinbase/rosetta-sdk-go/types"
 	"github.com/coinbase/rosetta-sdk-go/utils"
 	"github.com/stretchr/testify/assert"
 )
 
+const (
+	testExemptions = `[
+  {
+    "block_index": 1,
+    "block_hash": "1e7d3a2c5b4f6e8d9c0b1a2f3e4d5c6b7a8f9e0d1c2b3a4f5e6d7c8b9a0f1e2d",
+    "transaction_hash": "0d8d594d3b48f5a79f2ff4cb1e3f3b5c1de1e8a3f0d1d2ad6fbc1b2b1e5d0e7f",
+    "operation_indexes": [1],
+    "sub_account_address": "exempt",
+    "exemption_type": "dynamic",
+    "reason": "test"
+  }
+]`
+
+	testInvalidExemptions = `[
+  {
+    "block_index": 1,
+    "block_hash": "1e7d3a2c5b4f6e8d9c0b1a2f3e4d5c6b7a8f9e0d1c2b3a4f5e6d7c8b9a0f1e2d",
+    "transaction_hash": "0d8d594d3b48f5a79f2ff4cb1e3f3b5c1de1e8a3f0d1d2ad6fbc1b2b1e5d0e7f",
+    "exemption_type": "dynamic"
+  }
+]`
+)
+
+func TestNetworkExemptions(t *testing.T) {
+	assert.NoError(t, validateExemptions(mainnetExemptions))
+	assert.NoError(t, validateExemptions(testnetExemptions))
+
+	for _, exemption := range append(mainnetExemptions, testnetExemptions...) {
+		assert.NotEmpty(t, exemption.Source)
+	}
+}
+
 func TestLoadConfiguration(t *testing.T) {
+	devnetParams := *defichain.DevnetParams
+	devnetParams.GenesisHash, _ = chainhash.NewHashFromStr(
+		"1e7d3a2c5b4f6e8d9c0b1a2f3e4d5c6b7a8f9e0d1c2b3a4f5e6d7c8b9a0f1e2d",
+	)
+
 	tests := map[string]struct {
-		Mode    string
-		Network string
-		Port    string
+		Mode           string
+		Network        string
+		Port           string
+		GenesisHash    string
+		ExemptionsFile string
+		Policy         map[string]string
 
 		cfg *Configuration
 		err error
@@ -75,6 +117,8 @@ func TestLoadConfiguration(t *testing.T) {
 						DictionaryPath: mainnetTransactionDictionary,
 					},
 				},
+				Exemptions: mainnetExemptions,
+				Policy:     &PolicyConfiguration{},
 			},
 		},
 		"all set (testnet)": {
@@ -104,8 +148,204 @@ func TestLoadConfiguration(t *testing.T) {
 						DictionaryPath: testnetTransactionDictionary,
 					},
 				},
+				Exemptions: testnetExemptions,
+				Policy:     &PolicyConfiguration{},
+			},
+		},
+		"all set (regtest)": {
+			Mode:    string(Online),
+			Network: Regtest,
+			Port:    "1000",
+			cfg: &Configuration{
+				Mode: Online,
+				Network: &types.NetworkIdentifier{
+					Network:    defichain.RegtestNetwork,
+					Blockchain: defichain.Blockchain,
+				},
+				Params:                 defichain.RegtestParams,
+				Currency:               defichain.RegtestCurrency,
+				GenesisBlockIdentifier: defichain.RegtestGenesisBlockIdentifier,
+				Port:                   1000,
+				RPCPort:                regtestRPCPort,
+				ConfigPath:             regtestConfigPath,
+				Pruning: &PruningConfiguration{
+					Frequency: pruneFrequency,
+					Depth:     pruneDepth,
+					MinHeight: minPruneHeight,
+				},
+				Compressors: []*encoder.CompressorEntry{},
+				Exemptions:  []*defichain.Exemption{},
+				Policy:      &PolicyConfiguration{},
+			},
+		},
+		"all set (devnet)": {
+			Mode:        string(Online),
+			Network:     Devnet,
+			Port:        "1000",
+			GenesisHash: "1e7d3a2c5b4f6e8d9c0b1a2f3e4d5c6b7a8f9e0d1c2b3a4f5e6d7c8b9a0f1e2d",
+			cfg: &Configuration{
+				Mode: Online,
+				Network: &types.NetworkIdentifier{
+					Network:    defichain.DevnetNetwork,
+					Blockchain: defichain.Blockchain,
+				},
+				Params:   &devnetParams,
+				Currency: defichain.DevnetCurrency,
+				GenesisBlockIdentifier: &types.BlockIdentifier{
+					Hash: "1e7d3a2c5b4f6e8d9c0b1a2f3e4d5c6b7a8f9e0d1c2b3a4f5e6d7c8b9a0f1e2d",
+				},
+				Port:       1000,
+				RPCPort:    devnetRPCPort,
+				ConfigPath: devnetConfigPath,
+				Pruning: &PruningConfiguration{
+					Frequency: pruneFrequency,
+					Depth:     pruneDepth,
+					MinHeight: minPruneHeight,
+				},
+				Compressors: []*encoder.CompressorEntry{},
+				Exemptions:  []*defichain.Exemption{},
+				Policy:      &PolicyConfiguration{},
 			},
 		},
+		"all set (testnet with exemptions file)": {
+			Mode:           string(Online),
+			Network:        Testnet,
+			Port:           "1000",
+			ExemptionsFile: "exemptions.json",
+			cfg: &Configuration{
+				Mode: Online,
+				Network: &types.NetworkIdentifier{
+					Network:    defichain.TestnetNetwork,
+					Blockchain: defichain.Blockchain,
+				},
+				Params:                 defichain.TestnetParams,
+				Currency:               defichain.TestnetCurrency,
+				GenesisBlockIdentifier: defichain.TestnetGenesisBlockIdentifier,
+				Port:                   1000,
+				RPCPort:                testnetRPCPort,
+				ConfigPath:             testnetConfigPath,
+				Pruning: &PruningConfiguration{
+					Frequency: pruneFrequency,
+					Depth:     pruneDepth,
+					MinHeight: minPruneHeight,
+				},
+				Compressors: []*encoder.CompressorEntry{
+					{
+						Namespace:      transactionNamespace,
+						DictionaryPath: testnetTransactionDictionary,
+					},
+				},
+				Exemptions: []*defichain.Exemption{
+					{
+						BlockIndex:        1,
+						BlockHash:         "1e7d3a2c5b4f6e8d9c0b1a2f3e4d5c6b7a8f9e0d1c2b3a4f5e6d7c8b9a0f1e2d",
+						TransactionHash:   "0d8d594d3b48f5a79f2ff4cb1e3f3b5c1de1e8a3f0d1d2ad6fbc1b2b1e5d0e7f",
+						OperationIndexes:  []int64{1},
+						SubAccountAddress: "exempt",
+						ExemptionType:     types.BalanceDynamic,
+						Reason:            "test",
+					},
+				},
+				Policy: &PolicyConfiguration{},
+			},
+		},
+		"all set (testnet with policy)": {
+			Mode:    string(Online),
+			Network: Testnet,
+			Port:    "1000",
+			Policy: map[string]string{
+				PolicyMaxFeeEnv:              "100000",
+				PolicyMaxFeeRateEnv:          "0.001",
+				PolicyDustThresholdEnv:       "546",
+				PolicyMaxOutputsEnv:          "10",
+				PolicyAllowedDestinationsEnv: "tf1qvlmwgj9rsmpqx2c6dl54a36ev4zkd3pw3ufh4c, 7CYm8j6Jphjf6ghZHtsNfroacCgVdPZF3D",
+			},
+			cfg: &Configuration{
+				Mode: Online,
+				Network: &types.NetworkIdentifier{
+					Network:    defichain.TestnetNetwork,
+					Blockchain: defichain.Blockchain,
+				},
+				Params:                 defichain.TestnetParams,
+				Currency:               defichain.TestnetCurrency,
+				GenesisBlockIdentifier: defichain.TestnetGenesisBlockIdentifier,
+				Port:                   1000,
+				RPCPort:                testnetRPCPort,
+				ConfigPath:             testnetConfigPath,
+				Pruning: &PruningConfiguration{
+					Frequency: pruneFrequency,
+					Depth:     pruneDepth,
+					MinHeight: minPruneHeight,
+				},
+				Compressors: []*encoder.CompressorEntry{
+					{
+						Namespace:      transactionNamespace,
+						DictionaryPath: testnetTransactionDictionary,
+					},
+				},
+				Exemptions: testnetExemptions,
+				Policy: &PolicyConfiguration{
+					MaxFee:        100000,
+					MaxFeeRate:    0.001,
+					DustThreshold: 546,
+					MaxOutputs:    10,
+					AllowedDestinations: []string{
+						"tf1qvlmwgj9rsmpqx2c6dl54a36ev4zkd3pw3ufh4c",
+						"7CYm8j6Jphjf6ghZHtsNfroacCgVdPZF3D",
+					},
+				},
+			},
+		},
+		"invalid policy max fee": {
+			Mode:    string(Offline),
+			Network: Testnet,
+			Port:    "1000",
+			Policy:  map[string]string{PolicyMaxFeeEnv: "-1"},
+			err:     errors.New("unable to parse POLICY_MAX_FEE -1"),
+		},
+		"invalid policy max fee rate": {
+			Mode:    string(Offline),
+			Network: Testnet,
+			Port:    "1000",
+			Policy:  map[string]string{PolicyMaxFeeRateEnv: "high"},
+			err:     errors.New("unable to parse POLICY_MAX_FEE_RATE high"),
+		},
+		"policy destination of another network": {
+			Mode:    string(Offline),
+			Network: Mainnet,
+			Port:    "1000",
+			Policy: map[string]string{
+				PolicyAllowedDestinationsEnv: "tf1qvlmwgj9rsmpqx2c6dl54a36ev4zkd3pw3ufh4c",
+			},
+			err: errors.New("tf1qvlmwgj9rsmpqx2c6dl54a36ev4zkd3pw3ufh4c is not a valid destination address"),
+		},
+		"invalid exemptions file": {
+			Mode:           string(Offline),
+			Network:        Testnet,
+			Port:           "1000",
+			ExemptionsFile: "invalid_exemptions.json",
+			err:            errors.New("currency and exemption type require a sub account address: exemption 0 is invalid"),
+		},
+		"missing exemptions file": {
+			Mode:           string(Offline),
+			Network:        Testnet,
+			Port:           "1000",
+			ExemptionsFile: "missing.json",
+			err:            errors.New("unable to read exemptions file"),
+		},
+		"devnet without genesis hash": {
+			Mode:    string(Offline),
+			Network: Devnet,
+			Port:    "1000",
+			err:     errors.New("GENESIS_HASH must be populated"),
+		},
+		"devnet with invalid genesis hash": {
+			Mode:        string(Offline),
+			Network:     Devnet,
+			Port:        "1000",
+			GenesisHash: "bad hash",
+			err:         errors.New("genesis hash bad hash is not length 64"),
+		},
 		"invalid mode": {
 			Mode:    "bad mode",
 			Network: Testnet,
@@ -135,6 +375,34 @@ func TestLoadConfiguration(t *testing.T) {
 			os.Setenv(ModeEnv, test.Mode)
 			os.Setenv(NetworkEnv, test.Network)
 			os.Setenv(PortEnv, test.Port)
+			os.Setenv(GenesisHashEnv, test.GenesisHash)
+
+			exemptionsPath := ""
+			if len(test.ExemptionsFile) > 0 {
+				exemptionsPath = path.Join(newDir, test.ExemptionsFile)
+			}
+			os.Setenv(ExemptionsPathEnv, exemptionsPath)
+
+			for _, env := range []string{
+				PolicyMaxFeeEnv,
+				PolicyMaxFeeRateEnv,
+				PolicyDustThresholdEnv,
+				PolicyMaxOutputsEnv,
+				PolicyAllowedDestinationsEnv,
+			} {
+				os.Setenv(env, test.Policy[env])
+			}
+
+			assert.NoError(t, ioutil.WriteFile(
+				path.Join(newDir, "exemptions.json"),
+				[]byte(testExemptions),
+				os.FileMode(0600),
+			))
+			assert.NoError(t, ioutil.WriteFile(
+				path.Join(newDir, "invalid_exemptions.json"),
+				[]byte(testInvalidExemptions),
+				os.FileMode(0600),
+			))
 
 			cfg, err := LoadConfiguration(newDir)
 			if test.err != nil {
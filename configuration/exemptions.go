@@ -0,0 +1,80 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configuration
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/DeFiCh/rosetta-defichain/defichain"
+)
+
+// Each entry of the exemption tables must link the consensus
+// code or announcement it comes from in Source and be checked
+// against a synced defid before it is added. No DeFiChain
+// transaction has been verified to need an exemption yet, so
+// both tables are empty and an exemption that is needed before
+// one is added here must be provided with EXEMPTIONS_PATH.
+//
+// Genesis allocations are not exempted: unlike Bitcoin, defid
+// adds the outputs of every genesis transaction (including the
+// genesis masternodes) to its UTXO set, so they are spendable.
+// Source: https://github.com/DeFiCh/ain/blob/master/src/validation.cpp (ConnectBlock)
+var (
+	// mainnetExemptions are the historical mainnet transactions
+	// whose operations are skipped.
+	mainnetExemptions = []*defichain.Exemption{}
+
+	// testnetExemptions are the historical testnet transactions
+	// whose operations are skipped.
+	testnetExemptions = []*defichain.Exemption{}
+)
+
+// loadExemptions reads a JSON array of *defichain.Exemption
+// from a file and validates each entry.
+func loadExemptions(filePath string) ([]*defichain.Exemption, error) {
+	content, err := ioutil.ReadFile(filePath) // #nosec G304
+	if err != nil {
+		return nil, fmt.Errorf("%w: unable to read exemptions file %s", err, filePath)
+	}
+
+	exemptions := []*defichain.Exemption{}
+	if err := json.Unmarshal(content, &exemptions); err != nil {
+		return nil, fmt.Errorf("%w: unable to parse exemptions file %s", err, filePath)
+	}
+
+	if err := validateExemptions(exemptions); err != nil {
+		return nil, fmt.Errorf("%w: invalid exemptions file %s", err, filePath)
+	}
+
+	return exemptions, nil
+}
+
+// validateExemptions ensures all exemptions are
+// well-formed.
+func validateExemptions(exemptions []*defichain.Exemption) error {
+	for i, exemption := range exemptions {
+		if exemption == nil {
+			return fmt.Errorf("exemption %d is nil", i)
+		}
+
+		if err := exemption.Validate(); err != nil {
+			return fmt.Errorf("%w: exemption %d is invalid", err, i)
+		}
+	}
+
+	return nil
+}
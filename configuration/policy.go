@@ -0,0 +1,131 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configuration
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// PolicyMaxFeeEnv is the environment variable
+	// read to determine the max fee (in satoshis)
+	// of a constructed transaction (optional).
+	PolicyMaxFeeEnv = "POLICY_MAX_FEE"
+
+	// PolicyMaxFeeRateEnv is the environment variable
+	// read to determine the max fee rate (in DFI per kB)
+	// of a constructed transaction (optional).
+	PolicyMaxFeeRateEnv = "POLICY_MAX_FEE_RATE"
+
+	// PolicyDustThresholdEnv is the environment variable
+	// read to determine the smallest output (in satoshis)
+	// of a constructed transaction (optional).
+	PolicyDustThresholdEnv = "POLICY_DUST_THRESHOLD"
+
+	// PolicyMaxOutputsEnv is the environment variable
+	// read to determine the max number of outputs of a
+	// constructed transaction (optional).
+	PolicyMaxOutputsEnv = "POLICY_MAX_OUTPUTS"
+
+	// PolicyAllowedDestinationsEnv is the environment
+	// variable read to determine the comma-separated
+	// addresses a constructed transaction may pay
+	// to (optional).
+	PolicyAllowedDestinationsEnv = "POLICY_ALLOWED_DESTINATIONS"
+)
+
+// PolicyConfiguration is the safety policy enforced by
+// the construction service when a transaction is built
+// and again before it is broadcast. A zero value (or
+// an empty allow-list) disables a check.
+type PolicyConfiguration struct {
+	MaxFee        int64
+	MaxFeeRate    float64
+	DustThreshold int64
+	MaxOutputs    int
+
+	// AllowedDestinations are the addresses a transaction
+	// may pay to. Outputs paying back to a script spent
+	// by the transaction (ex: change) are always allowed.
+	AllowedDestinations []string
+}
+
+// loadPolicy parses the safety policy from the
+// Policy*Env environment variables.
+func loadPolicy(params *chaincfg.Params) (*PolicyConfiguration, error) {
+	policy := &PolicyConfiguration{}
+
+	var err error
+	if policy.MaxFee, err = parsePolicyInt(PolicyMaxFeeEnv); err != nil {
+		return nil, err
+	}
+
+	if policy.DustThreshold, err = parsePolicyInt(PolicyDustThresholdEnv); err != nil {
+		return nil, err
+	}
+
+	maxOutputs, err := parsePolicyInt(PolicyMaxOutputsEnv)
+	if err != nil {
+		return nil, err
+	}
+	policy.MaxOutputs = int(maxOutputs)
+
+	if value := os.Getenv(PolicyMaxFeeRateEnv); len(value) > 0 {
+		policy.MaxFeeRate, err = strconv.ParseFloat(value, 64)
+		if err != nil || policy.MaxFeeRate < 0 {
+			return nil, fmt.Errorf("%w: unable to parse %s %s", err, PolicyMaxFeeRateEnv, value)
+		}
+	}
+
+	if value := os.Getenv(PolicyAllowedDestinationsEnv); len(value) > 0 {
+		for _, address := range strings.Split(value, ",") {
+			address = strings.TrimSpace(address)
+			addr, err := btcutil.DecodeAddress(address, params)
+			if err != nil || !addr.IsForNet(params) {
+				return nil, fmt.Errorf(
+					"%w: %s is not a valid destination address",
+					err,
+					address,
+				)
+			}
+
+			policy.AllowedDestinations = append(policy.AllowedDestinations, address)
+		}
+	}
+
+	return policy, nil
+}
+
+// parsePolicyInt parses a non-negative integer from an
+// environment variable (0 if it is not populated).
+func parsePolicyInt(env string) (int64, error) {
+	value := os.Getenv(env)
+	if len(value) == 0 {
+		return 0, nil
+	}
+
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || parsed < 0 {
+		return 0, fmt.Errorf("%w: unable to parse %s %s", err, env, value)
+	}
+
+	return parsed, nil
+}
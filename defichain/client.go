@@ -17,18 +17,23 @@ package defichain
 import (
 	"bytes"
 	"context"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"net"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	defichainUtils "github.com/DeFiCh/rosetta-defichain/utils"
 
-	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
 	"github.com/coinbase/rosetta-sdk-go/types"
 	"github.com/coinbase/rosetta-sdk-go/utils"
 )
@@ -74,6 +79,9 @@ const (
 	// https://developer.bitcoin.org/reference/rpc/sendrawtransaction.html
 	requestMethodSendRawTransaction requestMethod = "sendrawtransaction"
 
+	// https://developer.bitcoin.org/reference/rpc/testmempoolaccept.html
+	requestMethodTestMempoolAccept requestMethod = "testmempoolaccept"
+
 	// https://developer.bitcoin.org/reference/rpc/getrawtransaction.html
 	requestMethodGetRawTransaction requestMethod = "getrawtransaction"
 
@@ -83,9 +91,21 @@ const (
 	// https://developer.bitcoin.org/reference/rpc/estimatesmartfee.html
 	requestMethodEstimateSmartFee requestMethod = "estimatesmartfee"
 
+	// https://developer.bitcoin.org/reference/rpc/getmempoolinfo.html
+	requestMethodGetMempoolInfo requestMethod = "getmempoolinfo"
+
 	// https://developer.bitcoin.org/reference/rpc/getrawmempool.html
 	requestMethodRawMempool requestMethod = "getrawmempool"
 
+	// https://developer.bitcoin.org/reference/rpc/getmempoolentry.html
+	requestMethodGetMempoolEntry requestMethod = "getmempoolentry"
+
+	// https://docs.defichain.com/rpc#listtokens
+	requestMethodListTokens requestMethod = "listtokens"
+
+	// https://docs.defichain.com/rpc#listaccounthistory
+	requestMethodListAccountHistory requestMethod = "listaccounthistory"
+
 	// blockNotFoundErrCode is the RPC error code when a block cannot be found
 	blockNotFoundErrCode = -5
 )
@@ -104,6 +124,19 @@ const (
 	// changing our peers).
 	rpcUsername = "rosetta"
 	rpcPassword = "rosetta"
+
+	// listTokensLimit is the page size used when
+	// paginating over `listtokens`.
+	listTokensLimit = 1000
+
+	// accountHistoryLimit is the maximum number of
+	// `listaccounthistory` entries of a block. defid
+	// defaults to 100, which a busy block can exceed.
+	accountHistoryLimit = math.MaxInt32
+
+	// nativeTokenSymbol is the symbol defid uses for
+	// NativeTokenID in account amounts on every network.
+	nativeTokenSymbol = "DFI"
 )
 
 var (
@@ -113,6 +146,22 @@ var (
 
 	// ErrJSONRPCError is returned when receiving an error from a JSON-RPC response
 	ErrJSONRPCError = errors.New("JSON-RPC error")
+
+	// ErrNoFeeEstimate is returned when defid doesn't
+	// have enough data to estimate a fee rate
+	ErrNoFeeEstimate = errors.New("no fee estimate available")
+
+	// ErrUnknownAccountHistory is returned when the account
+	// history of a block has an entry that is neither a
+	// reward nor caused by a transaction of the block
+	ErrUnknownAccountHistory = errors.New("unknown account history entry")
+
+	// rewardHistoryTypes are the types of account history
+	// entries that aren't caused by a transaction.
+	rewardHistoryTypes = map[string]struct{}{
+		"Rewards":    {},
+		"Commission": {},
+	}
 )
 
 // Client is used to fetch blocks from defid and
@@ -126,6 +175,9 @@ type Client struct {
 
 	genesisBlockIdentifier *types.BlockIdentifier
 	currency               *types.Currency
+	params                 *chaincfg.Params
+	tokens                 *TokenRegistry
+	exemptions             map[string][]*Exemption
 
 	httpClient *http.Client
 }
@@ -141,11 +193,24 @@ func NewClient(
 	baseURL string,
 	genesisBlockIdentifier *types.BlockIdentifier,
 	currency *types.Currency,
+	params *chaincfg.Params,
+	exemptions []*Exemption,
 ) *Client {
+	exemptionsByTransaction := map[string][]*Exemption{}
+	for _, exemption := range exemptions {
+		exemptionsByTransaction[exemption.TransactionHash] = append(
+			exemptionsByTransaction[exemption.TransactionHash],
+			exemption,
+		)
+	}
+
 	return &Client{
 		baseURL:                baseURL,
 		genesisBlockIdentifier: genesisBlockIdentifier,
 		currency:               currency,
+		params:                 params,
+		tokens:                 NewTokenRegistry(currency),
+		exemptions:             exemptionsByTransaction,
 		httpClient:             newHTTPClient(defaultTimeout),
 	}
 }
@@ -267,6 +332,72 @@ func (b *Client) ParseBlock(
 	return rblock, nil
 }
 
+// ParseTransaction returns a parsed DeFiChain transaction that
+// isn't in a block yet (ex: from the mempool) given a map of the
+// coins spent by its inputs. Its operations are shaped like the
+// ones returned by ParseBlock.
+func (b *Client) ParseTransaction(
+	ctx context.Context,
+	tx *Transaction,
+	coins map[string]*types.AccountCoin,
+) (*types.Transaction, error) {
+	// Transactions in the mempool are never
+	// the coinbase transaction of a block.
+	txOps, err := b.parseTxOperations(ctx, tx, 1, coins)
+	if err != nil {
+		return nil, fmt.Errorf("%w: error parsing transaction operations", err)
+	}
+
+	accountOps, err := b.parsePendingAccountOperations(ctx, tx, int64(len(txOps)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: error parsing account operations", err)
+	}
+	txOps = append(txOps, accountOps...)
+
+	logCustomTxError(ctx, tx)
+	metadata, err := tx.Metadata()
+	if err != nil {
+		return nil, fmt.Errorf("%w: unable to get metadata for transaction", err)
+	}
+
+	return &types.Transaction{
+		TransactionIdentifier: &types.TransactionIdentifier{
+			Hash: tx.Hash,
+		},
+		Operations: txOps,
+		Metadata:   metadata,
+	}, nil
+}
+
+// ParseOutputs returns the OUTPUT operations of a raw
+// DeFiChain transaction that isn't in a block yet (ex:
+// from the mempool). The operations are shaped like the
+// ones returned by ParseBlock, but their indexes start
+// at 0.
+func (b *Client) ParseOutputs(tx *Transaction) ([]*types.Operation, error) {
+	ops := make([]*types.Operation, len(tx.Outputs))
+	for networkIndex, output := range tx.Outputs {
+		op, err := b.parseOutputTransactionOperation(
+			output,
+			tx.Hash,
+			int64(networkIndex),
+			int64(networkIndex),
+		)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"%w: error parsing tx output, hash: %s, index: %d",
+				err,
+				tx.Hash,
+				networkIndex,
+			)
+		}
+
+		ops[networkIndex] = op
+	}
+
+	return ops, nil
+}
+
 // SendRawTransaction submits a serialized transaction
 // to defid.
 func (b *Client) SendRawTransaction(
@@ -286,6 +417,30 @@ func (b *Client) SendRawTransaction(
 	return response.Result, nil
 }
 
+// TestMempoolAccept returns whether a serialized transaction
+// would be accepted by the mempool of defid without
+// broadcasting it.
+func (b *Client) TestMempoolAccept(
+	ctx context.Context,
+	serializedTx string,
+) (*MempoolAcceptResult, error) {
+	// Parameters:
+	//   1. rawtxs
+	//   2. maxfeerate (0 means accept any fee)
+	params := []interface{}{[]string{serializedTx}, 0}
+
+	response := &testMempoolAcceptResponse{}
+	if err := b.post(ctx, requestMethodTestMempoolAccept, params, response); err != nil {
+		return nil, fmt.Errorf("%w: error testing mempool accept", err)
+	}
+
+	if len(response.Result) != 1 {
+		return nil, fmt.Errorf("expected 1 result but got %d", len(response.Result))
+	}
+
+	return response.Result[0], nil
+}
+
 // GetRawTransaction returns the raw transaction data
 func (b *Client) GetRawTransaction(
 	ctx context.Context,
@@ -335,23 +490,57 @@ func (b *Client) GetTransaction(
 }
 
 // SuggestedFeeRate estimates the approximate fee per vKB needed
-// to get a transaction in a block within conf_target.
+// to get a transaction in a block within conf_target. If
+// estimateMode is empty, defid's default mode is used.
+// ErrNoFeeEstimate is returned if defid has no estimate.
 func (b *Client) SuggestedFeeRate(
 	ctx context.Context,
 	confTarget int64,
+	estimateMode EstimateMode,
 ) (float64, error) {
 	// Parameters:
 	//   1. conf_target (confirmation target in blocks)
+	//   2. estimate_mode (optional)
 	params := []interface{}{confTarget}
+	if len(estimateMode) > 0 {
+		params = append(params, strings.ToUpper(string(estimateMode)))
+	}
 
 	response := &suggestedFeeRateResponse{}
 	if err := b.post(ctx, requestMethodEstimateSmartFee, params, response); err != nil {
 		return -1, fmt.Errorf("%w: error getting fee estimate", err)
 	}
 
+	if response.Result == nil || response.Result.FeeRate <= 0 {
+		var reasons []string
+		if response.Result != nil {
+			reasons = response.Result.Errors
+		}
+
+		return -1, fmt.Errorf("%w: %s", ErrNoFeeEstimate, strings.Join(reasons, ", "))
+	}
+
 	return response.Result.FeeRate, nil
 }
 
+// MempoolFeeRate returns the minimum fee per vKB for a
+// transaction to be accepted in the mempool of defid.
+func (b *Client) MempoolFeeRate(
+	ctx context.Context,
+) (float64, error) {
+	params := []interface{}{}
+	response := &mempoolInfoResponse{}
+	if err := b.post(ctx, requestMethodGetMempoolInfo, params, response); err != nil {
+		return -1, fmt.Errorf("%w: error getting mempool info", err)
+	}
+
+	if response.Result == nil {
+		return -1, errors.New("mempool info is missing")
+	}
+
+	return math.Max(response.Result.MempoolMinFee, response.Result.MinRelayTxFee), nil
+}
+
 // PruneBlockchain prunes up to the provided height.
 // https://bitcoincore.org/en/doc/0.20.0/rpc/blockchain/pruneblockchain
 func (b *Client) PruneBlockchain(
@@ -388,6 +577,175 @@ func (b *Client) RawMempool(
 	return response.Result, nil
 }
 
+// VerboseRawMempool returns the *MempoolEntry of each
+// transaction currently in the mempool, keyed by hash.
+func (b *Client) VerboseRawMempool(
+	ctx context.Context,
+) (map[string]*MempoolEntry, error) {
+	// Parameters:
+	//   1. verbose
+	params := []interface{}{true}
+
+	response := &verboseRawMempoolResponse{}
+	if err := b.post(ctx, requestMethodRawMempool, params, response); err != nil {
+		return nil, fmt.Errorf("%w: error getting verbose raw mempool", err)
+	}
+
+	return response.Result, nil
+}
+
+// MempoolEntry returns the *MempoolEntry of a
+// transaction in the mempool.
+func (b *Client) MempoolEntry(
+	ctx context.Context,
+	txid string,
+) (*MempoolEntry, error) {
+	// Parameters:
+	//   1. txid
+	params := []interface{}{txid}
+
+	response := &mempoolEntryResponse{}
+	if err := b.post(ctx, requestMethodGetMempoolEntry, params, response); err != nil {
+		return nil, fmt.Errorf("%w: error getting mempool entry %s", err, txid)
+	}
+
+	return response.Result, nil
+}
+
+// AccountHistory returns all changes of account
+// balances in the block at height. defid must run
+// with -acindex.
+func (b *Client) AccountHistory(
+	ctx context.Context,
+	height int64,
+) ([]*AccountHistory, error) {
+	// Parameters:
+	//   1. owner ("all" lists every account)
+	//   2. options (maxBlockHeight, depth, no_rewards, limit)
+	params := []interface{}{
+		"all",
+		map[string]interface{}{
+			"maxBlockHeight": height,
+			"depth":          0,
+			"no_rewards":     false,
+			"limit":          accountHistoryLimit,
+		},
+	}
+
+	response := &accountHistoryResponse{}
+	if err := b.post(ctx, requestMethodListAccountHistory, params, response); err != nil {
+		return nil, fmt.Errorf("%w: error listing account history of block %d", err, height)
+	}
+
+	return response.Result, nil
+}
+
+// ListTokens returns all tokens known by defid
+// keyed by token id.
+func (b *Client) ListTokens(
+	ctx context.Context,
+) (map[uint32]*Token, error) {
+	tokens := map[uint32]*Token{}
+	start := uint32(0)
+	includingStart := true
+	for {
+		// Parameters:
+		//   1. pagination (start, including_start, limit)
+		//   2. verbose
+		params := []interface{}{
+			map[string]interface{}{
+				"start":           start,
+				"including_start": includingStart,
+				"limit":           listTokensLimit,
+			},
+			true,
+		}
+
+		response := &listTokensResponse{}
+		if err := b.post(ctx, requestMethodListTokens, params, response); err != nil {
+			return nil, fmt.Errorf("%w: error listing tokens", err)
+		}
+
+		for rawTokenID, token := range response.Result {
+			tokenID, err := strconv.ParseUint(rawTokenID, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("%w: unable to parse token id %s", err, rawTokenID)
+			}
+
+			tokens[uint32(tokenID)] = token
+			if uint32(tokenID) > start {
+				start = uint32(tokenID)
+			}
+		}
+
+		if len(response.Result) < listTokensLimit {
+			return tokens, nil
+		}
+
+		includingStart = false
+	}
+}
+
+// TokenCurrency returns the *types.Currency for a token id.
+// If the token id is not registered yet, the registry is
+// refreshed with `listtokens`.
+func (b *Client) TokenCurrency(
+	ctx context.Context,
+	tokenID uint32,
+) (*types.Currency, error) {
+	if currency, ok := b.tokens.Currency(tokenID); ok {
+		return currency, nil
+	}
+
+	tokens, err := b.ListTokens(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unable to refresh tokens", err)
+	}
+
+	for id, token := range tokens {
+		b.tokens.Register(id, token)
+	}
+
+	currency, ok := b.tokens.Currency(tokenID)
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownToken, tokenID)
+	}
+
+	return currency, nil
+}
+
+// SymbolTokenID returns the token id of a symbol used
+// in account amounts. If the symbol is not registered
+// yet, the registry is refreshed with `listtokens`.
+func (b *Client) SymbolTokenID(
+	ctx context.Context,
+	symbol string,
+) (uint32, error) {
+	if symbol == nativeTokenSymbol {
+		return NativeTokenID, nil
+	}
+
+	if tokenID, ok := b.tokens.SymbolTokenID(symbol); ok {
+		return tokenID, nil
+	}
+
+	tokens, err := b.ListTokens(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%w: unable to refresh tokens", err)
+	}
+
+	for id, token := range tokens {
+		b.tokens.Register(id, token)
+	}
+
+	tokenID, ok := b.tokens.SymbolTokenID(symbol)
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownToken, symbol)
+	}
+
+	return tokenID, nil
+}
+
 // getPeerInfo performs the `getpeerinfo` JSON-RPC request
 func (b *Client) getPeerInfo(
 	ctx context.Context,
@@ -522,23 +880,49 @@ func (b *Client) getHashFromIndex(
 	return response.Result, nil
 }
 
-// skipTransactionOperations is used to skip operations on transactions that
-// contain duplicate UTXOs (which are no longer possible after BIP-30). This
-// function mirrors the behavior of a similar commit in bitcoin-core.
-//
-// Source: https://github.com/bitcoin/bitcoin/commit/ab91bf39b7c11e9c86bb2043c24f0f377f1cf514
-func skipTransactionOperations(blockNumber int64, blockHash string, transactionHash string) bool {
-	if blockNumber == 91842 && blockHash == "00000000000a4d0a398161ffc163c503763b1f4360639393e0e4c8e300e0caec" &&
-		transactionHash == "d5d27987d2a3dfc724e359870c6644b40e497bdc0589a033220fe15429d88599" {
-		return true
+// skipTransactionOperations marks the operations of a transaction
+// that are covered by an *Exemption as SkippedStatus.
+func (b *Client) skipTransactionOperations(
+	ctx context.Context,
+	block *Block,
+	transactionHash string,
+	ops []*types.Operation,
+) {
+	logger := defichainUtils.ExtractLogger(ctx, "client")
+
+	for _, exemption := range b.exemptions[transactionHash] {
+		for _, op := range ops {
+			if !exemption.Applies(block.Height, block.Hash, transactionHash, op) {
+				continue
+			}
+
+			logger.Warnw(
+				"skipping operation",
+				"block index", block.Height,
+				"block hash", block.Hash,
+				"transaction hash", transactionHash,
+				"operation index", op.OperationIdentifier.Index,
+				"reason", exemption.Reason,
+			)
+			op.Status = types.String(SkippedStatus)
+		}
 	}
+}
 
-	if blockNumber == 91880 && blockHash == "00000000000743f190a18c5577a3c2d2a1f610ae9601ac046a38084ccb7cd721" &&
-		transactionHash == "e3bf3d07d4b0375638d5f1db5255fe07ba2c4cb067cd81b84ee974b6585fb468" {
-		return true
+// logCustomTxError logs a custom transaction that can't be
+// decoded. defid already accepted it, so it never fails
+// parsing: its metadata has custom_tx_error instead.
+func logCustomTxError(ctx context.Context, tx *Transaction) {
+	_, err := tx.CustomTx()
+	if err == nil || errors.Is(err, ErrNotCustomTx) {
+		return
 	}
 
-	return false
+	defichainUtils.ExtractLogger(ctx, "client").Warnw(
+		"unable to decode custom transaction",
+		"transaction hash", tx.Hash,
+		"error", err,
+	)
 }
 
 // parseTransactions returns the transactions for a specified `Block`
@@ -547,31 +931,45 @@ func (b *Client) parseTransactions(
 	block *Block,
 	coins map[string]*types.AccountCoin,
 ) ([]*types.Transaction, error) {
-	logger := defichainUtils.ExtractLogger(ctx, "client")
-
 	if block == nil {
 		return nil, errors.New("error parsing nil block")
 	}
 
+	history, err := b.blockAccountHistory(ctx, block)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unable to get account history", err)
+	}
+
+	txHistory, err := groupAccountHistory(block, history)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unable to group account history", err)
+	}
+
 	txs := make([]*types.Transaction, len(block.Txs))
 
 	for index, transaction := range block.Txs {
-		txOps, err := b.parseTxOperations(transaction, index, coins)
+		txOps, err := b.parseTxOperations(ctx, transaction, index, coins)
 		if err != nil {
 			return nil, fmt.Errorf("%w: error parsing transaction operations", err)
 		}
 
-		if skipTransactionOperations(block.Height, block.Hash, transaction.Hash) {
-			logger.Warnw(
-				"skipping transaction",
-				"block index", block.Height,
-				"block hash", block.Hash,
-				"transaction hash", transaction.Hash,
+		accountOps, err := b.parseAccountOperations(
+			ctx,
+			transaction,
+			txHistory[transaction.Hash],
+			int64(len(txOps)),
+		)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"%w: error parsing account operations, hash: %s",
+				err,
+				transaction.Hash,
 			)
-			for _, op := range txOps {
-				op.Status = types.String(SkippedStatus)
-			}
 		}
+		txOps = append(txOps, accountOps...)
+
+		b.skipTransactionOperations(ctx, block, transaction.Hash, txOps)
+		logCustomTxError(ctx, transaction)
 
 		metadata, err := transaction.Metadata()
 		if err != nil {
@@ -615,6 +1013,7 @@ func (b *Client) parseTransactions(
 // parseTransactions returns the transaction operations for a specified transaction.
 // It uses a map of previous transactions to properly hydrate the input operations.
 func (b *Client) parseTxOperations(
+	ctx context.Context,
 	tx *Transaction,
 	txIndex int,
 	coins map[string]*types.AccountCoin,
@@ -679,6 +1078,471 @@ func (b *Client) parseTxOperations(
 	return txOps, nil
 }
 
+// blockAccountHistory returns the account history of a
+// block. Listing the account history is expensive, so it is
+// only listed for blocks with a custom transaction (account
+// balances only change in those blocks).
+//
+// The account history is listed by height, so the block hash
+// at that height is checked again afterwards to make sure the
+// history doesn't belong to a block of another branch.
+func (b *Client) blockAccountHistory(
+	ctx context.Context,
+	block *Block,
+) ([]*AccountHistory, error) {
+	if !hasCustomTx(block) {
+		return []*AccountHistory{}, nil
+	}
+
+	history, err := b.AccountHistory(ctx, block.Height)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := b.getHashFromIndex(ctx, block.Height)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unable to check block hash", err)
+	}
+
+	if hash != block.Hash {
+		return nil, fmt.Errorf(
+			"block %d changed from %s to %s while listing account history",
+			block.Height,
+			block.Hash,
+			hash,
+		)
+	}
+
+	return history, nil
+}
+
+// hasCustomTx returns a boolean indicating if any
+// transaction of a block is a custom transaction
+// (including custom transactions that can't be decoded).
+func hasCustomTx(block *Block) bool {
+	for _, tx := range block.Txs {
+		if _, err := tx.CustomTx(); !errors.Is(err, ErrNotCustomTx) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// groupAccountHistory groups the account history of a block
+// by transaction hash. Rewards (ex: liquidity pool rewards)
+// aren't caused by one of the transactions of the block and
+// are grouped under the coinbase transaction. Any other entry
+// of a transaction that isn't in the block is an error. Groups
+// are sorted by owner so operations are deterministic.
+func groupAccountHistory(
+	block *Block,
+	history []*AccountHistory,
+) (map[string][]*AccountHistory, error) {
+	grouped := map[string][]*AccountHistory{}
+	if len(block.Txs) == 0 {
+		return grouped, nil
+	}
+
+	hashes := map[string]struct{}{}
+	for _, tx := range block.Txs {
+		hashes[tx.Hash] = struct{}{}
+	}
+
+	coinbaseHash := block.Txs[0].Hash
+	for _, entry := range history {
+		hash := entry.TxID
+		if _, ok := hashes[hash]; !ok {
+			if _, ok := rewardHistoryTypes[entry.Type]; !ok {
+				return nil, fmt.Errorf(
+					"%w: %s entry of %s with transaction %q",
+					ErrUnknownAccountHistory,
+					entry.Type,
+					entry.Owner,
+					entry.TxID,
+				)
+			}
+
+			hash = coinbaseHash
+		}
+
+		grouped[hash] = append(grouped[hash], entry)
+	}
+
+	for _, entries := range grouped {
+		sort.SliceStable(entries, func(i, j int) bool {
+			if entries[i].TxN != entries[j].TxN {
+				return entries[i].TxN < entries[j].TxN
+			}
+
+			return entries[i].Owner < entries[j].Owner
+		})
+	}
+
+	return grouped, nil
+}
+
+// parseAccountOperations returns the operations that move
+// funds into, out of and between account balances in a
+// transaction of a block. Account balances are tracked under
+// the AccountBalancesSubAccount of the owner's address, so
+// they are reconciled separately from the UTXOs of the same
+// address.
+//
+// The effects of most custom transactions (ex: PoolSwap)
+// depend on the state of the chain, so the operations are
+// derived from the account history of defid rather than from
+// the DfTx payload. A custom transaction that moves balances
+// but has no account history was rejected by defid: its
+// payload operations are returned with FailureStatus.
+func (b *Client) parseAccountOperations(
+	ctx context.Context,
+	tx *Transaction,
+	history []*AccountHistory,
+	startIndex int64,
+) ([]*types.Operation, error) {
+	customTx, err := tx.CustomTx()
+	if err != nil {
+		// Transactions that can't be decoded still get
+		// the account history recorded by defid.
+		customTx = nil
+	}
+
+	if len(history) == 0 {
+		if customTx == nil || !movesBalances(customTx.Type) {
+			return []*types.Operation{}, nil
+		}
+
+		// The payload of a rejected custom transaction may
+		// reference tokens or scripts defid doesn't know, in
+		// which case its failure can't be represented.
+		ops, _, err := b.parseCustomTxOperations(ctx, customTx, startIndex, FailureStatus)
+		if err != nil {
+			return []*types.Operation{}, nil
+		}
+
+		return ops, nil
+	}
+
+	ops := &accountOperations{
+		client: b,
+		index:  startIndex,
+		status: SuccessStatus,
+		ops:    []*types.Operation{},
+	}
+	for _, entry := range history {
+		opType := AccountRewardOpType
+		if entry.TxID == tx.Hash {
+			opType = accountOpType(customTx)
+		}
+
+		ops.history(ctx, opType, entry)
+	}
+
+	if ops.err != nil {
+		return nil, fmt.Errorf("%w: unable to parse account history", ops.err)
+	}
+
+	return ops.ops, nil
+}
+
+// parsePendingAccountOperations returns the account balance
+// operations of a transaction that isn't in a block yet. As
+// there is no account history yet, operations are only returned
+// for custom transactions whose effects are fully determined by
+// their payload (so that no partial operations are published).
+func (b *Client) parsePendingAccountOperations(
+	ctx context.Context,
+	tx *Transaction,
+	startIndex int64,
+) ([]*types.Operation, error) {
+	customTx, err := tx.CustomTx()
+	if err != nil {
+		return []*types.Operation{}, nil
+	}
+
+	ops, complete, err := b.parseCustomTxOperations(ctx, customTx, startIndex, SuccessStatus)
+	if err != nil {
+		return nil, err
+	}
+
+	if !complete {
+		return []*types.Operation{}, nil
+	}
+
+	return ops, nil
+}
+
+// movesBalances returns a boolean indicating if a custom
+// transaction type changes account balances when it is
+// accepted by defid.
+func movesBalances(customTxType CustomTxType) bool {
+	switch customTxType {
+	case CustomTxMintToken,
+		CustomTxPoolSwap,
+		CustomTxAddPoolLiquidity,
+		CustomTxRemovePoolLiquidity,
+		CustomTxUtxosToAccount,
+		CustomTxAccountToUtxos,
+		CustomTxAccountToAccount,
+		CustomTxAnyAccountsToAccounts:
+		return true
+	default:
+		return false
+	}
+}
+
+// accountOpType returns the operation type of the
+// account balance changes of a custom transaction.
+func accountOpType(customTx *CustomTx) string {
+	if customTx == nil {
+		return AccountChangeOpType
+	}
+
+	switch customTx.Type {
+	case CustomTxUtxosToAccount:
+		return UtxosToAccountOpType
+	case CustomTxAccountToUtxos:
+		return AccountToUtxosOpType
+	case CustomTxAccountToAccount, CustomTxAnyAccountsToAccounts:
+		return AccountTransferOpType
+	case CustomTxMintToken:
+		return MintTokenOpType
+	case CustomTxPoolSwap:
+		return PoolSwapOpType
+	case CustomTxAddPoolLiquidity:
+		return AddPoolLiquidityOpType
+	case CustomTxRemovePoolLiquidity:
+		return RemovePoolLiquidityOpType
+	default:
+		return AccountChangeOpType
+	}
+}
+
+// parseCustomTxOperations returns the account balance
+// operations requested by the payload of a custom
+// transaction and a boolean indicating if they are its
+// complete effects. The effects of MintToken, PoolSwap,
+// AddPoolLiquidity and RemovePoolLiquidity depend on the
+// state of the chain, so only the debits they request are
+// returned.
+func (b *Client) parseCustomTxOperations(
+	ctx context.Context,
+	customTx *CustomTx,
+	startIndex int64,
+	status string,
+) ([]*types.Operation, bool, error) {
+	ops := &accountOperations{
+		client: b,
+		index:  startIndex,
+		status: status,
+		ops:    []*types.Operation{},
+	}
+	complete := true
+	switch message := customTx.Message.(type) {
+	case *UtxosToAccountMessage:
+		// The DFI credited to account balances is burned into
+		// the OP_RETURN output of the transaction.
+		ops.credit(ctx, UtxosToAccountOpType, message.To)
+	case *AccountToUtxosMessage:
+		// The UTXOs minted from account balances are already
+		// represented by the OUTPUT operations of the transaction.
+		ops.debit(ctx, AccountToUtxosOpType, message.From, message.Balances)
+	case *AccountToAccountMessage:
+		ops.debit(ctx, AccountTransferOpType, message.From, SumBalances(message.To))
+		ops.credit(ctx, AccountTransferOpType, message.To)
+	case *AnyAccountsToAccountsMessage:
+		for _, from := range message.From {
+			ops.debit(ctx, AccountTransferOpType, from.Script, from.Balances)
+		}
+		ops.credit(ctx, AccountTransferOpType, message.To)
+	case *PoolSwapMessage:
+		ops.debit(ctx, PoolSwapOpType, message.From, []*TokenAmount{
+			{TokenID: message.TokenFrom, Amount: message.AmountFrom},
+		})
+		complete = false
+	case *AddPoolLiquidityMessage:
+		for _, from := range message.From {
+			ops.debit(ctx, AddPoolLiquidityOpType, from.Script, from.Balances)
+		}
+		complete = false
+	case *RemovePoolLiquidityMessage:
+		ops.debit(ctx, RemovePoolLiquidityOpType, message.From, []*TokenAmount{message.Amount})
+		complete = false
+	default:
+		complete = !movesBalances(customTx.Type)
+	}
+
+	if ops.err != nil {
+		return nil, false, fmt.Errorf("%w: unable to parse %s operations", ops.err, customTx.Type)
+	}
+
+	return ops.ops, complete, nil
+}
+
+// accountOperations accumulates account balance operations.
+// The first error encountered is kept in err and all later
+// calls are ignored.
+type accountOperations struct {
+	client *Client
+	index  int64
+	status string
+	ops    []*types.Operation
+	err    error
+}
+
+// credit adds an operation crediting each balance
+// of each *ScriptBalances.
+func (a *accountOperations) credit(
+	ctx context.Context,
+	opType string,
+	accounts []*ScriptBalances,
+) {
+	for _, account := range accounts {
+		for _, balance := range account.Balances {
+			a.add(ctx, opType, account.Script, balance.TokenID, balance.Amount)
+		}
+	}
+}
+
+// debit adds an operation debiting each balance
+// from the account of script.
+func (a *accountOperations) debit(
+	ctx context.Context,
+	opType string,
+	script string,
+	balances []*TokenAmount,
+) {
+	for _, balance := range balances {
+		a.add(ctx, opType, script, balance.TokenID, -balance.Amount)
+	}
+}
+
+// history adds an operation for each amount of an
+// account history entry.
+func (a *accountOperations) history(
+	ctx context.Context,
+	opType string,
+	entry *AccountHistory,
+) {
+	for _, rawAmount := range entry.Amounts {
+		if a.err != nil {
+			return
+		}
+
+		parts := strings.Split(rawAmount, "@")
+		if len(parts) != 2 { // nolint:gomnd
+			a.err = fmt.Errorf("account amount %s is invalid", rawAmount)
+			return
+		}
+
+		amount, err := ParseAmount(json.Number(parts[0]))
+		if err != nil {
+			a.err = err
+			return
+		}
+
+		if amount == 0 {
+			continue
+		}
+
+		tokenID, err := a.client.SymbolTokenID(ctx, parts[1])
+		if err != nil {
+			a.err = err
+			return
+		}
+
+		a.addAccount(
+			ctx,
+			opType,
+			&types.AccountIdentifier{Address: entry.Owner},
+			tokenID,
+			amount,
+		)
+	}
+}
+
+// add appends an account balance operation for
+// amount of tokenID owned by script.
+func (a *accountOperations) add(
+	ctx context.Context,
+	opType string,
+	script string,
+	tokenID uint32,
+	amount int64,
+) {
+	if a.err != nil {
+		return
+	}
+
+	account, err := a.client.parseScriptAccount(script)
+	if err != nil {
+		a.err = err
+		return
+	}
+
+	a.addAccount(ctx, opType, account, tokenID, amount)
+}
+
+// addAccount appends an account balance operation for
+// amount of tokenID owned by account.
+func (a *accountOperations) addAccount(
+	ctx context.Context,
+	opType string,
+	account *types.AccountIdentifier,
+	tokenID uint32,
+	amount int64,
+) {
+	if a.err != nil {
+		return
+	}
+
+	currency, err := a.client.TokenCurrency(ctx, tokenID)
+	if err != nil {
+		a.err = err
+		return
+	}
+
+	account.SubAccount = &types.SubAccountIdentifier{
+		Address: AccountBalancesSubAccount,
+	}
+
+	a.ops = append(a.ops, &types.Operation{
+		OperationIdentifier: &types.OperationIdentifier{
+			Index: a.index,
+		},
+		Type:    opType,
+		Status:  types.String(a.status),
+		Account: account,
+		Amount: &types.Amount{
+			Value:    strconv.FormatInt(amount, 10),
+			Currency: currency,
+		},
+	})
+	a.index++
+}
+
+// SumBalances returns the total of each token across all
+// *ScriptBalances, in order of first appearance.
+func SumBalances(accounts []*ScriptBalances) []*TokenAmount {
+	totals := []*TokenAmount{}
+	indexes := map[uint32]int{}
+	for _, account := range accounts {
+		for _, balance := range account.Balances {
+			i, ok := indexes[balance.TokenID]
+			if !ok {
+				indexes[balance.TokenID] = len(totals)
+				totals = append(totals, &TokenAmount{TokenID: balance.TokenID})
+				i = len(totals) - 1
+			}
+
+			totals[i].Amount += balance.Amount
+		}
+	}
+
+	return totals
+}
+
 // parseOutputTransactionOperation returns the types.Operation for the specified
 // `deFichainOutput` transaction output.
 func (b *Client) parseOutputTransactionOperation(
@@ -806,9 +1670,8 @@ func (b *Client) parseInputTransactionOperation(
 }
 
 // parseAmount returns the atomic value of the specified amount.
-// https://godoc.org/github.com/btcsuite/btcutil#NewAmount
-func (b *Client) parseAmount(amount float64) (uint64, error) {
-	atomicAmount, err := btcutil.NewAmount(amount)
+func (b *Client) parseAmount(amount json.Number) (uint64, error) {
+	atomicAmount, err := ParseAmount(amount)
 	if err != nil {
 		return uint64(0), fmt.Errorf("%w: error parsing amount", err)
 	}
@@ -833,6 +1696,24 @@ func (b *Client) parseOutputAccount(
 	return &types.AccountIdentifier{Address: scriptPubKey.Addresses[0]}
 }
 
+// parseScriptAccount returns the *types.AccountIdentifier that
+// owns a hex-encoded locking script in account balances. Like
+// parseOutputAccount, scripts that do not resolve to a single
+// address are identified by their hex encoding.
+func (b *Client) parseScriptAccount(script string) (*types.AccountIdentifier, error) {
+	rawScript, err := hex.DecodeString(script)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unable to decode script %s", err, script)
+	}
+
+	_, addresses, _, err := txscript.ExtractPkScriptAddrs(rawScript, b.params)
+	if err != nil || len(addresses) != 1 {
+		return &types.AccountIdentifier{Address: script}, nil
+	}
+
+	return &types.AccountIdentifier{Address: addresses[0].EncodeAddress()}, nil
+}
+
 // coinbaseTxOperation constructs a transaction operation for the coinbase input.
 // This reflects an input that does not correspond to a previous output.
 func (b *Client) coinbaseTxOperation(
@@ -16,6 +16,8 @@ package defichain
 
 import (
 	"context"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -77,7 +79,7 @@ var (
 				},
 				Outputs: []*Output{
 					{
-						Value: 50,
+						Value: "50",
 						Index: 0,
 						ScriptPubKey: &ScriptPubKey{
 							ASM:  "04f5eeb2b10c944c6b9fbcfff94c35bdeecd93df977882babc7f3a2cf7f5c81d3b09a68db7f0e04f21de5d4230e75e6dbe7ad16eefe0d4325a62067dc6f369446a OP_CHECKSIG", // nolint
@@ -98,7 +100,7 @@ var (
 				Inputs:   []*Input{}, // all we care about in this test is the outputs
 				Outputs: []*Output{
 					{
-						Value: 0.0381,
+						Value: "0.0381",
 						Index: 0,
 						ScriptPubKey: &ScriptPubKey{
 							ASM:          "OP_DUP OP_HASH160 45db0b779c0b9fa207f12a8218c94fc77aff5045 OP_EQUALVERIFY OP_CHECKSIG",
@@ -111,7 +113,7 @@ var (
 						},
 					},
 					{
-						Value: 0.5,
+						Value: "0.5",
 						Index: 1,
 						ScriptPubKey: &ScriptPubKey{
 							ASM:  "",
@@ -159,7 +161,7 @@ var (
 				},
 				Outputs: []*Output{
 					{
-						Value: 15.89351625,
+						Value: "15.89351625",
 						Index: 0,
 						ScriptPubKey: &ScriptPubKey{
 							ASM:          "OP_HASH160 228f554bbf766d6f9cc828de1126e3d35d15e5fe OP_EQUAL",
@@ -172,7 +174,7 @@ var (
 						},
 					},
 					{
-						Value: 0,
+						Value: "0",
 						Index: 1,
 						ScriptPubKey: &ScriptPubKey{
 							ASM:  "OP_RETURN aa21a9ed10109f4b82aa3ed7ec9d02a2a90246478b3308c8b85daf62fe501d58d05727a4",
@@ -203,7 +205,7 @@ var (
 				},
 				Outputs: []*Output{
 					{
-						Value: 5.56,
+						Value: "5.56",
 						Index: 0,
 						ScriptPubKey: &ScriptPubKey{
 							ASM:          "OP_DUP OP_HASH160 c398efa9c392ba6013c5e04ee729755ef7f58b32 OP_EQUALVERIFY OP_CHECKSIG",
@@ -216,7 +218,7 @@ var (
 						},
 					},
 					{
-						Value: 44.44,
+						Value: "44.44",
 						Index: 1,
 						ScriptPubKey: &ScriptPubKey{
 							ASM:          "OP_DUP OP_HASH160 948c765a6914d43f2a7ac177da2c2f6b52de3d7c OP_EQUALVERIFY OP_CHECKSIG",
@@ -273,7 +275,7 @@ var (
 				},
 				Outputs: []*Output{
 					{
-						Value: 200.56,
+						Value: "200.56",
 						Index: 0,
 						ScriptPubKey: &ScriptPubKey{
 							ASM:          "OP_DUP OP_HASH160 c398efa9c392ba6013c5e04ee729755ef7f58b32 OP_EQUALVERIFY OP_CHECKSIG",
@@ -418,7 +420,7 @@ func TestNetworkStatus(t *testing.T) {
 				fmt.Fprintln(w, response.body)
 			}))
 
-			client := NewClient(ts.URL, MainnetGenesisBlockIdentifier, MainnetCurrency)
+			client := NewClient(ts.URL, MainnetGenesisBlockIdentifier, MainnetCurrency, MainnetParams, nil)
 			status, err := client.NetworkStatus(context.Background())
 			if test.expectedError != nil {
 				assert.Contains(err.Error(), test.expectedError.Error())
@@ -521,7 +523,7 @@ func TestGetPeers(t *testing.T) {
 				fmt.Fprintln(w, response.body)
 			}))
 
-			client := NewClient(ts.URL, MainnetGenesisBlockIdentifier, MainnetCurrency)
+			client := NewClient(ts.URL, MainnetGenesisBlockIdentifier, MainnetCurrency, MainnetParams, nil)
 			peers, err := client.GetPeers(context.Background())
 			if test.expectedError != nil {
 				assert.Contains(err.Error(), test.expectedError.Error())
@@ -682,7 +684,7 @@ func TestGetRawBlock(t *testing.T) {
 				fmt.Fprintln(w, response.body)
 			}))
 
-			client := NewClient(ts.URL, MainnetGenesisBlockIdentifier, MainnetCurrency)
+			client := NewClient(ts.URL, MainnetGenesisBlockIdentifier, MainnetCurrency, MainnetParams, nil)
 			block, coins, err := client.GetRawBlock(context.Background(), test.blockIdentifier)
 			if test.expectedError != nil {
 				assert.Contains(err.Error(), test.expectedError.Error())
@@ -1261,7 +1263,10 @@ func TestParseBlock(t *testing.T) {
 				assert = assert.New(t)
 			)
 
-			client := NewClient("", MainnetGenesisBlockIdentifier, MainnetCurrency)
+			ts := accountHistoryServer(t, emptyAccountHistory, block1000.Hash)
+			defer ts.Close()
+
+			client := NewClient(ts.URL, MainnetGenesisBlockIdentifier, MainnetCurrency, MainnetParams, nil)
 			block, err := client.ParseBlock(context.Background(), test.block, test.coins)
 			if test.expectedError != nil {
 				assert.Contains(err.Error(), test.expectedError.Error())
@@ -1273,6 +1278,179 @@ func TestParseBlock(t *testing.T) {
 	}
 }
 
+func TestParseBlockExemptions(t *testing.T) {
+	const coinbaseHash = "fe28050b93faea61fa88c4c630f0e1f0a1c24d0082dd0e10d369e13212128f33"
+
+	tests := map[string]struct {
+		exemptions []*Exemption
+
+		expectedStatuses []string
+	}{
+		"no exemptions": {
+			expectedStatuses: []string{SuccessStatus, SuccessStatus},
+		},
+		"transaction exemption": {
+			exemptions: []*Exemption{
+				{
+					BlockIndex:      block1000.Height,
+					BlockHash:       block1000.Hash,
+					TransactionHash: coinbaseHash,
+				},
+			},
+			expectedStatuses: []string{SkippedStatus, SkippedStatus},
+		},
+		"operation exemption": {
+			exemptions: []*Exemption{
+				{
+					BlockIndex:       block1000.Height,
+					BlockHash:        block1000.Hash,
+					TransactionHash:  coinbaseHash,
+					OperationIndexes: []int64{1},
+				},
+			},
+			expectedStatuses: []string{SuccessStatus, SkippedStatus},
+		},
+		"other block": {
+			exemptions: []*Exemption{
+				{
+					BlockIndex:      block1000.Height,
+					BlockHash:       "0000000008e647742775a230787d66fdf92c46a48c896bfbc85cdc8acc67e87d",
+					TransactionHash: coinbaseHash,
+				},
+			},
+			expectedStatuses: []string{SuccessStatus, SuccessStatus},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ts := accountHistoryServer(t, emptyAccountHistory, block1000.Hash)
+			defer ts.Close()
+
+			client := NewClient(
+				ts.URL,
+				MainnetGenesisBlockIdentifier,
+				MainnetCurrency,
+				MainnetParams,
+				test.exemptions,
+			)
+			block, err := client.ParseBlock(
+				context.Background(),
+				block1000,
+				map[string]*types.AccountCoin{},
+			)
+			assert.NoError(t, err)
+
+			statuses := []string{}
+			for _, op := range block.Transactions[0].Operations {
+				statuses = append(statuses, *op.Status)
+			}
+			assert.Equal(t, test.expectedStatuses, statuses)
+		})
+	}
+}
+
+func TestParseOutputs(t *testing.T) {
+	ts := accountHistoryServer(t, emptyAccountHistory, block1000.Hash)
+	defer ts.Close()
+
+	client := NewClient(
+		ts.URL,
+		MainnetGenesisBlockIdentifier,
+		MainnetCurrency,
+		MainnetParams,
+		nil,
+	)
+	block, err := client.ParseBlock(
+		context.Background(),
+		block1000,
+		map[string]*types.AccountCoin{},
+	)
+	assert.NoError(t, err)
+
+	// The OUTPUT operations of ParseBlock follow
+	// the coinbase INPUT operation.
+	expected := []*types.Operation{}
+	for _, op := range block.Transactions[0].Operations {
+		if op.Type != OutputOpType {
+			continue
+		}
+
+		op.OperationIdentifier.Index = *op.OperationIdentifier.NetworkIndex
+		expected = append(expected, op)
+	}
+	assert.NotEmpty(t, expected)
+
+	ops, err := client.ParseOutputs(block1000.Txs[0])
+	assert.NoError(t, err)
+	assert.Equal(t, expected, ops)
+}
+
+func TestParseTransaction(t *testing.T) {
+	client := NewClient(
+		"",
+		MainnetGenesisBlockIdentifier,
+		MainnetCurrency,
+		MainnetParams,
+		nil,
+	)
+
+	// The last input of the transaction spends the
+	// first output (vout 0) of its parent.
+	tx := block100000.Txs[2]
+	coins := map[string]*types.AccountCoin{}
+	for i, input := range tx.Inputs {
+		coinIdentifier := CoinIdentifier(input.TxHash, input.Vout)
+		coins[coinIdentifier] = &types.AccountCoin{
+			Account: &types.AccountIdentifier{Address: fmt.Sprintf("addr %d", i)},
+			Coin: &types.Coin{
+				CoinIdentifier: &types.CoinIdentifier{Identifier: coinIdentifier},
+				Amount: &types.Amount{
+					Value:    fmt.Sprintf("%d", (i+1)*100),
+					Currency: MainnetCurrency,
+				},
+			},
+		}
+	}
+
+	transaction, err := client.ParseTransaction(context.Background(), tx, coins)
+	assert.NoError(t, err)
+	assert.Equal(t, tx.Hash, transaction.TransactionIdentifier.Hash)
+	assert.Len(t, transaction.Operations, len(tx.Inputs)+len(tx.Outputs))
+
+	metadata, err := tx.Metadata()
+	assert.NoError(t, err)
+	assert.Equal(t, metadata, transaction.Metadata)
+
+	for i, input := range tx.Inputs {
+		op := transaction.Operations[i]
+		coinIdentifier := CoinIdentifier(input.TxHash, input.Vout)
+		assert.Equal(t, int64(i), op.OperationIdentifier.Index)
+		assert.Equal(t, int64(i), *op.OperationIdentifier.NetworkIndex)
+		assert.Equal(t, InputOpType, op.Type)
+		assert.Equal(t, SuccessStatus, *op.Status)
+		assert.Equal(t, coins[coinIdentifier].Account, op.Account)
+		assert.Equal(t, fmt.Sprintf("-%d", (i+1)*100), op.Amount.Value)
+		assert.Equal(t, &types.CoinChange{
+			CoinIdentifier: &types.CoinIdentifier{Identifier: coinIdentifier},
+			CoinAction:     types.CoinSpent,
+		}, op.CoinChange)
+	}
+
+	outputs, err := client.ParseOutputs(tx)
+	assert.NoError(t, err)
+	for _, op := range outputs {
+		op.OperationIdentifier.Index += int64(len(tx.Inputs))
+	}
+	assert.Equal(t, outputs, transaction.Operations[len(tx.Inputs):])
+
+	// Coins spent by all inputs are required.
+	delete(coins, CoinIdentifier(tx.Inputs[2].TxHash, tx.Inputs[2].Vout))
+	transaction, err = client.ParseTransaction(context.Background(), tx, coins)
+	assert.Nil(t, transaction)
+	assert.Error(t, err)
+}
+
 func TestSuggestedFeeRate(t *testing.T) {
 	tests := map[string]struct {
 		responses []responseFixture
@@ -1300,6 +1478,78 @@ func TestSuggestedFeeRate(t *testing.T) {
 			},
 			expectedError: errors.New("error getting fee estimate"),
 		},
+		"no estimate": {
+			responses: []responseFixture{
+				{
+					status: http.StatusOK,
+					body:   loadFixture("no_fee_rate.json"),
+					url:    url,
+				},
+			},
+			expectedError: ErrNoFeeEstimate,
+		},
+		"500 error": {
+			responses: []responseFixture{
+				{
+					status: http.StatusInternalServerError,
+					body:   "{}",
+					url:    url,
+				},
+			},
+			expectedError: errors.New("invalid response: 500 Internal Server Error"),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var (
+				assert = assert.New(t)
+			)
+
+			responses := make(chan responseFixture, len(test.responses))
+			for _, response := range test.responses {
+				responses <- response
+			}
+
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				response := <-responses
+				assert.Equal("application/json", r.Header.Get("Content-Type"))
+				assert.Equal("POST", r.Method)
+				assert.Equal(response.url, r.URL.RequestURI())
+
+				w.WriteHeader(response.status)
+				fmt.Fprintln(w, response.body)
+			}))
+
+			client := NewClient(ts.URL, MainnetGenesisBlockIdentifier, MainnetCurrency, MainnetParams, nil)
+			rate, err := client.SuggestedFeeRate(context.Background(), 1, ConservativeEstimateMode)
+			if test.expectedError != nil {
+				assert.Contains(err.Error(), test.expectedError.Error())
+			} else {
+				assert.NoError(err)
+				assert.Equal(test.expectedRate, rate)
+			}
+		})
+	}
+}
+
+func TestMempoolFeeRate(t *testing.T) {
+	tests := map[string]struct {
+		responses []responseFixture
+
+		expectedRate  float64
+		expectedError error
+	}{
+		"successful": {
+			responses: []responseFixture{
+				{
+					status: http.StatusOK,
+					body:   loadFixture("mempool_info.json"),
+					url:    url,
+				},
+			},
+			expectedRate: float64(0.00002),
+		},
 		"500 error": {
 			responses: []responseFixture{
 				{
@@ -1333,8 +1583,8 @@ func TestSuggestedFeeRate(t *testing.T) {
 				fmt.Fprintln(w, response.body)
 			}))
 
-			client := NewClient(ts.URL, MainnetGenesisBlockIdentifier, MainnetCurrency)
-			rate, err := client.SuggestedFeeRate(context.Background(), 1)
+			client := NewClient(ts.URL, MainnetGenesisBlockIdentifier, MainnetCurrency, MainnetParams, nil)
+			rate, err := client.MempoolFeeRate(context.Background())
 			if test.expectedError != nil {
 				assert.Contains(err.Error(), test.expectedError.Error())
 			} else {
@@ -1399,7 +1649,7 @@ func TestRawMempool(t *testing.T) {
 				fmt.Fprintln(w, response.body)
 			}))
 
-			client := NewClient(ts.URL, MainnetGenesisBlockIdentifier, MainnetCurrency)
+			client := NewClient(ts.URL, MainnetGenesisBlockIdentifier, MainnetCurrency, MainnetParams, nil)
 			txs, err := client.RawMempool(context.Background())
 			if test.expectedError != nil {
 				assert.Contains(err.Error(), test.expectedError.Error())
@@ -1411,6 +1661,802 @@ func TestRawMempool(t *testing.T) {
 	}
 }
 
+func TestVerboseRawMempool(t *testing.T) {
+	tests := map[string]struct {
+		responses []responseFixture
+
+		expectedEntries map[string]*MempoolEntry
+		expectedError   error
+	}{
+		"successful": {
+			responses: []responseFixture{
+				{
+					status: http.StatusOK,
+					body:   loadFixture("verbose_raw_mempool.json"),
+					url:    url,
+				},
+			},
+			expectedEntries: map[string]*MempoolEntry{
+				"9cec12d170e97e21a876fa2789e6bfc25aa22b8a5e05f3f276650844da0c33ab": {
+					Size:            225,
+					Time:            1604671800,
+					Height:          520000,
+					DescendantCount: 2,
+					DescendantSize:  450,
+					AncestorCount:   1,
+					AncestorSize:    225,
+					Fees: &MempoolEntryFees{
+						Base:       "0.00002250",
+						Modified:   "0.00002250",
+						Ancestor:   "0.00002250",
+						Descendant: "0.00006750",
+					},
+					Depends: []string{},
+					SpentBy: []string{
+						"37b4fcc8e0b229412faeab8baad45d3eb8e4eec41840d6ac2103987163459e75",
+					},
+					Bip125Replaceable: true,
+				},
+				"37b4fcc8e0b229412faeab8baad45d3eb8e4eec41840d6ac2103987163459e75": {
+					Size:            225,
+					Time:            1604671830,
+					Height:          520001,
+					DescendantCount: 1,
+					DescendantSize:  225,
+					AncestorCount:   2,
+					AncestorSize:    450,
+					Fees: &MempoolEntryFees{
+						Base:       "0.00004500",
+						Modified:   "0.00004500",
+						Ancestor:   "0.00006750",
+						Descendant: "0.00004500",
+					},
+					Depends: []string{
+						"9cec12d170e97e21a876fa2789e6bfc25aa22b8a5e05f3f276650844da0c33ab",
+					},
+					SpentBy:           []string{},
+					Bip125Replaceable: true,
+				},
+			},
+		},
+		"500 error": {
+			responses: []responseFixture{
+				{
+					status: http.StatusInternalServerError,
+					body:   "{}",
+					url:    url,
+				},
+			},
+			expectedError: errors.New("invalid response: 500 Internal Server Error"),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var (
+				assert = assert.New(t)
+			)
+
+			responses := make(chan responseFixture, len(test.responses))
+			for _, response := range test.responses {
+				responses <- response
+			}
+
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				response := <-responses
+				assert.Equal("application/json", r.Header.Get("Content-Type"))
+				assert.Equal("POST", r.Method)
+				assert.Equal(response.url, r.URL.RequestURI())
+
+				w.WriteHeader(response.status)
+				fmt.Fprintln(w, response.body)
+			}))
+
+			client := NewClient(ts.URL, MainnetGenesisBlockIdentifier, MainnetCurrency, MainnetParams, nil)
+			entries, err := client.VerboseRawMempool(context.Background())
+			if test.expectedError != nil {
+				assert.Contains(err.Error(), test.expectedError.Error())
+			} else {
+				assert.NoError(err)
+				assert.Equal(test.expectedEntries, entries)
+			}
+		})
+	}
+}
+
+func TestMempoolEntry(t *testing.T) {
+	tests := map[string]struct {
+		responses []responseFixture
+
+		expectedEntry *MempoolEntry
+		expectedError error
+	}{
+		"successful": {
+			responses: []responseFixture{
+				{
+					status: http.StatusOK,
+					body:   loadFixture("mempool_entry.json"),
+					url:    url,
+				},
+			},
+			expectedEntry: &MempoolEntry{
+				Size:            225,
+				Time:            1604671830,
+				Height:          520001,
+				DescendantCount: 1,
+				DescendantSize:  225,
+				AncestorCount:   2,
+				AncestorSize:    450,
+				Fees: &MempoolEntryFees{
+					Base:       "0.00004500",
+					Modified:   "0.00004500",
+					Ancestor:   "0.00006750",
+					Descendant: "0.00004500",
+				},
+				Depends: []string{
+					"9cec12d170e97e21a876fa2789e6bfc25aa22b8a5e05f3f276650844da0c33ab",
+				},
+				SpentBy:           []string{},
+				Bip125Replaceable: true,
+			},
+		},
+		"not in mempool": {
+			responses: []responseFixture{
+				{
+					status: http.StatusOK,
+					body: `{"result":null,"error":{"code":-5,` +
+						`"message":"Transaction not in mempool"},"id":"curltest"}`,
+					url: url,
+				},
+			},
+			expectedError: errors.New("Transaction not in mempool"),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var (
+				assert = assert.New(t)
+			)
+
+			responses := make(chan responseFixture, len(test.responses))
+			for _, response := range test.responses {
+				responses <- response
+			}
+
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				response := <-responses
+				assert.Equal("application/json", r.Header.Get("Content-Type"))
+				assert.Equal("POST", r.Method)
+				assert.Equal(response.url, r.URL.RequestURI())
+
+				w.WriteHeader(response.status)
+				fmt.Fprintln(w, response.body)
+			}))
+
+			client := NewClient(ts.URL, MainnetGenesisBlockIdentifier, MainnetCurrency, MainnetParams, nil)
+			entry, err := client.MempoolEntry(
+				context.Background(),
+				"37b4fcc8e0b229412faeab8baad45d3eb8e4eec41840d6ac2103987163459e75",
+			)
+			if test.expectedError != nil {
+				assert.Contains(err.Error(), test.expectedError.Error())
+			} else {
+				assert.NoError(err)
+				assert.Equal(test.expectedEntry, entry)
+			}
+		})
+	}
+}
+
+func TestTestMempoolAccept(t *testing.T) {
+	tests := map[string]struct {
+		responses []responseFixture
+
+		expectedResult *MempoolAcceptResult
+		expectedError  error
+	}{
+		"allowed": {
+			responses: []responseFixture{
+				{
+					status: http.StatusOK,
+					body:   loadFixture("test_mempool_accept.json"),
+					url:    url,
+				},
+			},
+			expectedResult: &MempoolAcceptResult{
+				TxID:    "2dd3cc3c8e1d4e6d6d8c8f4f1b3c5a7e9d0b2c4e6f8a0b1c3d5e7f9a1b3c5d7e",
+				Allowed: true,
+				Vsize:   110,
+				Fees:    &MempoolAcceptFees{Base: "0.0000111"},
+			},
+		},
+		"rejected": {
+			responses: []responseFixture{
+				{
+					status: http.StatusOK,
+					body:   loadFixture("test_mempool_accept_rejected.json"),
+					url:    url,
+				},
+			},
+			expectedResult: &MempoolAcceptResult{
+				TxID:         "2dd3cc3c8e1d4e6d6d8c8f4f1b3c5a7e9d0b2c4e6f8a0b1c3d5e7f9a1b3c5d7e",
+				RejectReason: "missing-inputs",
+			},
+		},
+		"decode error": {
+			responses: []responseFixture{
+				{
+					status: http.StatusOK,
+					body: `{"result":null,"error":{"code":-22,"message":"TX decode failed"},` +
+						`"id":"curltest"}`,
+					url: url,
+				},
+			},
+			expectedError: errors.New("TX decode failed"),
+		},
+		"500 error": {
+			responses: []responseFixture{
+				{
+					status: http.StatusInternalServerError,
+					body:   "{}",
+					url:    url,
+				},
+			},
+			expectedError: errors.New("invalid response: 500 Internal Server Error"),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var (
+				assert = assert.New(t)
+			)
+
+			responses := make(chan responseFixture, len(test.responses))
+			for _, response := range test.responses {
+				responses <- response
+			}
+
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				response := <-responses
+				assert.Equal("application/json", r.Header.Get("Content-Type"))
+				assert.Equal("POST", r.Method)
+				assert.Equal(response.url, r.URL.RequestURI())
+
+				w.WriteHeader(response.status)
+				fmt.Fprintln(w, response.body)
+			}))
+
+			client := NewClient(ts.URL, MainnetGenesisBlockIdentifier, MainnetCurrency, MainnetParams, nil)
+			result, err := client.TestMempoolAccept(context.Background(), "0100")
+			if test.expectedError != nil {
+				assert.Contains(err.Error(), test.expectedError.Error())
+			} else {
+				assert.NoError(err)
+				assert.Equal(test.expectedResult, result)
+			}
+		})
+	}
+}
+
+func TestTokenCurrency(t *testing.T) {
+	tests := map[string]struct {
+		responses []responseFixture
+		tokenID   uint32
+
+		expectedCurrency *types.Currency
+		expectedError    error
+	}{
+		"native token": {
+			tokenID:          0,
+			expectedCurrency: MainnetCurrency,
+		},
+		"dat": {
+			responses: []responseFixture{
+				{
+					status: http.StatusOK,
+					body:   loadFixture("list_tokens_response.json"),
+					url:    url,
+				},
+			},
+			tokenID: 2,
+			expectedCurrency: &types.Currency{
+				Symbol:   "BTC",
+				Decimals: 8,
+				Metadata: map[string]interface{}{
+					TokenIDMetadataKey: uint32(2),
+				},
+			},
+		},
+		"dst": {
+			responses: []responseFixture{
+				{
+					status: http.StatusOK,
+					body:   loadFixture("list_tokens_response.json"),
+					url:    url,
+				},
+			},
+			tokenID: 128,
+			expectedCurrency: &types.Currency{
+				Symbol:   "FOO#128",
+				Decimals: 8,
+				Metadata: map[string]interface{}{
+					TokenIDMetadataKey: uint32(128),
+				},
+			},
+		},
+		"unknown token": {
+			responses: []responseFixture{
+				{
+					status: http.StatusOK,
+					body:   loadFixture("list_tokens_response.json"),
+					url:    url,
+				},
+			},
+			tokenID:       3,
+			expectedError: ErrUnknownToken,
+		},
+		"500 error": {
+			responses: []responseFixture{
+				{
+					status: http.StatusInternalServerError,
+					body:   "{}",
+					url:    url,
+				},
+			},
+			tokenID:       2,
+			expectedError: errors.New("invalid response: 500 Internal Server Error"),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var (
+				assert = assert.New(t)
+			)
+
+			responses := make(chan responseFixture, len(test.responses))
+			for _, response := range test.responses {
+				responses <- response
+			}
+
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				response := <-responses
+				assert.Equal("application/json", r.Header.Get("Content-Type"))
+				assert.Equal("POST", r.Method)
+				assert.Equal(response.url, r.URL.RequestURI())
+
+				w.WriteHeader(response.status)
+				fmt.Fprintln(w, response.body)
+			}))
+
+			client := NewClient(ts.URL, MainnetGenesisBlockIdentifier, MainnetCurrency, MainnetParams, nil)
+			currency, err := client.TokenCurrency(context.Background(), test.tokenID)
+			if test.expectedError != nil {
+				assert.Contains(err.Error(), test.expectedError.Error())
+				return
+			}
+
+			assert.NoError(err)
+			assert.Equal(test.expectedCurrency, currency)
+
+			// Registered tokens are served without
+			// querying defid again.
+			currency, err = client.TokenCurrency(context.Background(), test.tokenID)
+			assert.NoError(err)
+			assert.Equal(test.expectedCurrency, currency)
+		})
+	}
+}
+
+func TestParseCustomTxOperations(t *testing.T) {
+	const (
+		address1 = "df1q4mfg3kqm4c7f8j7tyy028fa4uaw7zdzy2n68qz"
+		address2 = "df1qr4pelt25fk869v2sfrwxp7ttm7jyx0pyq9h4pn"
+	)
+
+	btc := &types.Currency{
+		Symbol:   "BTC",
+		Decimals: 8,
+		Metadata: map[string]interface{}{
+			TokenIDMetadataKey: uint32(2),
+		},
+	}
+
+	accountOp := func(index int64, opType, address, value string, currency *types.Currency) *types.Operation {
+		return &types.Operation{
+			OperationIdentifier: &types.OperationIdentifier{
+				Index: index,
+			},
+			Type:   opType,
+			Status: types.String(SuccessStatus),
+			Account: &types.AccountIdentifier{
+				Address: address,
+				SubAccount: &types.SubAccountIdentifier{
+					Address: AccountBalancesSubAccount,
+				},
+			},
+			Amount: &types.Amount{
+				Value:    value,
+				Currency: currency,
+			},
+		}
+	}
+
+	tests := map[string]struct {
+		payload string
+
+		expectedOps      []*types.Operation
+		expectedComplete bool
+		expectedError    error
+	}{
+		"utxos to account": {
+			payload: "44665478" + "55" + "01" + "16" + script1 + "01" + "00" + "00e1f50500000000",
+			expectedOps: []*types.Operation{
+				accountOp(2, UtxosToAccountOpType, address1, "100000000", MainnetCurrency),
+			},
+			expectedComplete: true,
+		},
+		"account to utxos": {
+			payload: "44665478" + "62" + "16" + script1 + "01" + "00" + "0065cd1d00000000" + "02000000",
+			expectedOps: []*types.Operation{
+				accountOp(2, AccountToUtxosOpType, address1, "-500000000", MainnetCurrency),
+			},
+			expectedComplete: true,
+		},
+		"account to account": {
+			payload: "44665478" + "42" + "16" + script1 + "02" +
+				"16" + script2 + "02" + "02" + "8813000000000000" + "00" + "0a00000000000000" +
+				"16" + script1 + "01" + "02" + "0500000000000000",
+			expectedOps: []*types.Operation{
+				accountOp(2, AccountTransferOpType, address1, "-5005", btc),
+				accountOp(3, AccountTransferOpType, address1, "-10", MainnetCurrency),
+				accountOp(4, AccountTransferOpType, address2, "5000", btc),
+				accountOp(5, AccountTransferOpType, address2, "10", MainnetCurrency),
+				accountOp(6, AccountTransferOpType, address1, "5", btc),
+			},
+			expectedComplete: true,
+		},
+		"any accounts to accounts": {
+			payload: "44665478" + "61" +
+				"02" + "16" + script1 + "01" + "02" + "0300000000000000" +
+				"16" + script2 + "01" + "02" + "0400000000000000" +
+				"01" + "17" + "a914" + "00112233445566778899aabbccddeeff00112233" + "87" +
+				"01" + "02" + "0700000000000000",
+			expectedOps: []*types.Operation{
+				accountOp(2, AccountTransferOpType, address1, "-3", btc),
+				accountOp(3, AccountTransferOpType, address2, "-4", btc),
+				accountOp(4, AccountTransferOpType, "dDRe9Egaa7RsASbCHQ7tjWT5dxWBb9zJbD", "7", btc),
+			},
+			expectedComplete: true,
+		},
+		"pool swap": {
+			payload: "44665478" + "73" + "16" + script1 + "00" + "00e1f50500000000" + "16" + script2 + "02" +
+				"ffffffffffffff7f" + "ffffffffffffff7f",
+			expectedOps: []*types.Operation{
+				accountOp(2, PoolSwapOpType, address1, "-100000000", MainnetCurrency),
+			},
+			expectedComplete: false,
+		},
+		"other custom tx": {
+			payload:          "44665478" + "5a" + "0102",
+			expectedOps:      []*types.Operation{},
+			expectedComplete: true,
+		},
+		"unknown token": {
+			payload:       "44665478" + "55" + "01" + "16" + script1 + "01" + "03" + "00e1f50500000000",
+			expectedError: ErrUnknownToken,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var (
+				assert = assert.New(t)
+			)
+
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal("application/json", r.Header.Get("Content-Type"))
+				assert.Equal("POST", r.Method)
+
+				w.WriteHeader(http.StatusOK)
+				fmt.Fprintln(w, loadFixture("list_tokens_response.json"))
+			}))
+			defer ts.Close()
+
+			customTx, err := DecodeCustomTx(nullDataScript(t, test.payload))
+			assert.NoError(err)
+
+			client := NewClient(ts.URL, MainnetGenesisBlockIdentifier, MainnetCurrency, MainnetParams, nil)
+			ops, complete, err := client.parseCustomTxOperations(
+				context.Background(),
+				customTx,
+				2,
+				SuccessStatus,
+			)
+			if test.expectedError != nil {
+				assert.Contains(err.Error(), test.expectedError.Error())
+			} else {
+				assert.NoError(err)
+				assert.Equal(test.expectedOps, ops)
+				assert.Equal(test.expectedComplete, complete)
+			}
+		})
+	}
+}
+
+// emptyAccountHistory is a `listaccounthistory`
+// response for a block without account changes.
+const emptyAccountHistory = `{"result": [], "error": null}`
+
+// accountHistoryServer returns a server that responds to
+// `listaccounthistory` with history, to `getblockhash` with
+// blockHash and to `listtokens` with list_tokens_response.json.
+func accountHistoryServer(t *testing.T, history string, blockHash string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := &request{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(req))
+
+		w.WriteHeader(http.StatusOK)
+		switch requestMethod(req.Method) {
+		case requestMethodListAccountHistory:
+			assert.Equal(t, "all", req.Params[0])
+			fmt.Fprintln(w, history)
+		case requestMethodGetBlockHash:
+			fmt.Fprintf(w, `{"result": %q, "error": null}`+"\n", blockHash)
+		case requestMethodListTokens:
+			fmt.Fprintln(w, loadFixture("list_tokens_response.json"))
+		default:
+			assert.Fail(t, "unexpected method", req.Method)
+		}
+	}))
+}
+
+func TestParseAccountOperations(t *testing.T) {
+	const (
+		address1 = "df1q4mfg3kqm4c7f8j7tyy028fa4uaw7zdzy2n68qz"
+		address2 = "df1qr4pelt25fk869v2sfrwxp7ttm7jyx0pyq9h4pn"
+		txHash   = "b4bfdb9a4e79b4a0b0a0c6b2b4b3b1e1c0b6b7a5f4a3d2c1b0a9f8e7d6c5b4a3"
+
+		poolSwap = "44665478" + "73" + "16" + script1 + "00" + "00e1f50500000000" + "16" + script2 + "02" +
+			"ffffffffffffff7f" + "ffffffffffffff7f"
+	)
+
+	btc := &types.Currency{
+		Symbol:   "BTC",
+		Decimals: 8,
+		Metadata: map[string]interface{}{
+			TokenIDMetadataKey: uint32(2),
+		},
+	}
+
+	accountOp := func(index int64, opType, status, address, value string, currency *types.Currency) *types.Operation {
+		return &types.Operation{
+			OperationIdentifier: &types.OperationIdentifier{
+				Index: index,
+			},
+			Type:   opType,
+			Status: types.String(status),
+			Account: &types.AccountIdentifier{
+				Address: address,
+				SubAccount: &types.SubAccountIdentifier{
+					Address: AccountBalancesSubAccount,
+				},
+			},
+			Amount: &types.Amount{
+				Value:    value,
+				Currency: currency,
+			},
+		}
+	}
+
+	tests := map[string]struct {
+		payload string
+		history []*AccountHistory
+
+		expectedOps   []*types.Operation
+		expectedError error
+	}{
+		"pool swap": {
+			payload: poolSwap,
+			history: []*AccountHistory{
+				{Owner: address1, Type: "PoolSwap", TxID: txHash, Amounts: []string{"-1.00000000@DFI"}},
+				{Owner: address2, Type: "PoolSwap", TxID: txHash, Amounts: []string{"0.00012345@BTC"}},
+			},
+			expectedOps: []*types.Operation{
+				accountOp(2, PoolSwapOpType, SuccessStatus, address1, "-100000000", MainnetCurrency),
+				accountOp(3, PoolSwapOpType, SuccessStatus, address2, "12345", btc),
+			},
+		},
+		"rejected pool swap": {
+			payload: poolSwap,
+			expectedOps: []*types.Operation{
+				accountOp(2, PoolSwapOpType, FailureStatus, address1, "-100000000", MainnetCurrency),
+			},
+		},
+		"rejected custom tx with unknown token": {
+			payload:     "44665478" + "55" + "01" + "16" + script1 + "01" + "03" + "00e1f50500000000",
+			expectedOps: []*types.Operation{},
+		},
+		"custom tx without balance changes": {
+			payload:     "44665478" + "5a" + "0102",
+			expectedOps: []*types.Operation{},
+		},
+		"undecodable custom tx": {
+			payload: "44665478" + "55" + "01" + "16" + script1 + "01",
+			history: []*AccountHistory{
+				{Owner: address1, TxID: txHash, Amounts: []string{"1@DFI", "0@BTC"}},
+			},
+			expectedOps: []*types.Operation{
+				accountOp(2, AccountChangeOpType, SuccessStatus, address1, "100000000", MainnetCurrency),
+			},
+		},
+		"rewards": {
+			payload: "deadbeef",
+			history: []*AccountHistory{
+				{Owner: address2, Type: "Rewards", Amounts: []string{"0.5@BTC-DFI"}},
+			},
+			expectedOps: []*types.Operation{
+				accountOp(2, AccountRewardOpType, SuccessStatus, address2, "50000000", &types.Currency{
+					Symbol:   "BTC-DFI",
+					Decimals: 8,
+					Metadata: map[string]interface{}{
+						TokenIDMetadataKey: uint32(5),
+					},
+				}),
+			},
+		},
+		"unknown symbol": {
+			payload: poolSwap,
+			history: []*AccountHistory{
+				{Owner: address1, TxID: txHash, Amounts: []string{"1@ETH"}},
+			},
+			expectedError: ErrUnknownToken,
+		},
+		"invalid amount": {
+			payload: poolSwap,
+			history: []*AccountHistory{
+				{Owner: address1, TxID: txHash, Amounts: []string{"1"}},
+			},
+			expectedError: errors.New("account amount 1 is invalid"),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var (
+				assert = assert.New(t)
+			)
+
+			ts := accountHistoryServer(t, emptyAccountHistory, block1000.Hash)
+			defer ts.Close()
+
+			tx := &Transaction{
+				Hash: txHash,
+				Outputs: []*Output{
+					{
+						Index: 0,
+						ScriptPubKey: &ScriptPubKey{
+							Hex:  hex.EncodeToString(nullDataScript(t, test.payload)),
+							Type: NullData,
+						},
+					},
+				},
+			}
+
+			client := NewClient(ts.URL, MainnetGenesisBlockIdentifier, MainnetCurrency, MainnetParams, nil)
+			ops, err := client.parseAccountOperations(context.Background(), tx, test.history, 2)
+			if test.expectedError != nil {
+				assert.Contains(err.Error(), test.expectedError.Error())
+			} else {
+				assert.NoError(err)
+				assert.Equal(test.expectedOps, ops)
+			}
+		})
+	}
+}
+
+func TestParseBlockAccountHistory(t *testing.T) {
+	const dfTxHash = "b4bfdb9a4e79b4a0b0a0c6b2b4b3b1e1c0b6b7a5f4a3d2c1b0a9f8e7d6c5b4a3"
+
+	blockWithCustomTx := *block1000
+	blockWithCustomTx.Txs = append([]*Transaction{}, block1000.Txs...)
+	blockWithCustomTx.Txs = append(blockWithCustomTx.Txs, &Transaction{
+		Hash: dfTxHash,
+		Outputs: []*Output{
+			{
+				Value: "0",
+				Index: 0,
+				ScriptPubKey: &ScriptPubKey{
+					Hex:  hex.EncodeToString(nullDataScript(t, "44665478"+"5a"+"0102")),
+					Type: NullData,
+				},
+			},
+		},
+	})
+
+	tests := map[string]struct {
+		block     *Block
+		history   string
+		blockHash string
+
+		expectedError error
+	}{
+		"rewards": {
+			block:     &blockWithCustomTx,
+			history:   loadFixture("list_account_history_response.json"),
+			blockHash: block1000.Hash,
+		},
+		"block without custom transactions": {
+			block: block1000,
+		},
+		"reorg while listing account history": {
+			block:         &blockWithCustomTx,
+			history:       loadFixture("list_account_history_response.json"),
+			blockHash:     "0000000008e647742775a230787d66fdf92c46a48c896bfbc85cdc8acc67e87d",
+			expectedError: errors.New("changed from"),
+		},
+		"unknown transaction": {
+			block: &blockWithCustomTx,
+			history: `{"result": [{"owner": "df1q4mfg3kqm4c7f8j7tyy028fa4uaw7zdzy2n68qz", ` +
+				`"blockHeight": 1000, "type": "AccountToAccount", "txn": 1, ` +
+				`"txid": "0c9fbb8a1ec3e6e6e1b6c7c0bcbdff4e3b0b4f0c2b1f2d4e5a6b7c8d9e0f1a2b", ` +
+				`"amounts": ["1.00000000@DFI"]}], "error": null}`,
+			blockHash:     block1000.Hash,
+			expectedError: ErrUnknownAccountHistory,
+		},
+		"unknown type without transaction": {
+			block: &blockWithCustomTx,
+			history: `{"result": [{"owner": "df1q4mfg3kqm4c7f8j7tyy028fa4uaw7zdzy2n68qz", ` +
+				`"blockHeight": 1000, "type": "AccountToAccount", ` +
+				`"amounts": ["1.00000000@DFI"]}], "error": null}`,
+			blockHash:     block1000.Hash,
+			expectedError: ErrUnknownAccountHistory,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var (
+				assert = assert.New(t)
+			)
+
+			ts := accountHistoryServer(t, test.history, test.blockHash)
+			defer ts.Close()
+
+			client := NewClient(ts.URL, MainnetGenesisBlockIdentifier, MainnetCurrency, MainnetParams, nil)
+			block, err := client.ParseBlock(context.Background(), test.block, map[string]*types.AccountCoin{})
+			if test.expectedError != nil {
+				assert.Contains(err.Error(), test.expectedError.Error())
+				return
+			}
+			assert.NoError(err)
+
+			ops := block.Transactions[0].Operations
+			if test.history == "" {
+				assert.Len(ops, 2)
+				return
+			}
+
+			// Rewards aren't caused by a transaction and are
+			// added to the coinbase transaction.
+			assert.Len(ops, 4)
+			for i, op := range ops[2:] {
+				assert.Equal(int64(i+2), op.OperationIdentifier.Index)
+				assert.Equal(AccountRewardOpType, op.Type)
+				assert.Equal(SuccessStatus, *op.Status)
+			}
+			assert.Equal("df1q4mfg3kqm4c7f8j7tyy028fa4uaw7zdzy2n68qz", ops[2].Account.Address)
+			assert.Equal("12345", ops[2].Amount.Value)
+			assert.Equal(MainnetCurrency, ops[2].Amount.Currency)
+			assert.Equal("df1qr4pelt25fk869v2sfrwxp7ttm7jyx0pyq9h4pn", ops[3].Account.Address)
+			assert.Equal("100", ops[3].Amount.Value)
+			assert.Equal("BTC", ops[3].Amount.Currency.Symbol)
+		})
+	}
+}
+
 // loadFixture takes a file name and returns the response fixture.
 func loadFixture(fileName string) string {
 	content, err := ioutil.ReadFile(fmt.Sprintf("client_fixtures/%s", fileName))
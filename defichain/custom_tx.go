@@ -0,0 +1,690 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package defichain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// CustomTxType identifies the application-level action
+// of a DeFiChain custom transaction.
+type CustomTxType byte
+
+// Custom transaction types, as defined in
+// https://github.com/DeFiCh/ain/blob/master/src/masternodes/mn_checks.h
+const (
+	CustomTxCreateMasternode      CustomTxType = 'C'
+	CustomTxResignMasternode      CustomTxType = 'R'
+	CustomTxSetGovVariable        CustomTxType = 'G'
+	CustomTxCreateToken           CustomTxType = 'T'
+	CustomTxMintToken             CustomTxType = 'M'
+	CustomTxUpdateToken           CustomTxType = 'N'
+	CustomTxUpdateTokenAny        CustomTxType = 'n'
+	CustomTxCreatePoolPair        CustomTxType = 'p'
+	CustomTxUpdatePoolPair        CustomTxType = 'u'
+	CustomTxPoolSwap              CustomTxType = 's'
+	CustomTxAddPoolLiquidity      CustomTxType = 'l'
+	CustomTxRemovePoolLiquidity   CustomTxType = 'r'
+	CustomTxUtxosToAccount        CustomTxType = 'U'
+	CustomTxAccountToUtxos        CustomTxType = 'b'
+	CustomTxAccountToAccount      CustomTxType = 'B'
+	CustomTxAnyAccountsToAccounts CustomTxType = 'a'
+	CustomTxAutoAuthPrep          CustomTxType = 'A'
+)
+
+var customTxTypeNames = map[CustomTxType]string{
+	CustomTxCreateMasternode:      "CreateMasternode",
+	CustomTxResignMasternode:      "ResignMasternode",
+	CustomTxSetGovVariable:        "SetGovVariable",
+	CustomTxCreateToken:           "CreateToken",
+	CustomTxMintToken:             "MintToken",
+	CustomTxUpdateToken:           "UpdateToken",
+	CustomTxUpdateTokenAny:        "UpdateTokenAny",
+	CustomTxCreatePoolPair:        "CreatePoolPair",
+	CustomTxUpdatePoolPair:        "UpdatePoolPair",
+	CustomTxPoolSwap:              "PoolSwap",
+	CustomTxAddPoolLiquidity:      "AddPoolLiquidity",
+	CustomTxRemovePoolLiquidity:   "RemovePoolLiquidity",
+	CustomTxUtxosToAccount:        "UtxosToAccount",
+	CustomTxAccountToUtxos:        "AccountToUtxos",
+	CustomTxAccountToAccount:      "AccountToAccount",
+	CustomTxAnyAccountsToAccounts: "AnyAccountsToAccounts",
+	CustomTxAutoAuthPrep:          "AutoAuthPrep",
+}
+
+// String returns the name defid uses for the custom
+// transaction type.
+func (c CustomTxType) String() string {
+	if name, ok := customTxTypeNames[c]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("Unknown(%q)", byte(c))
+}
+
+// MarshalText encodes the type by its name.
+func (c CustomTxType) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// UnmarshalText decodes a type from its name.
+func (c *CustomTxType) UnmarshalText(text []byte) error {
+	for t, name := range customTxTypeNames {
+		if name == string(text) {
+			*c = t
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown custom transaction type %s", string(text))
+}
+
+var (
+	// DfTxMarker prefixes the OP_RETURN payload
+	// of every DeFiChain custom transaction.
+	DfTxMarker = []byte("DfTx")
+
+	// ErrNotCustomTx is returned when a script or
+	// transaction does not carry a DfTx payload.
+	ErrNotCustomTx = errors.New("not a custom transaction")
+)
+
+// CustomTx is a decoded DeFiChain custom transaction.
+// Message is nil for types we don't deserialize.
+type CustomTx struct {
+	Type    CustomTxType `json:"type"`
+	Message interface{}  `json:"message,omitempty"`
+}
+
+// TokenAmount is an amount of a DeFiChain token
+// in its smallest unit.
+type TokenAmount struct {
+	TokenID uint32 `json:"token_id"`
+	Amount  int64  `json:"amount"`
+}
+
+// ScriptBalances are the token balances credited
+// to or debited from an account (script).
+type ScriptBalances struct {
+	Script   string         `json:"script"`
+	Balances []*TokenAmount `json:"balances"`
+}
+
+// CreateMasternodeMessage is the payload of CreateMasternode.
+type CreateMasternodeMessage struct {
+	OperatorType        uint8  `json:"operator_type"`
+	OperatorAuthAddress string `json:"operator_auth_address"`
+}
+
+// ResignMasternodeMessage is the payload of ResignMasternode.
+type ResignMasternodeMessage struct {
+	NodeID string `json:"node_id"`
+}
+
+// TokenMessage is the payload of CreateToken and
+// the new token definition of UpdateTokenAny.
+type TokenMessage struct {
+	Symbol  string `json:"symbol"`
+	Name    string `json:"name"`
+	Decimal uint8  `json:"decimal"`
+	Limit   int64  `json:"limit"`
+	Flags   uint8  `json:"flags"`
+}
+
+// MintTokenMessage is the payload of MintToken.
+type MintTokenMessage struct {
+	Balances []*TokenAmount `json:"balances"`
+}
+
+// UpdateTokenMessage is the payload of UpdateToken.
+type UpdateTokenMessage struct {
+	TokenTx string `json:"token_tx"`
+	IsDAT   bool   `json:"is_dat"`
+}
+
+// UpdateTokenAnyMessage is the payload of UpdateTokenAny.
+type UpdateTokenAnyMessage struct {
+	TokenTx string        `json:"token_tx"`
+	Token   *TokenMessage `json:"token"`
+}
+
+// CreatePoolPairMessage is the payload of CreatePoolPair.
+type CreatePoolPairMessage struct {
+	TokenA       uint32 `json:"token_a"`
+	TokenB       uint32 `json:"token_b"`
+	Commission   int64  `json:"commission"`
+	OwnerAddress string `json:"owner_address"`
+	Status       bool   `json:"status"`
+	PairSymbol   string `json:"pair_symbol"`
+}
+
+// UpdatePoolPairMessage is the payload of UpdatePoolPair.
+type UpdatePoolPairMessage struct {
+	PoolID       uint32 `json:"pool_id"`
+	Status       bool   `json:"status"`
+	Commission   int64  `json:"commission"`
+	OwnerAddress string `json:"owner_address"`
+}
+
+// PoolSwapMessage is the payload of PoolSwap.
+type PoolSwapMessage struct {
+	From             string `json:"from"`
+	TokenFrom        uint32 `json:"token_from"`
+	AmountFrom       int64  `json:"amount_from"`
+	To               string `json:"to"`
+	TokenTo          uint32 `json:"token_to"`
+	MaxPriceInteger  int64  `json:"max_price_integer"`
+	MaxPriceFraction int64  `json:"max_price_fraction"`
+}
+
+// AddPoolLiquidityMessage is the payload of AddPoolLiquidity.
+type AddPoolLiquidityMessage struct {
+	From         []*ScriptBalances `json:"from"`
+	ShareAddress string            `json:"share_address"`
+}
+
+// RemovePoolLiquidityMessage is the payload of RemovePoolLiquidity.
+type RemovePoolLiquidityMessage struct {
+	From   string       `json:"from"`
+	Amount *TokenAmount `json:"amount"`
+}
+
+// UtxosToAccountMessage is the payload of UtxosToAccount.
+type UtxosToAccountMessage struct {
+	To []*ScriptBalances `json:"to"`
+}
+
+// AccountToUtxosMessage is the payload of AccountToUtxos.
+type AccountToUtxosMessage struct {
+	From                string         `json:"from"`
+	Balances            []*TokenAmount `json:"balances"`
+	MintingOutputsStart uint32         `json:"minting_outputs_start"`
+}
+
+// AccountToAccountMessage is the payload of AccountToAccount.
+type AccountToAccountMessage struct {
+	From string            `json:"from"`
+	To   []*ScriptBalances `json:"to"`
+}
+
+// AnyAccountsToAccountsMessage is the payload of AnyAccountsToAccounts.
+type AnyAccountsToAccountsMessage struct {
+	From []*ScriptBalances `json:"from"`
+	To   []*ScriptBalances `json:"to"`
+}
+
+// DecodeCustomTx decodes the DfTx payload of an OP_RETURN
+// locking script. It returns ErrNotCustomTx if the script
+// does not carry the DfTx marker.
+//
+// Source: https://github.com/DeFiCh/ain/blob/master/src/masternodes/mn_checks.cpp
+func DecodeCustomTx(script []byte) (*CustomTx, error) {
+	if len(script) == 0 || script[0] != txscript.OP_RETURN {
+		return nil, ErrNotCustomTx
+	}
+
+	pushes, err := txscript.PushedData(script[1:])
+	if err != nil || len(pushes) != 1 {
+		return nil, ErrNotCustomTx
+	}
+
+	payload := pushes[0]
+	if len(payload) < len(DfTxMarker)+1 || !bytes.Equal(payload[:len(DfTxMarker)], DfTxMarker) {
+		return nil, ErrNotCustomTx
+	}
+
+	customTx := &CustomTx{Type: CustomTxType(payload[len(DfTxMarker)])}
+	r := &customTxReader{r: bytes.NewReader(payload[len(DfTxMarker)+1:])}
+
+	switch customTx.Type {
+	case CustomTxCreateMasternode:
+		customTx.Message = &CreateMasternodeMessage{
+			OperatorType:        r.readUint8(),
+			OperatorAuthAddress: hex.EncodeToString(r.readBytes(20)), // nolint:gomnd
+		}
+	case CustomTxResignMasternode:
+		customTx.Message = &ResignMasternodeMessage{NodeID: r.readHash()}
+	case CustomTxCreateToken:
+		customTx.Message = r.readToken()
+	case CustomTxMintToken:
+		customTx.Message = &MintTokenMessage{Balances: r.readBalances()}
+	case CustomTxUpdateToken:
+		customTx.Message = &UpdateTokenMessage{
+			TokenTx: r.readHash(),
+			IsDAT:   r.readBool(),
+		}
+	case CustomTxUpdateTokenAny:
+		customTx.Message = &UpdateTokenAnyMessage{
+			TokenTx: r.readHash(),
+			Token:   r.readToken(),
+		}
+	case CustomTxCreatePoolPair:
+		customTx.Message = &CreatePoolPairMessage{
+			TokenA:       r.readTokenID(),
+			TokenB:       r.readTokenID(),
+			Commission:   r.readInt64(),
+			OwnerAddress: r.readScript(),
+			Status:       r.readBool(),
+			PairSymbol:   r.readString(),
+		}
+	case CustomTxUpdatePoolPair:
+		customTx.Message = &UpdatePoolPairMessage{
+			PoolID:       r.readTokenID(),
+			Status:       r.readBool(),
+			Commission:   r.readInt64(),
+			OwnerAddress: r.readScript(),
+		}
+	case CustomTxPoolSwap:
+		customTx.Message = &PoolSwapMessage{
+			From:             r.readScript(),
+			TokenFrom:        r.readTokenID(),
+			AmountFrom:       r.readInt64(),
+			To:               r.readScript(),
+			TokenTo:          r.readTokenID(),
+			MaxPriceInteger:  r.readInt64(),
+			MaxPriceFraction: r.readInt64(),
+		}
+	case CustomTxAddPoolLiquidity:
+		customTx.Message = &AddPoolLiquidityMessage{
+			From:         r.readAccounts(),
+			ShareAddress: r.readScript(),
+		}
+	case CustomTxRemovePoolLiquidity:
+		customTx.Message = &RemovePoolLiquidityMessage{
+			From: r.readScript(),
+			Amount: &TokenAmount{
+				TokenID: r.readTokenID(),
+				Amount:  r.readInt64(),
+			},
+		}
+	case CustomTxUtxosToAccount:
+		customTx.Message = &UtxosToAccountMessage{To: r.readAccounts()}
+	case CustomTxAccountToUtxos:
+		customTx.Message = &AccountToUtxosMessage{
+			From:                r.readScript(),
+			Balances:            r.readBalances(),
+			MintingOutputsStart: r.readUint32(),
+		}
+	case CustomTxAccountToAccount:
+		customTx.Message = &AccountToAccountMessage{
+			From: r.readScript(),
+			To:   r.readAccounts(),
+		}
+	case CustomTxAnyAccountsToAccounts:
+		customTx.Message = &AnyAccountsToAccountsMessage{
+			From: r.readAccounts(),
+			To:   r.readAccounts(),
+		}
+	}
+
+	if r.err != nil {
+		return nil, fmt.Errorf("%w: unable to decode %s payload", r.err, customTx.Type)
+	}
+
+	return customTx, nil
+}
+
+// customTxReader deserializes DeFiChain's
+// serialization format. The first error
+// encountered is sticky so a message can be
+// decoded without checking every field.
+type customTxReader struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (c *customTxReader) readBytes(n int) []byte {
+	if c.err != nil {
+		return nil
+	}
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(c.r, b); err != nil {
+		c.err = err
+		return nil
+	}
+
+	return b
+}
+
+func (c *customTxReader) readUint8() uint8 {
+	b := c.readBytes(1)
+	if b == nil {
+		return 0
+	}
+
+	return b[0]
+}
+
+func (c *customTxReader) readBool() bool {
+	return c.readUint8() != 0
+}
+
+func (c *customTxReader) readUint32() uint32 {
+	b := c.readBytes(4) // nolint:gomnd
+	if b == nil {
+		return 0
+	}
+
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (c *customTxReader) readInt64() int64 {
+	b := c.readBytes(8) // nolint:gomnd
+	if b == nil {
+		return 0
+	}
+
+	return int64(binary.LittleEndian.Uint64(b))
+}
+
+// readCompactSize reads a CompactSize prefix (used for
+// vectors, maps and strings).
+func (c *customTxReader) readCompactSize() uint64 {
+	if c.err != nil {
+		return 0
+	}
+
+	n, err := wire.ReadVarInt(c.r, 0)
+	if err != nil {
+		c.err = err
+		return 0
+	}
+
+	if n > uint64(c.r.Len()) {
+		c.err = fmt.Errorf("size %d exceeds remaining payload", n)
+		return 0
+	}
+
+	return n
+}
+
+// readTokenID reads a DCT_ID, which is serialized
+// with the MSB base-128 VARINT encoding (not CompactSize).
+func (c *customTxReader) readTokenID() uint32 {
+	var n uint64
+	for c.err == nil {
+		b := c.readUint8()
+		if n > math.MaxUint32>>7 {
+			c.err = errors.New("token id overflows uint32")
+			return 0
+		}
+
+		n = (n << 7) | uint64(b&0x7f) // nolint:gomnd
+		if b&0x80 == 0 {
+			return uint32(n)
+		}
+		n++
+	}
+
+	return 0
+}
+
+func (c *customTxReader) readString() string {
+	return string(c.readBytes(int(c.readCompactSize())))
+}
+
+// readScript reads a CScript and returns it hex encoded.
+func (c *customTxReader) readScript() string {
+	return hex.EncodeToString(c.readBytes(int(c.readCompactSize())))
+}
+
+func (c *customTxReader) readHash() string {
+	b := c.readBytes(chainhash.HashSize)
+	if b == nil {
+		return ""
+	}
+
+	hash, err := chainhash.NewHash(b)
+	if err != nil {
+		c.err = err
+		return ""
+	}
+
+	return hash.String()
+}
+
+func (c *customTxReader) readToken() *TokenMessage {
+	return &TokenMessage{
+		Symbol:  c.readString(),
+		Name:    c.readString(),
+		Decimal: c.readUint8(),
+		Limit:   c.readInt64(),
+		Flags:   c.readUint8(),
+	}
+}
+
+// readBalances reads a CBalances (map of DCT_ID to CAmount).
+func (c *customTxReader) readBalances() []*TokenAmount {
+	count := c.readCompactSize()
+	balances := []*TokenAmount{}
+	for i := uint64(0); i < count && c.err == nil; i++ {
+		balances = append(balances, &TokenAmount{
+			TokenID: c.readTokenID(),
+			Amount:  c.readInt64(),
+		})
+	}
+
+	return balances
+}
+
+// readAccounts reads a CAccounts (map of CScript to CBalances).
+func (c *customTxReader) readAccounts() []*ScriptBalances {
+	count := c.readCompactSize()
+	accounts := []*ScriptBalances{}
+	for i := uint64(0); i < count && c.err == nil; i++ {
+		accounts = append(accounts, &ScriptBalances{
+			Script:   c.readScript(),
+			Balances: c.readBalances(),
+		})
+	}
+
+	return accounts
+}
+
+// EncodeCustomTx returns the OP_RETURN locking script carrying
+// the DfTx payload of a custom transaction. Only the messages
+// that move account balances can be encoded. Like defid, the
+// accounts and balances of a message are serialized in the
+// order of their keys.
+func EncodeCustomTx(customTx *CustomTx) ([]byte, error) {
+	w := &customTxWriter{}
+	w.writeBytes(DfTxMarker)
+	w.writeUint8(uint8(customTx.Type))
+
+	ok := false
+	switch customTx.Type {
+	case CustomTxUtxosToAccount:
+		var message *UtxosToAccountMessage
+		if message, ok = customTx.Message.(*UtxosToAccountMessage); ok {
+			w.writeAccounts(message.To)
+		}
+	case CustomTxAccountToUtxos:
+		var message *AccountToUtxosMessage
+		if message, ok = customTx.Message.(*AccountToUtxosMessage); ok {
+			w.writeScript(message.From)
+			w.writeBalances(message.Balances)
+			w.writeUint32(message.MintingOutputsStart)
+		}
+	case CustomTxAccountToAccount:
+		var message *AccountToAccountMessage
+		if message, ok = customTx.Message.(*AccountToAccountMessage); ok {
+			w.writeScript(message.From)
+			w.writeAccounts(message.To)
+		}
+	case CustomTxAnyAccountsToAccounts:
+		var message *AnyAccountsToAccountsMessage
+		if message, ok = customTx.Message.(*AnyAccountsToAccountsMessage); ok {
+			w.writeAccounts(message.From)
+			w.writeAccounts(message.To)
+		}
+	default:
+		return nil, fmt.Errorf("encoding %s is not supported", customTx.Type)
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("%T is not a valid %s message", customTx.Message, customTx.Type)
+	}
+
+	if w.err != nil {
+		return nil, fmt.Errorf("%w: unable to encode %s payload", w.err, customTx.Type)
+	}
+
+	// DeFiChain relays OP_RETURN outputs larger than
+	// txscript.MaxDataCarrierSize, so we can't use
+	// txscript.NullDataScript.
+	return txscript.NewScriptBuilder().
+		AddOp(txscript.OP_RETURN).
+		AddData(w.buf.Bytes()).
+		Script()
+}
+
+// customTxWriter serializes DeFiChain's
+// serialization format. Like customTxReader,
+// the first error encountered is sticky.
+type customTxWriter struct {
+	buf bytes.Buffer
+	err error
+}
+
+func (c *customTxWriter) writeBytes(b []byte) {
+	if c.err != nil {
+		return
+	}
+
+	c.buf.Write(b)
+}
+
+func (c *customTxWriter) writeUint8(n uint8) {
+	c.writeBytes([]byte{n})
+}
+
+func (c *customTxWriter) writeUint32(n uint32) {
+	b := make([]byte, 4) // nolint:gomnd
+	binary.LittleEndian.PutUint32(b, n)
+	c.writeBytes(b)
+}
+
+func (c *customTxWriter) writeInt64(n int64) {
+	b := make([]byte, 8) // nolint:gomnd
+	binary.LittleEndian.PutUint64(b, uint64(n))
+	c.writeBytes(b)
+}
+
+func (c *customTxWriter) writeCompactSize(n uint64) {
+	if c.err != nil {
+		return
+	}
+
+	c.err = wire.WriteVarInt(&c.buf, 0, n)
+}
+
+// writeTokenID writes a DCT_ID with the MSB
+// base-128 VARINT encoding.
+func (c *customTxWriter) writeTokenID(tokenID uint32) {
+	n := uint64(tokenID)
+	tmp := []byte{}
+	for {
+		b := byte(n & 0x7f) // nolint:gomnd
+		if len(tmp) > 0 {
+			b |= 0x80
+		}
+		tmp = append(tmp, b)
+
+		if n <= 0x7f { // nolint:gomnd
+			break
+		}
+		n = (n >> 7) - 1 // nolint:gomnd
+	}
+
+	for i := len(tmp) - 1; i >= 0; i-- {
+		c.writeUint8(tmp[i])
+	}
+}
+
+// writeScript writes a hex-encoded CScript.
+func (c *customTxWriter) writeScript(script string) {
+	b, err := hex.DecodeString(script)
+	if err != nil && c.err == nil {
+		c.err = fmt.Errorf("%w: unable to decode script %s", err, script)
+	}
+
+	c.writeCompactSize(uint64(len(b)))
+	c.writeBytes(b)
+}
+
+// writeBalances writes a CBalances (map of DCT_ID to CAmount).
+func (c *customTxWriter) writeBalances(balances []*TokenAmount) {
+	sorted := make([]*TokenAmount, len(balances))
+	copy(sorted, balances)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].TokenID < sorted[j].TokenID })
+
+	c.writeCompactSize(uint64(len(sorted)))
+	for i, balance := range sorted {
+		if i > 0 && sorted[i-1].TokenID == balance.TokenID && c.err == nil {
+			c.err = fmt.Errorf("token %d is duplicated", balance.TokenID)
+		}
+
+		c.writeTokenID(balance.TokenID)
+		c.writeInt64(balance.Amount)
+	}
+}
+
+// writeAccounts writes a CAccounts (map of CScript to CBalances).
+// CScript keys are ordered by size and then by content.
+func (c *customTxWriter) writeAccounts(accounts []*ScriptBalances) {
+	scripts := make([][]byte, len(accounts))
+	for i, account := range accounts {
+		script, err := hex.DecodeString(account.Script)
+		if err != nil && c.err == nil {
+			c.err = fmt.Errorf("%w: unable to decode script %s", err, account.Script)
+		}
+		scripts[i] = script
+	}
+
+	order := make([]int, len(accounts))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := scripts[order[i]], scripts[order[j]]
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+
+		return bytes.Compare(a, b) < 0
+	})
+
+	c.writeCompactSize(uint64(len(accounts)))
+	for i, index := range order {
+		if i > 0 && bytes.Equal(scripts[order[i-1]], scripts[index]) && c.err == nil {
+			c.err = fmt.Errorf("script %s is duplicated", accounts[index].Script)
+		}
+
+		c.writeScript(accounts[index].Script)
+		c.writeBalances(accounts[index].Balances)
+	}
+}
@@ -0,0 +1,424 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package defichain
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	script1 = "0014aed288d81bae3c93cbcb211ea3a7b5e75de13444"
+	script2 = "00141d439fad544d8fa2b15048dc60f96bdfa4433c24"
+)
+
+func nullDataScript(t *testing.T, payload string) []byte {
+	data, err := hex.DecodeString(payload)
+	assert.NoError(t, err)
+
+	// DeFiChain relays OP_RETURN outputs larger than
+	// txscript.MaxDataCarrierSize, so we can't use
+	// txscript.NullDataScript.
+	script, err := txscript.NewScriptBuilder().
+		AddOp(txscript.OP_RETURN).
+		AddData(data).
+		Script()
+	assert.NoError(t, err)
+
+	return script
+}
+
+func TestDecodeCustomTx(t *testing.T) {
+	tests := map[string]struct {
+		script []byte
+
+		customTx *CustomTx
+		err      string
+	}{
+		"utxos to account": {
+			script: nullDataScript(t, "44665478"+"55"+"01"+"16"+script1+"01"+"00"+"00e1f50500000000"),
+			customTx: &CustomTx{
+				Type: CustomTxUtxosToAccount,
+				Message: &UtxosToAccountMessage{
+					To: []*ScriptBalances{
+						{
+							Script:   script1,
+							Balances: []*TokenAmount{{TokenID: 0, Amount: 100000000}},
+						},
+					},
+				},
+			},
+		},
+		"account to utxos": {
+			script: nullDataScript(t, "44665478"+"62"+"16"+script1+"01"+"00"+"0065cd1d00000000"+"02000000"),
+			customTx: &CustomTx{
+				Type: CustomTxAccountToUtxos,
+				Message: &AccountToUtxosMessage{
+					From:                script1,
+					Balances:            []*TokenAmount{{TokenID: 0, Amount: 500000000}},
+					MintingOutputsStart: 2,
+				},
+			},
+		},
+		"account to account (multi-byte token id)": {
+			script: nullDataScript(
+				t,
+				"44665478"+"42"+"16"+script1+"01"+"16"+script2+"02"+"02"+"8813000000000000"+"8000"+"0100000000000000",
+			),
+			customTx: &CustomTx{
+				Type: CustomTxAccountToAccount,
+				Message: &AccountToAccountMessage{
+					From: script1,
+					To: []*ScriptBalances{
+						{
+							Script: script2,
+							Balances: []*TokenAmount{
+								{TokenID: 2, Amount: 5000},
+								{TokenID: 128, Amount: 1},
+							},
+						},
+					},
+				},
+			},
+		},
+		"pool swap": {
+			script: nullDataScript(
+				t,
+				"44665478"+"73"+"16"+script1+"00"+"00e1f50500000000"+"16"+script2+"01"+
+					"ffffffffffffff7f"+"ffffffffffffff7f",
+			),
+			customTx: &CustomTx{
+				Type: CustomTxPoolSwap,
+				Message: &PoolSwapMessage{
+					From:             script1,
+					TokenFrom:        0,
+					AmountFrom:       100000000,
+					To:               script2,
+					TokenTo:          1,
+					MaxPriceInteger:  9223372036854775807,
+					MaxPriceFraction: 9223372036854775807,
+				},
+			},
+		},
+		"create token": {
+			script: nullDataScript(
+				t,
+				"44665478"+"54"+"03425443"+"07426974636f696e"+"08"+"0000000000000000"+"03",
+			),
+			customTx: &CustomTx{
+				Type: CustomTxCreateToken,
+				Message: &TokenMessage{
+					Symbol:  "BTC",
+					Name:    "Bitcoin",
+					Decimal: 8,
+					Limit:   0,
+					Flags:   3,
+				},
+			},
+		},
+		"unknown type": {
+			script: nullDataScript(t, "44665478"+"5a"+"0102"),
+			customTx: &CustomTx{
+				Type: CustomTxType('Z'),
+			},
+		},
+		"truncated payload": {
+			script: nullDataScript(t, "44665478"+"55"+"01"+"16"+script1+"01"+"00"+"00e1f505"),
+			err:    "unable to decode UtxosToAccount payload",
+		},
+		"oversized script": {
+			script: nullDataScript(t, "44665478"+"62"+"ff"),
+			err:    "unable to decode AccountToUtxos payload",
+		},
+		"other OP_RETURN": {
+			script: nullDataScript(t, "deadbeef"),
+			err:    ErrNotCustomTx.Error(),
+		},
+		"not OP_RETURN": {
+			script: forceHexDecode(t, script1),
+			err:    ErrNotCustomTx.Error(),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			customTx, err := DecodeCustomTx(test.script)
+			if test.err != "" {
+				assert.Nil(t, customTx)
+				assert.Contains(t, err.Error(), test.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.customTx, customTx)
+		})
+	}
+}
+
+func TestEncodeCustomTx(t *testing.T) {
+	tests := map[string]struct {
+		customTx *CustomTx
+
+		script  []byte
+		decoded *CustomTx
+		err     string
+	}{
+		"utxos to account": {
+			customTx: &CustomTx{
+				Type: CustomTxUtxosToAccount,
+				Message: &UtxosToAccountMessage{
+					To: []*ScriptBalances{
+						{
+							Script:   script1,
+							Balances: []*TokenAmount{{TokenID: 0, Amount: 100000000}},
+						},
+					},
+				},
+			},
+			script: nullDataScript(t, "44665478"+"55"+"01"+"16"+script1+"01"+"00"+"00e1f50500000000"),
+		},
+		"account to utxos": {
+			customTx: &CustomTx{
+				Type: CustomTxAccountToUtxos,
+				Message: &AccountToUtxosMessage{
+					From:                script1,
+					Balances:            []*TokenAmount{{TokenID: 0, Amount: 500000000}},
+					MintingOutputsStart: 2,
+				},
+			},
+			script: nullDataScript(t, "44665478"+"62"+"16"+script1+"01"+"00"+"0065cd1d00000000"+"02000000"),
+		},
+		"account to account (unordered balances)": {
+			customTx: &CustomTx{
+				Type: CustomTxAccountToAccount,
+				Message: &AccountToAccountMessage{
+					From: script1,
+					To: []*ScriptBalances{
+						{
+							Script: script2,
+							Balances: []*TokenAmount{
+								{TokenID: 128, Amount: 1},
+								{TokenID: 2, Amount: 5000},
+							},
+						},
+					},
+				},
+			},
+			script: nullDataScript(
+				t,
+				"44665478"+"42"+"16"+script1+"01"+"16"+script2+"02"+"02"+"8813000000000000"+"8000"+"0100000000000000",
+			),
+			decoded: &CustomTx{
+				Type: CustomTxAccountToAccount,
+				Message: &AccountToAccountMessage{
+					From: script1,
+					To: []*ScriptBalances{
+						{
+							Script: script2,
+							Balances: []*TokenAmount{
+								{TokenID: 2, Amount: 5000},
+								{TokenID: 128, Amount: 1},
+							},
+						},
+					},
+				},
+			},
+		},
+		"any accounts to accounts (scripts ordered by size)": {
+			customTx: &CustomTx{
+				Type: CustomTxAnyAccountsToAccounts,
+				Message: &AnyAccountsToAccountsMessage{
+					From: []*ScriptBalances{
+						{
+							Script:   script1,
+							Balances: []*TokenAmount{{TokenID: 0, Amount: 1}},
+						},
+						{
+							Script:   "ff",
+							Balances: []*TokenAmount{{TokenID: 0, Amount: 1}},
+						},
+					},
+					To: []*ScriptBalances{
+						{
+							Script:   script2,
+							Balances: []*TokenAmount{{TokenID: 0, Amount: 2}},
+						},
+					},
+				},
+			},
+			script: nullDataScript(
+				t,
+				"44665478"+"61"+"02"+"01"+"ff"+"01"+"00"+"0100000000000000"+
+					"16"+script1+"01"+"00"+"0100000000000000"+
+					"01"+"16"+script2+"01"+"00"+"0200000000000000",
+			),
+			decoded: &CustomTx{
+				Type: CustomTxAnyAccountsToAccounts,
+				Message: &AnyAccountsToAccountsMessage{
+					From: []*ScriptBalances{
+						{
+							Script:   "ff",
+							Balances: []*TokenAmount{{TokenID: 0, Amount: 1}},
+						},
+						{
+							Script:   script1,
+							Balances: []*TokenAmount{{TokenID: 0, Amount: 1}},
+						},
+					},
+					To: []*ScriptBalances{
+						{
+							Script:   script2,
+							Balances: []*TokenAmount{{TokenID: 0, Amount: 2}},
+						},
+					},
+				},
+			},
+		},
+		"duplicate script": {
+			customTx: &CustomTx{
+				Type: CustomTxUtxosToAccount,
+				Message: &UtxosToAccountMessage{
+					To: []*ScriptBalances{
+						{Script: script1, Balances: []*TokenAmount{{TokenID: 0, Amount: 1}}},
+						{Script: script1, Balances: []*TokenAmount{{TokenID: 0, Amount: 1}}},
+					},
+				},
+			},
+			err: "is duplicated",
+		},
+		"invalid script": {
+			customTx: &CustomTx{
+				Type: CustomTxAccountToUtxos,
+				Message: &AccountToUtxosMessage{
+					From:     "zz",
+					Balances: []*TokenAmount{{TokenID: 0, Amount: 1}},
+				},
+			},
+			err: "unable to decode script zz",
+		},
+		"mismatched message": {
+			customTx: &CustomTx{
+				Type:    CustomTxUtxosToAccount,
+				Message: &AccountToUtxosMessage{},
+			},
+			err: "is not a valid UtxosToAccount message",
+		},
+		"unsupported type": {
+			customTx: &CustomTx{
+				Type:    CustomTxPoolSwap,
+				Message: &PoolSwapMessage{},
+			},
+			err: "encoding PoolSwap is not supported",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			script, err := EncodeCustomTx(test.customTx)
+			if test.err != "" {
+				assert.Nil(t, script)
+				assert.Contains(t, err.Error(), test.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, hex.EncodeToString(test.script), hex.EncodeToString(script))
+
+			decoded, err := DecodeCustomTx(script)
+			assert.NoError(t, err)
+			if test.decoded == nil {
+				test.decoded = test.customTx
+			}
+			assert.Equal(t, test.decoded, decoded)
+		})
+	}
+}
+
+func TestTransactionMetadataCustomTx(t *testing.T) {
+	tx := &Transaction{
+		Hash:    "b4bfdb9a4e79b4a0b0a0c6b2b4b3b1e1c0b6b7a5f4a3d2c1b0a9f8e7d6c5b4a3",
+		Version: 2,
+		Outputs: []*Output{
+			{
+				Index: 0,
+				ScriptPubKey: &ScriptPubKey{
+					Hex: hex.EncodeToString(nullDataScript(
+						t,
+						"44665478"+"55"+"01"+"16"+script1+"01"+"00"+"00e1f50500000000",
+					)),
+					Type: NullData,
+				},
+			},
+		},
+	}
+
+	metadata, err := tx.Metadata()
+	assert.NoError(t, err)
+	assert.Equal(t, forceMarshalMap(t, &TransactionMetadata{
+		Version: 2,
+		CustomTx: &CustomTx{
+			Type: CustomTxUtxosToAccount,
+			Message: &UtxosToAccountMessage{
+				To: []*ScriptBalances{
+					{
+						Script:   script1,
+						Balances: []*TokenAmount{{TokenID: 0, Amount: 100000000}},
+					},
+				},
+			},
+		},
+	}), metadata)
+
+	// Custom transaction types are surfaced by name.
+	b, err := json.Marshal(metadata)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `"type":"UtxosToAccount"`)
+}
+
+func TestTransactionMetadataCustomTxError(t *testing.T) {
+	tx := &Transaction{
+		Hash:    "b4bfdb9a4e79b4a0b0a0c6b2b4b3b1e1c0b6b7a5f4a3d2c1b0a9f8e7d6c5b4a3",
+		Version: 2,
+		Outputs: []*Output{
+			{
+				Index: 0,
+				ScriptPubKey: &ScriptPubKey{
+					Hex:  hex.EncodeToString(nullDataScript(t, "44665478"+"55"+"01"+"16"+script1+"01")),
+					Type: NullData,
+				},
+			},
+		},
+	}
+
+	// Transactions accepted by defid never fail
+	// parsing because of their DfTx payload.
+	metadata, err := tx.Metadata()
+	assert.NoError(t, err)
+	assert.NotContains(t, metadata, "custom_tx")
+	assert.Contains(t, metadata["custom_tx_error"], "unable to decode UtxosToAccount payload")
+}
+
+func forceHexDecode(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("could not decode hex %s", s)
+	}
+
+	return b
+}
@@ -0,0 +1,143 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package defichain
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/coinbase/rosetta-sdk-go/asserter"
+	"github.com/coinbase/rosetta-sdk-go/types"
+)
+
+// Exemption marks the operations of a historical transaction
+// as SkippedStatus. It is used for transactions whose effects
+// are not reflected in the UTXO set or account balances of
+// defid (ex: transactions reverted by an early consensus fix).
+//
+// An Exemption with a SubAccountAddress is also surfaced as a
+// *types.BalanceExemption so balances of the affected sub-account
+// may diverge from the sum of its operations. An Exemption without
+// one covers main (UTXO) accounts: their balances are the sum of
+// their coins, so skipping the operations is enough.
+type Exemption struct {
+	BlockIndex      int64  `json:"block_index"`
+	BlockHash       string `json:"block_hash"`
+	TransactionHash string `json:"transaction_hash"`
+
+	// OperationIndexes are the OperationIdentifier.Index values
+	// to skip. If empty, all operations in the transaction
+	// are skipped.
+	OperationIndexes []int64 `json:"operation_indexes,omitempty"`
+
+	SubAccountAddress string              `json:"sub_account_address,omitempty"`
+	Currency          *types.Currency     `json:"currency,omitempty"`
+	ExemptionType     types.ExemptionType `json:"exemption_type,omitempty"`
+
+	Reason string `json:"reason,omitempty"`
+
+	// Source links to the consensus code or announcement
+	// that explains the exemption.
+	Source string `json:"source,omitempty"`
+}
+
+// Validate ensures an *Exemption is well-formed.
+func (e *Exemption) Validate() error {
+	if e.BlockIndex < 0 {
+		return fmt.Errorf("block index %d is negative", e.BlockIndex)
+	}
+
+	if len(e.BlockHash) != TransactionHashLength {
+		return fmt.Errorf("block hash %s is not length 64", e.BlockHash)
+	}
+
+	if len(e.TransactionHash) != TransactionHashLength {
+		return fmt.Errorf("transaction hash %s is not length 64", e.TransactionHash)
+	}
+
+	// A *types.BalanceExemption that only specifies a currency
+	// applies to every account, which would make balance storage
+	// overwrite all balances with BalanceStorageHelper.AccountBalance.
+	// Exemptions of main accounts therefore have no balance exemption.
+	if len(e.SubAccountAddress) == 0 {
+		if e.Currency != nil || len(e.ExemptionType) > 0 {
+			return errors.New("currency and exemption type require a sub account address")
+		}
+
+		return nil
+	}
+
+	if err := asserter.BalanceExemptions(
+		[]*types.BalanceExemption{e.BalanceExemption()},
+	); err != nil {
+		return fmt.Errorf("%w: invalid balance exemption", err)
+	}
+
+	return nil
+}
+
+// BalanceExemption returns the *types.BalanceExemption
+// of an *Exemption or nil if it has no sub-account.
+func (e *Exemption) BalanceExemption() *types.BalanceExemption {
+	if len(e.SubAccountAddress) == 0 {
+		return nil
+	}
+
+	return &types.BalanceExemption{
+		SubAccountAddress: types.String(e.SubAccountAddress),
+		Currency:          e.Currency,
+		ExemptionType:     e.ExemptionType,
+	}
+}
+
+// BalanceExemptions returns the *types.BalanceExemption
+// of each *Exemption that has one.
+func BalanceExemptions(exemptions []*Exemption) []*types.BalanceExemption {
+	balanceExemptions := []*types.BalanceExemption{}
+	for _, exemption := range exemptions {
+		if balanceExemption := exemption.BalanceExemption(); balanceExemption != nil {
+			balanceExemptions = append(balanceExemptions, balanceExemption)
+		}
+	}
+
+	return balanceExemptions
+}
+
+// Applies returns a boolean indicating if an operation
+// of a transaction in a block is exempted.
+func (e *Exemption) Applies(
+	blockIndex int64,
+	blockHash string,
+	transactionHash string,
+	operation *types.Operation,
+) bool {
+	if e.BlockIndex != blockIndex ||
+		e.BlockHash != blockHash ||
+		e.TransactionHash != transactionHash {
+		return false
+	}
+
+	if len(e.OperationIndexes) == 0 {
+		return true
+	}
+
+	for _, index := range e.OperationIndexes {
+		if operation.OperationIdentifier.Index == index {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,113 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package defichain
+
+import (
+	"testing"
+
+	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExemptionValidate(t *testing.T) {
+	valid := func() *Exemption {
+		return &Exemption{
+			BlockIndex:        1,
+			BlockHash:         "279b1a87aedc7b9471d4ad4e5f12967ab6259926cd097ade188dfcf22ebfe72a",
+			TransactionHash:   "fe28050b93faea61fa88c4c630f0e1f0a1c24d0082dd0e10d369e13212128f33",
+			SubAccountAddress: "exempt",
+			ExemptionType:     types.BalanceGreaterOrEqual,
+		}
+	}
+
+	tests := map[string]struct {
+		modify func(*Exemption)
+
+		err string
+	}{
+		"valid": {
+			modify: func(*Exemption) {},
+		},
+		"valid with currency": {
+			modify: func(e *Exemption) { e.Currency = MainnetCurrency },
+		},
+		"negative block index": {
+			modify: func(e *Exemption) { e.BlockIndex = -1 },
+			err:    "block index -1 is negative",
+		},
+		"invalid block hash": {
+			modify: func(e *Exemption) { e.BlockHash = "abc" },
+			err:    "block hash abc is not length 64",
+		},
+		"invalid transaction hash": {
+			modify: func(e *Exemption) { e.TransactionHash = "abc" },
+			err:    "transaction hash abc is not length 64",
+		},
+		"main account": {
+			modify: func(e *Exemption) {
+				e.SubAccountAddress = ""
+				e.ExemptionType = ""
+			},
+		},
+		"main account with exemption type": {
+			modify: func(e *Exemption) { e.SubAccountAddress = "" },
+			err:    "currency and exemption type require a sub account address",
+		},
+		"main account with currency": {
+			modify: func(e *Exemption) {
+				e.SubAccountAddress = ""
+				e.ExemptionType = ""
+				e.Currency = MainnetCurrency
+			},
+			err: "currency and exemption type require a sub account address",
+		},
+		"invalid exemption type": {
+			modify: func(e *Exemption) { e.ExemptionType = "bad" },
+			err:    "invalid balance exemption",
+		},
+		"invalid currency": {
+			modify: func(e *Exemption) { e.Currency = &types.Currency{Decimals: 8} },
+			err:    "invalid balance exemption",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			exemption := valid()
+			test.modify(exemption)
+
+			err := exemption.Validate()
+			if test.err != "" {
+				assert.Contains(t, err.Error(), test.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			if len(exemption.SubAccountAddress) == 0 {
+				// Main accounts only skip operations.
+				assert.Empty(t, BalanceExemptions([]*Exemption{exemption}))
+				return
+			}
+
+			assert.Equal(t, []*types.BalanceExemption{
+				{
+					SubAccountAddress: types.String("exempt"),
+					Currency:          exemption.Currency,
+					ExemptionType:     exemption.ExemptionType,
+				},
+			}, BalanceExemptions([]*Exemption{exemption}))
+		})
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package defichain
+
+import (
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// DeFiChain network magics. rosetta-defichain never speaks the
+// p2p protocol, but btcd requires every registered network to
+// have a unique magic, so these must not collide with the
+// Bitcoin networks registered by chaincfg.
+const (
+	mainnetMagic wire.BitcoinNet = 0xe1c1aae2
+	testnetMagic wire.BitcoinNet = 0x0810100c
+	regtestMagic wire.BitcoinNet = 0xdbb6c0fb
+	devnetMagic  wire.BitcoinNet = 0x0d0c0b0a
+)
+
+// hdCoinType is the SLIP-44 coin type registered for DFI.
+const hdCoinType = 1129
+
+var (
+	// MainnetParams are the params for mainnet.
+	MainnetParams = &chaincfg.Params{
+		Name:        "mainnet",
+		Net:         mainnetMagic,
+		DefaultPort: "8555",
+		GenesisHash: mustHash(MainnetGenesisBlockIdentifier.Hash),
+
+		CoinbaseMaturity: 100, // nolint:gomnd
+
+		// Human-readable part for Bech32 encoded segwit addresses (df1...)
+		Bech32HRPSegwit: "df",
+
+		// Address encoding magics
+		PubKeyHashAddrID: 0x12, // starts with 8
+		ScriptHashAddrID: 0x5a, // starts with d
+		PrivateKeyID:     0x80, // starts with 5 (uncompressed) or K/L (compressed)
+
+		// BIP32 hierarchical deterministic extended key magics
+		HDPublicKeyID:  [4]byte{0x04, 0x88, 0xb2, 0x1e}, // starts with xpub
+		HDPrivateKeyID: [4]byte{0x04, 0x88, 0xad, 0xe4}, // starts with xprv
+
+		HDCoinType: hdCoinType,
+	}
+
+	// TestnetParams are the params for testnet.
+	TestnetParams = &chaincfg.Params{
+		Name:        "testnet",
+		Net:         testnetMagic,
+		DefaultPort: "18555",
+		GenesisHash: mustHash(TestnetGenesisBlockIdentifier.Hash),
+
+		CoinbaseMaturity: 100, // nolint:gomnd
+
+		// Human-readable part for Bech32 encoded segwit addresses (tf1...)
+		Bech32HRPSegwit: "tf",
+
+		// Address encoding magics
+		PubKeyHashAddrID: 0x0f, // starts with 7
+		ScriptHashAddrID: 0x80, // starts with t
+		PrivateKeyID:     0xef, // starts with 9 (uncompressed) or c (compressed)
+
+		// BIP32 hierarchical deterministic extended key magics
+		HDPublicKeyID:  [4]byte{0x04, 0x35, 0x87, 0xcf}, // starts with tpub
+		HDPrivateKeyID: [4]byte{0x04, 0x35, 0x83, 0x94}, // starts with tprv
+
+		HDCoinType: 1,
+	}
+
+	// RegtestParams are the params for a local
+	// regression test network.
+	RegtestParams = &chaincfg.Params{
+		Name:        "regtest",
+		Net:         regtestMagic,
+		DefaultPort: "19555",
+		GenesisHash: mustHash(RegtestGenesisBlockIdentifier.Hash),
+
+		CoinbaseMaturity: 100, // nolint:gomnd
+
+		// Human-readable part for Bech32 encoded segwit addresses (bcrt1...)
+		Bech32HRPSegwit: "bcrt",
+
+		// Address encoding magics
+		PubKeyHashAddrID: 0x6f, // starts with m or n
+		ScriptHashAddrID: 0xc4, // starts with 2
+		PrivateKeyID:     0xef, // starts with 9 (uncompressed) or c (compressed)
+
+		// BIP32 hierarchical deterministic extended key magics
+		HDPublicKeyID:  [4]byte{0x04, 0x35, 0x87, 0xcf}, // starts with tpub
+		HDPrivateKeyID: [4]byte{0x04, 0x35, 0x83, 0x94}, // starts with tprv
+
+		HDCoinType: 1,
+	}
+
+	// DevnetParams are the params for a private development
+	// network, which uses the address encodings of testnet.
+	// Devnets don't have a well-known genesis block, so the
+	// GenesisHash of a copy is set by the configuration.
+	DevnetParams = &chaincfg.Params{
+		Name:        "devnet",
+		Net:         devnetMagic,
+		DefaultPort: "20555",
+
+		CoinbaseMaturity: 100, // nolint:gomnd
+
+		// Human-readable part for Bech32 encoded segwit addresses (tf1...)
+		Bech32HRPSegwit: "tf",
+
+		// Address encoding magics
+		PubKeyHashAddrID: 0x0f, // starts with 7
+		ScriptHashAddrID: 0x80, // starts with t
+		PrivateKeyID:     0xef, // starts with 9 (uncompressed) or c (compressed)
+
+		// BIP32 hierarchical deterministic extended key magics
+		HDPublicKeyID:  [4]byte{0x04, 0x35, 0x87, 0xcf}, // starts with tpub
+		HDPrivateKeyID: [4]byte{0x04, 0x35, 0x83, 0x94}, // starts with tprv
+
+		HDCoinType: 1,
+	}
+)
+
+func init() {
+	// Registering the params makes btcutil aware of
+	// our address prefixes when decoding addresses.
+	for _, params := range []*chaincfg.Params{
+		MainnetParams,
+		TestnetParams,
+		RegtestParams,
+		DevnetParams,
+	} {
+		if err := chaincfg.Register(params); err != nil {
+			panic("failed to register " + params.Name + ": " + err.Error())
+		}
+	}
+}
+
+// mustHash parses a hard-coded block hash. It only
+// panics if one of the hashes above is malformed.
+func mustHash(hash string) *chainhash.Hash {
+	h, err := chainhash.NewHashFromStr(hash)
+	if err != nil {
+		panic(err)
+	}
+
+	return h
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package defichain
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParamsAddresses(t *testing.T) {
+	publicKey, err := hex.DecodeString(
+		"03d3d13e8180b10dfed0db4db9fb9013a5dcbdab64dff45d16310313c2929e71ac",
+	)
+	assert.NoError(t, err)
+	hash := btcutil.Hash160(publicKey)
+
+	tests := map[string]struct {
+		params *chaincfg.Params
+
+		witness    string
+		pubKeyHash string
+		scriptHash string
+	}{
+		"mainnet": {
+			params:     MainnetParams,
+			witness:    "df1q4mfg3kqm4c7f8j7tyy028fa4uaw7zdzy2n68qz",
+			pubKeyHash: "8X2EWXjWvTmyYFfKGj4AYXzLrtXHm3BaxT",
+			scriptHash: "dVMfQMCG3T94RThZ2w37TZazBD5CxWXtDz",
+		},
+		"testnet": {
+			params:     TestnetParams,
+			witness:    "tf1q4mfg3kqm4c7f8j7tyy028fa4uaw7zdzyerq5qx",
+			pubKeyHash: "7K1RZCqenvPM5xF4CU4D6AAyyNkTes3H4G",
+			scriptHash: "tnCapUXD2JkMVvzqxshDtKvt6Ns43HBJA7",
+		},
+		"regtest": {
+			params:     RegtestParams,
+			witness:    "bcrt1q4mfg3kqm4c7f8j7tyy028fa4uaw7zdzy2c2hq8",
+			pubKeyHash: "mwTL5dTJxEsTbZdNYk2oeCJWPoV1wd9uwD",
+			scriptHash: "2N9BbmrnoJaFw7QUjdQLtrrSNtgPCPh93MU",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			witness, err := btcutil.NewAddressWitnessPubKeyHash(hash, test.params)
+			assert.NoError(t, err)
+			assert.Equal(t, test.witness, witness.EncodeAddress())
+
+			pubKeyHash, err := btcutil.NewAddressPubKeyHash(hash, test.params)
+			assert.NoError(t, err)
+			assert.Equal(t, test.pubKeyHash, pubKeyHash.EncodeAddress())
+
+			scriptHash, err := btcutil.NewAddressScriptHashFromHash(hash, test.params)
+			assert.NoError(t, err)
+			assert.Equal(t, test.scriptHash, scriptHash.EncodeAddress())
+
+			// Ensure all addresses round-trip with the registered params.
+			for _, address := range []string{test.witness, test.pubKeyHash, test.scriptHash} {
+				decoded, err := btcutil.DecodeAddress(address, test.params)
+				assert.NoError(t, err)
+				assert.True(t, decoded.IsForNet(test.params))
+				assert.Equal(t, address, decoded.EncodeAddress())
+			}
+		})
+	}
+}
@@ -0,0 +1,628 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package defichain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// PSBT key types, as defined in
+// https://github.com/bitcoin/bips/blob/master/bip-0174.mediawiki
+const (
+	psbtGlobalUnsignedTx = 0x00
+
+	psbtInNonWitnessUtxo     = 0x00
+	psbtInWitnessUtxo        = 0x01
+	psbtInPartialSig         = 0x02
+	psbtInSighashType        = 0x03
+	psbtInRedeemScript       = 0x04
+	psbtInWitnessScript      = 0x05
+	psbtInBip32Derivation    = 0x06
+	psbtInFinalScriptSig     = 0x07
+	psbtInFinalScriptWitness = 0x08
+
+	psbtOutRedeemScript    = 0x00
+	psbtOutWitnessScript   = 0x01
+	psbtOutBip32Derivation = 0x02
+
+	// PsbtProprietaryType is the key type of
+	// proprietary PSBT fields.
+	PsbtProprietaryType = 0xFC
+
+	// maxPsbtFieldSize is the largest key or
+	// value of a PSBT field.
+	maxPsbtFieldSize = wire.MaxMessagePayload
+)
+
+var (
+	// PsbtMagic prefixes every serialized PSBT.
+	PsbtMagic = []byte{0x70, 0x73, 0x62, 0x74, 0xFF}
+
+	// ErrNotPsbt is returned when a byte slice
+	// does not start with PsbtMagic.
+	ErrNotPsbt = errors.New("not a partially signed transaction")
+)
+
+// Psbt is a partially signed transaction (BIP174). DeFiChain
+// uses the serialization format of Bitcoin. Fields we don't
+// interpret are preserved in Unknowns.
+type Psbt struct {
+	UnsignedTx *wire.MsgTx
+	Inputs     []*PsbtInput
+	Outputs    []*PsbtOutput
+	Unknowns   []*PsbtUnknown
+}
+
+// PsbtInput is the input map of a PSBT.
+type PsbtInput struct {
+	NonWitnessUtxo     *wire.MsgTx
+	WitnessUtxo        *wire.TxOut
+	PartialSigs        []*PartialSig
+	SighashType        txscript.SigHashType
+	RedeemScript       []byte
+	WitnessScript      []byte
+	Bip32Derivations   []*Bip32Derivation
+	FinalScriptSig     []byte
+	FinalScriptWitness wire.TxWitness
+	Unknowns           []*PsbtUnknown
+}
+
+// PsbtOutput is the output map of a PSBT.
+type PsbtOutput struct {
+	RedeemScript     []byte
+	WitnessScript    []byte
+	Bip32Derivations []*Bip32Derivation
+	Unknowns         []*PsbtUnknown
+}
+
+// PartialSig is the signature (with its sighash
+// type) of a public key.
+type PartialSig struct {
+	PublicKey []byte
+	Signature []byte
+}
+
+// Bip32Derivation is the BIP32 path of a public key
+// from the master key with MasterKeyFingerprint.
+type Bip32Derivation struct {
+	PublicKey            []byte
+	MasterKeyFingerprint uint32
+	Path                 []uint32
+}
+
+// PsbtUnknown is a PSBT field that is not interpreted.
+// Key includes the key type.
+type PsbtUnknown struct {
+	Key   []byte
+	Value []byte
+}
+
+// NewPsbt returns a PSBT with empty input and output
+// maps for an unsigned transaction.
+func NewPsbt(tx *wire.MsgTx) (*Psbt, error) {
+	for i, input := range tx.TxIn {
+		if len(input.SignatureScript) > 0 || len(input.Witness) > 0 {
+			return nil, fmt.Errorf("input %d of the unsigned transaction is signed", i)
+		}
+	}
+
+	p := &Psbt{
+		UnsignedTx: tx,
+		Inputs:     make([]*PsbtInput, len(tx.TxIn)),
+		Outputs:    make([]*PsbtOutput, len(tx.TxOut)),
+	}
+	for i := range p.Inputs {
+		p.Inputs[i] = &PsbtInput{}
+	}
+	for i := range p.Outputs {
+		p.Outputs[i] = &PsbtOutput{}
+	}
+
+	return p, nil
+}
+
+// ProprietaryKey returns the key of a proprietary
+// PSBT field.
+func ProprietaryKey(identifier string, subtype uint64, keyData []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(PsbtProprietaryType)
+	_ = wire.WriteVarBytes(&buf, 0, []byte(identifier))
+	_ = wire.WriteVarInt(&buf, 0, subtype)
+	buf.Write(keyData)
+
+	return buf.Bytes()
+}
+
+// Unknown returns the value of an unknown field
+// or nil if there is none.
+func (p *Psbt) Unknown(key []byte) []byte {
+	for _, unknown := range p.Unknowns {
+		if bytes.Equal(unknown.Key, key) {
+			return unknown.Value
+		}
+	}
+
+	return nil
+}
+
+// Extract returns the signed transaction of a PSBT
+// in which every input is finalized.
+func (p *Psbt) Extract() (*wire.MsgTx, error) {
+	tx := p.UnsignedTx.Copy()
+	for i, input := range p.Inputs {
+		if input.FinalScriptSig == nil && input.FinalScriptWitness == nil {
+			return nil, fmt.Errorf("input %d is not finalized", i)
+		}
+
+		tx.TxIn[i].SignatureScript = input.FinalScriptSig
+		tx.TxIn[i].Witness = input.FinalScriptWitness
+	}
+
+	return tx, nil
+}
+
+// DecodePsbt deserializes a PSBT.
+func DecodePsbt(b []byte) (*Psbt, error) {
+	if !bytes.HasPrefix(b, PsbtMagic) {
+		return nil, ErrNotPsbt
+	}
+
+	r := bytes.NewReader(b[len(PsbtMagic):])
+	globals, err := readPsbtMap(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unable to read global map", err)
+	}
+
+	p := &Psbt{}
+	for _, field := range globals {
+		if field.Key[0] != psbtGlobalUnsignedTx {
+			p.Unknowns = append(p.Unknowns, field)
+			continue
+		}
+
+		if len(field.Key) != 1 {
+			return nil, errors.New("invalid unsigned transaction key")
+		}
+
+		var tx wire.MsgTx
+		if err := tx.DeserializeNoWitness(bytes.NewReader(field.Value)); err != nil {
+			return nil, fmt.Errorf("%w: unable to deserialize unsigned transaction", err)
+		}
+
+		p.UnsignedTx = &tx
+	}
+
+	if p.UnsignedTx == nil {
+		return nil, errors.New("unsigned transaction is missing")
+	}
+
+	unknowns := p.Unknowns
+	p, err = NewPsbt(p.UnsignedTx)
+	if err != nil {
+		return nil, err
+	}
+	p.Unknowns = unknowns
+
+	for i := range p.Inputs {
+		fields, err := readPsbtMap(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unable to read input %d", err, i)
+		}
+
+		if err := p.Inputs[i].decode(fields, &p.UnsignedTx.TxIn[i].PreviousOutPoint); err != nil {
+			return nil, fmt.Errorf("%w: invalid input %d", err, i)
+		}
+	}
+
+	for i := range p.Outputs {
+		fields, err := readPsbtMap(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unable to read output %d", err, i)
+		}
+
+		if err := p.Outputs[i].decode(fields); err != nil {
+			return nil, fmt.Errorf("%w: invalid output %d", err, i)
+		}
+	}
+
+	if r.Len() > 0 {
+		return nil, fmt.Errorf("%d trailing bytes", r.Len())
+	}
+
+	return p, nil
+}
+
+func (i *PsbtInput) decode(fields []*PsbtUnknown, outpoint *wire.OutPoint) error {
+	for _, field := range fields {
+		keyData := field.Key[1:]
+
+		var err error
+		switch field.Key[0] {
+		case psbtInNonWitnessUtxo:
+			err = emptyKeyData(keyData)
+			if err == nil {
+				i.NonWitnessUtxo = &wire.MsgTx{}
+				err = i.NonWitnessUtxo.Deserialize(bytes.NewReader(field.Value))
+			}
+			if err == nil && i.NonWitnessUtxo.TxHash() != outpoint.Hash {
+				err = errors.New("non-witness utxo does not match the outpoint")
+			}
+		case psbtInWitnessUtxo:
+			err = emptyKeyData(keyData)
+			if err == nil {
+				i.WitnessUtxo, err = decodeTxOut(field.Value)
+			}
+		case psbtInPartialSig:
+			err = publicKeyData(keyData)
+			i.PartialSigs = append(i.PartialSigs, &PartialSig{
+				PublicKey: keyData,
+				Signature: field.Value,
+			})
+		case psbtInSighashType:
+			err = emptyKeyData(keyData)
+			if err == nil && len(field.Value) != 4 { // nolint:gomnd
+				err = errors.New("invalid sighash type")
+			}
+			if err == nil {
+				i.SighashType = txscript.SigHashType(binary.LittleEndian.Uint32(field.Value))
+			}
+		case psbtInRedeemScript:
+			err = emptyKeyData(keyData)
+			i.RedeemScript = field.Value
+		case psbtInWitnessScript:
+			err = emptyKeyData(keyData)
+			i.WitnessScript = field.Value
+		case psbtInBip32Derivation:
+			var derivation *Bip32Derivation
+			derivation, err = decodeBip32Derivation(keyData, field.Value)
+			i.Bip32Derivations = append(i.Bip32Derivations, derivation)
+		case psbtInFinalScriptSig:
+			err = emptyKeyData(keyData)
+			i.FinalScriptSig = field.Value
+		case psbtInFinalScriptWitness:
+			err = emptyKeyData(keyData)
+			if err == nil {
+				i.FinalScriptWitness, err = decodeWitness(field.Value)
+			}
+		default:
+			i.Unknowns = append(i.Unknowns, field)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (o *PsbtOutput) decode(fields []*PsbtUnknown) error {
+	for _, field := range fields {
+		keyData := field.Key[1:]
+
+		var err error
+		switch field.Key[0] {
+		case psbtOutRedeemScript:
+			err = emptyKeyData(keyData)
+			o.RedeemScript = field.Value
+		case psbtOutWitnessScript:
+			err = emptyKeyData(keyData)
+			o.WitnessScript = field.Value
+		case psbtOutBip32Derivation:
+			var derivation *Bip32Derivation
+			derivation, err = decodeBip32Derivation(keyData, field.Value)
+			o.Bip32Derivations = append(o.Bip32Derivations, derivation)
+		default:
+			o.Unknowns = append(o.Unknowns, field)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readPsbtMap reads the fields of a PSBT map up
+// to its separator. Duplicate keys are rejected.
+func readPsbtMap(r io.Reader) ([]*PsbtUnknown, error) {
+	fields := []*PsbtUnknown{}
+	keys := map[string]struct{}{}
+	for {
+		key, err := wire.ReadVarBytes(r, 0, maxPsbtFieldSize, "key")
+		if err != nil {
+			return nil, err
+		}
+
+		if len(key) == 0 {
+			return fields, nil
+		}
+
+		if _, ok := keys[string(key)]; ok {
+			return nil, fmt.Errorf("duplicate key %x", key)
+		}
+		keys[string(key)] = struct{}{}
+
+		value, err := wire.ReadVarBytes(r, 0, maxPsbtFieldSize, "value")
+		if err != nil {
+			return nil, err
+		}
+
+		fields = append(fields, &PsbtUnknown{Key: key, Value: value})
+	}
+}
+
+func emptyKeyData(keyData []byte) error {
+	if len(keyData) > 0 {
+		return errors.New("unexpected key data")
+	}
+
+	return nil
+}
+
+func publicKeyData(keyData []byte) error {
+	switch len(keyData) {
+	case 33, 65: // nolint:gomnd
+		return nil
+	default:
+		return fmt.Errorf("%x is not a public key", keyData)
+	}
+}
+
+func decodeTxOut(value []byte) (*wire.TxOut, error) {
+	r := bytes.NewReader(value)
+
+	var amount int64
+	if err := binary.Read(r, binary.LittleEndian, &amount); err != nil {
+		return nil, err
+	}
+
+	script, err := wire.ReadVarBytes(r, 0, maxPsbtFieldSize, "script")
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Len() > 0 {
+		return nil, errors.New("invalid witness utxo")
+	}
+
+	return wire.NewTxOut(amount, script), nil
+}
+
+func decodeWitness(value []byte) (wire.TxWitness, error) {
+	r := bytes.NewReader(value)
+	count, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if count > uint64(len(value)) {
+		return nil, errors.New("invalid witness")
+	}
+
+	witness := make(wire.TxWitness, count)
+	for i := range witness {
+		witness[i], err = wire.ReadVarBytes(r, 0, maxPsbtFieldSize, "witness")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if r.Len() > 0 {
+		return nil, errors.New("invalid witness")
+	}
+
+	return witness, nil
+}
+
+func decodeBip32Derivation(keyData []byte, value []byte) (*Bip32Derivation, error) {
+	if err := publicKeyData(keyData); err != nil {
+		return nil, err
+	}
+
+	if len(value) == 0 || len(value)%4 != 0 { // nolint:gomnd
+		return nil, errors.New("invalid bip32 derivation")
+	}
+
+	derivation := &Bip32Derivation{
+		PublicKey:            keyData,
+		MasterKeyFingerprint: binary.LittleEndian.Uint32(value),
+	}
+	for i := 4; i < len(value); i += 4 {
+		derivation.Path = append(derivation.Path, binary.LittleEndian.Uint32(value[i:]))
+	}
+
+	return derivation, nil
+}
+
+// EncodePsbt serializes a PSBT. The fields of each map
+// are serialized in the order of their keys.
+func EncodePsbt(p *Psbt) ([]byte, error) {
+	if p.UnsignedTx == nil ||
+		len(p.Inputs) != len(p.UnsignedTx.TxIn) ||
+		len(p.Outputs) != len(p.UnsignedTx.TxOut) {
+		return nil, errors.New("maps do not match the unsigned transaction")
+	}
+
+	var tx bytes.Buffer
+	if err := p.UnsignedTx.SerializeNoWitness(&tx); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.Write(PsbtMagic)
+
+	globals := append([]*PsbtUnknown{
+		{Key: []byte{psbtGlobalUnsignedTx}, Value: tx.Bytes()},
+	}, p.Unknowns...)
+	if err := writePsbtMap(&buf, globals); err != nil {
+		return nil, err
+	}
+
+	for _, input := range p.Inputs {
+		fields, err := input.encode()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := writePsbtMap(&buf, fields); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, output := range p.Outputs {
+		if err := writePsbtMap(&buf, output.encode()); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (i *PsbtInput) encode() ([]*PsbtUnknown, error) {
+	fields := []*PsbtUnknown{}
+	if i.NonWitnessUtxo != nil {
+		var tx bytes.Buffer
+		if err := i.NonWitnessUtxo.Serialize(&tx); err != nil {
+			return nil, err
+		}
+
+		fields = append(fields, &PsbtUnknown{Key: []byte{psbtInNonWitnessUtxo}, Value: tx.Bytes()})
+	}
+
+	if i.WitnessUtxo != nil {
+		var txOut bytes.Buffer
+		if err := wire.WriteTxOut(&txOut, 0, 0, i.WitnessUtxo); err != nil {
+			return nil, err
+		}
+
+		fields = append(fields, &PsbtUnknown{Key: []byte{psbtInWitnessUtxo}, Value: txOut.Bytes()})
+	}
+
+	for _, sig := range i.PartialSigs {
+		fields = append(fields, &PsbtUnknown{
+			Key:   append([]byte{psbtInPartialSig}, sig.PublicKey...),
+			Value: sig.Signature,
+		})
+	}
+
+	if i.SighashType != 0 {
+		value := make([]byte, 4) // nolint:gomnd
+		binary.LittleEndian.PutUint32(value, uint32(i.SighashType))
+		fields = append(fields, &PsbtUnknown{Key: []byte{psbtInSighashType}, Value: value})
+	}
+
+	fields = appendScript(fields, psbtInRedeemScript, i.RedeemScript)
+	fields = appendScript(fields, psbtInWitnessScript, i.WitnessScript)
+	fields = appendBip32Derivations(fields, psbtInBip32Derivation, i.Bip32Derivations)
+	fields = appendScript(fields, psbtInFinalScriptSig, i.FinalScriptSig)
+
+	if i.FinalScriptWitness != nil {
+		var witness bytes.Buffer
+		if err := wire.WriteVarInt(&witness, 0, uint64(len(i.FinalScriptWitness))); err != nil {
+			return nil, err
+		}
+
+		for _, item := range i.FinalScriptWitness {
+			if err := wire.WriteVarBytes(&witness, 0, item); err != nil {
+				return nil, err
+			}
+		}
+
+		fields = append(fields, &PsbtUnknown{
+			Key:   []byte{psbtInFinalScriptWitness},
+			Value: witness.Bytes(),
+		})
+	}
+
+	return append(fields, i.Unknowns...), nil
+}
+
+func (o *PsbtOutput) encode() []*PsbtUnknown {
+	fields := []*PsbtUnknown{}
+	fields = appendScript(fields, psbtOutRedeemScript, o.RedeemScript)
+	fields = appendScript(fields, psbtOutWitnessScript, o.WitnessScript)
+	fields = appendBip32Derivations(fields, psbtOutBip32Derivation, o.Bip32Derivations)
+
+	return append(fields, o.Unknowns...)
+}
+
+func appendScript(fields []*PsbtUnknown, keyType byte, script []byte) []*PsbtUnknown {
+	if script == nil {
+		return fields
+	}
+
+	return append(fields, &PsbtUnknown{Key: []byte{keyType}, Value: script})
+}
+
+func appendBip32Derivations(
+	fields []*PsbtUnknown,
+	keyType byte,
+	derivations []*Bip32Derivation,
+) []*PsbtUnknown {
+	for _, derivation := range derivations {
+		value := make([]byte, 4*(len(derivation.Path)+1)) // nolint:gomnd
+		binary.LittleEndian.PutUint32(value, derivation.MasterKeyFingerprint)
+		for i, index := range derivation.Path {
+			binary.LittleEndian.PutUint32(value[4*(i+1):], index)
+		}
+
+		fields = append(fields, &PsbtUnknown{
+			Key:   append([]byte{keyType}, derivation.PublicKey...),
+			Value: value,
+		})
+	}
+
+	return fields
+}
+
+// writePsbtMap writes the fields of a PSBT map (sorted
+// by key) followed by its separator.
+func writePsbtMap(w io.Writer, fields []*PsbtUnknown) error {
+	sorted := make([]*PsbtUnknown, len(fields))
+	copy(sorted, fields)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i].Key, sorted[j].Key) < 0
+	})
+
+	for i, field := range sorted {
+		if len(field.Key) == 0 {
+			return errors.New("empty key")
+		}
+
+		if i > 0 && bytes.Equal(sorted[i-1].Key, field.Key) {
+			return fmt.Errorf("duplicate key %x", field.Key)
+		}
+
+		if err := wire.WriteVarBytes(w, 0, field.Key); err != nil {
+			return err
+		}
+
+		if err := wire.WriteVarBytes(w, 0, field.Value); err != nil {
+			return err
+		}
+	}
+
+	return wire.WriteVarInt(w, 0, 0)
+}
@@ -0,0 +1,202 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package defichain
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+func psbtTx(t *testing.T) *wire.MsgTx {
+	hash, err := chainhash.NewHash(forceDecode(t, strings.Repeat("11", 32)))
+	assert.NoError(t, err)
+
+	tx := wire.NewMsgTx(2) // nolint:gomnd
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(hash, 0), []byte{}, nil))
+	tx.AddTxOut(wire.NewTxOut(1000, forceDecode(t, "0014"+strings.Repeat("22", 20))))
+
+	return tx
+}
+
+func forceDecode(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	assert.NoError(t, err)
+
+	return b
+}
+
+func TestEncodePsbt(t *testing.T) {
+	p, err := NewPsbt(psbtTx(t))
+	assert.NoError(t, err)
+
+	p.Inputs[0].WitnessUtxo = wire.NewTxOut(2000, forceDecode(t, "0014"+strings.Repeat("33", 20)))
+	p.Inputs[0].SighashType = txscript.SigHashAll
+	p.Outputs[0].Bip32Derivations = []*Bip32Derivation{
+		{
+			PublicKey:            forceDecode(t, "02"+strings.Repeat("44", 32)),
+			MasterKeyFingerprint: 0x3fb34dd3,
+			Path:                 []uint32{0x80000054, 0},
+		},
+	}
+
+	b, err := EncodePsbt(p)
+	assert.NoError(t, err)
+
+	tx := "02000000" + "01" + strings.Repeat("11", 32) + "00000000" + "00" + "ffffffff" +
+		"01" + "e803000000000000" + "16" + "0014" + strings.Repeat("22", 20) + "00000000"
+	assert.Equal(
+		t,
+		"70736274ff"+
+			"0100"+"52"+tx+"00"+
+			"0101"+"1f"+"d007000000000000"+"16"+"0014"+strings.Repeat("33", 20)+
+			"0103"+"04"+"01000000"+"00"+
+			"22"+"02"+"02"+strings.Repeat("44", 32)+"0c"+"d34db33f"+"54000080"+"00000000"+"00",
+		hex.EncodeToString(b),
+	)
+
+	decoded, err := DecodePsbt(b)
+	assert.NoError(t, err)
+	assert.Equal(t, p, decoded)
+}
+
+func TestPsbtRoundTrip(t *testing.T) {
+	previousTx := wire.NewMsgTx(2) // nolint:gomnd
+	previousTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, []byte{0x51}, nil))
+	previousTx.AddTxOut(wire.NewTxOut(2000, forceDecode(t, "a914"+strings.Repeat("55", 20)+"87")))
+
+	tx := psbtTx(t)
+	tx.TxIn[0].PreviousOutPoint.Hash = previousTx.TxHash()
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, 1), []byte{}, nil))
+
+	p, err := NewPsbt(tx)
+	assert.NoError(t, err)
+
+	publicKey := forceDecode(t, "03"+strings.Repeat("66", 32))
+	p.Inputs[0] = &PsbtInput{
+		NonWitnessUtxo: previousTx,
+		PartialSigs:    []*PartialSig{{PublicKey: publicKey, Signature: []byte{0x30, 0x01}}},
+		SighashType:    txscript.SigHashAll,
+		RedeemScript:   []byte{0x51},
+		Bip32Derivations: []*Bip32Derivation{
+			{PublicKey: publicKey, MasterKeyFingerprint: 1, Path: []uint32{1, 2}},
+		},
+		Unknowns: []*PsbtUnknown{{Key: []byte{0xF0}, Value: []byte{0x01}}},
+	}
+	p.Inputs[1] = &PsbtInput{
+		WitnessUtxo:        wire.NewTxOut(3000, forceDecode(t, "0020"+strings.Repeat("77", 32))),
+		WitnessScript:      []byte{0x51},
+		FinalScriptSig:     []byte{},
+		FinalScriptWitness: wire.TxWitness{{}, {0x01, 0x02}},
+	}
+	p.Outputs[0].RedeemScript = []byte{0x52}
+	p.Outputs[0].WitnessScript = []byte{0x53}
+	p.Unknowns = []*PsbtUnknown{
+		{Key: ProprietaryKey("defi", 0, nil), Value: []byte("[]")},
+	}
+
+	b, err := EncodePsbt(p)
+	assert.NoError(t, err)
+
+	decoded, err := DecodePsbt(b)
+	assert.NoError(t, err)
+	assert.Equal(t, p, decoded)
+	assert.Equal(t, []byte("[]"), decoded.Unknown(ProprietaryKey("defi", 0, nil)))
+	assert.Nil(t, decoded.Unknown(ProprietaryKey("defi", 1, nil)))
+
+	// Only finalized PSBTs can be extracted
+	_, err = decoded.Extract()
+	assert.EqualError(t, err, "input 0 is not finalized")
+
+	decoded.Inputs[0].FinalScriptSig = []byte{0x51}
+	extracted, err := decoded.Extract()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x51}, extracted.TxIn[0].SignatureScript)
+	assert.Equal(t, wire.TxWitness{{}, {0x01, 0x02}}, extracted.TxIn[1].Witness)
+	assert.Nil(t, p.UnsignedTx.TxIn[1].Witness)
+}
+
+func TestDecodePsbt(t *testing.T) {
+	tx := "02000000" + "01" + strings.Repeat("11", 32) + "00000000" + "00" + "ffffffff" +
+		"01" + "e803000000000000" + "16" + "0014" + strings.Repeat("22", 20) + "00000000"
+	signedTx := "02000000" + "01" + strings.Repeat("11", 32) + "00000000" + "0151" + "ffffffff" +
+		"01" + "e803000000000000" + "16" + "0014" + strings.Repeat("22", 20) + "00000000"
+
+	tests := map[string]struct {
+		psbt string
+		err  string
+	}{
+		"valid": {
+			psbt: "70736274ff" + "0100" + "52" + tx + "00" + "00" + "00",
+		},
+		"not a psbt": {
+			psbt: "0100" + "52" + tx + "00" + "00" + "00",
+			err:  ErrNotPsbt.Error(),
+		},
+		"missing unsigned transaction": {
+			psbt: "70736274ff" + "00",
+			err:  "unsigned transaction is missing",
+		},
+		"signed unsigned transaction": {
+			psbt: "70736274ff" + "0100" + "53" + signedTx + "00" + "00" + "00",
+			err:  "input 0 of the unsigned transaction is signed",
+		},
+		"duplicate key": {
+			psbt: "70736274ff" + "0100" + "52" + tx + "00" + "020300" + "0401000000" +
+				"020300" + "0401000000" + "00" + "00",
+			err: "duplicate key 0300: unable to read input 0",
+		},
+		"invalid key data": {
+			psbt: "70736274ff" + "0100" + "52" + tx + "00" + "020400" + "0151" + "00" + "00",
+			err:  "unexpected key data: invalid input 0",
+		},
+		"invalid public key": {
+			psbt: "70736274ff" + "0100" + "52" + tx + "00" + "00" + "020201" + "0400000000" + "00",
+			err:  "01 is not a public key: invalid output 0",
+		},
+		"missing output": {
+			psbt: "70736274ff" + "0100" + "52" + tx + "00" + "00",
+			err:  "EOF: unable to read output 0",
+		},
+		"trailing bytes": {
+			psbt: "70736274ff" + "0100" + "52" + tx + "00" + "00" + "00" + "00",
+			err:  "1 trailing bytes",
+		},
+		"non-witness utxo mismatch": {
+			psbt: "70736274ff" + "0100" + "52" + tx + "00" + "0100" + "52" + tx + "00" + "00",
+			err:  "non-witness utxo does not match the outpoint: invalid input 0",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, err := DecodePsbt(forceDecode(t, test.psbt))
+			if len(test.err) > 0 {
+				assert.EqualError(t, err, test.err)
+				assert.Nil(t, p)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Len(t, p.Inputs, 1)
+			assert.Len(t, p.Outputs, 1)
+		})
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package defichain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/coinbase/rosetta-sdk-go/types"
+)
+
+const (
+	// NativeTokenID is the token id of DFI. Balances of
+	// the native token are reported in the network
+	// currency (DFI/tDFI) without any metadata.
+	NativeTokenID = uint32(0)
+
+	// TokenIDMetadataKey is the *types.Currency metadata
+	// key that holds the id of a DeFiChain Standard Token.
+	TokenIDMetadataKey = "token_id"
+)
+
+var (
+	// ErrUnknownToken is returned when a token id
+	// is not known by defid.
+	ErrUnknownToken = errors.New("unknown token")
+
+	// ErrInvalidTokenCurrency is returned when a
+	// *types.Currency does not identify a token.
+	ErrInvalidTokenCurrency = errors.New("invalid token currency")
+)
+
+// Token is a DeFiChain Standard Token (DST) or DeFiChain
+// Asset Token (DAT) as returned by `listtokens`.
+type Token struct {
+	Symbol    string `json:"symbol"`
+	SymbolKey string `json:"symbolKey"`
+	Name      string `json:"name"`
+	Decimal   int32  `json:"decimal"`
+	Mintable  bool   `json:"mintable"`
+	Tradeable bool   `json:"tradeable"`
+	IsDAT     bool   `json:"isDAT"`
+	IsLPS     bool   `json:"isLPS"`
+	Finalized bool   `json:"finalized"`
+}
+
+// TokenRegistry maps DeFiChain token ids to the
+// *types.Currency used to represent them. It is safe
+// for concurrent use.
+type TokenRegistry struct {
+	native *types.Currency
+
+	currencies map[uint32]*types.Currency
+	mutex      sync.RWMutex
+}
+
+// NewTokenRegistry returns a new *TokenRegistry that
+// represents NativeTokenID with the native currency.
+func NewTokenRegistry(native *types.Currency) *TokenRegistry {
+	return &TokenRegistry{
+		native: native,
+		currencies: map[uint32]*types.Currency{
+			NativeTokenID: native,
+		},
+	}
+}
+
+// TokenCurrency returns the *types.Currency of a token.
+// The symbol key is used as symbol because, unlike the
+// symbol, it is unique across DATs, DSTs and LP tokens
+// (ex: BTC, DUSD, BTC-DFI, FOO#128).
+func TokenCurrency(tokenID uint32, token *Token) *types.Currency {
+	symbol := token.SymbolKey
+	if len(symbol) == 0 {
+		symbol = token.Symbol
+	}
+
+	return &types.Currency{
+		Symbol:   symbol,
+		Decimals: token.Decimal,
+		Metadata: map[string]interface{}{
+			TokenIDMetadataKey: tokenID,
+		},
+	}
+}
+
+// Register adds a token to the registry. The native
+// token cannot be overwritten.
+func (r *TokenRegistry) Register(tokenID uint32, token *Token) {
+	if tokenID == NativeTokenID {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.currencies[tokenID] = TokenCurrency(tokenID, token)
+}
+
+// Currency returns the *types.Currency of a token id
+// and a boolean indicating if it was registered.
+func (r *TokenRegistry) Currency(tokenID uint32) (*types.Currency, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	currency, ok := r.currencies[tokenID]
+	return currency, ok
+}
+
+// SymbolTokenID returns the id of the token whose
+// currency has symbol and a boolean indicating if
+// it was registered.
+func (r *TokenRegistry) SymbolTokenID(symbol string) (uint32, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for tokenID, currency := range r.currencies {
+		if currency.Symbol == symbol {
+			return tokenID, true
+		}
+	}
+
+	return 0, false
+}
+
+// Currencies returns all registered currencies
+// sorted by token id.
+func (r *TokenRegistry) Currencies() []*types.Currency {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	tokenIDs := make([]uint32, 0, len(r.currencies))
+	for tokenID := range r.currencies {
+		tokenIDs = append(tokenIDs, tokenID)
+	}
+	sort.Slice(tokenIDs, func(i, j int) bool { return tokenIDs[i] < tokenIDs[j] })
+
+	currencies := make([]*types.Currency, len(tokenIDs))
+	for i, tokenID := range tokenIDs {
+		currencies[i] = r.currencies[tokenID]
+	}
+
+	return currencies
+}
+
+// TokenID returns the token id represented by
+// a *types.Currency.
+func (r *TokenRegistry) TokenID(currency *types.Currency) (uint32, error) {
+	if currency == nil {
+		return 0, fmt.Errorf("%w: currency is nil", ErrInvalidTokenCurrency)
+	}
+
+	if types.Hash(currency) == types.Hash(r.native) {
+		return NativeTokenID, nil
+	}
+
+	rawTokenID, ok := currency.Metadata[TokenIDMetadataKey]
+	if !ok {
+		return 0, fmt.Errorf(
+			"%w: %s is missing %s metadata",
+			ErrInvalidTokenCurrency,
+			currency.Symbol,
+			TokenIDMetadataKey,
+		)
+	}
+
+	tokenID, err := parseTokenID(rawTokenID)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidTokenCurrency, err.Error())
+	}
+
+	if tokenID == NativeTokenID {
+		return 0, fmt.Errorf(
+			"%w: token %d must use %s",
+			ErrInvalidTokenCurrency,
+			NativeTokenID,
+			r.native.Symbol,
+		)
+	}
+
+	if registered, ok := r.Currency(tokenID); ok &&
+		types.Hash(registered) != types.Hash(currency) {
+		return 0, fmt.Errorf(
+			"%w: expected %s but got %s",
+			ErrInvalidTokenCurrency,
+			types.PrintStruct(registered),
+			types.PrintStruct(currency),
+		)
+	}
+
+	return tokenID, nil
+}
+
+// parseTokenID converts token_id metadata into a
+// uint32. JSON requests decode numbers as float64 while
+// values read from storage may use any integer type.
+func parseTokenID(rawTokenID interface{}) (uint32, error) {
+	var tokenID int64
+	switch v := rawTokenID.(type) {
+	case float64:
+		if v != math.Trunc(v) || v < 0 || v > math.MaxUint32 {
+			return 0, fmt.Errorf("token id %f is invalid", v)
+		}
+		tokenID = int64(v)
+	case json.Number:
+		parsed, err := v.Int64()
+		if err != nil {
+			return 0, fmt.Errorf("%w: unable to parse token id %s", err, v)
+		}
+		tokenID = parsed
+	case string:
+		parsed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: unable to parse token id %s", err, v)
+		}
+		tokenID = parsed
+	default:
+		value := reflect.ValueOf(rawTokenID)
+		switch value.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			tokenID = value.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if value.Uint() > math.MaxUint32 {
+				return 0, fmt.Errorf("token id %d is out of range", value.Uint())
+			}
+			tokenID = int64(value.Uint())
+		default:
+			return 0, fmt.Errorf("token id %v has unsupported type %T", v, v)
+		}
+	}
+
+	if tokenID < 0 || tokenID > math.MaxUint32 {
+		return 0, fmt.Errorf("token id %d is out of range", tokenID)
+	}
+
+	return uint32(tokenID), nil
+}
@@ -0,0 +1,137 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package defichain
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenRegistry(t *testing.T) {
+	registry := NewTokenRegistry(TestnetCurrency)
+	registry.Register(0, &Token{SymbolKey: "DFI", Decimal: 8})
+	registry.Register(128, &Token{Symbol: "FOO", SymbolKey: "FOO#128", Decimal: 8})
+	registry.Register(2, &Token{Symbol: "BTC", Decimal: 8})
+
+	btc := &types.Currency{
+		Symbol:   "BTC",
+		Decimals: 8,
+		Metadata: map[string]interface{}{TokenIDMetadataKey: uint32(2)},
+	}
+	foo := &types.Currency{
+		Symbol:   "FOO#128",
+		Decimals: 8,
+		Metadata: map[string]interface{}{TokenIDMetadataKey: uint32(128)},
+	}
+
+	native, ok := registry.Currency(0)
+	assert.True(t, ok)
+	assert.Equal(t, TestnetCurrency, native)
+
+	_, ok = registry.Currency(3)
+	assert.False(t, ok)
+
+	assert.Equal(t, []*types.Currency{TestnetCurrency, btc, foo}, registry.Currencies())
+
+	// Currencies decoded from JSON requests use float64 metadata.
+	var requestCurrency types.Currency
+	assert.NoError(t, json.Unmarshal(
+		[]byte(`{"symbol":"FOO#128","decimals":8,"metadata":{"token_id":128}}`),
+		&requestCurrency,
+	))
+
+	tests := map[string]struct {
+		currency *types.Currency
+
+		tokenID uint32
+		err     string
+	}{
+		"native": {
+			currency: TestnetCurrency,
+			tokenID:  0,
+		},
+		"registered": {
+			currency: btc,
+			tokenID:  2,
+		},
+		"json request": {
+			currency: &requestCurrency,
+			tokenID:  128,
+		},
+		"unregistered": {
+			currency: &types.Currency{
+				Symbol:   "ETH",
+				Decimals: 8,
+				Metadata: map[string]interface{}{TokenIDMetadataKey: "1"},
+			},
+			tokenID: 1,
+		},
+		"nil currency": {
+			err: "currency is nil",
+		},
+		"missing metadata": {
+			currency: &types.Currency{Symbol: "BTC", Decimals: 8},
+			err:      "BTC is missing token_id metadata",
+		},
+		"native token id": {
+			currency: &types.Currency{
+				Symbol:   "DFI",
+				Decimals: 8,
+				Metadata: map[string]interface{}{TokenIDMetadataKey: 0},
+			},
+			err: "token 0 must use tDFI",
+		},
+		"negative token id": {
+			currency: &types.Currency{
+				Symbol:   "BTC",
+				Decimals: 8,
+				Metadata: map[string]interface{}{TokenIDMetadataKey: -1},
+			},
+			err: "token id -1 is out of range",
+		},
+		"fractional token id": {
+			currency: &types.Currency{
+				Symbol:   "BTC",
+				Decimals: 8,
+				Metadata: map[string]interface{}{TokenIDMetadataKey: 2.5},
+			},
+			err: "token id 2.500000 is invalid",
+		},
+		"mismatched symbol": {
+			currency: &types.Currency{
+				Symbol:   "ETH",
+				Decimals: 8,
+				Metadata: map[string]interface{}{TokenIDMetadataKey: 2},
+			},
+			err: ErrInvalidTokenCurrency.Error(),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			tokenID, err := registry.TokenID(test.currency)
+			if test.err != "" {
+				assert.Contains(t, err.Error(), test.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.tokenID, tokenID)
+		})
+	}
+}
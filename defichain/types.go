@@ -15,11 +15,12 @@
 package defichain
 
 import (
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 
-	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/coinbase/rosetta-sdk-go/types"
 )
 
@@ -35,6 +36,14 @@ const (
 	// in TestnetNetworkIdentifier.
 	TestnetNetwork string = "Testnet3"
 
+	// RegtestNetwork is the value of the network
+	// in RegtestNetworkIdentifier.
+	RegtestNetwork string = "Regtest"
+
+	// DevnetNetwork is the value of the network
+	// in DevnetNetworkIdentifier.
+	DevnetNetwork string = "Devnet"
+
 	// Decimals is the decimals value
 	// used in Currency.
 	Decimals = 8
@@ -55,15 +64,76 @@ const (
 	// Coinbase.
 	CoinbaseOpType = "COINBASE"
 
+	// UtxosToAccountOpType is used to describe
+	// a credit to account balances funded by
+	// DFI burned in a UtxosToAccount transaction.
+	UtxosToAccountOpType = "UTXOS_TO_ACCOUNT"
+
+	// AccountToUtxosOpType is used to describe
+	// a debit from account balances that mints
+	// UTXOs in an AccountToUtxos transaction.
+	AccountToUtxosOpType = "ACCOUNT_TO_UTXOS"
+
+	// AccountTransferOpType is used to describe
+	// a debit or credit of account balances in
+	// an AccountToAccount or AnyAccountsToAccounts
+	// transaction.
+	AccountTransferOpType = "ACCOUNT_TRANSFER"
+
+	// MintTokenOpType is used to describe a
+	// credit of account balances in a MintToken
+	// transaction.
+	MintTokenOpType = "MINT_TOKEN"
+
+	// PoolSwapOpType is used to describe a debit
+	// or credit of account balances in a PoolSwap
+	// transaction.
+	PoolSwapOpType = "POOL_SWAP"
+
+	// AddPoolLiquidityOpType is used to describe
+	// a debit or credit of account balances in an
+	// AddPoolLiquidity transaction.
+	AddPoolLiquidityOpType = "ADD_POOL_LIQUIDITY"
+
+	// RemovePoolLiquidityOpType is used to describe
+	// a debit or credit of account balances in a
+	// RemovePoolLiquidity transaction.
+	RemovePoolLiquidityOpType = "REMOVE_POOL_LIQUIDITY"
+
+	// AccountChangeOpType is used to describe a
+	// debit or credit of account balances by any
+	// other custom transaction.
+	AccountChangeOpType = "ACCOUNT_CHANGE"
+
+	// AccountRewardOpType is used to describe a
+	// change of account balances that isn't caused
+	// by a transaction of the block (ex: liquidity
+	// pool rewards and commissions). These operations
+	// are added to the coinbase transaction.
+	AccountRewardOpType = "ACCOUNT_REWARD"
+
+	// AccountBalancesSubAccount is the
+	// SubAccountIdentifier.Address under which
+	// account balances (as opposed to UTXOs)
+	// of an address are tracked.
+	AccountBalancesSubAccount = "account"
+
 	// SuccessStatus is the status of all
 	// DeFiChain operations because anything
-	// on-chain is considered successful.
+	// on-chain is considered successful, except
+	// custom transactions rejected by defid.
 	SuccessStatus = "SUCCESS"
 
+	// FailureStatus is the status of the account
+	// balance operations of a custom transaction
+	// that was included in a block but rejected
+	// by defid (it didn't change any account
+	// balance).
+	FailureStatus = "FAILURE"
+
 	// SkippedStatus is the status of all
 	// operations that are skipped because
-	// of BIP-30. You can read more about these
-	// types of operations in BIP-30.
+	// they are covered by an Exemption.
 	SkippedStatus = "SKIPPED"
 
 	// TransactionHashLength is the length
@@ -76,14 +146,35 @@ const (
 	NullData = "nulldata"
 )
 
-// Fee estimate constants
+// Fee estimate constants (sizes are in bytes, witness
+// data is discounted by WitnessScaleFactor)
 // Source: https://bitcoinops.org/en/tools/calc-size/
 const (
-	MinFeeRate            = float64(0.00001) // nolint:gomnd
-	TransactionOverhead   = 12               // 4 version, 2 segwit flag, 1 vin, 1 vout, 4 lock time
-	InputSize             = 68               // 4 prev index, 32 prev hash, 4 sequence, 1 script size, ~27 script witness
-	OutputOverhead        = 9                // 8 value, 1 script size
-	P2PKHScriptPubkeySize = 25               // P2PKH size
+	MinFeeRate              = float64(0.00001) // nolint:gomnd
+	WitnessScaleFactor      = 4                // weight of a non-witness byte
+	TransactionOverhead     = 8                // 4 version, 4 lock time (+ input and output counts)
+	SegwitFlagWeight        = 2                // 1 marker, 1 flag (in weight units)
+	InputOverhead           = 40               // 32 prev hash, 4 prev index, 4 sequence (+ script sig size)
+	SignatureSize           = 72               // <= 71 DER signature (low S), 1 sighash type
+	P2PKHScriptSigSize      = 107              // 1 push, signature, 1 push, 33 public key
+	P2SHP2WPKHScriptSigSize = 23               // 1 push, 22 P2WPKH script
+	P2WPKHWitnessSize       = 108              // 1 item count, 1 push, signature, 1 push, 33 public key
+	OutputOverhead          = 8                // 8 value (+ script size)
+	DustThreshold           = 546              // smallest change output created by coin selection
+)
+
+// EstimateMode is the estimate_mode of an estimatesmartfee
+// request.
+type EstimateMode string
+
+const (
+	// EconomicalEstimateMode estimates a fee rate that
+	// is more responsive to short-term drops in demand.
+	EconomicalEstimateMode EstimateMode = "economical"
+
+	// ConservativeEstimateMode estimates a fee rate that
+	// is less likely to be insufficient.
+	ConservativeEstimateMode EstimateMode = "conservative"
 )
 
 var (
@@ -92,9 +183,6 @@ var (
 		Hash: "279b1a87aedc7b9471d4ad4e5f12967ab6259926cd097ade188dfcf22ebfe72a",
 	}
 
-	// MainnetParams are the params for mainnet.
-	MainnetParams = &chaincfg.MainNetParams
-
 	// MainnetCurrency is the *types.Currency for mainnet.
 	MainnetCurrency = &types.Currency{
 		Symbol:   "DFI",
@@ -106,20 +194,44 @@ var (
 		Hash: "034ac8c88a1a9b846750768c1ad6f295bc4d0dc4b9b418aee5c0ebd609be8f90",
 	}
 
-	// TestnetParams are the params for testnet.
-	TestnetParams = &chaincfg.TestNet3Params
-
 	// TestnetCurrency is the *types.Currency for testnet.
 	TestnetCurrency = &types.Currency{
 		Symbol:   "tDFI",
 		Decimals: Decimals,
 	}
 
+	// RegtestGenesisBlockIdentifier is the genesis block for regtest.
+	// Source: https://github.com/DeFiCh/ain/blob/master/src/chainparams.cpp
+	RegtestGenesisBlockIdentifier = &types.BlockIdentifier{
+		Hash: "0091f00915b263d08eba2091ba70ba40cea75242b3f51ea29f4a1b8d7814cd01",
+	}
+
+	// RegtestCurrency is the *types.Currency for regtest.
+	RegtestCurrency = &types.Currency{
+		Symbol:   "rDFI",
+		Decimals: Decimals,
+	}
+
+	// DevnetCurrency is the *types.Currency for devnet.
+	DevnetCurrency = &types.Currency{
+		Symbol:   "devDFI",
+		Decimals: Decimals,
+	}
+
 	// OperationTypes are all supported operation.Types.
 	OperationTypes = []string{
 		InputOpType,
 		OutputOpType,
 		CoinbaseOpType,
+		UtxosToAccountOpType,
+		AccountToUtxosOpType,
+		AccountTransferOpType,
+		MintTokenOpType,
+		PoolSwapOpType,
+		AddPoolLiquidityOpType,
+		RemovePoolLiquidityOpType,
+		AccountChangeOpType,
+		AccountRewardOpType,
 	}
 
 	// OperationStatuses are all supported operation.Status.
@@ -132,6 +244,10 @@ var (
 			Status:     SkippedStatus,
 			Successful: false,
 		},
+		{
+			Status:     FailureStatus,
+			Successful: false,
+		},
 	}
 )
 
@@ -177,6 +293,60 @@ type PeerInfo struct {
 	SyncedHeaders  int64  `json:"synced_headers"`
 }
 
+// MempoolAcceptResult is the result of a `testmempoolaccept`
+// request for a single transaction.
+type MempoolAcceptResult struct {
+	TxID         string `json:"txid"`
+	Allowed      bool   `json:"allowed"`
+	RejectReason string `json:"reject-reason"`
+
+	// Vsize and Fees are only populated if the
+	// transaction is allowed.
+	Vsize int64              `json:"vsize"`
+	Fees  *MempoolAcceptFees `json:"fees"`
+}
+
+// MempoolAcceptFees are the fees (in DFI) of a
+// transaction accepted by `testmempoolaccept`.
+type MempoolAcceptFees struct {
+	Base json.Number `json:"base"`
+}
+
+// MempoolEntry is a transaction in the mempool of defid
+// (returned by `getmempoolentry` and a verbose
+// `getrawmempool`). Size is the virtual size reported by
+// versions of defid that don't report Vsize. Time is the
+// UNIX time and Height the block height at which the
+// transaction entered the mempool.
+type MempoolEntry struct {
+	Size   int64 `json:"size"`
+	Vsize  int64 `json:"vsize"`
+	Time   int64 `json:"time"`
+	Height int64 `json:"height"`
+
+	DescendantCount int64 `json:"descendantcount"`
+	DescendantSize  int64 `json:"descendantsize"`
+	AncestorCount   int64 `json:"ancestorcount"`
+	AncestorSize    int64 `json:"ancestorsize"`
+
+	Fees              *MempoolEntryFees `json:"fees"`
+	Depends           []string          `json:"depends"`
+	SpentBy           []string          `json:"spentby"`
+	Bip125Replaceable bool              `json:"bip125-replaceable"`
+}
+
+// MempoolEntryFees are the fees (in DFI) of a *MempoolEntry.
+// Modified includes the fee deltas of `prioritisetransaction`.
+// Ancestor and Descendant are the modified fees of the
+// transaction and all of its in-mempool ancestors or
+// descendants.
+type MempoolEntryFees struct {
+	Base       json.Number `json:"base"`
+	Modified   json.Number `json:"modified"`
+	Ancestor   json.Number `json:"ancestor"`
+	Descendant json.Number `json:"descendant"`
+}
+
 // Block is a raw DeFiChain block (with verbosity == 2).
 type Block struct {
 	Hash              string  `json:"hash"`
@@ -238,7 +408,10 @@ type Transaction struct {
 	Outputs []*Output `json:"vout"`
 }
 
-// Metadata returns the metadata for a transaction.
+// Metadata returns the metadata for a transaction. A
+// custom transaction that can't be decoded was still
+// accepted by defid, so the decoding error is recorded
+// in CustomTxError instead of being returned.
 func (t Transaction) Metadata() (map[string]interface{}, error) {
 	m := &TransactionMetadata{
 		Size:     t.Size,
@@ -248,17 +421,46 @@ func (t Transaction) Metadata() (map[string]interface{}, error) {
 		Weight:   t.Weight,
 	}
 
+	customTx, err := t.CustomTx()
+	switch {
+	case err == nil:
+		m.CustomTx = customTx
+	case !errors.Is(err, ErrNotCustomTx):
+		m.CustomTxError = err.Error()
+	}
+
 	return types.MarshalMap(m)
 }
 
+// CustomTx decodes the DeFiChain custom transaction
+// carried by the transaction. defid only recognizes
+// a DfTx payload in the first output.
+func (t Transaction) CustomTx() (*CustomTx, error) {
+	if len(t.Outputs) == 0 ||
+		t.Outputs[0].ScriptPubKey == nil ||
+		t.Outputs[0].ScriptPubKey.Type != NullData {
+		return nil, ErrNotCustomTx
+	}
+
+	script, err := hex.DecodeString(t.Outputs[0].ScriptPubKey.Hex)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unable to decode OP_RETURN script", err)
+	}
+
+	return DecodeCustomTx(script)
+}
+
 // TransactionMetadata is a collection of useful
 // metadata in a transaction.
 type TransactionMetadata struct {
-	Size     int64 `json:"size,omitempty"`
-	Vsize    int64 `json:"vsize,omitempty"`
-	Version  int32 `json:"version,omitempty"`
-	Locktime int64 `json:"locktime,omitempty"`
-	Weight   int64 `json:"weight,omitempty"`
+	Size     int64     `json:"size,omitempty"`
+	Vsize    int64     `json:"vsize,omitempty"`
+	Version  int32     `json:"version,omitempty"`
+	Locktime int64     `json:"locktime,omitempty"`
+	Weight   int64     `json:"weight,omitempty"`
+	CustomTx *CustomTx `json:"custom_tx,omitempty"`
+
+	CustomTxError string `json:"custom_tx_error,omitempty"`
 }
 
 // Input is a raw input in a DeFiChain transaction.
@@ -287,7 +489,7 @@ func (i Input) Metadata() (map[string]interface{}, error) {
 
 // Output is a raw output in a DeFiChain transaction.
 type Output struct {
-	Value        float64       `json:"value"`
+	Value        json.Number   `json:"value"`
 	Index        int64         `json:"n"`
 	ScriptPubKey *ScriptPubKey `json:"scriptPubKey"`
 }
@@ -456,6 +658,25 @@ func (s sendRawTransactionResponse) Err() error {
 	)
 }
 
+// testMempoolAcceptResponse is the response body for `testmempoolaccept` requests
+type testMempoolAcceptResponse struct {
+	Result []*MempoolAcceptResult `json:"result"`
+	Error  *responseError         `json:"error"`
+}
+
+func (t testMempoolAcceptResponse) Err() error {
+	if t.Error == nil {
+		return nil
+	}
+
+	return fmt.Errorf(
+		"%w: error JSON RPC response, code: %d, message: %s",
+		ErrJSONRPCError,
+		t.Error.Code,
+		t.Error.Message,
+	)
+}
+
 // getRawTransactionResponse is the response body for `getrawtransaction` requests
 type getRawTransactionResponse struct {
 	Result json.RawMessage `json:"result"`
@@ -495,7 +716,8 @@ func (s getTransactionResponse) Err() error {
 }
 
 type suggestedFeeRate struct {
-	FeeRate float64 `json:"feerate"`
+	FeeRate float64  `json:"feerate"`
+	Errors  []string `json:"errors"`
 }
 
 // suggestedFeeRateResponse is the response body for `estimatesmartfee` requests
@@ -517,6 +739,30 @@ func (s suggestedFeeRateResponse) Err() error {
 	)
 }
 
+type mempoolInfo struct {
+	MempoolMinFee float64 `json:"mempoolminfee"`
+	MinRelayTxFee float64 `json:"minrelaytxfee"`
+}
+
+// mempoolInfoResponse is the response body for `getmempoolinfo` requests
+type mempoolInfoResponse struct {
+	Result *mempoolInfo   `json:"result"`
+	Error  *responseError `json:"error"`
+}
+
+func (m mempoolInfoResponse) Err() error {
+	if m.Error == nil {
+		return nil
+	}
+
+	return fmt.Errorf(
+		"%w: error JSON RPC response, code: %d, message: %s",
+		ErrJSONRPCError,
+		m.Error.Code,
+		m.Error.Message,
+	)
+}
+
 // rawMempoolResponse is the response body for `getrawmempool` requests.
 type rawMempoolResponse struct {
 	Result []string       `json:"result"`
@@ -536,6 +782,65 @@ func (r rawMempoolResponse) Err() error {
 	)
 }
 
+// verboseRawMempoolResponse is the response body for
+// verbose `getrawmempool` requests.
+type verboseRawMempoolResponse struct {
+	Result map[string]*MempoolEntry `json:"result"`
+	Error  *responseError           `json:"error"`
+}
+
+func (r verboseRawMempoolResponse) Err() error {
+	if r.Error == nil {
+		return nil
+	}
+
+	return fmt.Errorf(
+		"%w: error JSON RPC response, code: %d, message: %s",
+		ErrJSONRPCError,
+		r.Error.Code,
+		r.Error.Message,
+	)
+}
+
+// mempoolEntryResponse is the response body for
+// `getmempoolentry` requests.
+type mempoolEntryResponse struct {
+	Result *MempoolEntry  `json:"result"`
+	Error  *responseError `json:"error"`
+}
+
+func (m mempoolEntryResponse) Err() error {
+	if m.Error == nil {
+		return nil
+	}
+
+	return fmt.Errorf(
+		"%w: error JSON RPC response, code: %d, message: %s",
+		ErrJSONRPCError,
+		m.Error.Code,
+		m.Error.Message,
+	)
+}
+
+// listTokensResponse is the response body for `listtokens` requests.
+type listTokensResponse struct {
+	Result map[string]*Token `json:"result"`
+	Error  *responseError    `json:"error"`
+}
+
+func (l listTokensResponse) Err() error {
+	if l.Error == nil {
+		return nil
+	}
+
+	return fmt.Errorf(
+		"%w: error JSON RPC response, code: %d, message: %s",
+		ErrJSONRPCError,
+		l.Error.Code,
+		l.Error.Message,
+	)
+}
+
 // CoinIdentifier converts a tx hash and vout into
 // the canonical CoinIdentifier.Identifier used in
 // rosetta-defichain.
@@ -549,3 +854,37 @@ func TransactionHash(identifier string) string {
 	vals := strings.Split(identifier, ":")
 	return vals[0]
 }
+
+// AccountHistory is a change of the account balances of
+// an owner as returned by `listaccounthistory`. Amounts
+// are formatted as "amount@symbol" (ex: -1.5@BTC).
+// Changes that aren't caused by a transaction (ex:
+// liquidity pool rewards) have no TxID.
+type AccountHistory struct {
+	Owner       string   `json:"owner"`
+	BlockHeight int64    `json:"blockHeight"`
+	Type        string   `json:"type"`
+	TxN         int64    `json:"txn"`
+	TxID        string   `json:"txid"`
+	Amounts     []string `json:"amounts"`
+}
+
+// accountHistoryResponse is the response body for
+// `listaccounthistory` requests.
+type accountHistoryResponse struct {
+	Result []*AccountHistory `json:"result"`
+	Error  *responseError    `json:"error"`
+}
+
+func (a accountHistoryResponse) Err() error {
+	if a.Error == nil {
+		return nil
+	}
+
+	return fmt.Errorf(
+		"%w: error JSON RPC response, code: %d, message: %s",
+		ErrJSONRPCError,
+		a.Error.Code,
+		a.Error.Message,
+	)
+}
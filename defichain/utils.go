@@ -15,7 +15,10 @@
 package defichain
 
 import (
+	"encoding/json"
 	"fmt"
+	"math/big"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -26,6 +29,51 @@ import (
 	"github.com/coinbase/rosetta-sdk-go/types"
 )
 
+// amountRegexp matches the JSON number grammar
+// (capturing the exponent).
+var amountRegexp = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?(?:[eE]([+-]?[0-9]+))?$`)
+
+// maxAmountExponent is the largest absolute exponent of an
+// amount. Any valid amount can be written with a smaller
+// exponent, and big.Rat expands the exponent, so larger
+// ones (ex: 1e999999999) are rejected before parsing.
+const maxAmountExponent = 18
+
+// ParseAmount converts a decimal amount returned by defid
+// (ex: 0.00000001) into an exact integer amount of satoshis.
+// Unlike btcutil.NewAmount, it never rounds: amounts with more
+// precision than Decimals or that overflow an int64 are rejected.
+func ParseAmount(amount json.Number) (int64, error) {
+	value := amount.String()
+	match := amountRegexp.FindStringSubmatch(value)
+	if match == nil {
+		return 0, fmt.Errorf("%s is not a valid amount", value)
+	}
+
+	if exponent := match[3]; len(exponent) > 0 {
+		parsed, err := strconv.ParseInt(exponent, 10, 32)
+		if err != nil || parsed > maxAmountExponent || parsed < -maxAmountExponent {
+			return 0, fmt.Errorf("%s exponent is out of range", value)
+		}
+	}
+
+	rat, ok := new(big.Rat).SetString(value)
+	if !ok {
+		return 0, fmt.Errorf("%s is not a valid amount", value)
+	}
+
+	satoshis := rat.Mul(rat, new(big.Rat).SetInt64(SatoshisInDFI))
+	if !satoshis.IsInt() {
+		return 0, fmt.Errorf("%s has more than %d decimals", value, Decimals)
+	}
+
+	if !satoshis.Num().IsInt64() {
+		return 0, fmt.Errorf("%s overflows int64", value)
+	}
+
+	return satoshis.Num().Int64(), nil
+}
+
 // ParseCoinIdentifier returns the corresponding hash and index associated
 // with a *types.CoinIdentifier.
 func ParseCoinIdentifier(coinIdentifier *types.CoinIdentifier) (*chainhash.Hash, uint32, error) {
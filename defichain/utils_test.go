@@ -0,0 +1,163 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package defichain
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := map[string]struct {
+		amount string
+
+		satoshis int64
+		err      string
+	}{
+		"zero": {
+			amount:   "0",
+			satoshis: 0,
+		},
+		"1 satoshi": {
+			amount:   "0.00000001",
+			satoshis: 1,
+		},
+		"1 satoshi (exponent)": {
+			amount:   "1e-08",
+			satoshis: 1,
+		},
+		"integer": {
+			amount:   "50",
+			satoshis: 5000000000,
+		},
+		"integer (exponent)": {
+			amount:   "1E+2",
+			satoshis: 10000000000,
+		},
+		"many decimals": {
+			amount:   "15.89351625",
+			satoshis: 1589351625,
+		},
+		"trailing zeros": {
+			amount:   "1.1234567800000",
+			satoshis: 112345678,
+		},
+		"inexact float64": {
+			amount:   "0.29",
+			satoshis: 29000000,
+		},
+		"DFI max supply": {
+			amount:   "1200000000.00000000",
+			satoshis: 120000000000000000,
+		},
+		"BTC max supply": {
+			amount:   "21000000.00000000",
+			satoshis: 2100000000000000,
+		},
+		"max int64": {
+			amount:   "92233720368.54775807",
+			satoshis: math.MaxInt64,
+		},
+		"max int64 minus 1 satoshi": {
+			amount:   "92233720368.54775806",
+			satoshis: math.MaxInt64 - 1,
+		},
+		"negative": {
+			amount:   "-0.5",
+			satoshis: -50000000,
+		},
+		"min int64": {
+			amount:   "-92233720368.54775808",
+			satoshis: math.MinInt64,
+		},
+		"overflow": {
+			amount: "92233720368.54775808",
+			err:    "92233720368.54775808 overflows int64",
+		},
+		"too many decimals": {
+			amount: "1.000000001",
+			err:    "1.000000001 has more than 8 decimals",
+		},
+		"too many decimals (exponent)": {
+			amount: "1e-9",
+			err:    "1e-9 has more than 8 decimals",
+		},
+		"max exponent": {
+			amount:   "0.000000000000000001e18",
+			satoshis: 100000000,
+		},
+		"exponent out of range": {
+			amount: "1e19",
+			err:    "1e19 exponent is out of range",
+		},
+		"negative exponent out of range": {
+			amount: "1e-19",
+			err:    "1e-19 exponent is out of range",
+		},
+		"huge exponent": {
+			amount: "1e999999999999999999999",
+			err:    "1e999999999999999999999 exponent is out of range",
+		},
+		"empty": {
+			amount: "",
+			err:    " is not a valid amount",
+		},
+		"fraction": {
+			amount: "1/2",
+			err:    "1/2 is not a valid amount",
+		},
+		"hex": {
+			amount: "0x10",
+			err:    "0x10 is not a valid amount",
+		},
+		"leading zero": {
+			amount: "01",
+			err:    "01 is not a valid amount",
+		},
+		"not a number": {
+			amount: "abc",
+			err:    "abc is not a valid amount",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			satoshis, err := ParseAmount(json.Number(test.amount))
+			if test.err != "" {
+				assert.EqualError(t, err, test.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.satoshis, satoshis)
+		})
+	}
+}
+
+func TestOutputValueIsLossless(t *testing.T) {
+	var output Output
+	assert.NoError(t, json.Unmarshal(
+		[]byte(`{"value": 92233720368.54775807, "n": 0}`),
+		&output,
+	))
+	assert.Equal(t, json.Number("92233720368.54775807"), output.Value)
+
+	satoshis, err := ParseAmount(output.Value)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(math.MaxInt64), satoshis)
+}
@@ -19,6 +19,8 @@ import (
 	"errors"
 	"math/big"
 
+	"github.com/DeFiCh/rosetta-defichain/defichain"
+
 	"github.com/coinbase/rosetta-sdk-go/asserter"
 	"github.com/coinbase/rosetta-sdk-go/parser"
 	"github.com/coinbase/rosetta-sdk-go/storage/database"
@@ -34,7 +36,8 @@ var (
 
 // BalanceStorageHelper implements storage.BalanceStorageHelper.
 type BalanceStorageHelper struct {
-	a *asserter.Asserter
+	a          *asserter.Asserter
+	exemptions []*defichain.Exemption
 }
 
 // AccountBalance attempts to fetch the balance
@@ -58,7 +61,7 @@ func (h *BalanceStorageHelper) Asserter() *asserter.Asserter {
 
 // BalanceExemptions returns a list of *types.BalanceExemption.
 func (h *BalanceStorageHelper) BalanceExemptions() []*types.BalanceExemption {
-	return []*types.BalanceExemption{}
+	return defichain.BalanceExemptions(h.exemptions)
 }
 
 // ExemptFunc returns a parser.ExemptOperation.
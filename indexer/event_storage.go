@@ -0,0 +1,241 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/coinbase/rosetta-sdk-go/storage/database"
+	"github.com/coinbase/rosetta-sdk-go/storage/modules"
+	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/neilotoole/errgroup"
+)
+
+const (
+	// eventNamespace is the namespace event storage
+	// uses to record block events.
+	eventNamespace = "evt"
+
+	// firstSequence is the sequence of the first block
+	// event, so an empty log has a max sequence of 0
+	// (a negative max sequence is invalid).
+	firstSequence = 1
+)
+
+var _ modules.BlockWorker = (*EventStorage)(nil)
+
+// EventStorage records an ordered log of the blocks added
+// and removed by the indexer. It is a modules.BlockWorker,
+// so each event is stored in the same database transaction
+// as the block it describes and sequences are never reused.
+//
+// The log starts at the first block added after it was
+// introduced, so databases synced by an older version have
+// no events for earlier blocks. The start is stored so it
+// can be reported.
+type EventStorage struct {
+	db database.Database
+}
+
+// NewEventStorage returns a new EventStorage.
+func NewEventStorage(db database.Database) *EventStorage {
+	return &EventStorage{db: db}
+}
+
+// getNextSequenceKey returns the key of the
+// sequence of the next block event.
+func getNextSequenceKey() []byte {
+	return []byte(fmt.Sprintf("%s/next", eventNamespace))
+}
+
+// getStartKey returns the key of the index of
+// the block of the first block event.
+func getStartKey() []byte {
+	return []byte(fmt.Sprintf("%s/start", eventNamespace))
+}
+
+// getEventKey returns the key of a block event.
+func getEventKey(sequence int64) []byte {
+	return []byte(fmt.Sprintf("%s/event/%020d", eventNamespace, sequence))
+}
+
+// getNextSequence returns the sequence of the
+// next block event (firstSequence if there are none).
+func getNextSequence(ctx context.Context, dbTx database.Transaction) (int64, error) {
+	exists, value, err := dbTx.Get(ctx, getNextSequenceKey())
+	if err != nil {
+		return -1, fmt.Errorf("%w: unable to get next sequence", err)
+	}
+
+	if !exists {
+		return firstSequence, nil
+	}
+
+	sequence, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil {
+		return -1, fmt.Errorf("%w: unable to parse next sequence %s", err, string(value))
+	}
+
+	return sequence, nil
+}
+
+// storeEvent appends a block event to the log.
+func (e *EventStorage) storeEvent(
+	ctx context.Context,
+	dbTx database.Transaction,
+	blockIdentifier *types.BlockIdentifier,
+	eventType types.BlockEventType,
+) error {
+	sequence, err := getNextSequence(ctx, dbTx)
+	if err != nil {
+		return err
+	}
+
+	encoded, err := e.db.Encoder().Encode(eventNamespace, &types.BlockEvent{
+		Sequence:        sequence,
+		BlockIdentifier: blockIdentifier,
+		Type:            eventType,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: unable to encode block event", err)
+	}
+
+	if err := dbTx.Set(ctx, getEventKey(sequence), encoded, true); err != nil {
+		return fmt.Errorf("%w: unable to store block event %d", err, sequence)
+	}
+
+	if err := dbTx.Set(
+		ctx,
+		getNextSequenceKey(),
+		[]byte(strconv.FormatInt(sequence+1, 10)),
+		false,
+	); err != nil {
+		return fmt.Errorf("%w: unable to store next sequence", err)
+	}
+
+	if sequence != firstSequence {
+		return nil
+	}
+
+	if err := dbTx.Set(
+		ctx,
+		getStartKey(),
+		[]byte(strconv.FormatInt(blockIdentifier.Index, 10)),
+		false,
+	); err != nil {
+		return fmt.Errorf("%w: unable to store event log start", err)
+	}
+
+	return nil
+}
+
+// GetStart returns the index of the block of the first
+// block event (false if the log is empty).
+func (e *EventStorage) GetStart(ctx context.Context) (int64, bool, error) {
+	dbTx := e.db.ReadTransaction(ctx)
+	defer dbTx.Discard(ctx)
+
+	exists, value, err := dbTx.Get(ctx, getStartKey())
+	if err != nil {
+		return -1, false, fmt.Errorf("%w: unable to get event log start", err)
+	}
+
+	if !exists {
+		return -1, false, nil
+	}
+
+	start, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil {
+		return -1, false, fmt.Errorf("%w: unable to parse event log start %s", err, string(value))
+	}
+
+	return start, true, nil
+}
+
+// AddingBlock is called by BlockStorage when adding a block.
+func (e *EventStorage) AddingBlock(
+	ctx context.Context,
+	g *errgroup.Group,
+	block *types.Block,
+	transaction database.Transaction,
+) (database.CommitWorker, error) {
+	return nil, e.storeEvent(ctx, transaction, block.BlockIdentifier, types.ADDED)
+}
+
+// RemovingBlock is called by BlockStorage when removing a block.
+func (e *EventStorage) RemovingBlock(
+	ctx context.Context,
+	g *errgroup.Group,
+	block *types.Block,
+	transaction database.Transaction,
+) (database.CommitWorker, error) {
+	return nil, e.storeEvent(ctx, transaction, block.BlockIdentifier, types.REMOVED)
+}
+
+// GetEvents returns up to limit block events starting at
+// sequence offset (or the last limit events if offset is
+// nil) and the max sequence of the log. Sequences start at
+// firstSequence, so the max sequence of an empty log is 0.
+func (e *EventStorage) GetEvents(
+	ctx context.Context,
+	offset *int64,
+	limit int64,
+) ([]*types.BlockEvent, int64, error) {
+	dbTx := e.db.ReadTransaction(ctx)
+	defer dbTx.Discard(ctx)
+
+	nextSequence, err := getNextSequence(ctx, dbTx)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	maxSequence := nextSequence - 1
+
+	start := nextSequence - limit
+	if offset != nil {
+		start = *offset
+	}
+	if start < firstSequence {
+		start = firstSequence
+	}
+
+	end := start + limit
+	if end > nextSequence {
+		end = nextSequence
+	}
+
+	events := []*types.BlockEvent{}
+	for sequence := start; sequence < end; sequence++ {
+		exists, value, err := dbTx.Get(ctx, getEventKey(sequence))
+		if err != nil {
+			return nil, -1, fmt.Errorf("%w: unable to get block event %d", err, sequence)
+		}
+
+		if !exists {
+			return nil, -1, fmt.Errorf("block event %d is missing", sequence)
+		}
+
+		var event types.BlockEvent
+		if err := e.db.Encoder().Decode(eventNamespace, value, &event, false); err != nil {
+			return nil, -1, fmt.Errorf("%w: unable to decode block event %d", err, sequence)
+		}
+
+		events = append(events, &event)
+	}
+
+	return events, maxSequence, nil
+}
@@ -19,6 +19,7 @@ import (
 	"errors"
 	"fmt"
 	"runtime"
+	"sort"
 	"sync"
 	"time"
 
@@ -70,6 +71,10 @@ const (
 
 	// semaphoreWeight is the weight of each semaphore request.
 	semaphoreWeight = int64(1)
+
+	// accountNamespace is the namespace balance storage
+	// uses to record each account and currency pair.
+	accountNamespace = "acc"
 )
 
 var (
@@ -88,6 +93,8 @@ type Client interface {
 	) (*types.Block, error)
 	GetTransaction(ctx context.Context, txid string) ([]byte, error)
 	GetRawTransaction(ctx context.Context, txid, blockhash string) (*defichain.Transaction, error)
+	RawMempool(context.Context) ([]string, error)
+	ParseOutputs(*defichain.Transaction) ([]*types.Operation, error)
 }
 
 var _ syncer.Handler = (*Indexer)(nil)
@@ -99,6 +106,7 @@ type Indexer struct {
 	cancel context.CancelFunc
 
 	network       *types.NetworkIdentifier
+	currency      *types.Currency
 	pruningConfig *configuration.PruningConfiguration
 
 	client Client
@@ -108,8 +116,12 @@ type Indexer struct {
 	blockStorage   *modules.BlockStorage
 	balanceStorage *modules.BalanceStorage
 	coinStorage    *modules.CoinStorage
+	txStorage      *TransactionStorage
+	eventStorage   *EventStorage
 	workers        []modules.BlockWorker
 
+	mempool *MempoolTracker
+
 	waiter *waitTable
 
 	// Store coins created in pre-store before persisted
@@ -222,6 +234,7 @@ func Initialize(
 	i := &Indexer{
 		cancel:         cancel,
 		network:        config.Network,
+		currency:       config.Currency,
 		pruningConfig:  config.Pruning,
 		client:         client,
 		database:       localStore,
@@ -242,12 +255,20 @@ func Initialize(
 
 	balanceStorage := modules.NewBalanceStorage(localStore)
 	balanceStorage.Initialize(
-		&BalanceStorageHelper{asserter},
+		&BalanceStorageHelper{asserter, config.Exemptions},
 		&BalanceStorageHandler{},
 	)
 	i.balanceStorage = balanceStorage
 
-	i.workers = []modules.BlockWorker{coinStorage, balanceStorage}
+	txStorage := NewTransactionStorage()
+	i.txStorage = txStorage
+
+	eventStorage := NewEventStorage(localStore)
+	i.eventStorage = eventStorage
+
+	i.workers = []modules.BlockWorker{coinStorage, balanceStorage, txStorage, eventStorage}
+
+	i.mempool = NewMempoolTracker(client)
 
 	return i, nil
 }
@@ -269,6 +290,16 @@ func (i *Indexer) waitForNode(ctx context.Context) error {
 	}
 }
 
+// TrackMempool follows the mempool of defid
+// until stopped.
+func (i *Indexer) TrackMempool(ctx context.Context) error {
+	if err := i.waitForNode(ctx); err != nil {
+		return fmt.Errorf("%w: failed to wait for node", err)
+	}
+
+	return i.mempool.Track(ctx)
+}
+
 // Sync attempts to index DeFiChain blocks using
 // the defichain.Client until stopped.
 func (i *Indexer) Sync(ctx context.Context) error {
@@ -284,6 +315,21 @@ func (i *Indexer) Sync(ctx context.Context) error {
 		startIndex = head.Index + 1
 	}
 
+	// Blocks synced before the event log was
+	// introduced have no block events.
+	eventStart, recorded, err := i.eventStorage.GetStart(ctx)
+	if err != nil {
+		return err
+	}
+
+	logger := utils.ExtractLogger(ctx, "indexer")
+	switch {
+	case recorded && eventStart > 0:
+		logger.Infow("block events are recorded from block", "index", eventStart)
+	case !recorded && startIndex != indexPlaceholder:
+		logger.Warnw("block events are recorded from block", "index", startIndex)
+	}
+
 	// Load in previous blocks into syncer cache to handle reorgs.
 	// If previously processed blocks exist in storage, they are fetched.
 	// Otherwise, none are provided to the cache (the syncer will not attempt
@@ -871,6 +917,41 @@ func (i *Indexer) GetScriptPubKeys(
 	return scripts, nil
 }
 
+// GetCoinBlocks returns the *types.BlockIdentifier of the
+// block that created each coin.
+func (i *Indexer) GetCoinBlocks(
+	ctx context.Context,
+	coins []*types.Coin,
+) ([]*types.BlockIdentifier, error) {
+	databaseTransaction := i.database.ReadTransaction(ctx)
+	defer databaseTransaction.Discard(ctx)
+
+	blocks := make([]*types.BlockIdentifier, len(coins))
+	for j, coin := range coins {
+		transactionHash, _, err := defichain.ParseCoinIdentifier(coin.CoinIdentifier)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unable to parse coin identifier", err)
+		}
+
+		block, _, err := i.blockStorage.FindTransaction(
+			ctx,
+			&types.TransactionIdentifier{Hash: transactionHash.String()},
+			databaseTransaction,
+		)
+		if err != nil || block == nil {
+			return nil, fmt.Errorf(
+				"%w: unable to find transaction %s",
+				err,
+				transactionHash.String(),
+			)
+		}
+
+		blocks[j] = block
+	}
+
+	return blocks, nil
+}
+
 // GetBlockLazy returns a *types.BlockResponse from the indexer's block storage.
 // All transactions in a block must be fetched individually.
 func (i *Indexer) GetBlockLazy(
@@ -902,14 +983,105 @@ func (i *Indexer) GetCoins(
 	return i.coinStorage.GetCoins(ctx, accountIdentifier)
 }
 
-// GetBalance returns the balance of an account
-// at a particular *types.PartialBlockIdentifier.
-func (i *Indexer) GetBalance(
+// GetMempoolCoins overlays the coins spent and created by
+// transactions in the mempool on the confirmed coins of an
+// account (returned by GetCoins).
+func (i *Indexer) GetMempoolCoins(
 	ctx context.Context,
 	accountIdentifier *types.AccountIdentifier,
-	currency *types.Currency,
+	coins []*types.Coin,
+) ([]*types.Coin, error) {
+	return i.mempool.AccountCoins(accountIdentifier, coins)
+}
+
+// GetInputCoins returns the coins spent by the inputs of a
+// transaction that isn't in a block yet (ex: from the mempool).
+// Coins are looked up in coin storage, then in the outputs of
+// the transactions in the mempool.
+func (i *Indexer) GetInputCoins(
+	ctx context.Context,
+	tx *defichain.Transaction,
+) (map[string]*types.AccountCoin, error) {
+	coins := map[string]*types.AccountCoin{}
+	parents := map[string][]*types.Operation{}
+	for _, input := range tx.Inputs {
+		coinIdentifier := defichain.CoinIdentifier(input.TxHash, input.Vout)
+		coin, owner, err := i.coinStorage.GetCoin(
+			ctx,
+			&types.CoinIdentifier{Identifier: coinIdentifier},
+		)
+		if err == nil {
+			coins[coinIdentifier] = &types.AccountCoin{
+				Account: owner,
+				Coin:    coin,
+			}
+			continue
+		}
+
+		if !errors.Is(err, storageErrs.ErrCoinNotFound) {
+			return nil, fmt.Errorf("%w: unable to lookup coin %s", err, coinIdentifier)
+		}
+
+		if accountCoin, ok := i.mempool.Coin(coinIdentifier); ok {
+			coins[coinIdentifier] = accountCoin
+			continue
+		}
+
+		// The parent may have entered the mempool
+		// since the tracker last polled it.
+		ops, ok := parents[input.TxHash]
+		if !ok {
+			parent, err := i.client.GetRawTransaction(ctx, input.TxHash, "")
+			if err != nil {
+				return nil, fmt.Errorf(
+					"%w: unable to find coin %s",
+					err,
+					coinIdentifier,
+				)
+			}
+
+			ops, err = i.client.ParseOutputs(parent)
+			if err != nil {
+				return nil, fmt.Errorf("%w: unable to parse transaction %s", err, input.TxHash)
+			}
+
+			parents[input.TxHash] = ops
+		}
+
+		for _, op := range ops {
+			if op.CoinChange == nil ||
+				op.CoinChange.CoinIdentifier.Identifier != coinIdentifier {
+				continue
+			}
+
+			coins[coinIdentifier] = &types.AccountCoin{
+				Account: op.Account,
+				Coin: &types.Coin{
+					CoinIdentifier: op.CoinChange.CoinIdentifier,
+					Amount:         op.Amount,
+				},
+			}
+		}
+
+		if _, ok := coins[coinIdentifier]; !ok {
+			return nil, fmt.Errorf("unable to find coin %s", coinIdentifier)
+		}
+	}
+
+	return coins, nil
+}
+
+// GetBalances returns the balances of an account in each
+// of the provided currencies at a particular
+// *types.PartialBlockIdentifier. If no currencies are
+// provided, balances are returned for the native currency
+// and every currency the account has ever held.
+func (i *Indexer) GetBalances(
+	ctx context.Context,
+	accountIdentifier *types.AccountIdentifier,
+	currencies []*types.Currency,
 	blockIdentifier *types.PartialBlockIdentifier,
-) (*types.Amount, *types.BlockIdentifier, error) {
+) ([]*types.Amount, *types.BlockIdentifier, error) {
 	dbTx := i.database.ReadTransaction(ctx)
 	defer dbTx.Discard(ctx)
 
@@ -922,22 +1094,412 @@ func (i *Indexer) GetBalance(
 		return nil, nil, err
 	}
 
-	amount, err := i.balanceStorage.GetBalanceTransactional(
+	if len(currencies) == 0 {
+		currencies, err = i.accountCurrencies(ctx, dbTx, accountIdentifier)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	amounts := make([]*types.Amount, len(currencies))
+	for j, currency := range currencies {
+		amount, err := i.balanceStorage.GetBalanceTransactional(
+			ctx,
+			dbTx,
+			accountIdentifier,
+			currency,
+			blockResponse.Block.BlockIdentifier.Index,
+		)
+		if errors.Is(err, storageErrs.ErrAccountMissing) {
+			amount = &types.Amount{
+				Value:    zeroValue,
+				Currency: currency,
+			}
+		} else if err != nil {
+			return nil, nil, err
+		}
+
+		amounts[j] = amount
+	}
+
+	return amounts, blockResponse.Block.BlockIdentifier, nil
+}
+
+// SearchTransactions returns the transactions matching a
+// *types.SearchTransactionsRequest (starting with the most
+// recent) and the total number of matching transactions.
+// The request must have an address, account, coin or
+// transaction identifier condition to look up in the
+// transaction index.
+//
+// With a limit, the index is only scanned until a match
+// after the requested page is found, so the total is at
+// most offset+limit+1 (which is enough to know if there is
+// a next page).
+func (i *Indexer) SearchTransactions(
+	ctx context.Context,
+	request *types.SearchTransactionsRequest,
+) ([]*types.BlockTransaction, int64, error) {
+	dbTx := i.database.ReadTransaction(ctx)
+	defer dbTx.Discard(ctx)
+
+	oldestIndex, err := i.blockStorage.GetOldestBlockIndexTransactional(ctx, dbTx)
+	if errors.Is(err, storageErrs.ErrOldestIndexMissing) {
+		return []*types.BlockTransaction{}, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: unable to get oldest block index", err)
+	}
+
+	terms := searchTerms(request)
+	if len(terms) == 0 && request.TransactionIdentifier == nil {
+		return nil, 0, errors.New("an address, account, coin or transaction identifier is required")
+	}
+
+	// Blocks synced before the transaction index
+	// was introduced are not indexed.
+	indexStart, indexed, err := i.txStorage.getIndexStart(ctx, dbTx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if !indexed {
+		return nil, 0, errors.New("no blocks have been added to the transaction index")
+	}
+
+	if request.MaxBlock != nil && *request.MaxBlock < indexStart {
+		return nil, 0, fmt.Errorf("transactions before block %d are not indexed", indexStart)
+	}
+
+	minBlock := oldestIndex
+	if indexStart > minBlock {
+		minBlock = indexStart
+	}
+
+	var found *indexedTransaction
+	if request.TransactionIdentifier != nil {
+		blockIdentifier, _, err := i.blockStorage.FindTransaction(
+			ctx,
+			request.TransactionIdentifier,
+			dbTx,
+		)
+		if err != nil && !errors.Is(err, storageErrs.ErrCannotAccessPrunedData) {
+			return nil, 0, fmt.Errorf("%w: unable to find transaction", err)
+		}
+
+		if blockIdentifier != nil &&
+			(request.MaxBlock == nil || blockIdentifier.Index <= *request.MaxBlock) {
+			found = &indexedTransaction{
+				blockIdentifier:       blockIdentifier,
+				transactionIdentifier: request.TransactionIdentifier,
+			}
+		}
+	}
+
+	offset := int64(0)
+	if request.Offset != nil {
+		offset = *request.Offset
+	}
+
+	bound := int64(-1)
+	if request.Limit != nil {
+		bound = offset + *request.Limit + 1
+	}
+
+	// The transaction index only contains addresses and
+	// coins, so transactions must be fetched to check any
+	// other condition (or to match several conditions
+	// with the same operation).
+	or := request.Operator != nil && *request.Operator == types.OR
+	conditions := len(operationConditions(request, &types.Operation{}, nil))
+	if request.TransactionIdentifier != nil {
+		conditions++
+	}
+
+	successful := map[string]bool{}
+	for _, status := range defichain.OperationStatuses {
+		successful[status.Status] = status.Successful
+	}
+
+	fetched := map[string]*types.BlockTransaction{}
+	matches := func(candidate *indexedTransaction) (bool, error) {
+		if request.AccountIdentifier == nil && (or || conditions <= 1) {
+			return true, nil
+		}
+
+		blockTransaction, err := i.getBlockTransaction(ctx, candidate)
+		if err != nil {
+			return false, err
+		}
+
+		fetched[candidate.key()] = blockTransaction
+		return matchesTransaction(request, blockTransaction.Transaction, successful), nil
+	}
+
+	var candidates []*indexedTransaction
+	if or {
+		candidates, err = i.searchAny(ctx, dbTx, found, terms, minBlock, request.MaxBlock, bound, matches)
+	} else {
+		candidates, err = i.searchAll(ctx, dbTx, found, terms, minBlock, request.MaxBlock, bound, matches)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Transactions that were not fetched to be
+	// matched are only fetched if part of the page.
+	total := int64(len(candidates))
+	if offset >= total {
+		return []*types.BlockTransaction{}, total, nil
+	}
+
+	end := total
+	if request.Limit != nil && offset+*request.Limit < total {
+		end = offset + *request.Limit
+	}
+
+	page := make([]*types.BlockTransaction, end-offset)
+	for j := offset; j < end; j++ {
+		blockTransaction, ok := fetched[candidates[j].key()]
+		if !ok {
+			blockTransaction, err = i.getBlockTransaction(ctx, candidates[j])
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+
+		page[j-offset] = blockTransaction
+	}
+
+	return page, total, nil
+}
+
+// searchAll returns up to bound (if not negative) indexed
+// transactions found for the transaction identifier (if
+// not nil) or the first term, that are indexed for every
+// term and matches, starting with the most recent.
+func (i *Indexer) searchAll(
+	ctx context.Context,
+	dbTx database.Transaction,
+	found *indexedTransaction,
+	terms [][2]string,
+	minBlock int64,
+	maxBlock *int64,
+	bound int64,
+	matches func(*indexedTransaction) (bool, error),
+) ([]*indexedTransaction, error) {
+	matching := []*indexedTransaction{}
+	handler := func(candidate *indexedTransaction) (bool, error) {
+		for _, term := range terms {
+			indexed, err := i.txStorage.isIndexed(ctx, dbTx, term[0], term[1], candidate)
+			if err != nil {
+				return false, err
+			}
+
+			if !indexed {
+				return true, nil
+			}
+		}
+
+		ok, err := matches(candidate)
+		if err != nil {
+			return false, err
+		}
+
+		if ok {
+			matching = append(matching, candidate)
+		}
+
+		return bound < 0 || int64(len(matching)) < bound, nil
+	}
+
+	if found != nil || len(terms) == 0 {
+		if found != nil {
+			if _, err := handler(found); err != nil {
+				return nil, err
+			}
+		}
+
+		return matching, nil
+	}
+
+	if err := i.txStorage.scanTransactions(
 		ctx,
 		dbTx,
-		accountIdentifier,
-		currency,
-		blockResponse.Block.BlockIdentifier.Index,
+		terms[0][0],
+		terms[0][1],
+		minBlock,
+		maxBlock,
+		handler,
+	); err != nil {
+		return nil, err
+	}
+
+	return matching, nil
+}
+
+// searchAny returns up to bound (if not negative) indexed
+// transactions found for the transaction identifier (if
+// not nil) or indexed for any term that matches, starting
+// with the most recent.
+func (i *Indexer) searchAny(
+	ctx context.Context,
+	dbTx database.Transaction,
+	found *indexedTransaction,
+	terms [][2]string,
+	minBlock int64,
+	maxBlock *int64,
+	bound int64,
+	matches func(*indexedTransaction) (bool, error),
+) ([]*indexedTransaction, error) {
+	sets := [][]*indexedTransaction{}
+	if found != nil {
+		sets = append(sets, []*indexedTransaction{found})
+	}
+
+	// The first bound transactions of the union are
+	// within the first bound transactions of each set.
+	for _, term := range terms {
+		set := []*indexedTransaction{}
+		if err := i.txStorage.scanTransactions(
+			ctx,
+			dbTx,
+			term[0],
+			term[1],
+			minBlock,
+			maxBlock,
+			func(candidate *indexedTransaction) (bool, error) {
+				ok, err := matches(candidate)
+				if err != nil {
+					return false, err
+				}
+
+				if ok {
+					set = append(set, candidate)
+				}
+
+				return bound < 0 || int64(len(set)) < bound, nil
+			},
+		); err != nil {
+			return nil, err
+		}
+
+		sets = append(sets, set)
+	}
+
+	union := unionCandidates(sets)
+	if bound >= 0 && int64(len(union)) > bound {
+		union = union[:bound]
+	}
+
+	return union, nil
+}
+
+// GetBlockEvents returns up to limit block events starting
+// at sequence offset (or the last limit events if offset
+// is nil) and the max sequence of the event log.
+func (i *Indexer) GetBlockEvents(
+	ctx context.Context,
+	offset *int64,
+	limit int64,
+) ([]*types.BlockEvent, int64, error) {
+	return i.eventStorage.GetEvents(ctx, offset, limit)
+}
+
+// getBlockTransaction returns the *types.BlockTransaction
+// of an indexed transaction.
+func (i *Indexer) getBlockTransaction(
+	ctx context.Context,
+	candidate *indexedTransaction,
+) (*types.BlockTransaction, error) {
+	transaction, err := i.blockStorage.GetBlockTransaction(
+		ctx,
+		candidate.blockIdentifier,
+		candidate.transactionIdentifier,
 	)
-	if errors.Is(err, storageErrs.ErrAccountMissing) {
-		return &types.Amount{
-			Value:    zeroValue,
-			Currency: currency,
-		}, blockResponse.Block.BlockIdentifier, nil
+	if err != nil {
+		return nil, fmt.Errorf(
+			"%w: unable to get transaction %s",
+			err,
+			candidate.transactionIdentifier.Hash,
+		)
 	}
+
+	return &types.BlockTransaction{
+		BlockIdentifier: candidate.blockIdentifier,
+		Transaction:     transaction,
+	}, nil
+}
+
+// unionCandidates returns the union of sets of indexed
+// transactions, starting with the most recent.
+func unionCandidates(sets [][]*indexedTransaction) []*indexedTransaction {
+	seen := map[string]struct{}{}
+	union := []*indexedTransaction{}
+	for _, set := range sets {
+		for _, transaction := range set {
+			if _, ok := seen[transaction.key()]; ok {
+				continue
+			}
+
+			seen[transaction.key()] = struct{}{}
+			union = append(union, transaction)
+		}
+	}
+
+	sort.SliceStable(union, func(a, b int) bool {
+		if union[a].blockIdentifier.Index != union[b].blockIdentifier.Index {
+			return union[a].blockIdentifier.Index > union[b].blockIdentifier.Index
+		}
+
+		return union[a].transactionIdentifier.Hash > union[b].transactionIdentifier.Hash
+	})
+
+	return union
+}
+
+// accountCurrencies returns the native currency followed
+// by every other currency stored in balance storage for
+// a *types.AccountIdentifier.
+func (i *Indexer) accountCurrencies(
+	ctx context.Context,
+	dbTx database.Transaction,
+	accountIdentifier *types.AccountIdentifier,
+) ([]*types.Currency, error) {
+	currencies := []*types.Currency{i.currency}
+	_, err := dbTx.Scan(
+		ctx,
+		accountCurrencyPrefix(accountIdentifier),
+		accountCurrencyPrefix(accountIdentifier),
+		func(k []byte, v []byte) error {
+			var accountCurrency types.AccountCurrency
+			if err := i.database.Encoder().DecodeAccountCurrency(
+				v,
+				&accountCurrency,
+				false,
+			); err != nil {
+				return fmt.Errorf("%w: unable to decode account currency", err)
+			}
+
+			if types.Hash(accountCurrency.Currency) != types.Hash(i.currency) {
+				currencies = append(currencies, accountCurrency.Currency)
+			}
+
+			return nil
+		},
+		false,
+		false,
+	)
 	if err != nil {
-		return nil, nil, err
+		return nil, fmt.Errorf("%w: unable to scan account currencies", err)
 	}
 
-	return amount, blockResponse.Block.BlockIdentifier, nil
+	return currencies, nil
+}
+
+// accountCurrencyPrefix returns the prefix of all
+// account entries stored by balance storage for a
+// *types.AccountIdentifier (see modules.GetAccountKey).
+func accountCurrencyPrefix(accountIdentifier *types.AccountIdentifier) []byte {
+	return []byte(fmt.Sprintf("%s/%s/", accountNamespace, types.Hash(accountIdentifier)))
 }
@@ -248,6 +248,7 @@ func TestIndexer_Transactions(t *testing.T) {
 		Script  *defichain.ScriptPubKey
 		Coin    *types.Coin
 		Account *types.AccountIdentifier
+		Block   *types.BlockIdentifier
 	}
 
 	coinBank := map[string]*coinBankEntry{}
@@ -317,6 +318,7 @@ func TestIndexer_Transactions(t *testing.T) {
 				Account: &types.AccountIdentifier{
 					Address: rawHash,
 				},
+				Block: identifier,
 			}
 
 			transactions = append(transactions, tx)
@@ -402,6 +404,7 @@ func TestIndexer_Transactions(t *testing.T) {
 				// Ensure ScriptPubKeys are accessible.
 				allCoins := []*types.Coin{}
 				expectedPubKeys := []*defichain.ScriptPubKey{}
+				expectedBlocks := []*types.BlockIdentifier{}
 				for k, v := range coinBank {
 					allCoins = append(allCoins, &types.Coin{
 						CoinIdentifier: &types.CoinIdentifier{Identifier: k},
@@ -411,12 +414,18 @@ func TestIndexer_Transactions(t *testing.T) {
 						},
 					})
 					expectedPubKeys = append(expectedPubKeys, v.Script)
+					expectedBlocks = append(expectedBlocks, v.Block)
 				}
 
 				pubKeys, err := i.GetScriptPubKeys(ctx, allCoins)
 				assert.NoError(t, err)
 				assert.Equal(t, expectedPubKeys, pubKeys)
 
+				// Ensure the blocks of coins are accessible.
+				blocks, err := i.GetCoinBlocks(ctx, allCoins)
+				assert.NoError(t, err)
+				assert.Equal(t, expectedBlocks, blocks)
+
 				cancel()
 				close(waitForFinish)
 				return
@@ -836,3 +845,814 @@ func TestIndexer_HeaderReorg(t *testing.T) {
 	assert.Len(t, i.waiter.table, 0)
 	mockClient.AssertExpectations(t)
 }
+
+func TestIndexer_GetBalances(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	newDir, err := utils.CreateTempDir()
+	assert.NoError(t, err)
+	defer utils.RemoveTempDir(newDir)
+
+	mockClient := &mocks.Client{}
+	cfg := &configuration.Configuration{
+		Network: &types.NetworkIdentifier{
+			Network:    defichain.MainnetNetwork,
+			Blockchain: defichain.Blockchain,
+		},
+		Currency:               defichain.MainnetCurrency,
+		GenesisBlockIdentifier: defichain.MainnetGenesisBlockIdentifier,
+		IndexerPath:            newDir,
+	}
+
+	i, err := Initialize(ctx, cancel, cfg, mockClient)
+	assert.NoError(t, err)
+	defer i.CloseDatabase(ctx)
+	i.blockStorage.Initialize(i.workers)
+
+	account := &types.AccountIdentifier{Address: "account"}
+	btc := defichain.TokenCurrency(2, &defichain.Token{SymbolKey: "BTC", Decimal: 8})
+	eth := defichain.TokenCurrency(1, &defichain.Token{SymbolKey: "ETH", Decimal: 8})
+
+	genesis := &types.Block{
+		BlockIdentifier:       &types.BlockIdentifier{Hash: getBlockHash(0), Index: 0},
+		ParentBlockIdentifier: &types.BlockIdentifier{Hash: getBlockHash(0), Index: 0},
+		Timestamp:             1599002115110,
+	}
+	assert.NoError(t, i.blockStorage.SeeBlock(ctx, genesis))
+	assert.NoError(t, i.blockStorage.AddBlock(ctx, genesis))
+
+	block := &types.Block{
+		BlockIdentifier:       &types.BlockIdentifier{Hash: getBlockHash(1), Index: 1},
+		ParentBlockIdentifier: genesis.BlockIdentifier,
+		Timestamp:             1599002115110,
+		Transactions: []*types.Transaction{
+			{
+				TransactionIdentifier: &types.TransactionIdentifier{Hash: "tx"},
+				Operations: []*types.Operation{
+					{
+						OperationIdentifier: &types.OperationIdentifier{
+							Index:        0,
+							NetworkIndex: &index0,
+						},
+						Status:  types.String(defichain.SuccessStatus),
+						Type:    defichain.OutputOpType,
+						Account: account,
+						Amount: &types.Amount{
+							Value:    "100",
+							Currency: defichain.MainnetCurrency,
+						},
+						CoinChange: &types.CoinChange{
+							CoinAction: types.CoinCreated,
+							CoinIdentifier: &types.CoinIdentifier{
+								Identifier: "tx:0",
+							},
+						},
+					},
+					{
+						OperationIdentifier: &types.OperationIdentifier{
+							Index: 1,
+						},
+						Status:  types.String(defichain.SuccessStatus),
+						Type:    defichain.OutputOpType,
+						Account: account,
+						Amount: &types.Amount{
+							Value:    "50",
+							Currency: btc,
+						},
+					},
+				},
+			},
+		},
+	}
+	assert.NoError(t, i.blockStorage.SeeBlock(ctx, block))
+	assert.NoError(t, i.blockStorage.AddBlock(ctx, block))
+
+	// All currencies held by the account are returned,
+	// starting with the native currency.
+	amounts, blockIdentifier, err := i.GetBalances(ctx, account, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, block.BlockIdentifier, blockIdentifier)
+	assert.Len(t, amounts, 2)
+	assert.Equal(t, "100", amounts[0].Value)
+	assert.Equal(t, types.Hash(defichain.MainnetCurrency), types.Hash(amounts[0].Currency))
+	assert.Equal(t, "50", amounts[1].Value)
+	assert.Equal(t, types.Hash(btc), types.Hash(amounts[1].Currency))
+
+	// Historical balances are returned per currency.
+	amounts, blockIdentifier, err = i.GetBalances(
+		ctx,
+		account,
+		nil,
+		types.ConstructPartialBlockIdentifier(genesis.BlockIdentifier),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, genesis.BlockIdentifier, blockIdentifier)
+	assert.Len(t, amounts, 2)
+	assert.Equal(t, "0", amounts[0].Value)
+	assert.Equal(t, "0", amounts[1].Value)
+
+	// Requested currencies the account never held are zero.
+	amounts, _, err = i.GetBalances(ctx, account, []*types.Currency{eth, btc}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []*types.Amount{
+		{Value: "0", Currency: eth},
+		{Value: "50", Currency: amounts[1].Currency},
+	}, amounts)
+
+	// Unknown accounts only report the native currency.
+	amounts, _, err = i.GetBalances(
+		ctx,
+		&types.AccountIdentifier{Address: "unknown"},
+		nil,
+		nil,
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, []*types.Amount{
+		{Value: "0", Currency: defichain.MainnetCurrency},
+	}, amounts)
+}
+
+func TestIndexer_SearchTransactions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	newDir, err := utils.CreateTempDir()
+	assert.NoError(t, err)
+	defer utils.RemoveTempDir(newDir)
+
+	mockClient := &mocks.Client{}
+	cfg := &configuration.Configuration{
+		Network: &types.NetworkIdentifier{
+			Network:    defichain.MainnetNetwork,
+			Blockchain: defichain.Blockchain,
+		},
+		Currency:               defichain.MainnetCurrency,
+		GenesisBlockIdentifier: defichain.MainnetGenesisBlockIdentifier,
+		IndexerPath:            newDir,
+	}
+
+	i, err := Initialize(ctx, cancel, cfg, mockClient)
+	assert.NoError(t, err)
+	defer i.CloseDatabase(ctx)
+	i.blockStorage.Initialize(i.workers)
+
+	sender := &types.AccountIdentifier{Address: "sender"}
+	recipient := &types.AccountIdentifier{Address: "recipient"}
+	operation := func(
+		index int64,
+		opType string,
+		account *types.AccountIdentifier,
+		value string,
+		coinChange *types.CoinChange,
+	) *types.Operation {
+		return &types.Operation{
+			OperationIdentifier: &types.OperationIdentifier{
+				Index:        index,
+				NetworkIndex: &index,
+			},
+			Status:  types.String(defichain.SuccessStatus),
+			Type:    opType,
+			Account: account,
+			Amount: &types.Amount{
+				Value:    value,
+				Currency: defichain.MainnetCurrency,
+			},
+			CoinChange: coinChange,
+		}
+	}
+
+	genesis := &types.Block{
+		BlockIdentifier:       &types.BlockIdentifier{Hash: getBlockHash(0), Index: 0},
+		ParentBlockIdentifier: &types.BlockIdentifier{Hash: getBlockHash(0), Index: 0},
+		Timestamp:             1599002115110,
+	}
+	funding := &types.Transaction{
+		TransactionIdentifier: &types.TransactionIdentifier{Hash: "funding"},
+		Operations: []*types.Operation{
+			operation(0, defichain.OutputOpType, sender, "100", &types.CoinChange{
+				CoinAction:     types.CoinCreated,
+				CoinIdentifier: &types.CoinIdentifier{Identifier: "funding:0"},
+			}),
+		},
+	}
+	block1 := &types.Block{
+		BlockIdentifier:       &types.BlockIdentifier{Hash: getBlockHash(1), Index: 1},
+		ParentBlockIdentifier: genesis.BlockIdentifier,
+		Timestamp:             1599002115110,
+		Transactions:          []*types.Transaction{funding},
+	}
+	payment := &types.Transaction{
+		TransactionIdentifier: &types.TransactionIdentifier{Hash: "payment"},
+		Operations: []*types.Operation{
+			operation(0, defichain.InputOpType, sender, "-100", &types.CoinChange{
+				CoinAction:     types.CoinSpent,
+				CoinIdentifier: &types.CoinIdentifier{Identifier: "funding:0"},
+			}),
+			operation(1, defichain.OutputOpType, recipient, "90", &types.CoinChange{
+				CoinAction:     types.CoinCreated,
+				CoinIdentifier: &types.CoinIdentifier{Identifier: "payment:0"},
+			}),
+		},
+	}
+	block2 := &types.Block{
+		BlockIdentifier:       &types.BlockIdentifier{Hash: getBlockHash(2), Index: 2},
+		ParentBlockIdentifier: block1.BlockIdentifier,
+		Timestamp:             1599002115110,
+		Transactions:          []*types.Transaction{payment},
+	}
+	for _, block := range []*types.Block{genesis, block1, block2} {
+		assert.NoError(t, i.blockStorage.SeeBlock(ctx, block))
+		assert.NoError(t, i.blockStorage.AddBlock(ctx, block))
+	}
+
+	fundingResult := &types.BlockTransaction{
+		BlockIdentifier: block1.BlockIdentifier,
+		Transaction:     funding,
+	}
+	paymentResult := &types.BlockTransaction{
+		BlockIdentifier: block2.BlockIdentifier,
+		Transaction:     payment,
+	}
+
+	or := types.OR
+	tests := map[string]struct {
+		request *types.SearchTransactionsRequest
+
+		expectedTransactions []*types.BlockTransaction
+		expectedTotal        int64
+	}{
+		"address": {
+			request: &types.SearchTransactionsRequest{
+				Address: types.String("sender"),
+			},
+			expectedTransactions: []*types.BlockTransaction{paymentResult, fundingResult},
+			expectedTotal:        2,
+		},
+		"address page": {
+			request: &types.SearchTransactionsRequest{
+				Address: types.String("sender"),
+				Offset:  types.Int64(1),
+				Limit:   types.Int64(1),
+			},
+			expectedTransactions: []*types.BlockTransaction{fundingResult},
+			expectedTotal:        2,
+		},
+		"address total stops after the page": {
+			request: &types.SearchTransactionsRequest{
+				Address: types.String("sender"),
+				Limit:   types.Int64(0),
+			},
+			expectedTransactions: []*types.BlockTransaction{},
+			expectedTotal:        1,
+		},
+		"coin or address total stops after the page": {
+			request: &types.SearchTransactionsRequest{
+				Operator:       &or,
+				Address:        types.String("sender"),
+				CoinIdentifier: &types.CoinIdentifier{Identifier: "funding:0"},
+				Limit:          types.Int64(1),
+			},
+			expectedTransactions: []*types.BlockTransaction{paymentResult},
+			expectedTotal:        2,
+		},
+		"address past last page": {
+			request: &types.SearchTransactionsRequest{
+				Address: types.String("sender"),
+				Offset:  types.Int64(2),
+			},
+			expectedTransactions: []*types.BlockTransaction{},
+			expectedTotal:        2,
+		},
+		"max block": {
+			request: &types.SearchTransactionsRequest{
+				Address:  types.String("sender"),
+				MaxBlock: types.Int64(1),
+			},
+			expectedTransactions: []*types.BlockTransaction{fundingResult},
+			expectedTotal:        1,
+		},
+		"account": {
+			request: &types.SearchTransactionsRequest{
+				AccountIdentifier: recipient,
+			},
+			expectedTransactions: []*types.BlockTransaction{paymentResult},
+			expectedTotal:        1,
+		},
+		"account with sub account": {
+			request: &types.SearchTransactionsRequest{
+				AccountIdentifier: &types.AccountIdentifier{
+					Address:    "recipient",
+					SubAccount: &types.SubAccountIdentifier{Address: "sub"},
+				},
+			},
+			expectedTransactions: []*types.BlockTransaction{},
+			expectedTotal:        0,
+		},
+		"coin": {
+			request: &types.SearchTransactionsRequest{
+				CoinIdentifier: &types.CoinIdentifier{Identifier: "funding:0"},
+			},
+			expectedTransactions: []*types.BlockTransaction{paymentResult, fundingResult},
+			expectedTotal:        2,
+		},
+		"transaction identifier": {
+			request: &types.SearchTransactionsRequest{
+				TransactionIdentifier: payment.TransactionIdentifier,
+			},
+			expectedTransactions: []*types.BlockTransaction{paymentResult},
+			expectedTotal:        1,
+		},
+		"unknown transaction identifier": {
+			request: &types.SearchTransactionsRequest{
+				TransactionIdentifier: &types.TransactionIdentifier{Hash: "unknown"},
+			},
+			expectedTransactions: []*types.BlockTransaction{},
+			expectedTotal:        0,
+		},
+		"address and operation type": {
+			request: &types.SearchTransactionsRequest{
+				Address: types.String("sender"),
+				Type:    types.String(defichain.OutputOpType),
+			},
+			expectedTransactions: []*types.BlockTransaction{fundingResult},
+			expectedTotal:        1,
+		},
+		"address and success": {
+			request: &types.SearchTransactionsRequest{
+				Address: types.String("sender"),
+				Success: types.Bool(false),
+			},
+			expectedTransactions: []*types.BlockTransaction{},
+			expectedTotal:        0,
+		},
+		"address and coin": {
+			request: &types.SearchTransactionsRequest{
+				Address:        types.String("recipient"),
+				CoinIdentifier: &types.CoinIdentifier{Identifier: "funding:0"},
+			},
+			expectedTransactions: []*types.BlockTransaction{},
+			expectedTotal:        0,
+		},
+		"address or transaction identifier": {
+			request: &types.SearchTransactionsRequest{
+				Operator:              &or,
+				Address:               types.String("recipient"),
+				TransactionIdentifier: funding.TransactionIdentifier,
+			},
+			expectedTransactions: []*types.BlockTransaction{paymentResult, fundingResult},
+			expectedTotal:        2,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			transactions, total, err := i.SearchTransactions(ctx, test.request)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedTotal, total)
+			assert.Equal(
+				t,
+				types.PrettyPrintStruct(test.expectedTransactions),
+				types.PrettyPrintStruct(transactions),
+			)
+		})
+	}
+
+	// The index is reverted when a block is removed
+	assert.NoError(t, i.blockStorage.RemoveBlock(ctx, block2.BlockIdentifier))
+	transactions, total, err := i.SearchTransactions(ctx, &types.SearchTransactionsRequest{
+		Address: types.String("sender"),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(
+		t,
+		types.PrettyPrintStruct([]*types.BlockTransaction{fundingResult}),
+		types.PrettyPrintStruct(transactions),
+	)
+
+	_, total, err = i.SearchTransactions(ctx, &types.SearchTransactionsRequest{
+		CoinIdentifier: &types.CoinIdentifier{Identifier: "payment:0"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), total)
+
+	// Blocks before the start of the index (synced
+	// before upgrading) are not searched
+	dbTx := i.database.WriteTransaction(ctx, "", true)
+	assert.NoError(t, dbTx.Set(ctx, transactionIndexStartKey(), []byte("2"), false))
+	assert.NoError(t, dbTx.Commit(ctx))
+
+	_, total, err = i.SearchTransactions(ctx, &types.SearchTransactionsRequest{
+		Address: types.String("sender"),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), total)
+
+	_, _, err = i.SearchTransactions(ctx, &types.SearchTransactionsRequest{
+		Address:  types.String("sender"),
+		MaxBlock: types.Int64(1),
+	})
+	assert.EqualError(t, err, "transactions before block 2 are not indexed")
+}
+
+func TestIndexer_BlockEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	newDir, err := utils.CreateTempDir()
+	assert.NoError(t, err)
+	defer utils.RemoveTempDir(newDir)
+
+	mockClient := &mocks.Client{}
+	cfg := &configuration.Configuration{
+		Network: &types.NetworkIdentifier{
+			Network:    defichain.MainnetNetwork,
+			Blockchain: defichain.Blockchain,
+		},
+		Currency:               defichain.MainnetCurrency,
+		GenesisBlockIdentifier: defichain.MainnetGenesisBlockIdentifier,
+		IndexerPath:            newDir,
+	}
+
+	i, err := Initialize(ctx, cancel, cfg, mockClient)
+	assert.NoError(t, err)
+	defer i.CloseDatabase(ctx)
+	i.blockStorage.Initialize(i.workers)
+
+	// No events before the first block
+	events, maxSequence, err := i.GetBlockEvents(ctx, nil, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), maxSequence)
+	assert.Empty(t, events)
+
+	_, recorded, err := i.eventStorage.GetStart(ctx)
+	assert.NoError(t, err)
+	assert.False(t, recorded)
+
+	genesis := &types.Block{
+		BlockIdentifier:       &types.BlockIdentifier{Hash: getBlockHash(0), Index: 0},
+		ParentBlockIdentifier: &types.BlockIdentifier{Hash: getBlockHash(0), Index: 0},
+		Timestamp:             1599002115110,
+	}
+	block1 := &types.Block{
+		BlockIdentifier:       &types.BlockIdentifier{Hash: getBlockHash(1), Index: 1},
+		ParentBlockIdentifier: genesis.BlockIdentifier,
+		Timestamp:             1599002115110,
+	}
+	block1Fork := &types.Block{
+		BlockIdentifier:       &types.BlockIdentifier{Hash: "block 1 fork", Index: 1},
+		ParentBlockIdentifier: genesis.BlockIdentifier,
+		Timestamp:             1599002115110,
+	}
+	for _, block := range []*types.Block{genesis, block1} {
+		assert.NoError(t, i.blockStorage.SeeBlock(ctx, block))
+		assert.NoError(t, i.blockStorage.AddBlock(ctx, block))
+	}
+
+	// Reorg block 1
+	assert.NoError(t, i.blockStorage.RemoveBlock(ctx, block1.BlockIdentifier))
+	assert.NoError(t, i.blockStorage.SeeBlock(ctx, block1Fork))
+	assert.NoError(t, i.blockStorage.AddBlock(ctx, block1Fork))
+
+	// The log starts at the first block added
+	start, recorded, err := i.eventStorage.GetStart(ctx)
+	assert.NoError(t, err)
+	assert.True(t, recorded)
+	assert.Equal(t, int64(0), start)
+
+	allEvents := []*types.BlockEvent{
+		{Sequence: 1, BlockIdentifier: genesis.BlockIdentifier, Type: types.ADDED},
+		{Sequence: 2, BlockIdentifier: block1.BlockIdentifier, Type: types.ADDED},
+		{Sequence: 3, BlockIdentifier: block1.BlockIdentifier, Type: types.REMOVED},
+		{Sequence: 4, BlockIdentifier: block1Fork.BlockIdentifier, Type: types.ADDED},
+	}
+
+	tests := map[string]struct {
+		offset *int64
+		limit  int64
+
+		expectedEvents []*types.BlockEvent
+	}{
+		"from the beginning": {
+			offset:         types.Int64(0),
+			limit:          10,
+			expectedEvents: allEvents,
+		},
+		"from an offset": {
+			offset:         types.Int64(2),
+			limit:          2,
+			expectedEvents: allEvents[1:3],
+		},
+		"past the last event": {
+			offset:         types.Int64(5),
+			limit:          2,
+			expectedEvents: []*types.BlockEvent{},
+		},
+		"backwards from tip": {
+			limit:          2,
+			expectedEvents: allEvents[2:],
+		},
+		"backwards from tip past the first event": {
+			limit:          10,
+			expectedEvents: allEvents,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			events, maxSequence, err := i.GetBlockEvents(ctx, test.offset, test.limit)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(4), maxSequence)
+			assert.Equal(t, test.expectedEvents, events)
+		})
+	}
+}
+
+func mempoolOutput(
+	hash string,
+	vout int64,
+	address string,
+	value string,
+) *types.Operation {
+	return &types.Operation{
+		OperationIdentifier: &types.OperationIdentifier{Index: vout},
+		Type:                defichain.OutputOpType,
+		Account:             &types.AccountIdentifier{Address: address},
+		Amount: &types.Amount{
+			Value:    value,
+			Currency: defichain.TestnetCurrency,
+		},
+		CoinChange: &types.CoinChange{
+			CoinIdentifier: &types.CoinIdentifier{
+				Identifier: defichain.CoinIdentifier(hash, vout),
+			},
+			CoinAction: types.CoinCreated,
+		},
+	}
+}
+
+func mempoolCoin(identifier string, value string) *types.Coin {
+	return &types.Coin{
+		CoinIdentifier: &types.CoinIdentifier{Identifier: identifier},
+		Amount: &types.Amount{
+			Value:    value,
+			Currency: defichain.TestnetCurrency,
+		},
+	}
+}
+
+func TestMempoolTracker(t *testing.T) {
+	mockClient := &mocks.Client{}
+	tracker := NewMempoolTracker(mockClient)
+	ctx := context.Background()
+
+	account := &types.AccountIdentifier{Address: "addr A"}
+	confirmed := []*types.Coin{
+		mempoolCoin("confirmed:0", "100"),
+		mempoolCoin("confirmed:1", "200"),
+	}
+
+	coins, err := tracker.AccountCoins(account, confirmed)
+	assert.Nil(t, coins)
+	assert.True(t, errors.Is(err, ErrMempoolNotSynced))
+
+	// tx2 can't be fetched on the first poll
+	// and spends an output of tx1.
+	tx1 := &defichain.Transaction{
+		Hash:   "tx1",
+		Inputs: []*defichain.Input{{TxHash: "confirmed", Vout: 0}},
+	}
+	tx2 := &defichain.Transaction{
+		Hash:   "tx2",
+		Inputs: []*defichain.Input{{TxHash: "tx1", Vout: 1}},
+	}
+	tx3 := &defichain.Transaction{
+		Hash:   "tx3",
+		Inputs: []*defichain.Input{{TxHash: "confirmed", Vout: 1}},
+	}
+
+	mockClient.On("RawMempool", ctx).Return([]string{"tx1", "tx2"}, nil).Once()
+	mockClient.On("GetRawTransaction", ctx, "tx1", "").Return(tx1, nil).Once()
+	mockClient.On(
+		"GetRawTransaction",
+		ctx,
+		"tx2",
+		"",
+	).Return(nil, errors.New("not found")).Once()
+	mockClient.On("ParseOutputs", tx1).Return([]*types.Operation{
+		mempoolOutput("tx1", 0, "addr B", "40"),
+		mempoolOutput("tx1", 1, "addr A", "50"),
+		{
+			OperationIdentifier: &types.OperationIdentifier{Index: 2},
+			Type:                defichain.OutputOpType,
+		},
+	}, nil).Once()
+	assert.NoError(t, tracker.sync(ctx))
+
+	coins, err = tracker.AccountCoins(account, confirmed)
+	assert.NoError(t, err)
+	assert.Equal(t, []*types.Coin{
+		mempoolCoin("confirmed:1", "200"),
+		mempoolCoin("tx1:1", "50"),
+	}, coins)
+
+	// tx1 is still in the mempool, so it isn't fetched
+	// again, and tx2 isn't retried while it stays there.
+	mockClient.On("RawMempool", ctx).Return([]string{"tx1", "tx2"}, nil).Once()
+	assert.NoError(t, tracker.sync(ctx))
+
+	coins, err = tracker.AccountCoins(account, confirmed)
+	assert.NoError(t, err)
+	assert.Equal(t, []*types.Coin{
+		mempoolCoin("confirmed:1", "200"),
+		mempoolCoin("tx1:1", "50"),
+	}, coins)
+
+	// tx2 is retried once it leaves and
+	// reenters the mempool.
+	mockClient.On("RawMempool", ctx).Return([]string{"tx1"}, nil).Once()
+	assert.NoError(t, tracker.sync(ctx))
+
+	mockClient.On("RawMempool", ctx).Return([]string{"tx1", "tx2"}, nil).Once()
+	mockClient.On("GetRawTransaction", ctx, "tx2", "").Return(tx2, nil).Once()
+	mockClient.On("ParseOutputs", tx2).Return([]*types.Operation{
+		mempoolOutput("tx2", 0, "addr A", "45"),
+	}, nil).Once()
+	assert.NoError(t, tracker.sync(ctx))
+
+	coins, err = tracker.AccountCoins(account, confirmed)
+	assert.NoError(t, err)
+	assert.Equal(t, []*types.Coin{
+		mempoolCoin("confirmed:1", "200"),
+		mempoolCoin("tx2:0", "45"),
+	}, coins)
+
+	// tx1 and tx2 were mined (their coins are now confirmed)
+	// and tx3 entered the mempool.
+	mockClient.On("RawMempool", ctx).Return([]string{"tx3"}, nil).Once()
+	mockClient.On("GetRawTransaction", ctx, "tx3", "").Return(tx3, nil).Once()
+	mockClient.On("ParseOutputs", tx3).Return([]*types.Operation{
+		mempoolOutput("tx3", 0, "addr B", "190"),
+	}, nil).Once()
+	assert.NoError(t, tracker.sync(ctx))
+
+	coins, err = tracker.AccountCoins(account, []*types.Coin{
+		mempoolCoin("confirmed:1", "200"),
+		mempoolCoin("tx2:0", "45"),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []*types.Coin{
+		mempoolCoin("tx2:0", "45"),
+	}, coins)
+
+	// Errors fetching the mempool keep the
+	// last synced transactions.
+	mockClient.On("RawMempool", ctx).Return(nil, errors.New("rpc error")).Once()
+	assert.Error(t, tracker.sync(ctx))
+
+	coins, err = tracker.AccountCoins(account, confirmed)
+	assert.NoError(t, err)
+	assert.Equal(t, []*types.Coin{
+		mempoolCoin("confirmed:0", "100"),
+	}, coins)
+
+	mockClient.AssertExpectations(t)
+}
+
+func TestIndexer_GetInputCoins(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	newDir, err := utils.CreateTempDir()
+	assert.NoError(t, err)
+	defer utils.RemoveTempDir(newDir)
+
+	mockClient := &mocks.Client{}
+	cfg := &configuration.Configuration{
+		Network: &types.NetworkIdentifier{
+			Network:    defichain.MainnetNetwork,
+			Blockchain: defichain.Blockchain,
+		},
+		Currency:               defichain.MainnetCurrency,
+		GenesisBlockIdentifier: defichain.MainnetGenesisBlockIdentifier,
+		IndexerPath:            newDir,
+	}
+
+	i, err := Initialize(ctx, cancel, cfg, mockClient)
+	assert.NoError(t, err)
+	defer i.CloseDatabase(ctx)
+	i.blockStorage.Initialize(i.workers)
+
+	account := &types.AccountIdentifier{Address: "addr A"}
+	confirmed := &types.Operation{
+		OperationIdentifier: &types.OperationIdentifier{
+			Index:        0,
+			NetworkIndex: &index0,
+		},
+		Status:  types.String(defichain.SuccessStatus),
+		Type:    defichain.OutputOpType,
+		Account: account,
+		Amount: &types.Amount{
+			Value:    "100",
+			Currency: defichain.MainnetCurrency,
+		},
+		CoinChange: &types.CoinChange{
+			CoinAction: types.CoinCreated,
+			CoinIdentifier: &types.CoinIdentifier{
+				Identifier: "confirmed:0",
+			},
+		},
+	}
+	genesis := &types.Block{
+		BlockIdentifier:       &types.BlockIdentifier{Hash: getBlockHash(0), Index: 0},
+		ParentBlockIdentifier: &types.BlockIdentifier{Hash: getBlockHash(0), Index: 0},
+		Timestamp:             1599002115110,
+		Transactions: []*types.Transaction{
+			{
+				TransactionIdentifier: &types.TransactionIdentifier{Hash: "confirmed"},
+				Operations:            []*types.Operation{confirmed},
+			},
+		},
+	}
+	assert.NoError(t, i.blockStorage.SeeBlock(ctx, genesis))
+	assert.NoError(t, i.blockStorage.AddBlock(ctx, genesis))
+
+	// tx1 is tracked and tx2 entered the
+	// mempool after the last poll.
+	tx1 := &defichain.Transaction{Hash: "tx1"}
+	tx2 := &defichain.Transaction{Hash: "tx2"}
+	mockClient.On("RawMempool", ctx).Return([]string{"tx1"}, nil).Once()
+	mockClient.On("GetRawTransaction", ctx, "tx1", "").Return(tx1, nil).Once()
+	mockClient.On("ParseOutputs", tx1).Return([]*types.Operation{
+		mempoolOutput("tx1", 0, "addr B", "40"),
+	}, nil).Once()
+	assert.NoError(t, i.mempool.sync(ctx))
+
+	mockClient.On("GetRawTransaction", ctx, "tx2", "").Return(tx2, nil).Once()
+	mockClient.On("ParseOutputs", tx2).Return([]*types.Operation{
+		mempoolOutput("tx2", 0, "addr A", "30"),
+		mempoolOutput("tx2", 1, "addr C", "20"),
+	}, nil).Once()
+
+	// Outputs of tx2 are fetched once.
+	coins, err := i.GetInputCoins(ctx, &defichain.Transaction{
+		Hash: "tx3",
+		Inputs: []*defichain.Input{
+			{TxHash: "confirmed", Vout: 0},
+			{TxHash: "tx1", Vout: 0},
+			{TxHash: "tx2", Vout: 1},
+			{TxHash: "tx2", Vout: 0},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]*types.AccountCoin{
+		"confirmed:0": {
+			Account: account,
+			Coin: &types.Coin{
+				CoinIdentifier: confirmed.CoinChange.CoinIdentifier,
+				Amount:         confirmed.Amount,
+			},
+		},
+		"tx1:0": {
+			Account: &types.AccountIdentifier{Address: "addr B"},
+			Coin:    mempoolCoin("tx1:0", "40"),
+		},
+		"tx2:0": {
+			Account: &types.AccountIdentifier{Address: "addr A"},
+			Coin:    mempoolCoin("tx2:0", "30"),
+		},
+		"tx2:1": {
+			Account: &types.AccountIdentifier{Address: "addr C"},
+			Coin:    mempoolCoin("tx2:1", "20"),
+		},
+	}, coins)
+
+	// The parent of tx4 isn't in the mempool.
+	mockClient.On(
+		"GetRawTransaction",
+		ctx,
+		"missing",
+		"",
+	).Return(nil, errors.New("not found")).Once()
+	coins, err = i.GetInputCoins(ctx, &defichain.Transaction{
+		Hash:   "tx4",
+		Inputs: []*defichain.Input{{TxHash: "missing", Vout: 0}},
+	})
+	assert.Nil(t, coins)
+	assert.Error(t, err)
+
+	// tx1 doesn't have a second output.
+	mockClient.On("GetRawTransaction", ctx, "tx1", "").Return(tx1, nil).Once()
+	mockClient.On("ParseOutputs", tx1).Return([]*types.Operation{
+		mempoolOutput("tx1", 0, "addr B", "40"),
+	}, nil).Once()
+	coins, err = i.GetInputCoins(ctx, &defichain.Transaction{
+		Hash:   "tx5",
+		Inputs: []*defichain.Input{{TxHash: "tx1", Vout: 1}},
+	})
+	assert.Nil(t, coins)
+	assert.Error(t, err)
+
+	mockClient.AssertExpectations(t)
+}
@@ -0,0 +1,267 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/DeFiCh/rosetta-defichain/defichain"
+	"github.com/DeFiCh/rosetta-defichain/utils"
+
+	"github.com/coinbase/rosetta-sdk-go/types"
+	sdkUtils "github.com/coinbase/rosetta-sdk-go/utils"
+)
+
+const (
+	// mempoolPollInterval is how often the mempool
+	// tracker polls the mempool of defid.
+	mempoolPollInterval = 5 * time.Second
+)
+
+var (
+	// ErrMempoolNotSynced is returned when the mempool
+	// is queried before the tracker polled it once.
+	ErrMempoolNotSynced = errors.New("mempool not synced")
+)
+
+// mempoolTransaction is the coins spent and
+// created by a transaction in the mempool.
+type mempoolTransaction struct {
+	spent   []string
+	created []*types.AccountCoin
+}
+
+// MempoolTracker follows the mempool of defid by polling
+// getrawmempool and decoding each new transaction once.
+type MempoolTracker struct {
+	client Client
+
+	mutex        sync.RWMutex
+	synced       bool
+	transactions map[string]*mempoolTransaction
+
+	// failed is the transactions that couldn't be decoded,
+	// which aren't retried until they leave the mempool. It
+	// is only accessed by sync.
+	failed map[string]struct{}
+}
+
+// NewMempoolTracker returns a new MempoolTracker.
+func NewMempoolTracker(client Client) *MempoolTracker {
+	return &MempoolTracker{
+		client:       client,
+		transactions: map[string]*mempoolTransaction{},
+		failed:       map[string]struct{}{},
+	}
+}
+
+// Track polls the mempool of defid until
+// the context is canceled.
+func (m *MempoolTracker) Track(ctx context.Context) error {
+	logger := utils.ExtractLogger(ctx, "mempool")
+	for ctx.Err() == nil {
+		if err := m.sync(ctx); err != nil {
+			logger.Warnw("unable to sync mempool", "error", err)
+		}
+
+		if err := sdkUtils.ContextSleep(ctx, mempoolPollInterval); err != nil {
+			return err
+		}
+	}
+
+	return ctx.Err()
+}
+
+// sync diffs the mempool of defid with the tracked
+// transactions, decoding each new transaction.
+func (m *MempoolTracker) sync(ctx context.Context) error {
+	txids, err := m.client.RawMempool(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: unable to get raw mempool", err)
+	}
+
+	m.mutex.RLock()
+	transactions := make(map[string]*mempoolTransaction, len(txids))
+	for _, txid := range txids {
+		if transaction, ok := m.transactions[txid]; ok {
+			transactions[txid] = transaction
+		}
+	}
+	m.mutex.RUnlock()
+
+	logger := utils.ExtractLogger(ctx, "mempool")
+	failed := map[string]struct{}{}
+	for _, txid := range txids {
+		if _, ok := transactions[txid]; ok {
+			continue
+		}
+
+		if _, ok := m.failed[txid]; ok {
+			failed[txid] = struct{}{}
+			continue
+		}
+
+		transaction, err := m.decodeTransaction(ctx, txid)
+		if err != nil {
+			// The transaction may have been mined or evicted
+			// since the mempool was fetched. Either way, it is
+			// only retried if it leaves and reenters the mempool.
+			logger.Warnw("unable to decode mempool transaction", "txid", txid, "error", err)
+			failed[txid] = struct{}{}
+			continue
+		}
+
+		transactions[txid] = transaction
+	}
+
+	m.failed = failed
+
+	m.mutex.Lock()
+	m.transactions = transactions
+	m.synced = true
+	m.mutex.Unlock()
+
+	return nil
+}
+
+// decodeTransaction returns the coins spent and created
+// by a transaction in the mempool.
+func (m *MempoolTracker) decodeTransaction(
+	ctx context.Context,
+	txid string,
+) (*mempoolTransaction, error) {
+	tx, err := m.client.GetRawTransaction(ctx, txid, "")
+	if err != nil {
+		return nil, fmt.Errorf("%w: unable to get mempool transaction %s", err, txid)
+	}
+
+	ops, err := m.client.ParseOutputs(tx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unable to parse mempool transaction %s", err, txid)
+	}
+
+	transaction := &mempoolTransaction{
+		spent:   make([]string, len(tx.Inputs)),
+		created: []*types.AccountCoin{},
+	}
+	for i, input := range tx.Inputs {
+		transaction.spent[i] = defichain.CoinIdentifier(input.TxHash, input.Vout)
+	}
+
+	for _, op := range ops {
+		if op.CoinChange == nil {
+			continue
+		}
+
+		transaction.created = append(transaction.created, &types.AccountCoin{
+			Account: op.Account,
+			Coin: &types.Coin{
+				CoinIdentifier: op.CoinChange.CoinIdentifier,
+				Amount:         op.Amount,
+			},
+		})
+	}
+
+	return transaction, nil
+}
+
+// AccountCoins overlays the coins spent and created by
+// mempool transactions on the confirmed coins of an
+// account. Coins created in the mempool are appended
+// (sorted by identifier) unless a mempool transaction
+// already spends them.
+func (m *MempoolTracker) AccountCoins(
+	accountIdentifier *types.AccountIdentifier,
+	coins []*types.Coin,
+) ([]*types.Coin, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if !m.synced {
+		return nil, ErrMempoolNotSynced
+	}
+
+	spent := map[string]struct{}{}
+	for _, transaction := range m.transactions {
+		for _, coin := range transaction.spent {
+			spent[coin] = struct{}{}
+		}
+	}
+
+	overlay := []*types.Coin{}
+	included := map[string]struct{}{}
+	for _, coin := range coins {
+		if _, ok := spent[coin.CoinIdentifier.Identifier]; ok {
+			continue
+		}
+
+		overlay = append(overlay, coin)
+		included[coin.CoinIdentifier.Identifier] = struct{}{}
+	}
+
+	created := []*types.Coin{}
+	account := types.Hash(accountIdentifier)
+	for _, transaction := range m.transactions {
+		for _, accountCoin := range transaction.created {
+			identifier := accountCoin.Coin.CoinIdentifier.Identifier
+			if types.Hash(accountCoin.Account) != account {
+				continue
+			}
+
+			if _, ok := spent[identifier]; ok {
+				continue
+			}
+
+			// The transaction may be confirmed before
+			// the next poll.
+			if _, ok := included[identifier]; ok {
+				continue
+			}
+
+			created = append(created, accountCoin.Coin)
+		}
+	}
+
+	sort.Slice(created, func(i, j int) bool {
+		return created[i].CoinIdentifier.Identifier < created[j].CoinIdentifier.Identifier
+	})
+
+	return append(overlay, created...), nil
+}
+
+// Coin returns a coin created by a transaction
+// in the mempool.
+func (m *MempoolTracker) Coin(coinIdentifier string) (*types.AccountCoin, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	transaction, ok := m.transactions[defichain.TransactionHash(coinIdentifier)]
+	if !ok {
+		return nil, false
+	}
+
+	for _, accountCoin := range transaction.created {
+		if accountCoin.Coin.CoinIdentifier.Identifier == coinIdentifier {
+			return accountCoin, true
+		}
+	}
+
+	return nil, false
+}
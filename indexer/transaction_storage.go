@@ -0,0 +1,434 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/coinbase/rosetta-sdk-go/storage/database"
+	"github.com/coinbase/rosetta-sdk-go/storage/modules"
+	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/neilotoole/errgroup"
+)
+
+const (
+	// transactionIndexNamespace is the namespace transaction
+	// storage uses to index the transactions of each
+	// address and coin.
+	transactionIndexNamespace = "txi"
+
+	addressKind = "addr"
+	coinKind    = "coin"
+)
+
+var (
+	// errStopScan is returned by a scan handler to stop
+	// scanning the transaction index.
+	errStopScan = errors.New("stop scan")
+)
+
+var _ modules.BlockWorker = (*TransactionStorage)(nil)
+
+// TransactionStorage indexes the transactions touching each
+// address and coin. It is a modules.BlockWorker, so the index
+// is updated in the same database transaction as the block
+// (and reverted when the block is removed during a reorg).
+//
+// The index starts at the first block added after it was
+// introduced, so databases synced by an older version only
+// index blocks synced after upgrading. The start is stored
+// so searches can refuse older blocks.
+type TransactionStorage struct{}
+
+// indexedTransaction is a transaction found in
+// transaction storage.
+type indexedTransaction struct {
+	blockIdentifier       *types.BlockIdentifier
+	transactionIdentifier *types.TransactionIdentifier
+}
+
+// key returns a unique key of an indexed transaction.
+func (t *indexedTransaction) key() string {
+	return t.blockIdentifier.Hash + "/" + t.transactionIdentifier.Hash
+}
+
+// NewTransactionStorage returns a new TransactionStorage.
+func NewTransactionStorage() *TransactionStorage {
+	return &TransactionStorage{}
+}
+
+// transactionIndexStartKey returns the key of the
+// index of the first block in the transaction index.
+func transactionIndexStartKey() []byte {
+	return []byte(fmt.Sprintf("%s/start", transactionIndexNamespace))
+}
+
+// getIndexStart returns the index of the first block in
+// the transaction index (false if no block was indexed).
+func (t *TransactionStorage) getIndexStart(
+	ctx context.Context,
+	dbTx database.Transaction,
+) (int64, bool, error) {
+	exists, value, err := dbTx.Get(ctx, transactionIndexStartKey())
+	if err != nil {
+		return -1, false, fmt.Errorf("%w: unable to get transaction index start", err)
+	}
+
+	if !exists {
+		return -1, false, nil
+	}
+
+	start, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil {
+		return -1, false, fmt.Errorf(
+			"%w: unable to parse transaction index start %s",
+			err,
+			string(value),
+		)
+	}
+
+	return start, true, nil
+}
+
+// transactionIndexPrefix returns the prefix of all
+// transactions indexed for a term (an address or coin).
+func transactionIndexPrefix(kind string, term string) []byte {
+	return []byte(fmt.Sprintf("%s/%s/%s/", transactionIndexNamespace, kind, term))
+}
+
+// transactionIndexKey returns the key of a transaction
+// indexed for a term. Block indexes are zero-padded so
+// keys are sorted by block.
+func transactionIndexKey(
+	kind string,
+	term string,
+	blockIndex int64,
+	transactionIdentifier *types.TransactionIdentifier,
+) []byte {
+	return []byte(fmt.Sprintf(
+		"%s%020d/%s",
+		transactionIndexPrefix(kind, term),
+		blockIndex,
+		transactionIdentifier.Hash,
+	))
+}
+
+// transactionIndexKeys returns the keys of all transactions
+// of a block in the index.
+func transactionIndexKeys(block *types.Block) [][]byte {
+	keys := [][]byte{}
+	for _, transaction := range block.Transactions {
+		seen := map[string]struct{}{}
+		for _, op := range transaction.Operations {
+			terms := [][2]string{}
+			if op.Account != nil {
+				terms = append(terms, [2]string{addressKind, op.Account.Address})
+			}
+
+			if op.CoinChange != nil {
+				terms = append(
+					terms,
+					[2]string{coinKind, op.CoinChange.CoinIdentifier.Identifier},
+				)
+			}
+
+			for _, term := range terms {
+				key := transactionIndexKey(
+					term[0],
+					term[1],
+					block.BlockIdentifier.Index,
+					transaction.TransactionIdentifier,
+				)
+				if _, ok := seen[string(key)]; ok {
+					continue
+				}
+
+				seen[string(key)] = struct{}{}
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	return keys
+}
+
+// AddingBlock is called by BlockStorage when adding a block.
+func (t *TransactionStorage) AddingBlock(
+	ctx context.Context,
+	g *errgroup.Group,
+	block *types.Block,
+	transaction database.Transaction,
+) (database.CommitWorker, error) {
+	_, indexed, err := t.getIndexStart(ctx, transaction)
+	if err != nil {
+		return nil, err
+	}
+
+	if !indexed {
+		if err := transaction.Set(
+			ctx,
+			transactionIndexStartKey(),
+			[]byte(strconv.FormatInt(block.BlockIdentifier.Index, 10)),
+			false,
+		); err != nil {
+			return nil, fmt.Errorf("%w: unable to store transaction index start", err)
+		}
+	}
+
+	for _, key := range transactionIndexKeys(block) {
+		if err := transaction.Set(
+			ctx,
+			key,
+			[]byte(block.BlockIdentifier.Hash),
+			false,
+		); err != nil {
+			return nil, fmt.Errorf("%w: unable to index transaction %s", err, string(key))
+		}
+	}
+
+	return nil, nil
+}
+
+// RemovingBlock is called by BlockStorage when removing a block.
+func (t *TransactionStorage) RemovingBlock(
+	ctx context.Context,
+	g *errgroup.Group,
+	block *types.Block,
+	transaction database.Transaction,
+) (database.CommitWorker, error) {
+	for _, key := range transactionIndexKeys(block) {
+		if err := transaction.Delete(ctx, key); err != nil {
+			return nil, fmt.Errorf("%w: unable to unindex transaction %s", err, string(key))
+		}
+	}
+
+	return nil, nil
+}
+
+// scanTransactions calls handler with the transactions
+// indexed for a term in blocks between minBlock and maxBlock
+// (if not nil), starting with the most recent, until handler
+// returns false.
+func (t *TransactionStorage) scanTransactions(
+	ctx context.Context,
+	dbTx database.Transaction,
+	kind string,
+	term string,
+	minBlock int64,
+	maxBlock *int64,
+	handler func(*indexedTransaction) (bool, error),
+) error {
+	prefix := transactionIndexPrefix(kind, term)
+
+	// A reverse scan starts at the largest
+	// key lower than seekStart.
+	seekStart := append(append([]byte{}, prefix...), 0xff)
+	if maxBlock != nil {
+		seekStart = []byte(fmt.Sprintf("%s%020d/\xff", prefix, *maxBlock))
+	}
+
+	_, err := dbTx.Scan(
+		ctx,
+		prefix,
+		seekStart,
+		func(k []byte, v []byte) error {
+			parts := strings.SplitN(string(k[len(prefix):]), "/", 2) // nolint:gomnd
+			if len(parts) != 2 {                                     // nolint:gomnd
+				return fmt.Errorf("invalid transaction index key %s", string(k))
+			}
+
+			blockIndex, err := strconv.ParseInt(parts[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("%w: unable to parse block index %s", err, parts[0])
+			}
+
+			// Transactions of pruned blocks can't be returned
+			// and all remaining keys are older.
+			if blockIndex < minBlock {
+				return errStopScan
+			}
+
+			next, err := handler(&indexedTransaction{
+				blockIdentifier: &types.BlockIdentifier{
+					Index: blockIndex,
+					Hash:  string(v),
+				},
+				transactionIdentifier: &types.TransactionIdentifier{Hash: parts[1]},
+			})
+			if err != nil {
+				return err
+			}
+
+			if !next {
+				return errStopScan
+			}
+
+			return nil
+		},
+		false,
+		true,
+	)
+	if err != nil && !errors.Is(err, errStopScan) {
+		return fmt.Errorf("%w: unable to scan transaction index", err)
+	}
+
+	return nil
+}
+
+// isIndexed returns whether a transaction is
+// indexed for a term.
+func (t *TransactionStorage) isIndexed(
+	ctx context.Context,
+	dbTx database.Transaction,
+	kind string,
+	term string,
+	transaction *indexedTransaction,
+) (bool, error) {
+	exists, _, err := dbTx.Get(ctx, transactionIndexKey(
+		kind,
+		term,
+		transaction.blockIdentifier.Index,
+		transaction.transactionIdentifier,
+	))
+	if err != nil {
+		return false, fmt.Errorf("%w: unable to get transaction index key", err)
+	}
+
+	return exists, nil
+}
+
+// searchTerms returns the indexed terms of a
+// *types.SearchTransactionsRequest.
+func searchTerms(request *types.SearchTransactionsRequest) [][2]string {
+	terms := [][2]string{}
+	if request.Address != nil {
+		terms = append(terms, [2]string{addressKind, *request.Address})
+	}
+
+	if request.AccountIdentifier != nil {
+		terms = append(terms, [2]string{addressKind, request.AccountIdentifier.Address})
+	}
+
+	if request.CoinIdentifier != nil {
+		terms = append(terms, [2]string{coinKind, request.CoinIdentifier.Identifier})
+	}
+
+	return terms
+}
+
+// matchesTransaction returns whether a transaction matches
+// the conditions of a *types.SearchTransactionsRequest. With
+// the AND operator, one operation must match all operation
+// conditions. With the OR operator, any condition can match.
+func matchesTransaction(
+	request *types.SearchTransactionsRequest,
+	transaction *types.Transaction,
+	successful map[string]bool,
+) bool {
+	or := request.Operator != nil && *request.Operator == types.OR
+	if request.TransactionIdentifier != nil {
+		matches := request.TransactionIdentifier.Hash == transaction.TransactionIdentifier.Hash
+		if matches && or {
+			return true
+		}
+
+		if !matches && !or {
+			return false
+		}
+	}
+
+	// Without operation conditions, the transaction
+	// identifier is the only condition.
+	if len(operationConditions(request, &types.Operation{}, successful)) == 0 {
+		return !or
+	}
+
+	for _, op := range transaction.Operations {
+		conditions := operationConditions(request, op, successful)
+		matches := !or
+		for _, condition := range conditions {
+			if or {
+				matches = matches || condition
+			} else {
+				matches = matches && condition
+			}
+		}
+
+		if matches {
+			return true
+		}
+	}
+
+	return false
+}
+
+// operationConditions returns whether an operation matches
+// each operation condition of a *types.SearchTransactionsRequest.
+func operationConditions(
+	request *types.SearchTransactionsRequest,
+	op *types.Operation,
+	successful map[string]bool,
+) []bool {
+	conditions := []bool{}
+	if request.Address != nil {
+		conditions = append(
+			conditions,
+			op.Account != nil && op.Account.Address == *request.Address,
+		)
+	}
+
+	if request.AccountIdentifier != nil {
+		conditions = append(
+			conditions,
+			op.Account != nil && types.Hash(op.Account) == types.Hash(request.AccountIdentifier),
+		)
+	}
+
+	if request.CoinIdentifier != nil {
+		conditions = append(
+			conditions,
+			op.CoinChange != nil &&
+				op.CoinChange.CoinIdentifier.Identifier == request.CoinIdentifier.Identifier,
+		)
+	}
+
+	if request.Currency != nil {
+		conditions = append(
+			conditions,
+			op.Amount != nil && types.Hash(op.Amount.Currency) == types.Hash(request.Currency),
+		)
+	}
+
+	if request.Type != nil {
+		conditions = append(conditions, op.Type == *request.Type)
+	}
+
+	if request.Status != nil {
+		conditions = append(conditions, op.Status != nil && *op.Status == *request.Status)
+	}
+
+	if request.Success != nil {
+		conditions = append(
+			conditions,
+			op.Status != nil && successful[*op.Status] == *request.Success,
+		)
+	}
+
+	return conditions
+}
@@ -84,6 +84,8 @@ func startOnlineDependencies(
 		defichain.LocalhostURL(cfg.RPCPort),
 		cfg.GenesisBlockIdentifier,
 		cfg.Currency,
+		cfg.Params,
+		cfg.Exemptions,
 	)
 
 	g.Go(func() error {
@@ -108,6 +110,10 @@ func startOnlineDependencies(
 		return i.Prune(ctx)
 	})
 
+	g.Go(func() error {
+		return i.TrackMempool(ctx)
+	})
+
 	return client, i, nil
 }
 
@@ -156,7 +162,7 @@ func main() {
 		defichain.OperationTypes,
 		services.HistoricalBalanceLookup,
 		[]*types.NetworkIdentifier{cfg.Network},
-		nil,
+		services.CallMethods,
 		services.MempoolCoins,
 	)
 	if err != nil {
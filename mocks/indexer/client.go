@@ -161,3 +161,49 @@ func (_m *Client) PruneBlockchain(_a0 context.Context, _a1 int64) (int64, error)
 
 	return r0, r1
 }
+
+// ParseOutputs provides a mock function with given fields: _a0
+func (_m *Client) ParseOutputs(_a0 *defichain.Transaction) ([]*types.Operation, error) {
+	ret := _m.Called(_a0)
+
+	var r0 []*types.Operation
+	if rf, ok := ret.Get(0).(func(*defichain.Transaction) []*types.Operation); ok {
+		r0 = rf(_a0)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*types.Operation)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*defichain.Transaction) error); ok {
+		r1 = rf(_a0)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RawMempool provides a mock function with given fields: _a0
+func (_m *Client) RawMempool(_a0 context.Context) ([]string, error) {
+	ret := _m.Called(_a0)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(context.Context) []string); ok {
+		r0 = rf(_a0)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(_a0)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
@@ -62,6 +62,73 @@ func (_m *Client) GetRawTransaction(_a0 context.Context, _a1 string, _a2 string)
 	return r0, r1
 }
 
+// MempoolEntry provides a mock function with given fields: _a0, _a1
+func (_m *Client) MempoolEntry(_a0 context.Context, _a1 string) (*defichain.MempoolEntry, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 *defichain.MempoolEntry
+	if rf, ok := ret.Get(0).(func(context.Context, string) *defichain.MempoolEntry); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*defichain.MempoolEntry)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MempoolFeeRate provides a mock function with given fields: _a0
+func (_m *Client) MempoolFeeRate(_a0 context.Context) (float64, error) {
+	ret := _m.Called(_a0)
+
+	var r0 float64
+	if rf, ok := ret.Get(0).(func(context.Context) float64); ok {
+		r0 = rf(_a0)
+	} else {
+		r0 = ret.Get(0).(float64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(_a0)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ParseTransaction provides a mock function with given fields: _a0, _a1, _a2
+func (_m *Client) ParseTransaction(_a0 context.Context, _a1 *defichain.Transaction, _a2 map[string]*types.AccountCoin) (*types.Transaction, error) {
+	ret := _m.Called(_a0, _a1, _a2)
+
+	var r0 *types.Transaction
+	if rf, ok := ret.Get(0).(func(context.Context, *defichain.Transaction, map[string]*types.AccountCoin) *types.Transaction); ok {
+		r0 = rf(_a0, _a1, _a2)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*types.Transaction)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *defichain.Transaction, map[string]*types.AccountCoin) error); ok {
+		r1 = rf(_a0, _a1, _a2)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // RawMempool provides a mock function with given fields: _a0
 func (_m *Client) RawMempool(_a0 context.Context) ([]string, error) {
 	ret := _m.Called(_a0)
@@ -106,19 +173,42 @@ func (_m *Client) SendRawTransaction(_a0 context.Context, _a1 string) (string, e
 	return r0, r1
 }
 
-// SuggestedFeeRate provides a mock function with given fields: _a0, _a1
-func (_m *Client) SuggestedFeeRate(_a0 context.Context, _a1 int64) (float64, error) {
-	ret := _m.Called(_a0, _a1)
+// SuggestedFeeRate provides a mock function with given fields: _a0, _a1, _a2
+func (_m *Client) SuggestedFeeRate(_a0 context.Context, _a1 int64, _a2 defichain.EstimateMode) (float64, error) {
+	ret := _m.Called(_a0, _a1, _a2)
 
 	var r0 float64
-	if rf, ok := ret.Get(0).(func(context.Context, int64) float64); ok {
-		r0 = rf(_a0, _a1)
+	if rf, ok := ret.Get(0).(func(context.Context, int64, defichain.EstimateMode) float64); ok {
+		r0 = rf(_a0, _a1, _a2)
 	} else {
 		r0 = ret.Get(0).(float64)
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+	if rf, ok := ret.Get(1).(func(context.Context, int64, defichain.EstimateMode) error); ok {
+		r1 = rf(_a0, _a1, _a2)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// TestMempoolAccept provides a mock function with given fields: _a0, _a1
+func (_m *Client) TestMempoolAccept(_a0 context.Context, _a1 string) (*defichain.MempoolAcceptResult, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 *defichain.MempoolAcceptResult
+	if rf, ok := ret.Get(0).(func(context.Context, string) *defichain.MempoolAcceptResult); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*defichain.MempoolAcceptResult)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
 		r1 = rf(_a0, _a1)
 	} else {
 		r1 = ret.Error(1)
@@ -126,3 +216,26 @@ func (_m *Client) SuggestedFeeRate(_a0 context.Context, _a1 int64) (float64, err
 
 	return r0, r1
 }
+
+// VerboseRawMempool provides a mock function with given fields: _a0
+func (_m *Client) VerboseRawMempool(_a0 context.Context) (map[string]*defichain.MempoolEntry, error) {
+	ret := _m.Called(_a0)
+
+	var r0 map[string]*defichain.MempoolEntry
+	if rf, ok := ret.Get(0).(func(context.Context) map[string]*defichain.MempoolEntry); ok {
+		r0 = rf(_a0)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]*defichain.MempoolEntry)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(_a0)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
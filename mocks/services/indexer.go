@@ -17,21 +17,21 @@ type Indexer struct {
 	mock.Mock
 }
 
-// GetBalance provides a mock function with given fields: _a0, _a1, _a2, _a3
-func (_m *Indexer) GetBalance(_a0 context.Context, _a1 *types.AccountIdentifier, _a2 *types.Currency, _a3 *types.PartialBlockIdentifier) (*types.Amount, *types.BlockIdentifier, error) {
+// GetBalances provides a mock function with given fields: _a0, _a1, _a2, _a3
+func (_m *Indexer) GetBalances(_a0 context.Context, _a1 *types.AccountIdentifier, _a2 []*types.Currency, _a3 *types.PartialBlockIdentifier) ([]*types.Amount, *types.BlockIdentifier, error) {
 	ret := _m.Called(_a0, _a1, _a2, _a3)
 
-	var r0 *types.Amount
-	if rf, ok := ret.Get(0).(func(context.Context, *types.AccountIdentifier, *types.Currency, *types.PartialBlockIdentifier) *types.Amount); ok {
+	var r0 []*types.Amount
+	if rf, ok := ret.Get(0).(func(context.Context, *types.AccountIdentifier, []*types.Currency, *types.PartialBlockIdentifier) []*types.Amount); ok {
 		r0 = rf(_a0, _a1, _a2, _a3)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*types.Amount)
+			r0 = ret.Get(0).([]*types.Amount)
 		}
 	}
 
 	var r1 *types.BlockIdentifier
-	if rf, ok := ret.Get(1).(func(context.Context, *types.AccountIdentifier, *types.Currency, *types.PartialBlockIdentifier) *types.BlockIdentifier); ok {
+	if rf, ok := ret.Get(1).(func(context.Context, *types.AccountIdentifier, []*types.Currency, *types.PartialBlockIdentifier) *types.BlockIdentifier); ok {
 		r1 = rf(_a0, _a1, _a2, _a3)
 	} else {
 		if ret.Get(1) != nil {
@@ -40,7 +40,7 @@ func (_m *Indexer) GetBalance(_a0 context.Context, _a1 *types.AccountIdentifier,
 	}
 
 	var r2 error
-	if rf, ok := ret.Get(2).(func(context.Context, *types.AccountIdentifier, *types.Currency, *types.PartialBlockIdentifier) error); ok {
+	if rf, ok := ret.Get(2).(func(context.Context, *types.AccountIdentifier, []*types.Currency, *types.PartialBlockIdentifier) error); ok {
 		r2 = rf(_a0, _a1, _a2, _a3)
 	} else {
 		r2 = ret.Error(2)
@@ -95,6 +95,29 @@ func (_m *Indexer) GetBlockTransaction(_a0 context.Context, _a1 *types.BlockIden
 	return r0, r1
 }
 
+// GetCoinBlocks provides a mock function with given fields: _a0, _a1
+func (_m *Indexer) GetCoinBlocks(_a0 context.Context, _a1 []*types.Coin) ([]*types.BlockIdentifier, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 []*types.BlockIdentifier
+	if rf, ok := ret.Get(0).(func(context.Context, []*types.Coin) []*types.BlockIdentifier); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*types.BlockIdentifier)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []*types.Coin) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetCoins provides a mock function with given fields: _a0, _a1
 func (_m *Indexer) GetCoins(_a0 context.Context, _a1 *types.AccountIdentifier) ([]*types.Coin, *types.BlockIdentifier, error) {
 	ret := _m.Called(_a0, _a1)
@@ -127,6 +150,52 @@ func (_m *Indexer) GetCoins(_a0 context.Context, _a1 *types.AccountIdentifier) (
 	return r0, r1, r2
 }
 
+// GetInputCoins provides a mock function with given fields: _a0, _a1
+func (_m *Indexer) GetInputCoins(_a0 context.Context, _a1 *defichain.Transaction) (map[string]*types.AccountCoin, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 map[string]*types.AccountCoin
+	if rf, ok := ret.Get(0).(func(context.Context, *defichain.Transaction) map[string]*types.AccountCoin); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]*types.AccountCoin)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *defichain.Transaction) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetMempoolCoins provides a mock function with given fields: _a0, _a1, _a2
+func (_m *Indexer) GetMempoolCoins(_a0 context.Context, _a1 *types.AccountIdentifier, _a2 []*types.Coin) ([]*types.Coin, error) {
+	ret := _m.Called(_a0, _a1, _a2)
+
+	var r0 []*types.Coin
+	if rf, ok := ret.Get(0).(func(context.Context, *types.AccountIdentifier, []*types.Coin) []*types.Coin); ok {
+		r0 = rf(_a0, _a1, _a2)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*types.Coin)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *types.AccountIdentifier, []*types.Coin) error); ok {
+		r1 = rf(_a0, _a1, _a2)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetScriptPubKeys provides a mock function with given fields: _a0, _a1
 func (_m *Indexer) GetScriptPubKeys(_a0 context.Context, _a1 []*types.Coin) ([]*defichain.ScriptPubKey, error) {
 	ret := _m.Called(_a0, _a1)
@@ -149,3 +218,63 @@ func (_m *Indexer) GetScriptPubKeys(_a0 context.Context, _a1 []*types.Coin) ([]*
 
 	return r0, r1
 }
+
+// SearchTransactions provides a mock function with given fields: _a0, _a1
+func (_m *Indexer) SearchTransactions(_a0 context.Context, _a1 *types.SearchTransactionsRequest) ([]*types.BlockTransaction, int64, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 []*types.BlockTransaction
+	if rf, ok := ret.Get(0).(func(context.Context, *types.SearchTransactionsRequest) []*types.BlockTransaction); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*types.BlockTransaction)
+		}
+	}
+
+	var r1 int64
+	if rf, ok := ret.Get(1).(func(context.Context, *types.SearchTransactionsRequest) int64); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Get(1).(int64)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, *types.SearchTransactionsRequest) error); ok {
+		r2 = rf(_a0, _a1)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// GetBlockEvents provides a mock function with given fields: _a0, _a1, _a2
+func (_m *Indexer) GetBlockEvents(_a0 context.Context, _a1 *int64, _a2 int64) ([]*types.BlockEvent, int64, error) {
+	ret := _m.Called(_a0, _a1, _a2)
+
+	var r0 []*types.BlockEvent
+	if rf, ok := ret.Get(0).(func(context.Context, *int64, int64) []*types.BlockEvent); ok {
+		r0 = rf(_a0, _a1, _a2)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*types.BlockEvent)
+		}
+	}
+
+	var r1 int64
+	if rf, ok := ret.Get(1).(func(context.Context, *int64, int64) int64); ok {
+		r1 = rf(_a0, _a1, _a2)
+	} else {
+		r1 = ret.Get(1).(int64)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, *int64, int64) error); ok {
+		r2 = rf(_a0, _a1, _a2)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
@@ -49,14 +49,13 @@ func (s *AccountAPIService) AccountBalance(
 		return nil, wrapErr(ErrUnavailableOffline, nil)
 	}
 
-	// TODO: filter balances by request currencies
-
-	// If we are fetching a historical balance,
-	// use balance storage and don't return coins.
-	amount, block, err := s.i.GetBalance(
+	// If no currencies are requested, the indexer returns
+	// the balance of the native currency and of every
+	// token the account has held.
+	amounts, block, err := s.i.GetBalances(
 		ctx,
 		request.AccountIdentifier,
-		s.config.Currency,
+		request.Currencies,
 		request.BlockIdentifier,
 	)
 	if err != nil {
@@ -65,9 +64,7 @@ func (s *AccountAPIService) AccountBalance(
 
 	return &types.AccountBalanceResponse{
 		BlockIdentifier: block,
-		Balances: []*types.Amount{
-			amount,
-		},
+		Balances:        amounts,
 	}, nil
 }
 
@@ -82,15 +79,20 @@ func (s *AccountAPIService) AccountCoins(
 
 	// TODO: filter coins by request currencies
 
-	// TODO: support include_mempool query
-	// https://github.com/coinbase/rosetta-bitcoin/issues/36#issuecomment-724992022
-	// Once mempoolcoins are supported also change the bool service/types.go:MempoolCoins to true
-
 	coins, block, err := s.i.GetCoins(ctx, request.AccountIdentifier)
 	if err != nil {
 		return nil, wrapErr(ErrUnableToGetCoins, err)
 	}
 
+	// The block identifier remains the last indexed
+	// block when mempool coins are included.
+	if request.IncludeMempool {
+		coins, err = s.i.GetMempoolCoins(ctx, request.AccountIdentifier, coins)
+		if err != nil {
+			return nil, wrapErr(ErrUnableToGetMempoolCoins, err)
+		}
+	}
+
 	result := &types.AccountCoinsResponse{
 		BlockIdentifier: block,
 		Coins:           coins,
@@ -16,6 +16,7 @@ package services
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"github.com/DeFiCh/rosetta-defichain/configuration"
@@ -66,12 +67,12 @@ func TestAccountBalance_Online_Current(t *testing.T) {
 	}
 
 	mockIndexer.On(
-		"GetBalance",
+		"GetBalances",
 		ctx,
 		account,
-		defichain.MainnetCurrency,
+		([]*types.Currency)(nil),
 		(*types.PartialBlockIdentifier)(nil),
-	).Return(amount, block, nil).Once()
+	).Return([]*types.Amount{amount}, block, nil).Once()
 	bal, err := servicer.AccountBalance(ctx, &types.AccountBalanceRequest{
 		AccountIdentifier: account,
 	})
@@ -110,12 +111,12 @@ func TestAccountBalance_Online_Historical(t *testing.T) {
 	}
 
 	mockIndexer.On(
-		"GetBalance",
+		"GetBalances",
 		ctx,
 		account,
-		defichain.MainnetCurrency,
+		([]*types.Currency)(nil),
 		partialBlock,
-	).Return(amount, block, nil).Once()
+	).Return([]*types.Amount{amount}, block, nil).Once()
 	bal, err := servicer.AccountBalance(ctx, &types.AccountBalanceRequest{
 		AccountIdentifier: account,
 		BlockIdentifier:   partialBlock,
@@ -131,6 +132,54 @@ func TestAccountBalance_Online_Historical(t *testing.T) {
 	mockIndexer.AssertExpectations(t)
 }
 
+func TestAccountBalance_Online_Currencies(t *testing.T) {
+	cfg := &configuration.Configuration{
+		Mode:     configuration.Online,
+		Currency: defichain.MainnetCurrency,
+	}
+	mockIndexer := &mocks.Indexer{}
+	servicer := NewAccountAPIService(cfg, mockIndexer)
+	ctx := context.Background()
+	account := &types.AccountIdentifier{
+		Address: "hello",
+	}
+	block := &types.BlockIdentifier{
+		Index: 1000,
+		Hash:  "block 1000",
+	}
+	btc := defichain.TokenCurrency(2, &defichain.Token{SymbolKey: "BTC", Decimal: 8})
+	currencies := []*types.Currency{defichain.MainnetCurrency, btc}
+	amounts := []*types.Amount{
+		{
+			Value:    "25",
+			Currency: defichain.MainnetCurrency,
+		},
+		{
+			Value:    "10",
+			Currency: btc,
+		},
+	}
+
+	mockIndexer.On(
+		"GetBalances",
+		ctx,
+		account,
+		currencies,
+		(*types.PartialBlockIdentifier)(nil),
+	).Return(amounts, block, nil).Once()
+	bal, err := servicer.AccountBalance(ctx, &types.AccountBalanceRequest{
+		AccountIdentifier: account,
+		Currencies:        currencies,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, &types.AccountBalanceResponse{
+		BlockIdentifier: block,
+		Balances:        amounts,
+	}, bal)
+
+	mockIndexer.AssertExpectations(t)
+}
+
 func TestAccountCoins_Online(t *testing.T) {
 	cfg := &configuration.Configuration{
 		Mode:     configuration.Online,
@@ -188,3 +237,77 @@ func TestAccountCoins_Online(t *testing.T) {
 
 	mockIndexer.AssertExpectations(t)
 }
+
+func TestAccountCoins_Online_IncludeMempool(t *testing.T) {
+	cfg := &configuration.Configuration{
+		Mode:     configuration.Online,
+		Currency: defichain.MainnetCurrency,
+	}
+	mockIndexer := &mocks.Indexer{}
+	servicer := NewAccountAPIService(cfg, mockIndexer)
+	ctx := context.Background()
+
+	account := &types.AccountIdentifier{
+		Address: "hello",
+	}
+
+	coins := []*types.Coin{
+		{
+			Amount: &types.Amount{
+				Value: "10",
+			},
+			CoinIdentifier: &types.CoinIdentifier{
+				Identifier: "coin 1",
+			},
+		},
+	}
+	mempoolCoins := []*types.Coin{
+		{
+			Amount: &types.Amount{
+				Value: "5",
+			},
+			CoinIdentifier: &types.CoinIdentifier{
+				Identifier: "coin 2",
+			},
+		},
+	}
+	block := &types.BlockIdentifier{
+		Index: 1000,
+		Hash:  "block 1000",
+	}
+	mockIndexer.On("GetCoins", ctx, account).Return(coins, block, nil).Twice()
+	mockIndexer.On(
+		"GetMempoolCoins",
+		ctx,
+		account,
+		coins,
+	).Return(mempoolCoins, nil).Once()
+
+	bal, err := servicer.AccountCoins(ctx, &types.AccountCoinsRequest{
+		AccountIdentifier: account,
+		IncludeMempool:    true,
+	})
+	assert.Nil(t, err)
+
+	assert.Equal(t, &types.AccountCoinsResponse{
+		BlockIdentifier: block,
+		Coins:           mempoolCoins,
+	}, bal)
+
+	mockIndexer.On(
+		"GetMempoolCoins",
+		ctx,
+		account,
+		coins,
+	).Return(nil, errors.New("mempool not synced")).Once()
+
+	bal, err = servicer.AccountCoins(ctx, &types.AccountCoinsRequest{
+		AccountIdentifier: account,
+		IncludeMempool:    true,
+	})
+	assert.Nil(t, bal)
+	assert.Equal(t, ErrUnableToGetMempoolCoins.Code, err.Code)
+	assert.True(t, err.Retriable)
+
+	mockIndexer.AssertExpectations(t)
+}
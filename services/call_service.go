@@ -0,0 +1,176 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/DeFiCh/rosetta-defichain/configuration"
+	"github.com/DeFiCh/rosetta-defichain/defichain"
+
+	"github.com/coinbase/rosetta-sdk-go/server"
+	"github.com/coinbase/rosetta-sdk-go/types"
+)
+
+// CallAPIService implements the server.CallAPIServicer interface.
+type CallAPIService struct {
+	config *configuration.Configuration
+	client Client
+}
+
+// NewCallAPIService creates a new instance of a CallAPIService.
+func NewCallAPIService(
+	config *configuration.Configuration,
+	client Client,
+) server.CallAPIServicer {
+	return &CallAPIService{
+		config: config,
+		client: client,
+	}
+}
+
+// Call implements the /call endpoint.
+func (s *CallAPIService) Call(
+	ctx context.Context,
+	request *types.CallRequest,
+) (*types.CallResponse, *types.Error) {
+	if s.config.Mode != configuration.Online {
+		return nil, wrapErr(ErrUnavailableOffline, nil)
+	}
+
+	switch request.Method {
+	case TestMempoolAcceptMethod:
+		return s.testMempoolAccept(ctx, request.Parameters)
+	case RawMempoolMethod:
+		return s.rawMempool(ctx)
+	default:
+		return nil, wrapErr(
+			ErrCallMethodInvalid,
+			fmt.Errorf("%s is not a supported method", request.Method),
+		)
+	}
+}
+
+// testMempoolAccept checks if defid would accept a signed
+// transaction in its mempool without broadcasting it.
+func (s *CallAPIService) testMempoolAccept(
+	ctx context.Context,
+	parameters map[string]interface{},
+) (*types.CallResponse, *types.Error) {
+	var params TestMempoolAcceptParameters
+	if err := types.UnmarshalMap(parameters, &params); err != nil {
+		return nil, wrapErr(ErrCallParametersInvalid, err)
+	}
+
+	if len(params.SignedTransaction) == 0 {
+		return nil, wrapErr(
+			ErrCallParametersInvalid,
+			fmt.Errorf("signed_transaction must be populated"),
+		)
+	}
+
+	signed, err := decodeSignedTransaction(params.SignedTransaction)
+	if err != nil {
+		return nil, wrapErr(ErrUnableToParseIntermediateResult, err)
+	}
+
+	tx, inputAmounts, err := decodeSignedMsgTx(signed)
+	if err != nil {
+		return nil, wrapErr(ErrUnableToParseIntermediateResult, err)
+	}
+
+	response, err := s.client.TestMempoolAccept(ctx, signed.Transaction)
+	if err != nil {
+		return nil, wrapErr(ErrDefid, fmt.Errorf("%w unable to test transaction", err))
+	}
+
+	mintingStart, err := mintingOutputsStart(tx)
+	if err != nil {
+		return nil, wrapErr(ErrUnableToParseIntermediateResult, err)
+	}
+
+	// defid only populates the fee and vsize of allowed
+	// transactions, so we compute them otherwise.
+	fee := transactionFee(tx, inputAmounts, mintingStart)
+	if response.Fees != nil {
+		fee, err = defichain.ParseAmount(response.Fees.Base)
+		if err != nil {
+			return nil, wrapErr(ErrUnableToParseIntermediateResult, err)
+		}
+	}
+
+	vsize := int64(signedVsize(tx))
+	if response.Vsize > 0 {
+		vsize = response.Vsize
+	}
+
+	result, err := types.MarshalMap(&TestMempoolAcceptResult{
+		TransactionIdentifier: &types.TransactionIdentifier{
+			Hash: response.TxID,
+		},
+		Allowed:      response.Allowed,
+		RejectReason: response.RejectReason,
+		Fee: &types.Amount{
+			Value:    strconv.FormatInt(fee, 10),
+			Currency: s.config.Currency,
+		},
+		Vsize: vsize,
+	})
+	if err != nil {
+		return nil, wrapErr(ErrUnableToParseIntermediateResult, err)
+	}
+
+	// The result depends on the state of the
+	// mempool, so it isn't idempotent.
+	return &types.CallResponse{
+		Result:     result,
+		Idempotent: false,
+	}, nil
+}
+
+// rawMempool returns the mempool entry of each
+// transaction in the mempool of defid.
+func (s *CallAPIService) rawMempool(
+	ctx context.Context,
+) (*types.CallResponse, *types.Error) {
+	entries, err := s.client.VerboseRawMempool(ctx)
+	if err != nil {
+		return nil, wrapErr(ErrDefid, fmt.Errorf("%w unable to get raw mempool", err))
+	}
+
+	transactions := make(map[string]*MempoolEntryMetadata, len(entries))
+	for hash, entry := range entries {
+		metadata, err := mempoolEntryMetadata(entry)
+		if err != nil {
+			return nil, wrapErr(ErrUnableToParseIntermediateResult, err)
+		}
+
+		transactions[hash] = metadata
+	}
+
+	result, err := types.MarshalMap(&RawMempoolResult{Transactions: transactions})
+	if err != nil {
+		return nil, wrapErr(ErrUnableToParseIntermediateResult, err)
+	}
+
+	// The result depends on the state of the
+	// mempool, so it isn't idempotent.
+	return &types.CallResponse{
+		Result:     result,
+		Idempotent: false,
+	}, nil
+}
@@ -0,0 +1,258 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/DeFiCh/rosetta-defichain/configuration"
+	"github.com/DeFiCh/rosetta-defichain/defichain"
+	mocks "github.com/DeFiCh/rosetta-defichain/mocks/services"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCallService_Offline(t *testing.T) {
+	cfg := &configuration.Configuration{
+		Mode: configuration.Offline,
+	}
+	mockClient := &mocks.Client{}
+	servicer := NewCallAPIService(cfg, mockClient)
+	ctx := context.Background()
+
+	callResponse, err := servicer.Call(ctx, &types.CallRequest{
+		Method: TestMempoolAcceptMethod,
+	})
+	assert.Nil(t, callResponse)
+	assert.Equal(t, ErrUnavailableOffline.Code, err.Code)
+
+	mockClient.AssertExpectations(t)
+}
+
+func TestCallService_TestMempoolAccept(t *testing.T) {
+	cfg := &configuration.Configuration{
+		Mode:     configuration.Online,
+		Currency: defichain.TestnetCurrency,
+	}
+	ctx := context.Background()
+
+	// 100,000,000 in, 99,990,000 out (fee 10,000)
+	hash, err := chainhash.NewHash(forceHexDecode(t, strings.Repeat("11", 32)))
+	assert.NoError(t, err)
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(hash, 0), nil, nil))
+	tx.TxIn[0].Witness = wire.TxWitness{
+		bytes.Repeat([]byte{0x01}, 71),
+		bytes.Repeat([]byte{0x02}, 33),
+	}
+	tx.AddTxOut(wire.NewTxOut(
+		99990000,
+		forceHexDecode(t, "0014d88413b340d04dd9f19dc92a5c6836c6c6c69b8d"),
+	))
+
+	buf := bytes.NewBuffer(make([]byte, 0, tx.SerializeSize()))
+	assert.NoError(t, tx.Serialize(buf))
+	serializedTx := hex.EncodeToString(buf.Bytes())
+	rawTx, err := json.Marshal(&signedTransaction{
+		Transaction:  serializedTx,
+		InputAmounts: []string{"-100000000"},
+	})
+	assert.NoError(t, err)
+	signedRaw := hex.EncodeToString(rawTx)
+	txHash := tx.TxHash().String()
+
+	tests := map[string]struct {
+		method     string
+		parameters map[string]interface{}
+
+		mempoolAccept *defichain.MempoolAcceptResult
+		defidErr      error
+
+		expectedResult *TestMempoolAcceptResult
+		expectedErr    *types.Error
+	}{
+		"allowed": {
+			method:     TestMempoolAcceptMethod,
+			parameters: map[string]interface{}{"signed_transaction": signedRaw},
+			mempoolAccept: &defichain.MempoolAcceptResult{
+				TxID:    txHash,
+				Allowed: true,
+				Vsize:   110,
+				Fees:    &defichain.MempoolAcceptFees{Base: "0.0001"},
+			},
+			expectedResult: &TestMempoolAcceptResult{
+				TransactionIdentifier: &types.TransactionIdentifier{Hash: txHash},
+				Allowed:               true,
+				Fee: &types.Amount{
+					Value:    "10000",
+					Currency: defichain.TestnetCurrency,
+				},
+				Vsize: 110,
+			},
+		},
+		"rejected": {
+			method:     TestMempoolAcceptMethod,
+			parameters: map[string]interface{}{"signed_transaction": signedRaw},
+			mempoolAccept: &defichain.MempoolAcceptResult{
+				TxID:         txHash,
+				RejectReason: "missing-inputs",
+			},
+			expectedResult: &TestMempoolAcceptResult{
+				TransactionIdentifier: &types.TransactionIdentifier{Hash: txHash},
+				RejectReason:          "missing-inputs",
+				Fee: &types.Amount{
+					Value:    "10000",
+					Currency: defichain.TestnetCurrency,
+				},
+				Vsize: int64(signedVsize(tx)),
+			},
+		},
+		"defid error": {
+			method:      TestMempoolAcceptMethod,
+			parameters:  map[string]interface{}{"signed_transaction": signedRaw},
+			defidErr:    errors.New("connection refused"),
+			expectedErr: ErrDefid,
+		},
+		"unsupported method": {
+			method:      "sendrawtransaction",
+			parameters:  map[string]interface{}{"signed_transaction": signedRaw},
+			expectedErr: ErrCallMethodInvalid,
+		},
+		"missing signed transaction": {
+			method:      TestMempoolAcceptMethod,
+			parameters:  map[string]interface{}{},
+			expectedErr: ErrCallParametersInvalid,
+		},
+		"invalid signed transaction": {
+			method:      TestMempoolAcceptMethod,
+			parameters:  map[string]interface{}{"signed_transaction": "hello"},
+			expectedErr: ErrUnableToParseIntermediateResult,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockClient := &mocks.Client{}
+			servicer := NewCallAPIService(cfg, mockClient)
+
+			if test.mempoolAccept != nil || test.defidErr != nil {
+				mockClient.On(
+					"TestMempoolAccept",
+					ctx,
+					serializedTx,
+				).Return(
+					test.mempoolAccept,
+					test.defidErr,
+				).Once()
+			}
+
+			callResponse, rErr := servicer.Call(ctx, &types.CallRequest{
+				NetworkIdentifier: &types.NetworkIdentifier{
+					Network:    defichain.TestnetNetwork,
+					Blockchain: defichain.Blockchain,
+				},
+				Method:     test.method,
+				Parameters: test.parameters,
+			})
+			if test.expectedErr != nil {
+				assert.Nil(t, callResponse)
+				assert.Equal(t, test.expectedErr.Code, rErr.Code)
+			} else {
+				assert.Nil(t, rErr)
+				assert.False(t, callResponse.Idempotent)
+
+				var result TestMempoolAcceptResult
+				assert.NoError(t, types.UnmarshalMap(callResponse.Result, &result))
+				assert.Equal(t, test.expectedResult, &result)
+			}
+
+			mockClient.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCallService_RawMempool(t *testing.T) {
+	cfg := &configuration.Configuration{
+		Mode:     configuration.Online,
+		Currency: defichain.TestnetCurrency,
+	}
+	mockClient := &mocks.Client{}
+	servicer := NewCallAPIService(cfg, mockClient)
+	ctx := context.Background()
+
+	mockClient.On("VerboseRawMempool", ctx).Return(map[string]*defichain.MempoolEntry{
+		"tx1": {
+			Vsize:         250,
+			Time:          1604671800,
+			Height:        520000,
+			AncestorCount: 1,
+			AncestorSize:  250,
+			Fees: &defichain.MempoolEntryFees{
+				Base:       "0.0000025",
+				Modified:   "0.0000025",
+				Ancestor:   "0.0000025",
+				Descendant: "0.0000025",
+			},
+			Depends: []string{},
+			SpentBy: []string{},
+		},
+	}, nil).Once()
+	callResponse, err := servicer.Call(ctx, &types.CallRequest{
+		Method: RawMempoolMethod,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, &types.CallResponse{
+		Result: forceMarshalMap(t, &RawMempoolResult{
+			Transactions: map[string]*MempoolEntryMetadata{
+				"tx1": {
+					Vsize:            250,
+					Time:             1604671800,
+					Height:           520000,
+					Fee:              250,
+					ModifiedFee:      250,
+					AncestorCount:    1,
+					AncestorSize:     250,
+					AncestorFees:     250,
+					AncestorFeePerKB: 0.00001,
+					DescendantFees:   250,
+					Depends:          []string{},
+					SpentBy:          []string{},
+				},
+			},
+		}),
+		Idempotent: false,
+	}, callResponse)
+
+	mockClient.On(
+		"VerboseRawMempool",
+		ctx,
+	).Return(nil, errors.New("rpc error")).Once()
+	callResponse, err = servicer.Call(ctx, &types.CallRequest{
+		Method: RawMempoolMethod,
+	})
+	assert.Nil(t, callResponse)
+	assert.Equal(t, ErrDefid.Code, err.Code)
+
+	mockClient.AssertExpectations(t)
+}
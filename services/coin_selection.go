@@ -0,0 +1,441 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+
+	"github.com/DeFiCh/rosetta-defichain/defichain"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcutil"
+	"github.com/coinbase/rosetta-sdk-go/types"
+)
+
+// CoinSelection is the strategy used by /construction/metadata
+// to select the coins of the funding account.
+type CoinSelection string
+
+const (
+	// LargestFirst selects the largest coins first. It
+	// minimizes the number of inputs.
+	LargestFirst CoinSelection = "largest_first"
+
+	// BranchAndBound searches for a set of coins that pays
+	// the outputs and the fee without a change output. If
+	// there is none, it falls back to LargestFirst.
+	BranchAndBound CoinSelection = "branch_and_bound"
+
+	// OldestFirst selects the coins created in the
+	// earliest blocks first.
+	OldestFirst CoinSelection = "oldest_first"
+
+	// maxBranchAndBoundTries bounds the number of
+	// branches BranchAndBound explores.
+	maxBranchAndBoundTries = 100000
+)
+
+// validCoinSelection returns an error if a
+// CoinSelection is not supported.
+func validCoinSelection(strategy CoinSelection) error {
+	switch strategy {
+	case LargestFirst, BranchAndBound, OldestFirst:
+		return nil
+	default:
+		return fmt.Errorf("%s is not a valid coin selection", strategy)
+	}
+}
+
+// coinCandidate is a coin that may be selected.
+type coinCandidate struct {
+	coin   *types.Coin
+	amount int64
+
+	// block is the index of the block that created
+	// the coin (only populated for OldestFirst).
+	block int64
+}
+
+// feeFunc returns the fee of a transaction spending
+// inputs coins with or without a change output.
+type feeFunc func(inputs int, change bool) int64
+
+// coinSelectionResult is the outcome of a coin selection.
+type coinSelectionResult struct {
+	coins []*types.Coin
+
+	// fee is the difference between the selected amount
+	// and the amount sent (including the change).
+	fee    int64
+	change int64
+}
+
+// unspentCoins returns the confirmed coins of an account that
+// no mempool transaction spends, so chained transactions don't
+// select them again. Coins created in the mempool are not
+// returned (they aren't indexed yet).
+func (s *ConstructionAPIService) unspentCoins(
+	ctx context.Context,
+	accountIdentifier *types.AccountIdentifier,
+) ([]*types.Coin, error) {
+	coins, _, err := s.i.GetCoins(ctx, accountIdentifier)
+	if err != nil {
+		return nil, err
+	}
+
+	mempoolCoins, err := s.i.GetMempoolCoins(ctx, accountIdentifier, coins)
+	if err != nil {
+		return nil, fmt.Errorf("%w unable to get mempool coins", err)
+	}
+
+	confirmed := map[string]struct{}{}
+	for _, coin := range coins {
+		confirmed[coin.CoinIdentifier.Identifier] = struct{}{}
+	}
+
+	unspent := []*types.Coin{}
+	for _, coin := range mempoolCoins {
+		if _, ok := confirmed[coin.CoinIdentifier.Identifier]; ok {
+			unspent = append(unspent, coin)
+		}
+	}
+
+	return unspent, nil
+}
+
+// selectFundingCoins selects the coins of the funding account
+// covering the funded amount and the fee at satoshisPerB.
+func (s *ConstructionAPIService) selectFundingCoins(
+	ctx context.Context,
+	options *preprocessOptions,
+	satoshisPerB float64,
+) (*coinSelectionResult, error) {
+	target, err := strconv.ParseInt(options.FundingAmount, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w unable to parse funding amount", err)
+	}
+
+	coins, err := s.unspentCoins(ctx, options.FundingAccount)
+	if err != nil {
+		return nil, fmt.Errorf("%w unable to get coins of funding account", err)
+	}
+
+	candidates := make([]*coinCandidate, len(coins))
+	for i, coin := range coins {
+		amount, err := types.AmountValue(coin.Amount)
+		if err != nil || !amount.IsInt64() {
+			return nil, fmt.Errorf("coin %s has an invalid amount", coin.CoinIdentifier.Identifier)
+		}
+
+		candidates[i] = &coinCandidate{coin: coin, amount: amount.Int64()}
+	}
+
+	if options.CoinSelection == OldestFirst && len(coins) > 0 {
+		blocks, err := s.i.GetCoinBlocks(ctx, coins)
+		if err != nil {
+			return nil, fmt.Errorf("%w unable to get blocks of coins", err)
+		}
+
+		for i, block := range blocks {
+			candidates[i].block = block.Index
+		}
+	}
+
+	addr, err := btcutil.DecodeAddress(options.FundingAccount.Address, s.config.Params)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"%w unable to decode address %s",
+			err,
+			options.FundingAccount.Address,
+		)
+	}
+
+	changeScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		return nil, fmt.Errorf("%w unable to construct payToAddrScript", err)
+	}
+
+	inputWeight, witness, err := s.inputWeight(&types.Operation{Account: options.FundingAccount})
+	if err != nil {
+		return nil, err
+	}
+
+	// The segwit flag may already be included in the
+	// estimated size (the estimate is never too low).
+	flagWeight := 0
+	if witness {
+		flagWeight = defichain.SegwitFlagWeight
+	}
+
+	changeSize := outputSize(changeScript)
+	fee := func(inputs int, change bool) int64 {
+		size := options.EstimatedSize + float64(vsize(inputs*inputWeight+flagWeight))
+		if change {
+			size += float64(changeSize)
+		}
+
+		return int64(satoshisPerB * size)
+	}
+
+	return selectCoins(options.CoinSelection, candidates, target, fee)
+}
+
+// spendOperation returns the INPUT operation spending a
+// coin of address that is not part of the intent and
+// its (negative) amount.
+func (s *ConstructionAPIService) spendOperation(
+	address string,
+	coin *types.Coin,
+) (*types.Operation, *big.Int, error) {
+	if coin == nil || coin.Amount == nil || coin.CoinIdentifier == nil {
+		return nil, nil, fmt.Errorf("coin of %s is invalid", address)
+	}
+
+	amount, err := types.AmountValue(coin.Amount)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w unable to parse coin amount", err)
+	}
+	amount.Neg(amount)
+
+	return &types.Operation{
+		Type: defichain.InputOpType,
+		Account: &types.AccountIdentifier{
+			Address: address,
+		},
+		Amount: &types.Amount{
+			Value:    amount.String(),
+			Currency: s.config.Currency,
+		},
+		CoinChange: &types.CoinChange{
+			CoinIdentifier: coin.CoinIdentifier,
+			CoinAction:     types.CoinSpent,
+		},
+	}, amount, nil
+}
+
+// spentCoin returns a coin with a negative amount, as
+// expected by Indexer.GetScriptPubKeys.
+func spentCoin(coin *types.Coin) (*types.Coin, error) {
+	value, err := types.NegateValue(coin.Amount.Value)
+	if err != nil {
+		return nil, fmt.Errorf("%w unable to negate amount of coin", err)
+	}
+
+	return &types.Coin{
+		CoinIdentifier: coin.CoinIdentifier,
+		Amount: &types.Amount{
+			Value:    value,
+			Currency: coin.Amount.Currency,
+		},
+	}, nil
+}
+
+// selectCoins selects candidates covering target and the
+// fee. A change output is only added if it is not dust.
+func selectCoins(
+	strategy CoinSelection,
+	candidates []*coinCandidate,
+	target int64,
+	fee feeFunc,
+) (*coinSelectionResult, error) {
+	// Sorting by identifier first makes the selection
+	// deterministic when amounts or blocks are equal.
+	sorted := make([]*coinCandidate, len(candidates))
+	copy(sorted, candidates)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].coin.CoinIdentifier.Identifier < sorted[j].coin.CoinIdentifier.Identifier
+	})
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].amount > sorted[j].amount })
+
+	switch strategy {
+	case BranchAndBound:
+		if result := branchAndBound(sorted, target, fee); result != nil {
+			return result, nil
+		}
+	case OldestFirst:
+		sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].block < sorted[j].block })
+	case LargestFirst:
+	default:
+		return nil, validCoinSelection(strategy)
+	}
+
+	return accumulateCoins(sorted, target, fee)
+}
+
+// accumulateCoins selects candidates in order until
+// they cover target and the fee.
+func accumulateCoins(
+	candidates []*coinCandidate,
+	target int64,
+	fee feeFunc,
+) (*coinSelectionResult, error) {
+	total := int64(0)
+	for i, candidate := range candidates {
+		total += candidate.amount
+		inputs := i + 1
+
+		if change := total - target - fee(inputs, true); change >= defichain.DustThreshold {
+			return &coinSelectionResult{
+				coins:  coinsOf(candidates[:inputs]),
+				fee:    fee(inputs, true),
+				change: change,
+			}, nil
+		}
+
+		// Any amount too small for a change output
+		// is added to the fee.
+		if total-target >= fee(inputs, false) {
+			return &coinSelectionResult{
+				coins: coinsOf(candidates[:inputs]),
+				fee:   total - target,
+			}, nil
+		}
+	}
+
+	return nil, fmt.Errorf(
+		"%d is available but %d and the fee are required",
+		total,
+		target,
+	)
+}
+
+// branchAndBound searches for candidates whose amount minus
+// the fee they add is at least target but less than target
+// plus the cost of a change output. It returns nil if there
+// is no such selection.
+func branchAndBound(
+	candidates []*coinCandidate,
+	target int64,
+	fee feeFunc,
+) *coinSelectionResult {
+	baseFee := fee(0, false)
+	inputFee := fee(1, false) - baseFee
+	costOfChange := fee(0, true) - baseFee + defichain.DustThreshold
+	effectiveTarget := target + baseFee
+
+	// Coins worth less than the fee to spend them
+	// can't be part of the selection.
+	effective := []*coinCandidate{}
+	for _, candidate := range candidates {
+		if candidate.amount > inputFee {
+			effective = append(effective, candidate)
+		}
+	}
+
+	// remaining[i] is the effective value of
+	// effective[i:].
+	remaining := make([]int64, len(effective)+1)
+	for i := len(effective) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + effective[i].amount - inputFee
+	}
+
+	tries := 0
+	selected := []*coinCandidate{}
+	var search func(i int, value int64) bool
+	search = func(i int, value int64) bool {
+		tries++
+		switch {
+		case tries > maxBranchAndBoundTries, value > effectiveTarget+costOfChange:
+			return false
+		case value >= effectiveTarget:
+			return true
+		case i == len(effective), value+remaining[i] < effectiveTarget:
+			return false
+		}
+
+		selected = append(selected, effective[i])
+		if search(i+1, value+effective[i].amount-inputFee) {
+			return true
+		}
+		selected = selected[:len(selected)-1]
+
+		return search(i+1, value)
+	}
+
+	if !search(0, 0) {
+		return nil
+	}
+
+	// The fee is not exactly linear in the number
+	// of inputs because it is rounded down.
+	total := int64(0)
+	for _, candidate := range selected {
+		total += candidate.amount
+	}
+	if total-target < fee(len(selected), false) {
+		return nil
+	}
+
+	return &coinSelectionResult{
+		coins: coinsOf(selected),
+		fee:   total - target,
+	}
+}
+
+// coinsOf returns the coins of candidates.
+func coinsOf(candidates []*coinCandidate) []*types.Coin {
+	coins := make([]*types.Coin, len(candidates))
+	for i, candidate := range candidates {
+		coins[i] = candidate.coin
+	}
+
+	return coins
+}
+
+// fundedAmount returns the amount the coins of the funding
+// account must cover: the OUTPUT operations that are not
+// minted and the DFI burned by the custom transaction.
+func fundedAmount(operations []*types.Operation, intent *customTxIntent) (int64, error) {
+	total := new(big.Int)
+	for _, operation := range operations {
+		if operation.Type != defichain.OutputOpType {
+			continue
+		}
+
+		var metadata OutputOperationMetadata
+		if err := types.UnmarshalMap(operation.Metadata, &metadata); err != nil {
+			return 0, fmt.Errorf("%w unable to parse output metadata", err)
+		}
+
+		if metadata.Minted {
+			continue
+		}
+
+		amount, err := types.AmountValue(operation.Amount)
+		if err != nil {
+			return 0, fmt.Errorf("%w unable to parse output amount", err)
+		}
+
+		if amount.Sign() <= 0 {
+			return 0, fmt.Errorf("output amount %s must be positive", amount)
+		}
+
+		total.Add(total, amount)
+	}
+
+	if intent != nil {
+		total.Add(total, big.NewInt(intent.value))
+	}
+
+	if !total.IsInt64() {
+		return 0, fmt.Errorf("funded amount %s overflows int64", total)
+	}
+
+	return total.Int64(), nil
+}
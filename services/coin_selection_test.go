@@ -0,0 +1,181 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DeFiCh/rosetta-defichain/defichain"
+
+	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectCoins(t *testing.T) {
+	coin := func(identifier string) *types.Coin {
+		return &types.Coin{
+			CoinIdentifier: &types.CoinIdentifier{Identifier: identifier},
+		}
+	}
+	candidates := []*coinCandidate{
+		{coin: coin("c3:0"), amount: 20000, block: 3},
+		{coin: coin("c1:0"), amount: 100000, block: 5},
+		{coin: coin("c4:0"), amount: 9000, block: 2},
+		{coin: coin("c2:0"), amount: 50000, block: 1},
+	}
+	fee := func(inputs int, change bool) int64 {
+		fee := int64(100 + 50*inputs)
+		if change {
+			fee += 30
+		}
+
+		return fee
+	}
+
+	var tests = map[string]struct {
+		strategy CoinSelection
+		target   int64
+
+		result *coinSelectionResult
+		err    error
+	}{
+		"largest first": {
+			strategy: LargestFirst,
+			target:   60000,
+			result: &coinSelectionResult{
+				coins:  []*types.Coin{coin("c1:0")},
+				fee:    180,
+				change: 39820,
+			},
+		},
+		"largest first (multiple coins)": {
+			strategy: LargestFirst,
+			target:   120000,
+			result: &coinSelectionResult{
+				coins:  []*types.Coin{coin("c1:0"), coin("c2:0")},
+				fee:    230,
+				change: 29770,
+			},
+		},
+		"dust change": {
+			strategy: LargestFirst,
+			target:   99300,
+			result: &coinSelectionResult{
+				coins: []*types.Coin{coin("c1:0")},
+				fee:   700,
+			},
+		},
+		"oldest first": {
+			strategy: OldestFirst,
+			target:   60000,
+			result: &coinSelectionResult{
+				coins:  []*types.Coin{coin("c2:0"), coin("c4:0"), coin("c3:0")},
+				fee:    280,
+				change: 18720,
+			},
+		},
+		"branch and bound": {
+			strategy: BranchAndBound,
+			target:   58800,
+			result: &coinSelectionResult{
+				coins: []*types.Coin{coin("c2:0"), coin("c4:0")},
+				fee:   200,
+			},
+		},
+		"branch and bound (fallback)": {
+			strategy: BranchAndBound,
+			target:   60000,
+			result: &coinSelectionResult{
+				coins:  []*types.Coin{coin("c1:0")},
+				fee:    180,
+				change: 39820,
+			},
+		},
+		"insufficient funds": {
+			strategy: LargestFirst,
+			target:   200000,
+			err:      errors.New("179000 is available but 200000 and the fee are required"),
+		},
+		"invalid strategy": {
+			strategy: CoinSelection("random"),
+			target:   1000,
+			err:      errors.New("random is not a valid coin selection"),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			result, err := selectCoins(test.strategy, candidates, test.target, fee)
+			if test.err != nil {
+				assert.EqualError(t, err, test.err.Error())
+				assert.Nil(t, result)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.result, result)
+		})
+	}
+}
+
+func TestFundedAmount(t *testing.T) {
+	output := func(value string, metadata map[string]interface{}) *types.Operation {
+		return &types.Operation{
+			Type:     defichain.OutputOpType,
+			Account:  &types.AccountIdentifier{Address: "address"},
+			Amount:   &types.Amount{Value: value, Currency: defichain.TestnetCurrency},
+			Metadata: metadata,
+		}
+	}
+
+	var tests = map[string]struct {
+		operations []*types.Operation
+		intent     *customTxIntent
+
+		amount int64
+		err    error
+	}{
+		"outputs": {
+			operations: []*types.Operation{
+				output("1000", nil),
+				output("500", map[string]interface{}{"minted": true}),
+				{
+					Type:   defichain.InputOpType,
+					Amount: &types.Amount{Value: "-3000", Currency: defichain.TestnetCurrency},
+				},
+			},
+			intent: &customTxIntent{value: 10},
+			amount: 1010,
+		},
+		"negative output": {
+			operations: []*types.Operation{output("-1000", nil)},
+			err:        errors.New("output amount -1000 must be positive"),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			amount, err := fundedAmount(test.operations, test.intent)
+			if test.err != nil {
+				assert.EqualError(t, err, test.err.Error())
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.amount, amount)
+		})
+	}
+}
@@ -28,6 +28,7 @@ import (
 	"github.com/DeFiCh/rosetta-defichain/defichain"
 
 	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
@@ -51,6 +52,12 @@ type ConstructionAPIService struct {
 	config *configuration.Configuration
 	client Client
 	i      Indexer
+
+	// tokens resolves the token ids of token currencies. No
+	// token is registered, so it is only used to parse the
+	// token_id metadata of currencies (construction must
+	// work offline).
+	tokens *defichain.TokenRegistry
 }
 
 // NewConstructionAPIService creates a new instance of a ConstructionAPIService.
@@ -63,6 +70,7 @@ func NewConstructionAPIService(
 		config: config,
 		client: client,
 		i:      i,
+		tokens: defichain.NewTokenRegistry(config.Currency),
 	}
 }
 
@@ -71,47 +79,168 @@ func (s *ConstructionAPIService) ConstructionDerive(
 	ctx context.Context,
 	request *types.ConstructionDeriveRequest,
 ) (*types.ConstructionDeriveResponse, *types.Error) {
-	addr, err := btcutil.NewAddressWitnessPubKeyHash(
-		btcutil.Hash160(request.PublicKey.Bytes),
-		s.config.Params,
-	)
+	address, err := s.deriveAddress(request.PublicKey.Bytes)
 	if err != nil {
 		return nil, wrapErr(ErrUnableToDerive, err)
 	}
 
 	return &types.ConstructionDeriveResponse{
 		AccountIdentifier: &types.AccountIdentifier{
-			Address: addr.EncodeAddress(),
+			Address: address,
 		},
 	}, nil
 }
 
-// estimateSize returns the estimated size of a transaction in vBytes.
-func (s *ConstructionAPIService) estimateSize(operations []*types.Operation) float64 {
-	size := defichain.TransactionOverhead
+// deriveAddress returns the SegWit-Bech32 address of a
+// public key. It also identifies the signers of multisig
+// inputs.
+func (s *ConstructionAPIService) deriveAddress(publicKey []byte) (string, error) {
+	addr, err := btcutil.NewAddressWitnessPubKeyHash(
+		btcutil.Hash160(publicKey),
+		s.config.Params,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return addr.EncodeAddress(), nil
+}
+
+// parseInputMetadata returns the *InputOperationMetadata
+// of an INPUT operation.
+func parseInputMetadata(operation *types.Operation) (*InputOperationMetadata, error) {
+	var metadata InputOperationMetadata
+	if err := types.UnmarshalMap(operation.Metadata, &metadata); err != nil {
+		return nil, fmt.Errorf("%w unable to parse input metadata", err)
+	}
+
+	return &metadata, nil
+}
+
+// inputWeight returns the estimated weight of an input and
+// whether it has witness data.
+func (s *ConstructionAPIService) inputWeight(operation *types.Operation) (int, bool, error) {
+	metadata, err := parseInputMetadata(operation)
+	if err != nil {
+		return 0, false, err
+	}
+
+	for _, script := range []struct {
+		hex     string
+		witness bool
+	}{
+		{metadata.RedeemScript, false},
+		{metadata.WitnessScript, true},
+	} {
+		if len(script.hex) == 0 {
+			continue
+		}
+
+		decodedScript, err := hex.DecodeString(script.hex)
+		if err != nil {
+			return 0, false, fmt.Errorf("%w unable to decode script", err)
+		}
+
+		// A redeem script that isn't multisig is
+		// sized as P2SH-P2WPKH.
+		if weight, err := multisigInputWeight(decodedScript, script.witness); err == nil {
+			return weight, script.witness, nil
+		}
+	}
+
+	addr, err := btcutil.DecodeAddress(operation.Account.Address, s.config.Params)
+	if err != nil {
+		return 0, false, fmt.Errorf(
+			"%w unable to decode address %s",
+			err,
+			operation.Account.Address,
+		)
+	}
+
+	switch addr.(type) {
+	case *btcutil.AddressPubKeyHash:
+		return defichain.WitnessScaleFactor *
+			(defichain.InputOverhead + 1 + defichain.P2PKHScriptSigSize), false, nil
+	case *btcutil.AddressScriptHash:
+		return defichain.WitnessScaleFactor*
+			(defichain.InputOverhead+1+defichain.P2SHP2WPKHScriptSigSize) +
+			defichain.P2WPKHWitnessSize, true, nil
+	case *btcutil.AddressWitnessPubKeyHash:
+		return defichain.WitnessScaleFactor*(defichain.InputOverhead+1) +
+			defichain.P2WPKHWitnessSize, true, nil
+	default:
+		return 0, false, fmt.Errorf(
+			"unable to estimate the size of an input of %s",
+			operation.Account.Address,
+		)
+	}
+}
+
+// outputSize returns the size of an output
+// paying to script.
+func outputSize(script []byte) int {
+	return defichain.OutputOverhead + wire.VarIntSerializeSize(uint64(len(script))) + len(script)
+}
+
+// estimateSize returns the estimated virtual size of a transaction
+// in vBytes. extraOutputs are the scripts of the outputs that don't
+// have an OUTPUT operation (ex: the DfTx output).
+func (s *ConstructionAPIService) estimateSize(
+	operations []*types.Operation,
+	extraOutputs ...[]byte,
+) (float64, error) {
+	weight := 0
+	inputs := 0
+	outputs := len(extraOutputs)
+	witness := false
 	for _, operation := range operations {
 		switch operation.Type {
 		case defichain.InputOpType:
-			size += defichain.InputSize
+			inputWeight, inputWitness, err := s.inputWeight(operation)
+			if err != nil {
+				return 0, err
+			}
+
+			weight += inputWeight
+			witness = witness || inputWitness
+			inputs++
 		case defichain.OutputOpType:
-			size += defichain.OutputOverhead
 			addr, err := btcutil.DecodeAddress(operation.Account.Address, s.config.Params)
 			if err != nil {
-				size += defichain.P2PKHScriptPubkeySize
-				continue
+				return 0, fmt.Errorf(
+					"%w unable to decode address %s",
+					err,
+					operation.Account.Address,
+				)
 			}
 
 			script, err := txscript.PayToAddrScript(addr)
 			if err != nil {
-				size += defichain.P2PKHScriptPubkeySize
-				continue
+				return 0, fmt.Errorf("%w unable to construct payToAddrScript", err)
 			}
 
-			size += len(script)
+			weight += defichain.WitnessScaleFactor * outputSize(script)
+			outputs++
 		}
 	}
 
-	return float64(size)
+	for _, script := range extraOutputs {
+		weight += defichain.WitnessScaleFactor * outputSize(script)
+	}
+
+	weight += defichain.WitnessScaleFactor * (defichain.TransactionOverhead +
+		wire.VarIntSerializeSize(uint64(inputs)) +
+		wire.VarIntSerializeSize(uint64(outputs)))
+	if witness {
+		weight += defichain.SegwitFlagWeight
+	}
+
+	return float64(vsize(weight)), nil
+}
+
+// vsize returns the virtual size of weight.
+func vsize(weight int) int {
+	return (weight + defichain.WitnessScaleFactor - 1) / defichain.WitnessScaleFactor
 }
 
 // ConstructionPreprocess implements the /construction/preprocess
@@ -138,13 +267,112 @@ func (s *ConstructionAPIService) ConstructionPreprocess(
 		},
 	}
 
-	matches, err := parser.MatchOperations(descriptions, request.Operations)
+	var metadata PreprocessMetadata
+	if err := types.UnmarshalMap(request.Metadata, &metadata); err != nil {
+		return nil, wrapErr(ErrUnclearIntent, err)
+	}
+
+	operations, intent, err := s.parseCustomTxIntent(request.Operations)
+	if err != nil {
+		return nil, wrapErr(ErrUnclearIntent, err)
+	}
+
+	if err := validFeePolicy(&metadata); err != nil {
+		return nil, wrapErr(ErrUnclearIntent, err)
+	}
+
+	if err := validEncoding(metadata.Encoding); err != nil {
+		return nil, wrapErr(ErrUnclearIntent, err)
+	}
+
+	maxFee, err := s.maxFee(request.MaxFee)
+	if err != nil {
+		return nil, wrapErr(ErrUnclearIntent, err)
+	}
+
+	// The coins of the funding account are selected
+	// in /construction/metadata.
+	funding := metadata.FundingAccount != nil
+	descriptions.OperationDescriptions[0].Optional = funding
+
+	matches, err := parser.MatchOperations(descriptions, operations)
+	if err != nil {
+		return nil, wrapErr(ErrUnclearIntent, err)
+	}
+
+	inputs := []*types.Operation{}
+	if matches[0] != nil {
+		inputs = matches[0].Operations
+	}
+
+	if err := validReplacement(&metadata, inputs); err != nil {
+		return nil, wrapErr(ErrUnclearIntent, err)
+	}
+
+	var fundingAmount string
+	coinSelection := metadata.CoinSelection
+	if funding {
+		if len(inputs) > 0 {
+			return nil, wrapErr(
+				ErrUnclearIntent,
+				errors.New("INPUT operations cannot be used with a funding account"),
+			)
+		}
+
+		if len(coinSelection) == 0 {
+			coinSelection = LargestFirst
+		}
+
+		if err := validCoinSelection(coinSelection); err != nil {
+			return nil, wrapErr(ErrUnclearIntent, err)
+		}
+
+		amount, err := fundedAmount(operations, intent)
+		if err != nil {
+			return nil, wrapErr(ErrUnclearIntent, err)
+		}
+		fundingAmount = strconv.FormatInt(amount, 10)
+
+		// The coins of the funding account authorize
+		// its debits.
+		intent.fundedBy(metadata.FundingAccount.Address)
+	}
+
+	// Each auth coin is spent by an input and returned
+	// by an output to the same address.
+	var authAddresses []string
+	sizeOperations := operations
+	if intent != nil {
+		authAddresses = intent.authAddresses
+		for _, address := range authAddresses {
+			account := &types.AccountIdentifier{Address: address}
+			sizeOperations = append(
+				sizeOperations,
+				&types.Operation{Type: defichain.InputOpType, Account: account},
+				&types.Operation{Type: defichain.OutputOpType, Account: account},
+			)
+		}
+	}
+
+	var customTxScripts [][]byte
+	if intent != nil {
+		script, err := defichain.EncodeCustomTx(intent.customTx)
+		if err != nil {
+			return nil, wrapErr(ErrUnclearIntent, err)
+		}
+
+		customTxScripts = append(customTxScripts, script)
+	}
+
+	estimatedSize, err := s.estimateSize(sizeOperations, customTxScripts...)
 	if err != nil {
 		return nil, wrapErr(ErrUnclearIntent, err)
 	}
 
-	coins := make([]*types.Coin, len(matches[0].Operations))
-	for i, input := range matches[0].Operations {
+	coins := make([]*types.Coin, len(inputs))
+	redeemScripts := make([]string, len(inputs))
+	derivedAccounts := []*types.AccountIdentifier{}
+	for i, input := range inputs {
 		if input.CoinChange == nil {
 			return nil, wrapErr(ErrUnclearIntent, errors.New("CoinChange cannot be nil"))
 		}
@@ -153,20 +381,83 @@ func (s *ConstructionAPIService) ConstructionPreprocess(
 			CoinIdentifier: input.CoinChange.CoinIdentifier,
 			Amount:         input.Amount,
 		}
+
+		inputMetadata, err := parseInputMetadata(input)
+		if err != nil {
+			return nil, wrapErr(ErrUnclearIntent, err)
+		}
+
+		if len(inputMetadata.RedeemScript) > 0 {
+			redeemScripts[i] = inputMetadata.RedeemScript
+			continue
+		}
+
+		derivedAccounts = append(derivedAccounts, input.Account)
+	}
+
+	if funding {
+		derivedAccounts = append(derivedAccounts, metadata.FundingAccount)
+	}
+
+	for _, address := range authAddresses {
+		derivedAccounts = append(derivedAccounts, &types.AccountIdentifier{Address: address})
+	}
+
+	// The redeem script of a P2SH-P2WPKH input is derived
+	// from the public key in /construction/metadata.
+	requiredPublicKeys := []*types.AccountIdentifier{}
+	seenAddresses := map[string]struct{}{}
+	for _, account := range derivedAccounts {
+		addr, err := btcutil.DecodeAddress(account.Address, s.config.Params)
+		if err != nil {
+			continue
+		}
+
+		if _, ok := addr.(*btcutil.AddressScriptHash); !ok {
+			continue
+		}
+
+		if _, ok := seenAddresses[account.Address]; ok {
+			continue
+		}
+
+		seenAddresses[account.Address] = struct{}{}
+		requiredPublicKeys = append(requiredPublicKeys, account)
 	}
 
 	options, err := types.MarshalMap(&preprocessOptions{
-		Coins:         coins,
-		EstimatedSize: s.estimateSize(request.Operations),
-		FeeMultiplier: request.SuggestedFeeMultiplier,
+		Coins:          coins,
+		EstimatedSize:  estimatedSize,
+		FeeMultiplier:  request.SuggestedFeeMultiplier,
+		RedeemScripts:  compactScripts(redeemScripts),
+		AuthAddresses:  authAddresses,
+		FundingAccount: metadata.FundingAccount,
+		FundingAmount:  fundingAmount,
+		CoinSelection:  coinSelection,
+
+		ConfirmationTarget: metadata.ConfirmationTarget,
+		EstimateMode:       metadata.EstimateMode,
+		FeePerKB:           metadata.FeePerKB,
+		MaxFee:             maxFee,
+
+		Replaceable: metadata.Replaceable,
+		LockTime:    metadata.LockTime,
+		Replaces:    metadata.Replaces,
+
+		Encoding: metadata.Encoding,
 	})
 	if err != nil {
 		return nil, wrapErr(ErrUnableToParseIntermediateResult, err)
 	}
 
-	return &types.ConstructionPreprocessResponse{
+	response := &types.ConstructionPreprocessResponse{
 		Options: options,
-	}, nil
+	}
+	if len(requiredPublicKeys) > 0 {
+		response.RequiredPublicKeys = requiredPublicKeys
+	}
+
+	return response, nil
 }
 
 // ConstructionMetadata implements the /construction/metadata endpoint.
@@ -185,31 +476,111 @@ func (s *ConstructionAPIService) ConstructionMetadata(
 
 	// Determine feePerKB and ensure it is not below the minimum fee
 	// relay rate.
-	feePerKB, err := s.client.SuggestedFeeRate(ctx, defaultConfirmationTarget)
+	rate, err := s.feeRate(ctx, &options)
 	if err != nil {
 		return nil, wrapErr(ErrCouldNotGetFeeRate, err)
 	}
-	if options.FeeMultiplier != nil {
-		feePerKB *= *options.FeeMultiplier
-	}
-	if feePerKB < defichain.MinFeeRate {
-		feePerKB = defichain.MinFeeRate
-	}
 
 	// Calculated the estimated fee in Satoshis
-	satoshisPerB := (feePerKB * float64(defichain.SatoshisInDFI)) / bytesInKb
+	satoshisPerB := (rate.feePerKB * float64(defichain.SatoshisInDFI)) / bytesInKb
 	estimatedFee := satoshisPerB * options.EstimatedSize
 	suggestedFee := &types.Amount{
 		Value:    fmt.Sprintf("%d", int64(estimatedFee)),
 		Currency: s.config.Currency,
 	}
 
-	scripts, err := s.i.GetScriptPubKeys(ctx, options.Coins)
+	// Coins are spent in the order of the INPUT operations,
+	// the funding coins and the auth coins.
+	coins := options.Coins
+	var selection *coinSelectionResult
+	if options.FundingAccount != nil {
+		selection, err = s.selectFundingCoins(ctx, &options, satoshisPerB)
+		if err != nil {
+			return nil, wrapErr(ErrUnableToSelectCoins, err)
+		}
+
+		suggestedFee.Value = strconv.FormatInt(selection.fee, 10)
+		for _, coin := range selection.coins {
+			spent, err := spentCoin(coin)
+			if err != nil {
+				return nil, wrapErr(ErrInvalidCoin, err)
+			}
+
+			coins = append(coins, spent)
+		}
+	}
+
+	// A replacement pays at least the fee required
+	// to replace the transaction.
+	var replacedFee, replacementFee string
+	if len(options.Replaces) > 0 {
+		fee, replaced, err := s.replacementFee(ctx, &options)
+		if err != nil {
+			return nil, wrapErr(ErrUnableToReplace, err)
+		}
+		replacedFee = strconv.FormatInt(replaced, 10)
+		replacementFee = strconv.FormatInt(fee, 10)
+
+		if fee > int64(estimatedFee) {
+			suggestedFee.Value = strconv.FormatInt(fee, 10)
+		}
+	}
+
+	if len(options.MaxFee) > 0 {
+		if err := exceedsMaxFee(suggestedFee.Value, options.MaxFee); err != nil {
+			return nil, wrapErr(ErrFeeTooHigh, err)
+		}
+	}
+
+	authCoins, err := s.authCoins(ctx, options.AuthAddresses)
+	if err != nil {
+		return nil, wrapErr(ErrAuthCoinMissing, err)
+	}
+
+	for _, authCoin := range authCoins {
+		spent, err := spentCoin(authCoin.Coin)
+		if err != nil {
+			return nil, wrapErr(ErrInvalidCoin, err)
+		}
+
+		coins = append(coins, spent)
+	}
+
+	scripts, err := s.i.GetScriptPubKeys(ctx, coins)
 	if err != nil {
 		return nil, wrapErr(ErrScriptPubKeysMissing, err)
 	}
 
-	metadata, err := types.MarshalMap(&constructionMetadata{ScriptPubKeys: scripts})
+	redeemScripts, err := s.redeemScripts(scripts, request.PublicKeys, options.RedeemScripts)
+	if err != nil {
+		return nil, wrapErr(ErrRedeemScriptMissing, err)
+	}
+
+	result := &constructionMetadata{
+		ScriptPubKeys: scripts,
+		RedeemScripts: redeemScripts,
+		AuthCoins:     authCoins,
+
+		FeePerKB:           rate.feePerKB,
+		ConfirmationTarget: rate.target,
+		FeeRateSource:      rate.source,
+
+		Replaceable:    options.Replaceable,
+		LockTime:       options.LockTime,
+		ReplacedFee:    replacedFee,
+		ReplacementFee: replacementFee,
+
+		Encoding: options.Encoding,
+	}
+	if selection != nil {
+		result.FundingAddress = options.FundingAccount.Address
+		result.FundingCoins = selection.coins
+		if selection.change > 0 {
+			result.ChangeAmount = strconv.FormatInt(selection.change, 10)
+		}
+	}
+
+	metadata, err := types.MarshalMap(result)
 	if err != nil {
 		return nil, wrapErr(ErrUnableToParseIntermediateResult, err)
 	}
@@ -220,6 +591,122 @@ func (s *ConstructionAPIService) ConstructionMetadata(
 	}, nil
 }
 
+// redeemScripts returns the hex-encoded redeem script of each
+// P2SH input. Redeem scripts that are not provided in the input
+// metadata are derived from the public keys (P2SH-P2WPKH). If
+// there are no P2SH inputs, nil is returned.
+func (s *ConstructionAPIService) redeemScripts(
+	scripts []*defichain.ScriptPubKey,
+	publicKeys []*types.PublicKey,
+	providedScripts []string,
+) ([]string, error) {
+	var redeemScripts []string
+	for i, script := range scripts {
+		decodedScript, err := hex.DecodeString(script.Hex)
+		if err != nil {
+			return nil, fmt.Errorf("%w unable to decode script for utxo %d", err, i)
+		}
+
+		if txscript.GetScriptClass(decodedScript) != txscript.ScriptHashTy {
+			continue
+		}
+
+		if redeemScripts == nil {
+			redeemScripts = make([]string, len(scripts))
+		}
+
+		if provided := scriptAt(providedScripts, i); len(provided) > 0 {
+			redeemScripts[i] = provided
+			continue
+		}
+
+		for _, publicKey := range publicKeys {
+			redeemScript, err := witnessPubKeyHashScript(publicKey.Bytes, s.config.Params)
+			if err != nil {
+				return nil, err
+			}
+
+			if bytes.Equal(p2shScript(redeemScript), decodedScript) {
+				redeemScripts[i] = hex.EncodeToString(redeemScript)
+				break
+			}
+		}
+
+		if len(redeemScripts[i]) == 0 {
+			return nil, fmt.Errorf(
+				"no public key provided for utxo %d (%s)",
+				i,
+				script.Hex,
+			)
+		}
+	}
+
+	return redeemScripts, nil
+}
+
+// witnessPubKeyHashScript returns the P2WPKH script of a
+// public key.
+func witnessPubKeyHashScript(publicKey []byte, params *chaincfg.Params) ([]byte, error) {
+	addr, err := btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(publicKey), params)
+	if err != nil {
+		return nil, fmt.Errorf("%w unable to derive witness address", err)
+	}
+
+	return txscript.PayToAddrScript(addr)
+}
+
+// p2shScript returns the P2SH script of a redeem script.
+func p2shScript(redeemScript []byte) []byte {
+	script, _ := txscript.NewScriptBuilder().
+		AddOp(txscript.OP_HASH160).
+		AddData(btcutil.Hash160(redeemScript)).
+		AddOp(txscript.OP_EQUAL).
+		Script()
+
+	return script
+}
+
+// redeemScript returns the decoded redeem script of
+// utxo i and ensures it hashes to the P2SH script.
+func redeemScript(i int, hexScript string, script []byte) ([]byte, error) {
+	if len(hexScript) == 0 {
+		return nil, fmt.Errorf("redeem script for utxo %d is missing", i)
+	}
+
+	decodedScript, err := hex.DecodeString(hexScript)
+	if err != nil {
+		return nil, fmt.Errorf("%w unable to decode redeem script for utxo %d", err, i)
+	}
+
+	if !bytes.Equal(p2shScript(decodedScript), script) {
+		return nil, fmt.Errorf("redeem script for utxo %d does not match %x", i, script)
+	}
+
+	return decodedScript, nil
+}
+
+// scriptAt returns the script of utxo i or an empty
+// string if there is none.
+func scriptAt(scripts []string, i int) string {
+	if i >= len(scripts) {
+		return ""
+	}
+
+	return scripts[i]
+}
+
+// compactScripts returns nil if no script is populated so
+// that single-sig transactions don't carry empty scripts.
+func compactScripts(scripts []string) []string {
+	for _, script := range scripts {
+		if len(script) > 0 {
+			return scripts
+		}
+	}
+
+	return nil
+}
+
 // ConstructionPayloads implements the /construction/payloads endpoint.
 func (s *ConstructionAPIService) ConstructionPayloads(
 	ctx context.Context,
@@ -256,13 +743,117 @@ func (s *ConstructionAPIService) ConstructionPayloads(
 		ErrUnmatched: true,
 	}
 
-	matches, err := parser.MatchOperations(descriptions, request.Operations)
+	operations, intent, err := s.parseCustomTxIntent(request.Operations)
+	if err != nil {
+		return nil, wrapErr(ErrUnclearIntent, err)
+	}
+
+	var metadata constructionMetadata
+	if err := types.UnmarshalMap(request.Metadata, &metadata); err != nil {
+		return nil, wrapErr(ErrUnableToParseIntermediateResult, err)
+	}
+
+	// A custom transaction may not have any OUTPUT operations
+	// (ex: all DFI of the inputs is converted to account balances)
+	// and funded transactions don't have any INPUT operations.
+	funding := len(metadata.FundingAddress) > 0
+	descriptions.OperationDescriptions[0].Optional = funding
+	descriptions.OperationDescriptions[1].Optional = intent != nil
+
+	matches, err := parser.MatchOperations(descriptions, operations)
+	if err != nil {
+		return nil, wrapErr(ErrUnclearIntent, err)
+	}
+
+	inputs := []*types.Operation{}
+	amounts := []*big.Int{}
+	if matches[0] != nil {
+		inputs = append(inputs, matches[0].Operations...)
+		amounts = append(amounts, matches[0].Amounts...)
+	}
+
+	outputs := matches[1]
+	if outputs == nil {
+		outputs = &parser.Match{}
+	}
+
+	if funding {
+		intent.fundedBy(metadata.FundingAddress)
+	}
+
+	var authAddresses []string
+	var currencies []*types.Currency
+	if intent != nil {
+		authAddresses, currencies = intent.authAddresses, intent.currencies
+	}
+
+	if len(metadata.AuthCoins) != len(authAddresses) {
+		return nil, wrapErr(ErrAuthCoinMissing, fmt.Errorf(
+			"expected %d auth coins but got %d",
+			len(authAddresses),
+			len(metadata.AuthCoins),
+		))
+	}
+
+	// Funding coins and then auth coins are spent after
+	// the coins of the INPUT operations.
+	for _, coin := range metadata.FundingCoins {
+		input, amount, err := s.spendOperation(metadata.FundingAddress, coin)
+		if err != nil {
+			return nil, wrapErr(ErrInvalidCoin, err)
+		}
+
+		inputs = append(inputs, input)
+		amounts = append(amounts, amount)
+	}
+
+	authValues := make([]int64, len(metadata.AuthCoins))
+	for i, authCoin := range metadata.AuthCoins {
+		if authCoin.Address != authAddresses[i] {
+			return nil, wrapErr(ErrAuthCoinMissing, fmt.Errorf(
+				"expected auth coin of %s but got %s",
+				authAddresses[i],
+				authCoin.Address,
+			))
+		}
+
+		input, amount, err := s.spendOperation(authCoin.Address, authCoin.Coin)
+		if err != nil {
+			return nil, wrapErr(ErrInvalidCoin, err)
+		}
+
+		inputs = append(inputs, input)
+		amounts = append(amounts, amount)
+		authValues[i] = -amount.Int64()
+	}
+
+	var change int64
+	if len(metadata.ChangeAmount) > 0 {
+		change, err = strconv.ParseInt(metadata.ChangeAmount, 10, 64)
+		if err != nil || change <= 0 {
+			return nil, wrapErr(
+				ErrUnableToParseIntermediateResult,
+				fmt.Errorf("change amount %s is invalid", metadata.ChangeAmount),
+			)
+		}
+	}
+
+	extraOutputs := len(metadata.AuthCoins)
+	if change > 0 {
+		extraOutputs++
+	}
+
+	regularOutputs, mintedOutputs, customTxScript, err := outputLayout(
+		intent,
+		outputs,
+		extraOutputs,
+	)
 	if err != nil {
 		return nil, wrapErr(ErrUnclearIntent, err)
 	}
 
 	tx := wire.NewMsgTx(wire.TxVersion)
-	for _, input := range matches[0].Operations {
+	for _, input := range inputs {
 		if input.CoinChange == nil {
 			return nil, wrapErr(ErrUnclearIntent, errors.New("CoinChange cannot be nil"))
 		}
@@ -272,23 +863,68 @@ func (s *ConstructionAPIService) ConstructionPayloads(
 			return nil, wrapErr(ErrInvalidCoin, err)
 		}
 
+		inputMetadata, err := parseInputMetadata(input)
+		if err != nil {
+			return nil, wrapErr(ErrUnclearIntent, err)
+		}
+
 		tx.AddTxIn(&wire.TxIn{
 			PreviousOutPoint: wire.OutPoint{
 				Hash:  *transactionHash,
 				Index: index,
 			},
 			SignatureScript: nil,
-			Sequence:        wire.MaxTxInSequenceNum,
+			Sequence:        inputSequence(inputMetadata, metadata.Replaceable, metadata.LockTime),
+		})
+	}
+
+	tx.LockTime = metadata.LockTime
+	if err := validSequences(tx, metadata.Replaceable); err != nil {
+		return nil, wrapErr(ErrUnclearIntent, err)
+	}
+
+	if customTxScript != nil {
+		tx.AddTxOut(&wire.TxOut{
+			Value:    intent.value,
+			PkScript: customTxScript,
 		})
 	}
 
-	for i, output := range matches[1].Operations {
-		addr, err := btcutil.DecodeAddress(output.Account.Address, s.config.Params)
+	// The change is returned to the funding address and
+	// the whole amount of each auth coin to its address.
+	// outputOps holds the OUTPUT operation of each output
+	// of the transaction (nil if there is none).
+	outputOps := make([]*types.Operation, len(tx.TxOut))
+	outputAddresses := []string{}
+	outputValues := []int64{}
+	for _, i := range regularOutputs {
+		outputOps = append(outputOps, outputs.Operations[i])
+		outputAddresses = append(outputAddresses, outputs.Operations[i].Account.Address)
+		outputValues = append(outputValues, outputs.Amounts[i].Int64())
+	}
+	if change > 0 {
+		outputOps = append(outputOps, nil)
+		outputAddresses = append(outputAddresses, metadata.FundingAddress)
+		outputValues = append(outputValues, change)
+	}
+	for i, authCoin := range metadata.AuthCoins {
+		outputOps = append(outputOps, nil)
+		outputAddresses = append(outputAddresses, authCoin.Address)
+		outputValues = append(outputValues, authValues[i])
+	}
+	for _, i := range mintedOutputs {
+		outputOps = append(outputOps, outputs.Operations[i])
+		outputAddresses = append(outputAddresses, outputs.Operations[i].Account.Address)
+		outputValues = append(outputValues, outputs.Amounts[i].Int64())
+	}
+
+	for i, address := range outputAddresses {
+		addr, err := btcutil.DecodeAddress(address, s.config.Params)
 		if err != nil {
 			return nil, wrapErr(ErrUnableToDecodeAddress, fmt.Errorf(
 				"%w unable to decode address %s",
 				err,
-				output.Account.Address,
+				address,
 			),
 			)
 		}
@@ -302,23 +938,52 @@ func (s *ConstructionAPIService) ConstructionPayloads(
 		}
 
 		tx.AddTxOut(&wire.TxOut{
-			Value:    matches[1].Amounts[i].Int64(),
+			Value:    outputValues[i],
 			PkScript: pkScript,
 		})
 	}
 
+	if err := validScriptPubKeys(metadata.ScriptPubKeys, len(tx.TxIn)); err != nil {
+		return nil, wrapErr(ErrUnableToParseIntermediateResult, err)
+	}
+
+	inputScripts := make([][]byte, len(tx.TxIn))
+	inputValues := make([]int64, len(tx.TxIn))
+	for i := range tx.TxIn {
+		inputScripts[i], err = hex.DecodeString(metadata.ScriptPubKeys[i].Hex)
+		if err != nil {
+			return nil, wrapErr(ErrUnableToDecodeScriptPubKey, err)
+		}
+
+		inputValues[i] = new(big.Int).Abs(amounts[i]).Int64()
+	}
+
+	// The minted outputs are the last outputs.
+	mintingStart := len(tx.TxOut) - len(mintedOutputs)
+	fee := transactionFee(tx, inputValues, mintingStart)
+	if err := validReplacementFee(fee, metadata.ReplacementFee); err != nil {
+		return nil, wrapErr(ErrUnableToReplace, err)
+	}
+
+	if rErr := s.checkPolicy(tx, inputScripts, inputValues, mintingStart, func() (int, error) {
+		return s.unsignedVsize(tx, inputs)
+	}); rErr != nil {
+		return nil, rErr
+	}
+
 	// Create Signing Payloads (must be done after entire tx is constructed
 	// or hash will not be correct).
 	inputAmounts := make([]string, len(tx.TxIn))
 	inputAddresses := make([]string, len(tx.TxIn))
-	payloads := make([]*types.SigningPayload, len(tx.TxIn))
-	var metadata constructionMetadata
-	if err := types.UnmarshalMap(request.Metadata, &metadata); err != nil {
-		return nil, wrapErr(ErrUnableToParseIntermediateResult, err)
-	}
+	redeemScripts := make([]string, len(tx.TxIn))
+	witnessScripts := make([]string, len(tx.TxIn))
+	payloads := []*types.SigningPayload{}
 
+	sigHashes := txscript.NewTxSigHashes(tx)
 	for i := range tx.TxIn {
-		address := matches[0].Operations[i].Account.Address
+		input := inputs[i]
+		address := input.Account.Address
+
 		script, err := hex.DecodeString(metadata.ScriptPubKeys[i].Hex)
 		if err != nil {
 			return nil, wrapErr(ErrUnableToDecodeScriptPubKey, err)
@@ -332,37 +997,115 @@ func (s *ConstructionAPIService) ConstructionPayloads(
 			)
 		}
 
+		inputMetadata, err := parseInputMetadata(input)
+		if err != nil {
+			return nil, wrapErr(ErrUnclearIntent, err)
+		}
+
 		inputAddresses[i] = address
-		inputAmounts[i] = matches[0].Amounts[i].String()
-		absAmount := new(big.Int).Abs(matches[0].Amounts[i]).Int64()
+		inputAmounts[i] = amounts[i].String()
+		absAmount := new(big.Int).Abs(amounts[i]).Int64()
+
+		// The script committed to by the signature hash, whether
+		// the input is signed using BIP143 and the signers.
+		var signingScript []byte
+		var witness bool
+		signers := []string{address}
 
 		switch class {
 		case txscript.WitnessV0PubKeyHashTy:
-			hash, err := txscript.CalcWitnessSigHash(
-				script,
-				txscript.NewTxSigHashes(tx),
-				txscript.SigHashAll,
-				tx,
-				i,
-				absAmount,
-			)
+			signingScript, witness = script, true
+		case txscript.PubKeyHashTy:
+			signingScript = script
+		case txscript.ScriptHashTy:
+			hexScript := inputMetadata.RedeemScript
+			if len(hexScript) == 0 {
+				hexScript = scriptAt(metadata.RedeemScripts, i)
+			}
+
+			redeemScript, err := redeemScript(i, hexScript, script)
+			if err != nil {
+				return nil, wrapErr(ErrRedeemScriptMissing, err)
+			}
+			redeemScripts[i] = hex.EncodeToString(redeemScript)
+
+			switch redeemClass := txscript.GetScriptClass(redeemScript); redeemClass {
+			case txscript.WitnessV0PubKeyHashTy:
+				// The BIP143 script code of a P2WPKH program is
+				// derived by txscript.CalcWitnessSigHash.
+				signingScript, witness = redeemScript, true
+			case txscript.MultiSigTy:
+				signers, err = s.multisigSignerAddresses(redeemScript, inputMetadata.Signers)
+				if err != nil {
+					return nil, wrapErr(ErrUnclearIntent, err)
+				}
+
+				signingScript = redeemScript
+			default:
+				return nil, wrapErr(
+					ErrUnsupportedScriptType,
+					fmt.Errorf("unupported redeem script type: %s", redeemClass),
+				)
+			}
+		case txscript.WitnessV0ScriptHashTy:
+			witnessScript, err := witnessScript(i, inputMetadata.WitnessScript, script)
 			if err != nil {
-				return nil, wrapErr(ErrUnableToCalculateSignatureHash, err)
+				return nil, wrapErr(ErrWitnessScriptMissing, err)
+			}
+			witnessScripts[i] = hex.EncodeToString(witnessScript)
+
+			if witnessClass := txscript.GetScriptClass(witnessScript); witnessClass !=
+				txscript.MultiSigTy {
+				return nil, wrapErr(
+					ErrUnsupportedScriptType,
+					fmt.Errorf("unupported witness script type: %s", witnessClass),
+				)
 			}
 
-			payloads[i] = &types.SigningPayload{
-				AccountIdentifier: &types.AccountIdentifier{
-					Address: address,
-				},
-				Bytes:         hash,
-				SignatureType: types.Ecdsa,
+			signers, err = s.multisigSignerAddresses(witnessScript, inputMetadata.Signers)
+			if err != nil {
+				return nil, wrapErr(ErrUnclearIntent, err)
 			}
+
+			signingScript, witness = witnessScript, true
 		default:
 			return nil, wrapErr(
 				ErrUnsupportedScriptType,
 				fmt.Errorf("unupported script type: %s", class),
 			)
 		}
+
+		var hash []byte
+		if witness {
+			hash, err = txscript.CalcWitnessSigHash(
+				signingScript,
+				sigHashes,
+				txscript.SigHashAll,
+				tx,
+				i,
+				absAmount,
+			)
+		} else {
+			hash, err = txscript.CalcSignatureHash(
+				signingScript,
+				txscript.SigHashAll,
+				tx,
+				i,
+			)
+		}
+		if err != nil {
+			return nil, wrapErr(ErrUnableToCalculateSignatureHash, err)
+		}
+
+		for _, signer := range signers {
+			payloads = append(payloads, &types.SigningPayload{
+				AccountIdentifier: &types.AccountIdentifier{
+					Address: signer,
+				},
+				Bytes:         hash,
+				SignatureType: types.Ecdsa,
+			})
+		}
 	}
 
 	buf := bytes.NewBuffer(make([]byte, 0, tx.SerializeSize()))
@@ -370,12 +1113,29 @@ func (s *ConstructionAPIService) ConstructionPayloads(
 		return nil, wrapErr(ErrUnableToParseIntermediateResult, err)
 	}
 
-	rawTx, err := json.Marshal(&unsignedTransaction{
+	unsigned := &unsignedTransaction{
 		Transaction:    hex.EncodeToString(buf.Bytes()),
 		ScriptPubKeys:  metadata.ScriptPubKeys,
 		InputAmounts:   inputAmounts,
 		InputAddresses: inputAddresses,
-	})
+		RedeemScripts:  compactScripts(redeemScripts),
+		WitnessScripts: compactScripts(witnessScripts),
+		Currencies:     currencies,
+	}
+
+	if metadata.Encoding == PsbtTransactionEncoding {
+		packet, err := encodeUnsignedPsbt(tx, unsigned, inputs, outputOps)
+		if err != nil {
+			return nil, wrapErr(ErrUnclearIntent, err)
+		}
+
+		return &types.ConstructionPayloadsResponse{
+			UnsignedTransaction: packet,
+			Payloads:            payloads,
+		}, nil
+	}
+
+	rawTx, err := json.Marshal(unsigned)
 	if err != nil {
 		return nil, wrapErr(ErrUnableToParseIntermediateResult, err)
 	}
@@ -386,6 +1146,111 @@ func (s *ConstructionAPIService) ConstructionPayloads(
 	}, nil
 }
 
+// decodeUnsignedTransaction returns an unsigned transaction
+// returned by /construction/payloads and its decoded
+// transaction. The PSBT is nil unless it is a PSBT.
+func (s *ConstructionAPIService) decodeUnsignedTransaction(
+	raw string,
+) (*unsignedTransaction, *wire.MsgTx, *defichain.Psbt, error) {
+	var unsigned *unsignedTransaction
+	var packet *defichain.Psbt
+	if isPsbt(raw) {
+		var err error
+		unsigned, packet, err = s.decodeUnsignedPsbt(raw)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	} else {
+		decodedTx, err := hex.DecodeString(raw)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%w transaction cannot be decoded", err)
+		}
+
+		if err := json.Unmarshal(decodedTx, &unsigned); err != nil {
+			return nil, nil, nil, fmt.Errorf("%w unable to unmarshal defichain transaction", err)
+		}
+	}
+
+	decodedCoreTx, err := hex.DecodeString(unsigned.Transaction)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("%w transaction cannot be decoded", err)
+	}
+
+	var tx wire.MsgTx
+	if err := tx.Deserialize(bytes.NewReader(decodedCoreTx)); err != nil {
+		return nil, nil, nil, fmt.Errorf("%w unable to deserialize tx", err)
+	}
+
+	if err := validScriptPubKeys(unsigned.ScriptPubKeys, len(tx.TxIn)); err != nil {
+		return nil, nil, nil, err
+	}
+
+	if len(unsigned.InputAmounts) != len(tx.TxIn) ||
+		len(unsigned.InputAddresses) != len(tx.TxIn) {
+		return nil, nil, nil, fmt.Errorf("expected %d input amounts and addresses", len(tx.TxIn))
+	}
+
+	return unsigned, &tx, packet, nil
+}
+
+// validScriptPubKeys returns an error unless there
+// is a script pub key for each of count inputs.
+func validScriptPubKeys(scriptPubKeys []*defichain.ScriptPubKey, count int) error {
+	if len(scriptPubKeys) != count {
+		return fmt.Errorf("expected %d script pub keys but got %d", count, len(scriptPubKeys))
+	}
+
+	for i, scriptPubKey := range scriptPubKeys {
+		if scriptPubKey == nil {
+			return fmt.Errorf("script pub key %d is missing", i)
+		}
+	}
+
+	return nil
+}
+
+// decodeSignedTransaction returns a signed transaction
+// returned by /construction/combine.
+func decodeSignedTransaction(raw string) (*signedTransaction, error) {
+	if isPsbt(raw) {
+		return decodeSignedPsbt(raw)
+	}
+
+	decodedTx, err := hex.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w signed transaction cannot be decoded", err)
+	}
+
+	var signed signedTransaction
+	if err := json.Unmarshal(decodedTx, &signed); err != nil {
+		return nil, fmt.Errorf("%w unable to unmarshal signed defichain transaction", err)
+	}
+
+	return &signed, nil
+}
+
+// multisigSignerAddresses returns the addresses of the
+// signers of a multisig input in script order.
+func (s *ConstructionAPIService) multisigSignerAddresses(
+	script []byte,
+	signers []string,
+) ([]string, error) {
+	publicKeys, err := multisigSigners(script, signers)
+	if err != nil {
+		return nil, err
+	}
+
+	addresses := make([]string, len(publicKeys))
+	for i, publicKey := range publicKeys {
+		addresses[i], err = s.deriveAddress(publicKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return addresses, nil
+}
+
 func normalizeSignature(signature []byte) []byte {
 	sig := btcec.Signature{ // signature is in form of R || S
 		R: new(big.Int).SetBytes(signature[:32]),
@@ -401,64 +1266,97 @@ func (s *ConstructionAPIService) ConstructionCombine(
 	ctx context.Context,
 	request *types.ConstructionCombineRequest,
 ) (*types.ConstructionCombineResponse, *types.Error) {
-	decodedTx, err := hex.DecodeString(request.UnsignedTransaction)
+	unsigned, tx, packet, err := s.decodeUnsignedTransaction(request.UnsignedTransaction)
 	if err != nil {
-		return nil, wrapErr(
-			ErrUnableToParseIntermediateResult,
-			fmt.Errorf("%w transaction cannot be decoded", err),
-		)
+		return nil, wrapErr(ErrUnableToParseIntermediateResult, err)
 	}
 
-	var unsigned unsignedTransaction
-	if err := json.Unmarshal(decodedTx, &unsigned); err != nil {
-		return nil, wrapErr(
-			ErrUnableToParseIntermediateResult,
-			fmt.Errorf("%w unable to unmarshal defichain transaction", err),
-		)
+	inputs, rErr := s.signingInputs(unsigned, tx)
+	if rErr != nil {
+		return nil, rErr
 	}
 
-	decodedCoreTx, err := hex.DecodeString(unsigned.Transaction)
-	if err != nil {
-		return nil, wrapErr(
-			ErrUnableToParseIntermediateResult,
-			fmt.Errorf("%w transaction cannot be decoded", err),
-		)
+	if rErr := s.matchSignatures(inputs, request.Signatures); rErr != nil {
+		return nil, rErr
 	}
 
-	var tx wire.MsgTx
-	if err := tx.Deserialize(bytes.NewReader(decodedCoreTx)); err != nil {
-		return nil, wrapErr(
-			ErrUnableToParseIntermediateResult,
-			fmt.Errorf("%w unable to deserialize tx", err),
-		)
-	}
+	for i, input := range inputs {
+		switch {
+		case input.class == txscript.WitnessV0PubKeyHashTy:
+			tx.TxIn[i].Witness = wire.TxWitness{
+				normalizeSignature(input.signatures[0].Bytes),
+				input.signatures[0].PublicKey.Bytes,
+			}
+		case input.class == txscript.PubKeyHashTy:
+			sigScript, err := txscript.NewScriptBuilder().
+				AddData(normalizeSignature(input.signatures[0].Bytes)).
+				AddData(input.signatures[0].PublicKey.Bytes).
+				Script()
+			if err != nil {
+				return nil, wrapErr(
+					ErrUnableToParseIntermediateResult,
+					fmt.Errorf("%w unable to construct signature script", err),
+				)
+			}
 
-	for i := range tx.TxIn {
-		decodedScript, err := hex.DecodeString(unsigned.ScriptPubKeys[i].Hex)
-		if err != nil {
-			return nil, wrapErr(ErrUnableToDecodeScriptPubKey, err)
+			tx.TxIn[i].SignatureScript = sigScript
+		case input.class == txscript.ScriptHashTy && !input.multisig():
+			sigScript, err := txscript.NewScriptBuilder().AddData(input.script).Script()
+			if err != nil {
+				return nil, wrapErr(
+					ErrUnableToParseIntermediateResult,
+					fmt.Errorf("%w unable to construct signature script", err),
+				)
+			}
+
+			tx.TxIn[i].SignatureScript = sigScript
+			tx.TxIn[i].Witness = wire.TxWitness{
+				normalizeSignature(input.signatures[0].Bytes),
+				input.signatures[0].PublicKey.Bytes,
+			}
+		case input.class == txscript.ScriptHashTy:
+			fullsigs, err := orderSignatures(input.script, input.signatures)
+			if err != nil {
+				return nil, wrapErr(ErrUnclearIntent, err)
+			}
+
+			// OP_CHECKMULTISIG pops an extra (dummy) item
+			builder := txscript.NewScriptBuilder().AddOp(txscript.OP_0)
+			for _, fullsig := range fullsigs {
+				builder.AddData(fullsig)
+			}
+
+			sigScript, err := builder.AddData(input.script).Script()
+			if err != nil {
+				return nil, wrapErr(
+					ErrUnableToParseIntermediateResult,
+					fmt.Errorf("%w unable to construct signature script", err),
+				)
+			}
+
+			tx.TxIn[i].SignatureScript = sigScript
+		case input.class == txscript.WitnessV0ScriptHashTy:
+			fullsigs, err := orderSignatures(input.script, input.signatures)
+			if err != nil {
+				return nil, wrapErr(ErrUnclearIntent, err)
+			}
+
+			// OP_CHECKMULTISIG pops an extra (dummy) item
+			witness := wire.TxWitness{[]byte{}}
+			witness = append(witness, fullsigs...)
+			tx.TxIn[i].Witness = append(witness, input.script)
 		}
+	}
 
-		class, _, err := defichain.ParseSingleAddress(s.config.Params, decodedScript)
+	if packet != nil {
+		signedPacket, err := finalizePsbt(packet, tx)
 		if err != nil {
-			return nil, wrapErr(
-				ErrUnableToDecodeAddress,
-				fmt.Errorf("%w unable to parse address for script", err),
-			)
+			return nil, wrapErr(ErrUnableToParseIntermediateResult, err)
 		}
 
-		pkData := request.Signatures[i].PublicKey.Bytes
-		fullsig := normalizeSignature(request.Signatures[i].Bytes)
-
-		switch class {
-		case txscript.WitnessV0PubKeyHashTy:
-			tx.TxIn[i].Witness = wire.TxWitness{fullsig, pkData}
-		default:
-			return nil, wrapErr(
-				ErrUnsupportedScriptType,
-				fmt.Errorf("unupported script type: %s", class),
-			)
-		}
+		return &types.ConstructionCombineResponse{
+			SignedTransaction: signedPacket,
+		}, nil
 	}
 
 	buf := bytes.NewBuffer(make([]byte, 0, tx.SerializeSize()))
@@ -469,6 +1367,7 @@ func (s *ConstructionAPIService) ConstructionCombine(
 	rawTx, err := json.Marshal(&signedTransaction{
 		Transaction:  hex.EncodeToString(buf.Bytes()),
 		InputAmounts: unsigned.InputAmounts,
+		Currencies:   unsigned.Currencies,
 	})
 	if err != nil {
 		return nil, wrapErr(
@@ -487,20 +1386,9 @@ func (s *ConstructionAPIService) ConstructionHash(
 	ctx context.Context,
 	request *types.ConstructionHashRequest,
 ) (*types.TransactionIdentifierResponse, *types.Error) {
-	decodedTx, err := hex.DecodeString(request.SignedTransaction)
+	signed, err := decodeSignedTransaction(request.SignedTransaction)
 	if err != nil {
-		return nil, wrapErr(
-			ErrUnableToParseIntermediateResult,
-			fmt.Errorf("%w signed transaction cannot be decoded", err),
-		)
-	}
-
-	var signed signedTransaction
-	if err := json.Unmarshal(decodedTx, &signed); err != nil {
-		return nil, wrapErr(
-			ErrUnableToParseIntermediateResult,
-			fmt.Errorf("%w unable to unmarshal signed defichain transaction", err),
-		)
+		return nil, wrapErr(ErrUnableToParseIntermediateResult, err)
 	}
 
 	bytesTx, err := hex.DecodeString(signed.Transaction)
@@ -529,40 +1417,18 @@ func (s *ConstructionAPIService) ConstructionHash(
 func (s *ConstructionAPIService) parseUnsignedTransaction(
 	request *types.ConstructionParseRequest,
 ) (*types.ConstructionParseResponse, *types.Error) {
-	decodedTx, err := hex.DecodeString(request.Transaction)
-	if err != nil {
-		return nil, wrapErr(
-			ErrUnableToParseIntermediateResult,
-			fmt.Errorf("%w transaction cannot be decoded", err),
-		)
-	}
-
-	var unsigned unsignedTransaction
-	if err := json.Unmarshal(decodedTx, &unsigned); err != nil {
-		return nil, wrapErr(
-			ErrUnableToParseIntermediateResult,
-			fmt.Errorf("%w unable to unmarshal defichain transaction", err),
-		)
-	}
-
-	decodedCoreTx, err := hex.DecodeString(unsigned.Transaction)
+	unsigned, tx, _, err := s.decodeUnsignedTransaction(request.Transaction)
 	if err != nil {
-		return nil, wrapErr(
-			ErrUnableToParseIntermediateResult,
-			fmt.Errorf("%w transaction cannot be decoded", err),
-		)
-	}
-
-	var tx wire.MsgTx
-	if err := tx.Deserialize(bytes.NewReader(decodedCoreTx)); err != nil {
-		return nil, wrapErr(
-			ErrUnableToParseIntermediateResult,
-			fmt.Errorf("%w unable to deserialize tx", err),
-		)
+		return nil, wrapErr(ErrUnableToParseIntermediateResult, err)
 	}
 
 	ops := []*types.Operation{}
 	for i, input := range tx.TxIn {
+		inputMetadata, err := sequenceMetadata(input)
+		if err != nil {
+			return nil, wrapErr(ErrUnableToParseIntermediateResult, err)
+		}
+
 		networkIndex := int64(i)
 		ops = append(ops, &types.Operation{
 			OperationIdentifier: &types.OperationIdentifier{
@@ -587,58 +1453,34 @@ func (s *ConstructionAPIService) parseUnsignedTransaction(
 					),
 				},
 			},
+			Metadata: inputMetadata,
 		})
 	}
 
-	for i, output := range tx.TxOut {
-		networkIndex := int64(i)
-		_, addr, err := defichain.ParseSingleAddress(s.config.Params, output.PkScript)
-		if err != nil {
-			return nil, wrapErr(
-				ErrUnableToDecodeAddress,
-				fmt.Errorf("%w unable to parse output address", err),
-			)
-		}
+	outputOps, err := s.parseOutputOperations(tx, int64(len(ops)), unsigned.Currencies)
+	if err != nil {
+		return nil, wrapErr(ErrUnableToDecodeAddress, err)
+	}
+	ops = append(ops, outputOps...)
 
-		ops = append(ops, &types.Operation{
-			OperationIdentifier: &types.OperationIdentifier{
-				Index:        int64(len(ops)),
-				NetworkIndex: &networkIndex,
-			},
-			Type: defichain.OutputOpType,
-			Account: &types.AccountIdentifier{
-				Address: addr.String(),
-			},
-			Amount: &types.Amount{
-				Value:    strconv.FormatInt(output.Value, 10),
-				Currency: s.config.Currency,
-			},
-		})
+	metadata, err := parseMetadata(tx)
+	if err != nil {
+		return nil, wrapErr(ErrUnableToParseIntermediateResult, err)
 	}
 
 	return &types.ConstructionParseResponse{
 		Operations:               ops,
 		AccountIdentifierSigners: []*types.AccountIdentifier{},
+		Metadata:                 metadata,
 	}, nil
 }
 
 func (s *ConstructionAPIService) parseSignedTransaction(
 	request *types.ConstructionParseRequest,
 ) (*types.ConstructionParseResponse, *types.Error) {
-	decodedTx, err := hex.DecodeString(request.Transaction)
+	signed, err := decodeSignedTransaction(request.Transaction)
 	if err != nil {
-		return nil, wrapErr(
-			ErrUnableToParseIntermediateResult,
-			fmt.Errorf("%w signed transaction cannot be decoded", err),
-		)
-	}
-
-	var signed signedTransaction
-	if err := json.Unmarshal(decodedTx, &signed); err != nil {
-		return nil, wrapErr(
-			ErrUnableToParseIntermediateResult,
-			fmt.Errorf("%w unable to unmarshal signed defichain transaction", err),
-		)
+		return nil, wrapErr(ErrUnableToParseIntermediateResult, err)
 	}
 
 	serializedTx, err := hex.DecodeString(signed.Transaction)
@@ -657,10 +1499,18 @@ func (s *ConstructionAPIService) parseSignedTransaction(
 		)
 	}
 
+	if len(signed.InputAmounts) != len(tx.TxIn) {
+		return nil, wrapErr(
+			ErrUnableToParseIntermediateResult,
+			fmt.Errorf("expected %d input amounts", len(tx.TxIn)),
+		)
+	}
+
 	ops := []*types.Operation{}
 	signers := []*types.AccountIdentifier{}
+	sigHashes := txscript.NewTxSigHashes(&tx)
 	for i, input := range tx.TxIn {
-		pkScript, err := txscript.ComputePkScript(input.SignatureScript, input.Witness)
+		pkScript, err := computePkScript(input)
 		if err != nil {
 			return nil, wrapErr(
 				ErrUnableToComputePkScript,
@@ -668,7 +1518,7 @@ func (s *ConstructionAPIService) parseSignedTransaction(
 			)
 		}
 
-		_, addr, err := defichain.ParseSingleAddress(s.config.Params, pkScript.Script())
+		_, addr, err := defichain.ParseSingleAddress(s.config.Params, pkScript)
 		if err != nil {
 			return nil, wrapErr(
 				ErrUnableToDecodeAddress,
@@ -676,10 +1526,25 @@ func (s *ConstructionAPIService) parseSignedTransaction(
 			)
 		}
 
+		inputSigners, err := s.multisigInputSigners(&tx, sigHashes, i, signed.InputAmounts[i])
+		if err != nil {
+			return nil, wrapErr(
+				ErrUnableToParseIntermediateResult,
+				fmt.Errorf("%w unable to parse signers of input %d", err, i),
+			)
+		}
+
+		if inputSigners == nil {
+			inputSigners = []*types.AccountIdentifier{{Address: addr.EncodeAddress()}}
+		}
+
+		inputMetadata, err := sequenceMetadata(input)
+		if err != nil {
+			return nil, wrapErr(ErrUnableToParseIntermediateResult, err)
+		}
+
 		networkIndex := int64(i)
-		signers = append(signers, &types.AccountIdentifier{
-			Address: addr.EncodeAddress(),
-		})
+		signers = append(signers, inputSigners...)
 		ops = append(ops, &types.Operation{
 			OperationIdentifier: &types.OperationIdentifier{
 				Index:        int64(len(ops)),
@@ -703,41 +1568,120 @@ func (s *ConstructionAPIService) parseSignedTransaction(
 					),
 				},
 			},
+			Metadata: inputMetadata,
 		})
 	}
 
-	for i, output := range tx.TxOut {
-		networkIndex := int64(i)
-		_, addr, err := defichain.ParseSingleAddress(s.config.Params, output.PkScript)
-		if err != nil {
-			return nil, wrapErr(
-				ErrUnableToDecodeAddress,
-				fmt.Errorf("%w unable to parse output address", err),
-			)
-		}
+	outputOps, err := s.parseOutputOperations(&tx, int64(len(ops)), signed.Currencies)
+	if err != nil {
+		return nil, wrapErr(ErrUnableToDecodeAddress, err)
+	}
+	ops = append(ops, outputOps...)
 
-		ops = append(ops, &types.Operation{
-			OperationIdentifier: &types.OperationIdentifier{
-				Index:        int64(len(ops)),
-				NetworkIndex: &networkIndex,
-			},
-			Type: defichain.OutputOpType,
-			Account: &types.AccountIdentifier{
-				Address: addr.String(),
-			},
-			Amount: &types.Amount{
-				Value:    strconv.FormatInt(output.Value, 10),
-				Currency: s.config.Currency,
-			},
-		})
+	metadata, err := parseMetadata(&tx)
+	if err != nil {
+		return nil, wrapErr(ErrUnableToParseIntermediateResult, err)
 	}
 
 	return &types.ConstructionParseResponse{
 		Operations:               ops,
 		AccountIdentifierSigners: signers,
+		Metadata:                 metadata,
 	}, nil
 }
 
+// multisigInputSigners returns the signers of a P2SH or
+// P2WSH multisig input. If the input does not spend a
+// multisig script, nil is returned.
+func (s *ConstructionAPIService) multisigInputSigners(
+	tx *wire.MsgTx,
+	sigHashes *txscript.TxSigHashes,
+	i int,
+	inputAmount string,
+) ([]*types.AccountIdentifier, error) {
+	input := tx.TxIn[i]
+
+	var script []byte
+	var signatures [][]byte
+	var sigHash func(txscript.SigHashType) ([]byte, error)
+	switch {
+	case len(input.Witness) > 2 && // nolint:gomnd
+		txscript.GetScriptClass(input.Witness[len(input.Witness)-1]) == txscript.MultiSigTy:
+		amount, err := strconv.ParseInt(inputAmount, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w unable to parse input amount %s", err, inputAmount)
+		}
+		if amount < 0 {
+			amount = -amount
+		}
+
+		script = input.Witness[len(input.Witness)-1]
+		signatures = input.Witness[1 : len(input.Witness)-1]
+		sigHash = func(hashType txscript.SigHashType) ([]byte, error) {
+			return txscript.CalcWitnessSigHash(script, sigHashes, hashType, tx, i, amount)
+		}
+	case len(input.SignatureScript) > 0:
+		pushes, err := txscript.PushedData(input.SignatureScript)
+		if err != nil || len(pushes) < 3 || // nolint:gomnd
+			txscript.GetScriptClass(pushes[len(pushes)-1]) != txscript.MultiSigTy {
+			return nil, nil
+		}
+
+		script = pushes[len(pushes)-1]
+		signatures = pushes[1 : len(pushes)-1]
+		sigHash = func(hashType txscript.SigHashType) ([]byte, error) {
+			return txscript.CalcSignatureHash(script, hashType, tx, i)
+		}
+	default:
+		return nil, nil
+	}
+
+	publicKeys, err := multisigSignatureKeys(script, signatures, sigHash)
+	if err != nil {
+		return nil, err
+	}
+
+	signers := make([]*types.AccountIdentifier, len(publicKeys))
+	for j, publicKey := range publicKeys {
+		address, err := s.deriveAddress(publicKey)
+		if err != nil {
+			return nil, err
+		}
+
+		signers[j] = &types.AccountIdentifier{Address: address}
+	}
+
+	return signers, nil
+}
+
+// computePkScript returns the script of the output spent
+// by a signed input. P2PKH signature scripts are parsed
+// directly (<sig> <pubkey>) so signers using uncompressed
+// public keys are recovered as well.
+func computePkScript(input *wire.TxIn) ([]byte, error) {
+	if len(input.SignatureScript) > 0 {
+		pushes, err := txscript.PushedData(input.SignatureScript)
+		if err == nil && len(pushes) == 2 { // nolint:gomnd
+			if _, err := btcec.ParsePubKey(pushes[1], btcec.S256()); err == nil {
+				return txscript.NewScriptBuilder().
+					AddOp(txscript.OP_DUP).
+					AddOp(txscript.OP_HASH160).
+					AddData(btcutil.Hash160(pushes[1])).
+					AddOp(txscript.OP_EQUALVERIFY).
+					AddOp(txscript.OP_CHECKSIG).
+					Script()
+			}
+		}
+	}
+
+	pkScript, err := txscript.ComputePkScript(input.SignatureScript, input.Witness)
+	if err != nil {
+		return nil, err
+	}
+
+	return pkScript.Script(), nil
+}
+
 // ConstructionParse implements the /construction/parse endpoint.
 func (s *ConstructionAPIService) ConstructionParse(
 	ctx context.Context,
@@ -759,20 +1703,13 @@ func (s *ConstructionAPIService) ConstructionSubmit(
 		return nil, wrapErr(ErrUnavailableOffline, nil)
 	}
 
-	decodedTx, err := hex.DecodeString(request.SignedTransaction)
+	signed, err := decodeSignedTransaction(request.SignedTransaction)
 	if err != nil {
-		return nil, wrapErr(
-			ErrUnableToParseIntermediateResult,
-			fmt.Errorf("%w signed transaction cannot be decoded", err),
-		)
+		return nil, wrapErr(ErrUnableToParseIntermediateResult, err)
 	}
 
-	var signed signedTransaction
-	if err := json.Unmarshal(decodedTx, &signed); err != nil {
-		return nil, wrapErr(
-			ErrUnableToParseIntermediateResult,
-			fmt.Errorf("%w unable to unmarshal signed defichain transaction", err),
-		)
+	if rErr := s.checkSignedPolicy(signed); rErr != nil {
+		return nil, rErr
 	}
 
 	txHash, err := s.client.SendRawTransaction(ctx, signed.Transaction)
@@ -15,14 +15,22 @@
 package services
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"testing"
 
 	"github.com/DeFiCh/rosetta-defichain/configuration"
 	"github.com/DeFiCh/rosetta-defichain/defichain"
 	mocks "github.com/DeFiCh/rosetta-defichain/mocks/services"
 
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/coinbase/rosetta-sdk-go/parser"
 	"github.com/coinbase/rosetta-sdk-go/types"
 	"github.com/stretchr/testify/assert"
 )
@@ -67,7 +75,7 @@ func TestConstructionService(t *testing.T) {
 	publicKey := &types.PublicKey{
 		Bytes: forceHexDecode(
 			t,
-			"03d3d13e8180b10dfed0db4db9fb9013a5dcbdab64dff45d16310313c2929e71ac",
+			"0340414284b0f51a3dc8d8bf6f6b1002012b75778f296e935d7493d7cee2a63b83",
 		),
 		CurveType: types.Secp256k1,
 	}
@@ -78,7 +86,7 @@ func TestConstructionService(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, &types.ConstructionDeriveResponse{
 		AccountIdentifier: &types.AccountIdentifier{
-			Address: "tf1q4mfg3kqm4c7f8j7tyy028fa4uaw7zdzyerq5qx",
+			Address: "tf1qvlmwgj9rsmpqx2c6dl54a36ev4zkd3pw3ufh4c",
 		},
 	}, deriveResponse)
 
@@ -90,7 +98,7 @@ func TestConstructionService(t *testing.T) {
 			},
 			Type: defichain.InputOpType,
 			Account: &types.AccountIdentifier{
-				Address: "tf1q4mfg3kqm4c7f8j7tyy028fa4uaw7zdzyerq5qx",
+				Address: "tf1qvlmwgj9rsmpqx2c6dl54a36ev4zkd3pw3ufh4c",
 			},
 			Amount: &types.Amount{
 				Value:    "-999999444",
@@ -152,7 +160,7 @@ func TestConstructionService(t *testing.T) {
 				},
 			},
 		},
-		EstimatedSize: 142,
+		EstimatedSize: 141, // 10 + 0.5 (segwit flag) + 68 + 31 + 31 rounded up
 		FeeMultiplier: &feeMultiplier,
 	}
 	assert.Equal(t, &types.ConstructionPreprocessResponse{
@@ -163,12 +171,12 @@ func TestConstructionService(t *testing.T) {
 	metadata := &constructionMetadata{
 		ScriptPubKeys: []*defichain.ScriptPubKey{
 			{
-				ASM:          "0 aed288d81bae3c93cbcb211ea3a7b5e75de13444",
-				Hex:          "0014aed288d81bae3c93cbcb211ea3a7b5e75de13444",
+				ASM:          "0 67f6e448a386c2032b1a6fe95ec759654566c42e",
+				Hex:          "001467f6e448a386c2032b1a6fe95ec759654566c42e",
 				RequiredSigs: 1,
 				Type:         "witness_v0_keyhash",
 				Addresses: []string{
-					"tf1q4mfg3kqm4c7f8j7tyy028fa4uaw7zdzyerq5qx",
+					"tf1qvlmwgj9rsmpqx2c6dl54a36ev4zkd3pw3ufh4c",
 				},
 			},
 		},
@@ -187,10 +195,14 @@ func TestConstructionService(t *testing.T) {
 		"SuggestedFeeRate",
 		ctx,
 		defaultConfirmationTarget,
+		defichain.EstimateMode(""),
 	).Return(
 		defichain.MinFeeRate*10,
 		nil,
 	).Once()
+	metadata.FeePerKB = defichain.MinFeeRate * 10 * feeMultiplier
+	metadata.ConfirmationTarget = defaultConfirmationTarget
+	metadata.FeeRateSource = SmartFeeRateSource
 	metadataResponse, err := servicer.ConstructionMetadata(ctx, &types.ConstructionMetadataRequest{
 		NetworkIdentifier: networkIdentifier,
 		Options:           forceMarshalMap(t, options),
@@ -200,7 +212,7 @@ func TestConstructionService(t *testing.T) {
 		Metadata: forceMarshalMap(t, metadata),
 		SuggestedFee: []*types.Amount{
 			{
-				Value:    "1065", // 1,420 * 0.75
+				Value:    "1057", // 1,410 * 0.75
 				Currency: defichain.TestnetCurrency,
 			},
 		},
@@ -219,10 +231,12 @@ func TestConstructionService(t *testing.T) {
 		"SuggestedFeeRate",
 		ctx,
 		defaultConfirmationTarget,
+		defichain.EstimateMode(""),
 	).Return(
 		defichain.MinFeeRate,
 		nil,
 	).Once()
+	metadata.FeePerKB = defichain.MinFeeRate
 	metadataResponse, err = servicer.ConstructionMetadata(ctx, &types.ConstructionMetadataRequest{
 		NetworkIdentifier: networkIdentifier,
 		Options:           forceMarshalMap(t, options),
@@ -232,14 +246,14 @@ func TestConstructionService(t *testing.T) {
 		Metadata: forceMarshalMap(t, metadata),
 		SuggestedFee: []*types.Amount{
 			{
-				Value:    "142", // we don't go below minimum fee rate
+				Value:    "141", // we don't go below minimum fee rate
 				Currency: defichain.TestnetCurrency,
 			},
 		},
 	}, metadataResponse)
 
 	// Test Payloads
-	unsignedRaw := "7b227472616e73616374696f6e223a2230313030303030303031333732616531316363636439616366313632636564353936666536626230356237396439636664303162363539303638623366666661393939396535333564343030303030303030303066666666666666663032646239313065303030303030303030303136303031343164343339666164353434643866613262313530343864633630663936626466613434333363323437316165303030303030303030303030313630303134643838343133623334306430346464396631396463393261356336383336633663366336396238643030303030303030222c227363726970745075624b657973223a5b7b2261736d223a22302061656432383864383162616533633933636263623231316561336137623565373564653133343434222c22686578223a223030313461656432383864383162616533633933636263623231316561336137623565373564653133343434222c2272657153696773223a312c2274797065223a227769746e6573735f76305f6b657968617368222c22616464726573736573223a5b2274663171346d6667336b716d34633766386a37747979303238666134756177377a647a79657271357178225d7d5d2c22696e7075745f616d6f756e7473223a5b222d393939393939343434225d2c22696e7075745f616464726573736573223a5b2274663171346d6667336b716d34633766386a37747979303238666134756177377a647a79657271357178225d7d" // nolint
+	unsignedRaw := "7b227472616e73616374696f6e223a2230313030303030303031333732616531316363636439616366313632636564353936666536626230356237396439636664303162363539303638623366666661393939396535333564343030303030303030303066666666666666663032646239313065303030303030303030303136303031343164343339666164353434643866613262313530343864633630663936626466613434333363323437316165303030303030303030303030313630303134643838343133623334306430346464396631396463393261356336383336633663366336396238643030303030303030222c227363726970745075624b657973223a5b7b2261736d223a22302036376636653434386133383663323033326231613666653935656337353936353435363663343265222c22686578223a223030313436376636653434386133383663323033326231613666653935656337353936353435363663343265222c2272657153696773223a312c2274797065223a227769746e6573735f76305f6b657968617368222c22616464726573736573223a5b2274663171766c6d77676a3972736d707178326336646c35346133366576347a6b64337077337566683463225d7d5d2c22696e7075745f616d6f756e7473223a5b222d393939393939343434225d2c22696e7075745f616464726573736573223a5b2274663171766c6d77676a3972736d707178326336646c35346133366576347a6b64337077337566683463225d7d" // nolint
 	payloadsResponse, err := servicer.ConstructionPayloads(ctx, &types.ConstructionPayloadsRequest{
 		NetworkIdentifier: networkIdentifier,
 		Operations:        ops,
@@ -247,6 +261,7 @@ func TestConstructionService(t *testing.T) {
 	})
 	val0 := int64(0)
 	val1 := int64(1)
+	finalSequence := uint32(wire.MaxTxInSequenceNum)
 	parseOps := []*types.Operation{
 		{
 			OperationIdentifier: &types.OperationIdentifier{
@@ -255,7 +270,7 @@ func TestConstructionService(t *testing.T) {
 			},
 			Type: defichain.InputOpType,
 			Account: &types.AccountIdentifier{
-				Address: "tf1q4mfg3kqm4c7f8j7tyy028fa4uaw7zdzyerq5qx",
+				Address: "tf1qvlmwgj9rsmpqx2c6dl54a36ev4zkd3pw3ufh4c",
 			},
 			Amount: &types.Amount{
 				Value:    "-999999444",
@@ -267,6 +282,7 @@ func TestConstructionService(t *testing.T) {
 				},
 				CoinAction: types.CoinSpent,
 			},
+			Metadata: forceMarshalMap(t, &InputOperationMetadata{Sequence: &finalSequence}),
 		},
 		{
 			OperationIdentifier: &types.OperationIdentifier{
@@ -305,10 +321,10 @@ func TestConstructionService(t *testing.T) {
 	signingPayload := &types.SigningPayload{
 		Bytes: forceHexDecode(
 			t,
-			"69b9d24fb4ee7e69b02ad457c50a56460da918bdbc83e50fbbe69c23164edbc0",
+			"838c46add1b5d740dd2e6a8ba349deb92b9bd8e7f450f8c853147e51ceffb9cb",
 		),
 		AccountIdentifier: &types.AccountIdentifier{
-			Address: "tf1q4mfg3kqm4c7f8j7tyy028fa4uaw7zdzyerq5qx",
+			Address: "tf1qvlmwgj9rsmpqx2c6dl54a36ev4zkd3pw3ufh4c",
 		},
 		SignatureType: types.Ecdsa,
 	}
@@ -327,10 +343,11 @@ func TestConstructionService(t *testing.T) {
 	assert.Equal(t, &types.ConstructionParseResponse{
 		Operations:               parseOps,
 		AccountIdentifierSigners: []*types.AccountIdentifier{},
+		Metadata:                 forceMarshalMap(t, &ParseMetadata{}),
 	}, parseUnsignedResponse)
 
 	// Test Combine
-	signedRaw := "7b227472616e73616374696f6e223a22303130303030303030303031303133373261653131636363643961636631363263656435393666653662623035623739643963666430316236353930363862336666666139393939653533356434303030303030303030306666666666666666303264623931306530303030303030303030313630303134316434333966616435343464386661326231353034386463363066393662646661343433336332343731616530303030303030303030303031363030313464383834313362333430643034646439663139646339326135633638333663366336633639623864303234373330343430323230323538373665633862396635316433343361356135366163353439633063383238303035656634356562653964613136366462363435633039313537323233663032323034636430386237323738613838383961383131333539313562636531306431656633626239326232313766383161306465376537396666623364666436616335303132313033643364313365383138306231306466656430646234646239666239303133613564636264616236346466663435643136333130333133633239323965373161633030303030303030222c22696e7075745f616d6f756e7473223a5b222d393939393939343434225d7d" // nolint
+	signedRaw := "7b227472616e73616374696f6e223a22303130303030303030303031303133373261653131636363643961636631363263656435393666653662623035623739643963666430316236353930363862336666666139393939653533356434303030303030303030306666666666666666303264623931306530303030303030303030313630303134316434333966616435343464386661326231353034386463363066393662646661343433336332343731616530303030303030303030303031363030313464383834313362333430643034646439663139646339326135633638333663366336633639623864303234373330343430323230363363623231613364343666323839666435343337306164636537396531303464393361643465613965306432653230323139643831393039313531366362343032323036656232646430386231383665363032366536623833653362393133613866363831653137666335313966626139303432353638636632626337663434336534303132313033343034313432383462306635316133646338643862663666366231303032303132623735373738663239366539333564373439336437636565326136336238333030303030303030222c22696e7075745f616d6f756e7473223a5b222d393939393939343434225d7d" // nolint
 	combineResponse, err := servicer.ConstructionCombine(ctx, &types.ConstructionCombineRequest{
 		NetworkIdentifier:   networkIdentifier,
 		UnsignedTransaction: unsignedRaw,
@@ -338,7 +355,7 @@ func TestConstructionService(t *testing.T) {
 			{
 				Bytes: forceHexDecode(
 					t,
-					"25876ec8b9f51d343a5a56ac549c0c828005ef45ebe9da166db645c09157223f4cd08b7278a8889a81135915bce10d1ef3bb92b217f81a0de7e79ffb3dfd6ac5", // nolint
+					"63cb21a3d46f289fd54370adce79e104d93ad4ea9e0d2e20219d819091516cb46eb2dd08b186e6026e6b83e3b913a8f681e17fc519fba9042568cf2bc7f443e4", // nolint
 				),
 				SigningPayload: signingPayload,
 				PublicKey:      publicKey,
@@ -361,10 +378,38 @@ func TestConstructionService(t *testing.T) {
 	assert.Equal(t, &types.ConstructionParseResponse{
 		Operations: parseOps,
 		AccountIdentifierSigners: []*types.AccountIdentifier{
-			{Address: "tf1q4mfg3kqm4c7f8j7tyy028fa4uaw7zdzyerq5qx"},
+			{Address: "tf1qvlmwgj9rsmpqx2c6dl54a36ev4zkd3pw3ufh4c"},
 		},
+		Metadata: forceMarshalMap(t, &ParseMetadata{}),
 	}, parseSignedResponse)
 
+	// Test fewer script pub keys, input amounts or
+	// input addresses than inputs
+	shortMetadata := forceMarshalMap(t, metadata)
+	shortMetadata["script_pub_keys"] = []interface{}{}
+	_, err = servicer.ConstructionPayloads(ctx, &types.ConstructionPayloadsRequest{
+		NetworkIdentifier: networkIdentifier,
+		Operations:        ops,
+		Metadata:          shortMetadata,
+	})
+	assert.Equal(t, ErrUnableToParseIntermediateResult.Code, err.Code)
+
+	for _, field := range []string{"scriptPubKeys", "input_amounts", "input_addresses"} {
+		_, err = servicer.ConstructionParse(ctx, &types.ConstructionParseRequest{
+			NetworkIdentifier: networkIdentifier,
+			Signed:            false,
+			Transaction:       removeRawField(t, unsignedRaw, field),
+		})
+		assert.Equal(t, ErrUnableToParseIntermediateResult.Code, err.Code)
+	}
+
+	_, err = servicer.ConstructionParse(ctx, &types.ConstructionParseRequest{
+		NetworkIdentifier: networkIdentifier,
+		Signed:            true,
+		Transaction:       removeRawField(t, signedRaw, "input_amounts"),
+	})
+	assert.Equal(t, ErrUnableToParseIntermediateResult.Code, err.Code)
+
 	// Test Hash
 	transactionIdentifier := &types.TransactionIdentifier{
 		Hash: "d72427f967dbe9691328c03cb0c4be74d33dd22b537cd4a081d6ba4da970e8fc",
@@ -379,7 +424,7 @@ func TestConstructionService(t *testing.T) {
 	}, hashResponse)
 
 	// Test Submit
-	deFichainTransaction := "01000000000101372ae11cccd9acf162ced596fe6bb05b79d9cfd01b659068b3fffa9999e535d40000000000ffffffff02db910e00000000001600141d439fad544d8fa2b15048dc60f96bdfa4433c2471ae000000000000160014d88413b340d04dd9f19dc92a5c6836c6c6c69b8d02473044022025876ec8b9f51d343a5a56ac549c0c828005ef45ebe9da166db645c09157223f02204cd08b7278a8889a81135915bce10d1ef3bb92b217f81a0de7e79ffb3dfd6ac5012103d3d13e8180b10dfed0db4db9fb9013a5dcbdab64dff45d16310313c2929e71ac00000000" // nolint
+	deFichainTransaction := "01000000000101372ae11cccd9acf162ced596fe6bb05b79d9cfd01b659068b3fffa9999e535d40000000000ffffffff02db910e00000000001600141d439fad544d8fa2b15048dc60f96bdfa4433c2471ae000000000000160014d88413b340d04dd9f19dc92a5c6836c6c6c69b8d02473044022063cb21a3d46f289fd54370adce79e104d93ad4ea9e0d2e20219d819091516cb402206eb2dd08b186e6026e6b83e3b913a8f681e17fc519fba9042568cf2bc7f443e401210340414284b0f51a3dc8d8bf6f6b1002012b75778f296e935d7493d7cee2a63b8300000000" // nolint
 	mockClient.On(
 		"SendRawTransaction",
 		ctx,
@@ -400,3 +445,2087 @@ func TestConstructionService(t *testing.T) {
 	mockClient.AssertExpectations(t)
 	mockIndexer.AssertExpectations(t)
 }
+
+func signPayload(t *testing.T, privKey *btcec.PrivateKey, payload *types.SigningPayload) []byte {
+	sig, err := privKey.Sign(payload.Bytes)
+	assert.NoError(t, err)
+
+	// Signatures are returned in the form of R || S.
+	signature := make([]byte, 64) // nolint:gomnd
+	rBytes, sBytes := sig.R.Bytes(), sig.S.Bytes()
+	copy(signature[32-len(rBytes):32], rBytes)
+	copy(signature[64-len(sBytes):], sBytes)
+
+	return signature
+}
+
+// removeRawField removes a field of a hex-encoded
+// JSON transaction returned by the construction API.
+func removeRawField(t *testing.T, raw string, field string) string {
+	var decoded map[string]interface{}
+	assert.NoError(t, json.Unmarshal(forceHexDecode(t, raw), &decoded))
+	delete(decoded, field)
+
+	encoded, err := json.Marshal(decoded)
+	assert.NoError(t, err)
+
+	return hex.EncodeToString(encoded)
+}
+
+func TestConstructionService_P2PKH(t *testing.T) {
+	networkIdentifier = &types.NetworkIdentifier{
+		Network:    defichain.TestnetNetwork,
+		Blockchain: defichain.Blockchain,
+	}
+
+	cfg := &configuration.Configuration{
+		Mode:     configuration.Online,
+		Network:  networkIdentifier,
+		Params:   defichain.TestnetParams,
+		Currency: defichain.TestnetCurrency,
+	}
+
+	mockIndexer := &mocks.Indexer{}
+	mockClient := &mocks.Client{}
+	servicer := NewConstructionAPIService(cfg, mockClient, mockIndexer)
+	ctx := context.Background()
+
+	privKey, pubKey := btcec.PrivKeyFromBytes(btcec.S256(), forceHexDecode(
+		t,
+		"8f0a8b1a9f0f9e2a7f3c5b6d4e1a2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c",
+	))
+	publicKey := &types.PublicKey{
+		Bytes:     pubKey.SerializeCompressed(),
+		CurveType: types.Secp256k1,
+	}
+	legacyAddress := "7CYm8j6Jphjf6ghZHtsNfroacCgVdPZF3D"
+	segwitAddress := "tf1qvlmwgj9rsmpqx2c6dl54a36ev4zkd3pw3ufh4c"
+
+	// A legacy P2PKH input mixed with a segwit input
+	ops := []*types.Operation{
+		{
+			OperationIdentifier: &types.OperationIdentifier{
+				Index: 0,
+			},
+			Type: defichain.InputOpType,
+			Account: &types.AccountIdentifier{
+				Address: legacyAddress,
+			},
+			Amount: &types.Amount{
+				Value:    "-100000000",
+				Currency: defichain.TestnetCurrency,
+			},
+			CoinChange: &types.CoinChange{
+				CoinIdentifier: &types.CoinIdentifier{
+					Identifier: "d435e59999faffb36890651bd0cfd9795bb06bfe96d5ce62f1acd9cc1ce12a37:0",
+				},
+				CoinAction: types.CoinSpent,
+			},
+		},
+		{
+			OperationIdentifier: &types.OperationIdentifier{
+				Index: 1,
+			},
+			Type: defichain.InputOpType,
+			Account: &types.AccountIdentifier{
+				Address: segwitAddress,
+			},
+			Amount: &types.Amount{
+				Value:    "-50000000",
+				Currency: defichain.TestnetCurrency,
+			},
+			CoinChange: &types.CoinChange{
+				CoinIdentifier: &types.CoinIdentifier{
+					Identifier: "d435e59999faffb36890651bd0cfd9795bb06bfe96d5ce62f1acd9cc1ce12a37:1",
+				},
+				CoinAction: types.CoinSpent,
+			},
+		},
+		{
+			OperationIdentifier: &types.OperationIdentifier{
+				Index: 2,
+			},
+			Type: defichain.OutputOpType,
+			Account: &types.AccountIdentifier{
+				Address: "tf1qr4pelt25fk869v2sfrwxp7ttm7jyx0pyn4dxph",
+			},
+			Amount: &types.Amount{
+				Value:    "149990000",
+				Currency: defichain.TestnetCurrency,
+			},
+		},
+	}
+
+	// Test Preprocess
+	preprocessResponse, err := servicer.ConstructionPreprocess(
+		ctx,
+		&types.ConstructionPreprocessRequest{
+			NetworkIdentifier: networkIdentifier,
+			Operations:        ops,
+		},
+	)
+	assert.Nil(t, err)
+	var options preprocessOptions
+	assert.NoError(t, types.UnmarshalMap(preprocessResponse.Options, &options))
+	assert.Equal(t, float64(258), options.EstimatedSize) // 10 + 0.5 + 148 + 68 + 31
+
+	// Test Payloads
+	metadata := &constructionMetadata{
+		ScriptPubKeys: []*defichain.ScriptPubKey{
+			{
+				ASM:          "OP_DUP OP_HASH160 67f6e448a386c2032b1a6fe95ec759654566c42e OP_EQUALVERIFY OP_CHECKSIG",
+				Hex:          "76a91467f6e448a386c2032b1a6fe95ec759654566c42e88ac",
+				RequiredSigs: 1,
+				Type:         "pubkeyhash",
+				Addresses:    []string{legacyAddress},
+			},
+			{
+				ASM:          "0 67f6e448a386c2032b1a6fe95ec759654566c42e",
+				Hex:          "001467f6e448a386c2032b1a6fe95ec759654566c42e",
+				RequiredSigs: 1,
+				Type:         "witness_v0_keyhash",
+				Addresses:    []string{segwitAddress},
+			},
+		},
+	}
+	payloadsResponse, err := servicer.ConstructionPayloads(ctx, &types.ConstructionPayloadsRequest{
+		NetworkIdentifier: networkIdentifier,
+		Operations:        ops,
+		Metadata:          forceMarshalMap(t, metadata),
+	})
+	assert.Nil(t, err)
+	assert.Len(t, payloadsResponse.Payloads, 2)
+	assert.Equal(t, legacyAddress, payloadsResponse.Payloads[0].AccountIdentifier.Address)
+	assert.Equal(t, segwitAddress, payloadsResponse.Payloads[1].AccountIdentifier.Address)
+
+	// Test Combine
+	signatures := make([]*types.Signature, len(payloadsResponse.Payloads))
+	for i, payload := range payloadsResponse.Payloads {
+		assert.Equal(t, types.Ecdsa, payload.SignatureType)
+		signatures[i] = &types.Signature{
+			Bytes:          signPayload(t, privKey, payload),
+			SigningPayload: payload,
+			PublicKey:      publicKey,
+			SignatureType:  types.Ecdsa,
+		}
+	}
+	combineResponse, err := servicer.ConstructionCombine(ctx, &types.ConstructionCombineRequest{
+		NetworkIdentifier:   networkIdentifier,
+		UnsignedTransaction: payloadsResponse.UnsignedTransaction,
+		Signatures:          signatures,
+	})
+	assert.Nil(t, err)
+
+	// The signed transaction must pass script validation
+	var signed signedTransaction
+	assert.NoError(t, json.Unmarshal(
+		forceHexDecode(t, combineResponse.SignedTransaction),
+		&signed,
+	))
+	var tx wire.MsgTx
+	assert.NoError(t, tx.Deserialize(bytes.NewReader(forceHexDecode(t, signed.Transaction))))
+	assert.Len(t, tx.TxIn[0].Witness, 0)
+	assert.NotEmpty(t, tx.TxIn[0].SignatureScript)
+	assert.Len(t, tx.TxIn[1].Witness, 2)
+	assert.Empty(t, tx.TxIn[1].SignatureScript)
+
+	sigHashes := txscript.NewTxSigHashes(&tx)
+	inputAmounts := []int64{100000000, 50000000}
+	for i, scriptPubKey := range metadata.ScriptPubKeys {
+		vm, err := txscript.NewEngine(
+			forceHexDecode(t, scriptPubKey.Hex),
+			&tx,
+			i,
+			txscript.StandardVerifyFlags,
+			nil,
+			sigHashes,
+			inputAmounts[i],
+		)
+		assert.NoError(t, err)
+		assert.NoError(t, vm.Execute())
+	}
+
+	// Test Parse Signed
+	parseSignedResponse, err := servicer.ConstructionParse(ctx, &types.ConstructionParseRequest{
+		NetworkIdentifier: networkIdentifier,
+		Signed:            true,
+		Transaction:       combineResponse.SignedTransaction,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.AccountIdentifier{
+		{Address: legacyAddress},
+		{Address: segwitAddress},
+	}, parseSignedResponse.AccountIdentifierSigners)
+	assert.Equal(t, legacyAddress, parseSignedResponse.Operations[0].Account.Address)
+	assert.Equal(t, segwitAddress, parseSignedResponse.Operations[1].Account.Address)
+
+	mockClient.AssertExpectations(t)
+	mockIndexer.AssertExpectations(t)
+}
+
+func TestComputePkScript(t *testing.T) {
+	_, pubKey := btcec.PrivKeyFromBytes(btcec.S256(), forceHexDecode(
+		t,
+		"8f0a8b1a9f0f9e2a7f3c5b6d4e1a2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c",
+	))
+	sig := forceHexDecode(
+		t,
+		"3044022025876ec8b9f51d343a5a56ac549c0c828005ef45ebe9da166db645c09157223f02204cd08b7278a8889a81135915bce10d1ef3bb92b217f81a0de7e79ffb3dfd6ac501", // nolint
+	)
+
+	tests := map[string]struct {
+		input *wire.TxIn
+
+		pkScript string
+		err      bool
+	}{
+		"p2pkh (compressed)": {
+			input: &wire.TxIn{
+				SignatureScript: forceScript(t, sig, pubKey.SerializeCompressed()),
+			},
+			pkScript: "76a91467f6e448a386c2032b1a6fe95ec759654566c42e88ac",
+		},
+		"p2pkh (uncompressed)": {
+			input: &wire.TxIn{
+				SignatureScript: forceScript(t, sig, pubKey.SerializeUncompressed()),
+			},
+			pkScript: "76a914" + hex.EncodeToString(
+				btcutil.Hash160(pubKey.SerializeUncompressed()),
+			) + "88ac",
+		},
+		"p2wpkh": {
+			input: &wire.TxIn{
+				Witness: wire.TxWitness{sig, pubKey.SerializeCompressed()},
+			},
+			pkScript: "001467f6e448a386c2032b1a6fe95ec759654566c42e",
+		},
+		"unsigned": {
+			input: &wire.TxIn{},
+			err:   true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			pkScript, err := computePkScript(test.input)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.pkScript, hex.EncodeToString(pkScript))
+		})
+	}
+}
+
+func forceScript(t *testing.T, pushes ...[]byte) []byte {
+	builder := txscript.NewScriptBuilder()
+	for _, push := range pushes {
+		builder.AddData(push)
+	}
+
+	script, err := builder.Script()
+	assert.NoError(t, err)
+
+	return script
+}
+
+func TestConstructionService_P2SHP2WPKH(t *testing.T) {
+	networkIdentifier = &types.NetworkIdentifier{
+		Network:    defichain.TestnetNetwork,
+		Blockchain: defichain.Blockchain,
+	}
+
+	cfg := &configuration.Configuration{
+		Mode:     configuration.Online,
+		Network:  networkIdentifier,
+		Params:   defichain.TestnetParams,
+		Currency: defichain.TestnetCurrency,
+	}
+
+	mockIndexer := &mocks.Indexer{}
+	mockClient := &mocks.Client{}
+	servicer := NewConstructionAPIService(cfg, mockClient, mockIndexer)
+	ctx := context.Background()
+
+	privKey, pubKey := btcec.PrivKeyFromBytes(btcec.S256(), forceHexDecode(
+		t,
+		"8f0a8b1a9f0f9e2a7f3c5b6d4e1a2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c",
+	))
+	publicKey := &types.PublicKey{
+		Bytes:     pubKey.SerializeCompressed(),
+		CurveType: types.Secp256k1,
+	}
+	otherPublicKey := &types.PublicKey{
+		Bytes: forceHexDecode(
+			t,
+			"03d3d13e8180b10dfed0db4db9fb9013a5dcbdab64dff45d16310313c2929e71ac",
+		),
+		CurveType: types.Secp256k1,
+	}
+	p2shAddress := "tiMUgw1YkZ4i35PZXG95u6r7U7mAt3KpC5"
+	segwitAddress := "tf1qvlmwgj9rsmpqx2c6dl54a36ev4zkd3pw3ufh4c"
+
+	// A P2SH-P2WPKH input mixed with a segwit input
+	ops := []*types.Operation{
+		{
+			OperationIdentifier: &types.OperationIdentifier{
+				Index: 0,
+			},
+			Type: defichain.InputOpType,
+			Account: &types.AccountIdentifier{
+				Address: p2shAddress,
+			},
+			Amount: &types.Amount{
+				Value:    "-100000000",
+				Currency: defichain.TestnetCurrency,
+			},
+			CoinChange: &types.CoinChange{
+				CoinIdentifier: &types.CoinIdentifier{
+					Identifier: "d435e59999faffb36890651bd0cfd9795bb06bfe96d5ce62f1acd9cc1ce12a37:0",
+				},
+				CoinAction: types.CoinSpent,
+			},
+		},
+		{
+			OperationIdentifier: &types.OperationIdentifier{
+				Index: 1,
+			},
+			Type: defichain.InputOpType,
+			Account: &types.AccountIdentifier{
+				Address: segwitAddress,
+			},
+			Amount: &types.Amount{
+				Value:    "-50000000",
+				Currency: defichain.TestnetCurrency,
+			},
+			CoinChange: &types.CoinChange{
+				CoinIdentifier: &types.CoinIdentifier{
+					Identifier: "d435e59999faffb36890651bd0cfd9795bb06bfe96d5ce62f1acd9cc1ce12a37:1",
+				},
+				CoinAction: types.CoinSpent,
+			},
+		},
+		{
+			OperationIdentifier: &types.OperationIdentifier{
+				Index: 2,
+			},
+			Type: defichain.OutputOpType,
+			Account: &types.AccountIdentifier{
+				Address: "tf1qr4pelt25fk869v2sfrwxp7ttm7jyx0pyn4dxph",
+			},
+			Amount: &types.Amount{
+				Value:    "149990000",
+				Currency: defichain.TestnetCurrency,
+			},
+		},
+	}
+
+	// Test Preprocess
+	preprocessResponse, err := servicer.ConstructionPreprocess(
+		ctx,
+		&types.ConstructionPreprocessRequest{
+			NetworkIdentifier: networkIdentifier,
+			Operations:        ops,
+		},
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.AccountIdentifier{
+		{Address: p2shAddress},
+	}, preprocessResponse.RequiredPublicKeys)
+	var options preprocessOptions
+	assert.NoError(t, types.UnmarshalMap(preprocessResponse.Options, &options))
+	assert.Equal(t, float64(201), options.EstimatedSize) // 10 + 0.5 + 91 + 68 + 31
+
+	// Test Metadata
+	scriptPubKeys := []*defichain.ScriptPubKey{
+		{
+			ASM:          "OP_HASH160 84a0a86fb8e39a3b465ea1a13414bb831dabcba2 OP_EQUAL",
+			Hex:          "a91484a0a86fb8e39a3b465ea1a13414bb831dabcba287",
+			RequiredSigs: 1,
+			Type:         "scripthash",
+			Addresses:    []string{p2shAddress},
+		},
+		{
+			ASM:          "0 67f6e448a386c2032b1a6fe95ec759654566c42e",
+			Hex:          "001467f6e448a386c2032b1a6fe95ec759654566c42e",
+			RequiredSigs: 1,
+			Type:         "witness_v0_keyhash",
+			Addresses:    []string{segwitAddress},
+		},
+	}
+	mockIndexer.On(
+		"GetScriptPubKeys",
+		ctx,
+		options.Coins,
+	).Return(
+		scriptPubKeys,
+		nil,
+	).Twice()
+	mockClient.On(
+		"SuggestedFeeRate",
+		ctx,
+		defaultConfirmationTarget,
+		defichain.EstimateMode(""),
+	).Return(
+		defichain.MinFeeRate,
+		nil,
+	).Twice()
+
+	// Missing public key
+	metadataResponse, err := servicer.ConstructionMetadata(ctx, &types.ConstructionMetadataRequest{
+		NetworkIdentifier: networkIdentifier,
+		Options:           preprocessResponse.Options,
+		PublicKeys:        []*types.PublicKey{otherPublicKey},
+	})
+	assert.Nil(t, metadataResponse)
+	assert.Equal(t, ErrRedeemScriptMissing.Code, err.Code)
+
+	metadataResponse, err = servicer.ConstructionMetadata(ctx, &types.ConstructionMetadataRequest{
+		NetworkIdentifier: networkIdentifier,
+		Options:           preprocessResponse.Options,
+		PublicKeys:        []*types.PublicKey{otherPublicKey, publicKey},
+	})
+	assert.Nil(t, err)
+	metadata := &constructionMetadata{
+		ScriptPubKeys:      scriptPubKeys,
+		RedeemScripts:      []string{"001467f6e448a386c2032b1a6fe95ec759654566c42e", ""},
+		FeePerKB:           defichain.MinFeeRate,
+		ConfirmationTarget: defaultConfirmationTarget,
+		FeeRateSource:      SmartFeeRateSource,
+	}
+	assert.Equal(t, forceMarshalMap(t, metadata), metadataResponse.Metadata)
+
+	// Test Payloads
+	payloadsResponse, err := servicer.ConstructionPayloads(ctx, &types.ConstructionPayloadsRequest{
+		NetworkIdentifier: networkIdentifier,
+		Operations:        ops,
+		Metadata:          metadataResponse.Metadata,
+	})
+	assert.Nil(t, err)
+	assert.Len(t, payloadsResponse.Payloads, 2)
+	assert.Equal(t, p2shAddress, payloadsResponse.Payloads[0].AccountIdentifier.Address)
+	assert.Equal(t, segwitAddress, payloadsResponse.Payloads[1].AccountIdentifier.Address)
+
+	// Payloads are rejected if the redeem script doesn't
+	// match the P2SH script.
+	invalidMetadata := &constructionMetadata{
+		ScriptPubKeys: scriptPubKeys,
+		RedeemScripts: []string{"00141d439fad544d8fa2b15048dc60f96bdfa4433c24", ""},
+	}
+	invalidPayloadsResponse, err := servicer.ConstructionPayloads(
+		ctx,
+		&types.ConstructionPayloadsRequest{
+			NetworkIdentifier: networkIdentifier,
+			Operations:        ops,
+			Metadata:          forceMarshalMap(t, invalidMetadata),
+		},
+	)
+	assert.Nil(t, invalidPayloadsResponse)
+	assert.Equal(t, ErrRedeemScriptMissing.Code, err.Code)
+
+	// Test Combine
+	signatures := make([]*types.Signature, len(payloadsResponse.Payloads))
+	for i, payload := range payloadsResponse.Payloads {
+		signatures[i] = &types.Signature{
+			Bytes:          signPayload(t, privKey, payload),
+			SigningPayload: payload,
+			PublicKey:      publicKey,
+			SignatureType:  types.Ecdsa,
+		}
+	}
+	combineResponse, err := servicer.ConstructionCombine(ctx, &types.ConstructionCombineRequest{
+		NetworkIdentifier:   networkIdentifier,
+		UnsignedTransaction: payloadsResponse.UnsignedTransaction,
+		Signatures:          signatures,
+	})
+	assert.Nil(t, err)
+
+	// The signed transaction must pass script validation
+	var signed signedTransaction
+	assert.NoError(t, json.Unmarshal(
+		forceHexDecode(t, combineResponse.SignedTransaction),
+		&signed,
+	))
+	var tx wire.MsgTx
+	assert.NoError(t, tx.Deserialize(bytes.NewReader(forceHexDecode(t, signed.Transaction))))
+	assert.Equal(t, forceScript(
+		t,
+		forceHexDecode(t, "001467f6e448a386c2032b1a6fe95ec759654566c42e"),
+	), tx.TxIn[0].SignatureScript)
+	assert.Len(t, tx.TxIn[0].Witness, 2)
+	assert.Empty(t, tx.TxIn[1].SignatureScript)
+	assert.Len(t, tx.TxIn[1].Witness, 2)
+
+	sigHashes := txscript.NewTxSigHashes(&tx)
+	inputAmounts := []int64{100000000, 50000000}
+	for i, scriptPubKey := range scriptPubKeys {
+		vm, err := txscript.NewEngine(
+			forceHexDecode(t, scriptPubKey.Hex),
+			&tx,
+			i,
+			txscript.StandardVerifyFlags,
+			nil,
+			sigHashes,
+			inputAmounts[i],
+		)
+		assert.NoError(t, err)
+		assert.NoError(t, vm.Execute())
+	}
+
+	// Test Parse Signed
+	parseSignedResponse, err := servicer.ConstructionParse(ctx, &types.ConstructionParseRequest{
+		NetworkIdentifier: networkIdentifier,
+		Signed:            true,
+		Transaction:       combineResponse.SignedTransaction,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.AccountIdentifier{
+		{Address: p2shAddress},
+		{Address: segwitAddress},
+	}, parseSignedResponse.AccountIdentifierSigners)
+
+	mockClient.AssertExpectations(t)
+	mockIndexer.AssertExpectations(t)
+}
+
+func TestConstructionService_Multisig(t *testing.T) {
+	networkIdentifier = &types.NetworkIdentifier{
+		Network:    defichain.TestnetNetwork,
+		Blockchain: defichain.Blockchain,
+	}
+
+	cfg := &configuration.Configuration{
+		Mode:     configuration.Online,
+		Network:  networkIdentifier,
+		Params:   defichain.TestnetParams,
+		Currency: defichain.TestnetCurrency,
+	}
+
+	mockIndexer := &mocks.Indexer{}
+	mockClient := &mocks.Client{}
+	servicer := NewConstructionAPIService(cfg, mockClient, mockIndexer)
+	ctx := context.Background()
+
+	privKeys := make([]*btcec.PrivateKey, 3)
+	publicKeys := make([]*types.PublicKey, 3)
+	addressPubKeys := make([]*btcutil.AddressPubKey, 3)
+	signerAddresses := make([]string, 3)
+	for i, seed := range []string{
+		"8f0a8b1a9f0f9e2a7f3c5b6d4e1a2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c",
+		"1d2c3b4a5968778695a4b3c2d1e0f1e2d3c4b5a69788796a5b4c3d2e1f0e1d2c",
+		"5a4b3c2d1e0f9e8d7c6b5a49382716051f2e3d4c5b6a79881f2e3d4c5b6a7988",
+	} {
+		var pubKey *btcec.PublicKey
+		privKeys[i], pubKey = btcec.PrivKeyFromBytes(btcec.S256(), forceHexDecode(t, seed))
+		publicKeys[i] = &types.PublicKey{
+			Bytes:     pubKey.SerializeCompressed(),
+			CurveType: types.Secp256k1,
+		}
+
+		var err error
+		addressPubKeys[i], err = btcutil.NewAddressPubKey(publicKeys[i].Bytes, cfg.Params)
+		assert.NoError(t, err)
+
+		deriveResponse, rErr := servicer.ConstructionDerive(ctx, &types.ConstructionDeriveRequest{
+			NetworkIdentifier: networkIdentifier,
+			PublicKey:         publicKeys[i],
+		})
+		assert.Nil(t, rErr)
+		signerAddresses[i] = deriveResponse.AccountIdentifier.Address
+	}
+
+	// 2-of-3 multisig
+	multisigScript, err := txscript.MultiSigScript(addressPubKeys, 2)
+	assert.NoError(t, err)
+	p2shAddress, err := btcutil.NewAddressScriptHash(multisigScript, cfg.Params)
+	assert.NoError(t, err)
+	p2shScript, err := txscript.PayToAddrScript(p2shAddress)
+	assert.NoError(t, err)
+	witnessScriptHash := sha256.Sum256(multisigScript)
+	p2wshAddress, err := btcutil.NewAddressWitnessScriptHash(witnessScriptHash[:], cfg.Params)
+	assert.NoError(t, err)
+	p2wshScript, err := txscript.PayToAddrScript(p2wshAddress)
+	assert.NoError(t, err)
+
+	ops := []*types.Operation{
+		{
+			OperationIdentifier: &types.OperationIdentifier{
+				Index: 0,
+			},
+			Type: defichain.InputOpType,
+			Account: &types.AccountIdentifier{
+				Address: p2shAddress.EncodeAddress(),
+			},
+			Amount: &types.Amount{
+				Value:    "-100000000",
+				Currency: defichain.TestnetCurrency,
+			},
+			CoinChange: &types.CoinChange{
+				CoinIdentifier: &types.CoinIdentifier{
+					Identifier: "d435e59999faffb36890651bd0cfd9795bb06bfe96d5ce62f1acd9cc1ce12a37:0",
+				},
+				CoinAction: types.CoinSpent,
+			},
+			Metadata: forceMarshalMap(t, &InputOperationMetadata{
+				RedeemScript: hex.EncodeToString(multisigScript),
+			}),
+		},
+		{
+			OperationIdentifier: &types.OperationIdentifier{
+				Index: 1,
+			},
+			Type: defichain.InputOpType,
+			Account: &types.AccountIdentifier{
+				Address: p2wshAddress.EncodeAddress(),
+			},
+			Amount: &types.Amount{
+				Value:    "-50000000",
+				Currency: defichain.TestnetCurrency,
+			},
+			CoinChange: &types.CoinChange{
+				CoinIdentifier: &types.CoinIdentifier{
+					Identifier: "d435e59999faffb36890651bd0cfd9795bb06bfe96d5ce62f1acd9cc1ce12a37:1",
+				},
+				CoinAction: types.CoinSpent,
+			},
+			Metadata: forceMarshalMap(t, &InputOperationMetadata{
+				WitnessScript: hex.EncodeToString(multisigScript),
+				Signers: []string{
+					hex.EncodeToString(publicKeys[2].Bytes),
+					hex.EncodeToString(publicKeys[0].Bytes),
+				},
+			}),
+		},
+		{
+			OperationIdentifier: &types.OperationIdentifier{
+				Index: 2,
+			},
+			Type: defichain.OutputOpType,
+			Account: &types.AccountIdentifier{
+				Address: "tf1qr4pelt25fk869v2sfrwxp7ttm7jyx0pyn4dxph",
+			},
+			Amount: &types.Amount{
+				Value:    "149990000",
+				Currency: defichain.TestnetCurrency,
+			},
+		},
+	}
+
+	// Test Preprocess
+	preprocessResponse, rErr := servicer.ConstructionPreprocess(
+		ctx,
+		&types.ConstructionPreprocessRequest{
+			NetworkIdentifier: networkIdentifier,
+			Operations:        ops,
+		},
+	)
+	assert.Nil(t, rErr)
+	assert.Nil(t, preprocessResponse.RequiredPublicKeys)
+	var options preprocessOptions
+	assert.NoError(t, types.UnmarshalMap(preprocessResponse.Options, &options))
+	assert.Equal(t, float64(443), options.EstimatedSize) // 10 + 0.5 + 297 + 104.5 + 31
+	assert.Equal(t, []string{hex.EncodeToString(multisigScript), ""}, options.RedeemScripts)
+
+	// Test Metadata
+	scriptPubKeys := []*defichain.ScriptPubKey{
+		{
+			Hex:          hex.EncodeToString(p2shScript),
+			RequiredSigs: 1,
+			Type:         "scripthash",
+			Addresses:    []string{p2shAddress.EncodeAddress()},
+		},
+		{
+			Hex:          hex.EncodeToString(p2wshScript),
+			RequiredSigs: 1,
+			Type:         "witness_v0_scripthash",
+			Addresses:    []string{p2wshAddress.EncodeAddress()},
+		},
+	}
+	mockIndexer.On(
+		"GetScriptPubKeys",
+		ctx,
+		options.Coins,
+	).Return(
+		scriptPubKeys,
+		nil,
+	).Once()
+	mockClient.On(
+		"SuggestedFeeRate",
+		ctx,
+		defaultConfirmationTarget,
+		defichain.EstimateMode(""),
+	).Return(
+		defichain.MinFeeRate,
+		nil,
+	).Once()
+	metadataResponse, rErr := servicer.ConstructionMetadata(ctx, &types.ConstructionMetadataRequest{
+		NetworkIdentifier: networkIdentifier,
+		Options:           preprocessResponse.Options,
+	})
+	assert.Nil(t, rErr)
+	assert.Equal(t, forceMarshalMap(t, &constructionMetadata{
+		ScriptPubKeys:      scriptPubKeys,
+		RedeemScripts:      []string{hex.EncodeToString(multisigScript), ""},
+		FeePerKB:           defichain.MinFeeRate,
+		ConfirmationTarget: defaultConfirmationTarget,
+		FeeRateSource:      SmartFeeRateSource,
+	}), metadataResponse.Metadata)
+
+	// Test Payloads
+	payloadsResponse, rErr := servicer.ConstructionPayloads(ctx, &types.ConstructionPayloadsRequest{
+		NetworkIdentifier: networkIdentifier,
+		Operations:        ops,
+		Metadata:          metadataResponse.Metadata,
+	})
+	assert.Nil(t, rErr)
+	assert.Len(t, payloadsResponse.Payloads, 4)
+
+	// P2SH signers default to the first required public keys,
+	// P2WSH signers are sorted in script order.
+	payloadKeys := []int{0, 1, 0, 2}
+	for i, payload := range payloadsResponse.Payloads {
+		assert.Equal(t, signerAddresses[payloadKeys[i]], payload.AccountIdentifier.Address)
+	}
+	assert.Equal(t, payloadsResponse.Payloads[0].Bytes, payloadsResponse.Payloads[1].Bytes)
+	assert.Equal(t, payloadsResponse.Payloads[2].Bytes, payloadsResponse.Payloads[3].Bytes)
+	assert.NotEqual(t, payloadsResponse.Payloads[0].Bytes, payloadsResponse.Payloads[2].Bytes)
+
+	// Missing witness script
+	invalidOps := make([]*types.Operation, len(ops))
+	copy(invalidOps, ops)
+	invalidOps[1] = &types.Operation{
+		OperationIdentifier: ops[1].OperationIdentifier,
+		Type:                ops[1].Type,
+		Account:             ops[1].Account,
+		Amount:              ops[1].Amount,
+		CoinChange:          ops[1].CoinChange,
+	}
+	invalidPayloadsResponse, rErr := servicer.ConstructionPayloads(
+		ctx,
+		&types.ConstructionPayloadsRequest{
+			NetworkIdentifier: networkIdentifier,
+			Operations:        invalidOps,
+			Metadata:          metadataResponse.Metadata,
+		},
+	)
+	assert.Nil(t, invalidPayloadsResponse)
+	assert.Equal(t, ErrWitnessScriptMissing.Code, rErr.Code)
+
+	// Test Combine (signatures of each input are provided
+	// out of script order)
+	signatures := make([]*types.Signature, len(payloadsResponse.Payloads))
+	for i, payload := range payloadsResponse.Payloads {
+		signatures[i] = &types.Signature{
+			Bytes:          signPayload(t, privKeys[payloadKeys[i]], payload),
+			SigningPayload: payload,
+			PublicKey:      publicKeys[payloadKeys[i]],
+			SignatureType:  types.Ecdsa,
+		}
+	}
+	signatures[0], signatures[1] = signatures[1], signatures[0]
+	signatures[2], signatures[3] = signatures[3], signatures[2]
+
+	// Missing signature
+	invalidCombineResponse, rErr := servicer.ConstructionCombine(
+		ctx,
+		&types.ConstructionCombineRequest{
+			NetworkIdentifier:   networkIdentifier,
+			UnsignedTransaction: payloadsResponse.UnsignedTransaction,
+			Signatures:          signatures[:3],
+		},
+	)
+	assert.Nil(t, invalidCombineResponse)
+	assert.Equal(t, ErrUnclearIntent.Code, rErr.Code)
+
+	combineResponse, rErr := servicer.ConstructionCombine(ctx, &types.ConstructionCombineRequest{
+		NetworkIdentifier:   networkIdentifier,
+		UnsignedTransaction: payloadsResponse.UnsignedTransaction,
+		Signatures:          signatures,
+	})
+	assert.Nil(t, rErr)
+
+	// The signed transaction must pass script validation
+	var signed signedTransaction
+	assert.NoError(t, json.Unmarshal(
+		forceHexDecode(t, combineResponse.SignedTransaction),
+		&signed,
+	))
+	var tx wire.MsgTx
+	assert.NoError(t, tx.Deserialize(bytes.NewReader(forceHexDecode(t, signed.Transaction))))
+	assert.Len(t, tx.TxIn[0].Witness, 0)
+	assert.Empty(t, tx.TxIn[1].SignatureScript)
+	assert.Len(t, tx.TxIn[1].Witness, 4)
+
+	sigHashes := txscript.NewTxSigHashes(&tx)
+	inputAmounts := []int64{100000000, 50000000}
+	for i, scriptPubKey := range scriptPubKeys {
+		vm, err := txscript.NewEngine(
+			forceHexDecode(t, scriptPubKey.Hex),
+			&tx,
+			i,
+			txscript.StandardVerifyFlags,
+			nil,
+			sigHashes,
+			inputAmounts[i],
+		)
+		assert.NoError(t, err)
+		assert.NoError(t, vm.Execute())
+	}
+
+	// Test Parse Signed
+	parseSignedResponse, rErr := servicer.ConstructionParse(ctx, &types.ConstructionParseRequest{
+		NetworkIdentifier: networkIdentifier,
+		Signed:            true,
+		Transaction:       combineResponse.SignedTransaction,
+	})
+	assert.Nil(t, rErr)
+	assert.Equal(t, []*types.AccountIdentifier{
+		{Address: signerAddresses[0]},
+		{Address: signerAddresses[1]},
+		{Address: signerAddresses[0]},
+		{Address: signerAddresses[2]},
+	}, parseSignedResponse.AccountIdentifierSigners)
+	assert.Equal(t, p2shAddress.EncodeAddress(), parseSignedResponse.Operations[0].Account.Address)
+	assert.Equal(t, p2wshAddress.EncodeAddress(), parseSignedResponse.Operations[1].Account.Address)
+
+	mockClient.AssertExpectations(t)
+	mockIndexer.AssertExpectations(t)
+}
+
+func TestConstructionService_CustomTx(t *testing.T) {
+	networkIdentifier = &types.NetworkIdentifier{
+		Network:    defichain.TestnetNetwork,
+		Blockchain: defichain.Blockchain,
+	}
+
+	cfg := &configuration.Configuration{
+		Mode:     configuration.Online,
+		Network:  networkIdentifier,
+		Params:   defichain.TestnetParams,
+		Currency: defichain.TestnetCurrency,
+	}
+
+	mockIndexer := &mocks.Indexer{}
+	mockClient := &mocks.Client{}
+	servicer := NewConstructionAPIService(cfg, mockClient, mockIndexer)
+	intentParser := parser.New(nil, nil, nil)
+	ctx := context.Background()
+
+	privKey, pubKey := btcec.PrivKeyFromBytes(btcec.S256(), forceHexDecode(
+		t,
+		"8f0a8b1a9f0f9e2a7f3c5b6d4e1a2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c",
+	))
+	publicKey := &types.PublicKey{
+		Bytes:     pubKey.SerializeCompressed(),
+		CurveType: types.Secp256k1,
+	}
+	address := "tf1qvlmwgj9rsmpqx2c6dl54a36ev4zkd3pw3ufh4c"
+	script := "001467f6e448a386c2032b1a6fe95ec759654566c42e"
+	otherAddress := "tf1qr4pelt25fk869v2sfrwxp7ttm7jyx0pyn4dxph"
+	otherScript := "00141d439fad544d8fa2b15048dc60f96bdfa4433c24"
+	accountOp := func(index int64, opType string, address string, value string) *types.Operation {
+		return &types.Operation{
+			OperationIdentifier: &types.OperationIdentifier{
+				Index: index,
+			},
+			Type: opType,
+			Account: &types.AccountIdentifier{
+				Address: address,
+				SubAccount: &types.SubAccountIdentifier{
+					Address: defichain.AccountBalancesSubAccount,
+				},
+			},
+			Amount: &types.Amount{
+				Value:    value,
+				Currency: defichain.TestnetCurrency,
+			},
+		}
+	}
+	input := &types.Operation{
+		OperationIdentifier: &types.OperationIdentifier{
+			Index: 0,
+		},
+		Type: defichain.InputOpType,
+		Account: &types.AccountIdentifier{
+			Address: address,
+		},
+		Amount: &types.Amount{
+			Value:    "-100000000",
+			Currency: defichain.TestnetCurrency,
+		},
+		CoinChange: &types.CoinChange{
+			CoinIdentifier: &types.CoinIdentifier{
+				Identifier: "d435e59999faffb36890651bd0cfd9795bb06bfe96d5ce62f1acd9cc1ce12a37:1",
+			},
+			CoinAction: types.CoinSpent,
+		},
+	}
+	change := &types.Operation{
+		OperationIdentifier: &types.OperationIdentifier{
+			Index: 1,
+		},
+		Type: defichain.OutputOpType,
+		Account: &types.AccountIdentifier{
+			Address: address,
+		},
+		Amount: &types.Amount{
+			Value:    "49990000",
+			Currency: defichain.TestnetCurrency,
+		},
+	}
+	metadata := &constructionMetadata{
+		ScriptPubKeys: []*defichain.ScriptPubKey{
+			{
+				ASM:          "0 67f6e448a386c2032b1a6fe95ec759654566c42e",
+				Hex:          script,
+				RequiredSigs: 1,
+				Type:         "witness_v0_keyhash",
+				Addresses:    []string{address},
+			},
+		},
+	}
+
+	tests := map[string]struct {
+		ops []*types.Operation
+
+		estimatedSize float64
+		outputs       []*wire.TxOut
+		customTx      *defichain.CustomTx
+		mintedOutputs []int64
+	}{
+		"utxos to account": {
+			ops: []*types.Operation{
+				input,
+				change,
+				accountOp(2, defichain.UtxosToAccountOpType, otherAddress, "50000000"),
+			},
+			estimatedSize: 160, // 10 + 0.5 + 68 + 31 + 50
+			outputs: []*wire.TxOut{
+				{Value: 50000000},
+				{Value: 49990000, PkScript: forceHexDecode(t, script)},
+			},
+			customTx: &defichain.CustomTx{
+				Type: defichain.CustomTxUtxosToAccount,
+				Message: &defichain.UtxosToAccountMessage{
+					To: []*defichain.ScriptBalances{
+						{
+							Script:   otherScript,
+							Balances: []*defichain.TokenAmount{{TokenID: 0, Amount: 50000000}},
+						},
+					},
+				},
+			},
+		},
+		"account to utxos": {
+			ops: []*types.Operation{
+				input,
+				{
+					OperationIdentifier: &types.OperationIdentifier{
+						Index: 1,
+					},
+					Type: defichain.OutputOpType,
+					Account: &types.AccountIdentifier{
+						Address: otherAddress,
+					},
+					Amount: &types.Amount{
+						Value:    "250000000",
+						Currency: defichain.TestnetCurrency,
+					},
+					Metadata: forceMarshalMap(t, &OutputOperationMetadata{Minted: true}),
+				},
+				change,
+				accountOp(3, defichain.AccountToUtxosOpType, address, "-250000000"),
+			},
+			estimatedSize: 194, // 10 + 0.5 + 68 + 31 + 31 + 53
+			outputs: []*wire.TxOut{
+				{Value: 0},
+				{Value: 49990000, PkScript: forceHexDecode(t, script)},
+				{Value: 250000000, PkScript: forceHexDecode(t, otherScript)},
+			},
+			customTx: &defichain.CustomTx{
+				Type: defichain.CustomTxAccountToUtxos,
+				Message: &defichain.AccountToUtxosMessage{
+					From:                script,
+					Balances:            []*defichain.TokenAmount{{TokenID: 0, Amount: 250000000}},
+					MintingOutputsStart: 2,
+				},
+			},
+			mintedOutputs: []int64{2},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Test Preprocess
+			preprocessResponse, err := servicer.ConstructionPreprocess(
+				ctx,
+				&types.ConstructionPreprocessRequest{
+					NetworkIdentifier: networkIdentifier,
+					Operations:        test.ops,
+				},
+			)
+			assert.Nil(t, err)
+			var options preprocessOptions
+			assert.NoError(t, types.UnmarshalMap(preprocessResponse.Options, &options))
+			assert.Equal(t, test.estimatedSize, options.EstimatedSize)
+
+			// Test Payloads
+			payloadsResponse, err := servicer.ConstructionPayloads(ctx, &types.ConstructionPayloadsRequest{
+				NetworkIdentifier: networkIdentifier,
+				Operations:        test.ops,
+				Metadata:          forceMarshalMap(t, metadata),
+			})
+			assert.Nil(t, err)
+			assert.Len(t, payloadsResponse.Payloads, 1)
+
+			var unsigned unsignedTransaction
+			assert.NoError(t, json.Unmarshal(
+				forceHexDecode(t, payloadsResponse.UnsignedTransaction),
+				&unsigned,
+			))
+			var tx wire.MsgTx
+			assert.NoError(t, tx.Deserialize(bytes.NewReader(forceHexDecode(t, unsigned.Transaction))))
+			assert.Len(t, tx.TxOut, len(test.outputs))
+			for i, output := range test.outputs {
+				assert.Equal(t, output.Value, tx.TxOut[i].Value)
+				if i > 0 {
+					assert.Equal(t, output.PkScript, tx.TxOut[i].PkScript)
+				}
+			}
+
+			// The DfTx output is always the first output
+			customTx, decodeErr := defichain.DecodeCustomTx(tx.TxOut[0].PkScript)
+			assert.NoError(t, decodeErr)
+			assert.Equal(t, test.customTx, customTx)
+
+			// Test Parse Unsigned
+			parseUnsignedResponse, err := servicer.ConstructionParse(ctx, &types.ConstructionParseRequest{
+				NetworkIdentifier: networkIdentifier,
+				Signed:            false,
+				Transaction:       payloadsResponse.UnsignedTransaction,
+			})
+			assert.Nil(t, err)
+			assert.NoError(t, intentParser.ExpectedOperations(
+				test.ops,
+				parseUnsignedResponse.Operations,
+				true,
+				false,
+			))
+
+			for _, op := range parseUnsignedResponse.Operations {
+				if op.Type != defichain.OutputOpType {
+					continue
+				}
+
+				var outputMetadata OutputOperationMetadata
+				assert.NoError(t, types.UnmarshalMap(op.Metadata, &outputMetadata))
+				minted := false
+				for _, index := range test.mintedOutputs {
+					minted = minted || *op.OperationIdentifier.NetworkIndex == index
+				}
+				assert.Equal(t, minted, outputMetadata.Minted)
+			}
+
+			// Test Combine
+			combineResponse, err := servicer.ConstructionCombine(ctx, &types.ConstructionCombineRequest{
+				NetworkIdentifier:   networkIdentifier,
+				UnsignedTransaction: payloadsResponse.UnsignedTransaction,
+				Signatures: []*types.Signature{
+					{
+						Bytes:          signPayload(t, privKey, payloadsResponse.Payloads[0]),
+						SigningPayload: payloadsResponse.Payloads[0],
+						PublicKey:      publicKey,
+						SignatureType:  types.Ecdsa,
+					},
+				},
+			})
+			assert.Nil(t, err)
+
+			// Test Parse Signed
+			parseSignedResponse, err := servicer.ConstructionParse(ctx, &types.ConstructionParseRequest{
+				NetworkIdentifier: networkIdentifier,
+				Signed:            true,
+				Transaction:       combineResponse.SignedTransaction,
+			})
+			assert.Nil(t, err)
+			assert.Equal(t, []*types.AccountIdentifier{{Address: address}}, parseSignedResponse.AccountIdentifierSigners)
+			assert.NoError(t, intentParser.ExpectedOperations(
+				test.ops,
+				parseSignedResponse.Operations,
+				true,
+				false,
+			))
+		})
+	}
+
+	mockClient.AssertExpectations(t)
+	mockIndexer.AssertExpectations(t)
+}
+
+func TestConstructionService_TokenTransfer(t *testing.T) {
+	networkIdentifier = &types.NetworkIdentifier{
+		Network:    defichain.TestnetNetwork,
+		Blockchain: defichain.Blockchain,
+	}
+
+	cfg := &configuration.Configuration{
+		Mode:     configuration.Online,
+		Network:  networkIdentifier,
+		Params:   defichain.TestnetParams,
+		Currency: defichain.TestnetCurrency,
+	}
+
+	mockIndexer := &mocks.Indexer{}
+	mockClient := &mocks.Client{}
+	servicer := NewConstructionAPIService(cfg, mockClient, mockIndexer)
+	intentParser := parser.New(nil, nil, nil)
+	ctx := context.Background()
+
+	privKey, pubKey := btcec.PrivKeyFromBytes(btcec.S256(), forceHexDecode(
+		t,
+		"8f0a8b1a9f0f9e2a7f3c5b6d4e1a2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c",
+	))
+	publicKey := &types.PublicKey{
+		Bytes:     pubKey.SerializeCompressed(),
+		CurveType: types.Secp256k1,
+	}
+	legacyAddress := "7CYm8j6Jphjf6ghZHtsNfroacCgVdPZF3D"
+	segwitAddress := "tf1qvlmwgj9rsmpqx2c6dl54a36ev4zkd3pw3ufh4c"
+	otherAddress := "tf1qr4pelt25fk869v2sfrwxp7ttm7jyx0pyn4dxph"
+	btc := &types.Currency{
+		Symbol:   "BTC",
+		Decimals: 8,
+		Metadata: map[string]interface{}{defichain.TokenIDMetadataKey: float64(2)},
+	}
+
+	// The legacy address has no INPUT operation, so an
+	// auth coin is added to the transaction.
+	ops := []*types.Operation{
+		{
+			OperationIdentifier: &types.OperationIdentifier{
+				Index: 0,
+			},
+			Type: defichain.InputOpType,
+			Account: &types.AccountIdentifier{
+				Address: segwitAddress,
+			},
+			Amount: &types.Amount{
+				Value:    "-100000000",
+				Currency: defichain.TestnetCurrency,
+			},
+			CoinChange: &types.CoinChange{
+				CoinIdentifier: &types.CoinIdentifier{
+					Identifier: "d435e59999faffb36890651bd0cfd9795bb06bfe96d5ce62f1acd9cc1ce12a37:1",
+				},
+				CoinAction: types.CoinSpent,
+			},
+		},
+		{
+			OperationIdentifier: &types.OperationIdentifier{
+				Index: 1,
+			},
+			Type: defichain.OutputOpType,
+			Account: &types.AccountIdentifier{
+				Address: segwitAddress,
+			},
+			Amount: &types.Amount{
+				Value:    "99990000",
+				Currency: defichain.TestnetCurrency,
+			},
+		},
+		{
+			OperationIdentifier: &types.OperationIdentifier{
+				Index: 2,
+			},
+			Type: defichain.AccountTransferOpType,
+			Account: &types.AccountIdentifier{
+				Address: legacyAddress,
+				SubAccount: &types.SubAccountIdentifier{
+					Address: defichain.AccountBalancesSubAccount,
+				},
+			},
+			Amount: &types.Amount{
+				Value:    "-4000",
+				Currency: btc,
+			},
+		},
+		{
+			OperationIdentifier: &types.OperationIdentifier{
+				Index: 3,
+			},
+			Type: defichain.AccountTransferOpType,
+			Account: &types.AccountIdentifier{
+				Address: otherAddress,
+				SubAccount: &types.SubAccountIdentifier{
+					Address: defichain.AccountBalancesSubAccount,
+				},
+			},
+			Amount: &types.Amount{
+				Value:    "4000",
+				Currency: btc,
+			},
+		},
+	}
+
+	// Test Preprocess
+	preprocessResponse, err := servicer.ConstructionPreprocess(
+		ctx,
+		&types.ConstructionPreprocessRequest{
+			NetworkIdentifier: networkIdentifier,
+			Operations:        ops,
+		},
+	)
+	assert.Nil(t, err)
+	options := &preprocessOptions{
+		Coins: []*types.Coin{
+			{
+				CoinIdentifier: ops[0].CoinChange.CoinIdentifier,
+				Amount:         ops[0].Amount,
+			},
+		},
+		EstimatedSize: 368, // 10 + 0.5 + 68 + 31 + 148 (auth input) + 34 (auth output) + 76 (DfTx)
+		AuthAddresses: []string{legacyAddress},
+	}
+	assert.Equal(t, &types.ConstructionPreprocessResponse{
+		Options: forceMarshalMap(t, options),
+	}, preprocessResponse)
+
+	// Test Metadata
+	authCoins := []*types.Coin{
+		{
+			CoinIdentifier: &types.CoinIdentifier{
+				Identifier: "d435e59999faffb36890651bd0cfd9795bb06bfe96d5ce62f1acd9cc1ce12a37:2",
+			},
+			Amount: &types.Amount{
+				Value:    "20000",
+				Currency: defichain.TestnetCurrency,
+			},
+		},
+		{
+			CoinIdentifier: &types.CoinIdentifier{
+				Identifier: "d435e59999faffb36890651bd0cfd9795bb06bfe96d5ce62f1acd9cc1ce12a37:3",
+			},
+			Amount: &types.Amount{
+				Value:    "5000",
+				Currency: defichain.TestnetCurrency,
+			},
+		},
+	}
+	scriptPubKeys := []*defichain.ScriptPubKey{
+		{
+			ASM:          "0 67f6e448a386c2032b1a6fe95ec759654566c42e",
+			Hex:          "001467f6e448a386c2032b1a6fe95ec759654566c42e",
+			RequiredSigs: 1,
+			Type:         "witness_v0_keyhash",
+			Addresses:    []string{segwitAddress},
+		},
+		{
+			ASM:          "OP_DUP OP_HASH160 67f6e448a386c2032b1a6fe95ec759654566c42e OP_EQUALVERIFY OP_CHECKSIG",
+			Hex:          "76a91467f6e448a386c2032b1a6fe95ec759654566c42e88ac",
+			RequiredSigs: 1,
+			Type:         "pubkeyhash",
+			Addresses:    []string{legacyAddress},
+		},
+	}
+	mockIndexer.On(
+		"GetCoins",
+		ctx,
+		&types.AccountIdentifier{Address: legacyAddress},
+	).Return(
+		authCoins,
+		&types.BlockIdentifier{Index: 1, Hash: "block 1"},
+		nil,
+	).Once()
+	mockIndexer.On(
+		"GetMempoolCoins",
+		ctx,
+		&types.AccountIdentifier{Address: legacyAddress},
+		authCoins,
+	).Return(
+		authCoins,
+		nil,
+	).Once()
+	mockIndexer.On(
+		"GetScriptPubKeys",
+		ctx,
+		append(options.Coins, &types.Coin{
+			CoinIdentifier: authCoins[1].CoinIdentifier,
+			Amount: &types.Amount{
+				Value:    "-5000",
+				Currency: defichain.TestnetCurrency,
+			},
+		}),
+	).Return(
+		scriptPubKeys,
+		nil,
+	).Once()
+	mockClient.On(
+		"SuggestedFeeRate",
+		ctx,
+		defaultConfirmationTarget,
+		defichain.EstimateMode(""),
+	).Return(
+		defichain.MinFeeRate,
+		nil,
+	).Once()
+	metadataResponse, err := servicer.ConstructionMetadata(ctx, &types.ConstructionMetadataRequest{
+		NetworkIdentifier: networkIdentifier,
+		Options:           forceMarshalMap(t, options),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, forceMarshalMap(t, &constructionMetadata{
+		ScriptPubKeys:      scriptPubKeys,
+		AuthCoins:          []*authCoin{{Address: legacyAddress, Coin: authCoins[1]}},
+		FeePerKB:           defichain.MinFeeRate,
+		ConfirmationTarget: defaultConfirmationTarget,
+		FeeRateSource:      SmartFeeRateSource,
+	}), metadataResponse.Metadata)
+
+	// Test Payloads
+	payloadsResponse, err := servicer.ConstructionPayloads(ctx, &types.ConstructionPayloadsRequest{
+		NetworkIdentifier: networkIdentifier,
+		Operations:        ops,
+		Metadata:          metadataResponse.Metadata,
+	})
+	assert.Nil(t, err)
+	assert.Len(t, payloadsResponse.Payloads, 2)
+	assert.Equal(t, segwitAddress, payloadsResponse.Payloads[0].AccountIdentifier.Address)
+	assert.Equal(t, legacyAddress, payloadsResponse.Payloads[1].AccountIdentifier.Address)
+
+	// Payloads requires the auth coins
+	_, err = servicer.ConstructionPayloads(ctx, &types.ConstructionPayloadsRequest{
+		NetworkIdentifier: networkIdentifier,
+		Operations:        ops,
+		Metadata:          forceMarshalMap(t, &constructionMetadata{ScriptPubKeys: scriptPubKeys[:1]}),
+	})
+	assert.Equal(t, ErrAuthCoinMissing.Code, err.Code)
+
+	// Test Parse Unsigned
+	parseUnsignedResponse, err := servicer.ConstructionParse(ctx, &types.ConstructionParseRequest{
+		NetworkIdentifier: networkIdentifier,
+		Signed:            false,
+		Transaction:       payloadsResponse.UnsignedTransaction,
+	})
+	assert.Nil(t, err)
+	assert.NoError(t, intentParser.ExpectedOperations(
+		ops,
+		parseUnsignedResponse.Operations,
+		false,
+		false,
+	))
+
+	// The auth coin is spent and returned to the legacy address
+	authOps := []*types.Operation{}
+	for _, op := range parseUnsignedResponse.Operations {
+		if op.Account.Address == legacyAddress && op.Account.SubAccount == nil {
+			authOps = append(authOps, op)
+		}
+	}
+	assert.Len(t, authOps, 2)
+	assert.Equal(t, "-5000", authOps[0].Amount.Value)
+	assert.Equal(t, "5000", authOps[1].Amount.Value)
+
+	// Test Combine
+	signatures := make([]*types.Signature, len(payloadsResponse.Payloads))
+	for i, payload := range payloadsResponse.Payloads {
+		signatures[i] = &types.Signature{
+			Bytes:          signPayload(t, privKey, payload),
+			SigningPayload: payload,
+			PublicKey:      publicKey,
+			SignatureType:  types.Ecdsa,
+		}
+	}
+	combineResponse, err := servicer.ConstructionCombine(ctx, &types.ConstructionCombineRequest{
+		NetworkIdentifier:   networkIdentifier,
+		UnsignedTransaction: payloadsResponse.UnsignedTransaction,
+		Signatures:          signatures,
+	})
+	assert.Nil(t, err)
+
+	// The signed transaction must pass script validation
+	var signed signedTransaction
+	assert.NoError(t, json.Unmarshal(
+		forceHexDecode(t, combineResponse.SignedTransaction),
+		&signed,
+	))
+	var tx wire.MsgTx
+	assert.NoError(t, tx.Deserialize(bytes.NewReader(forceHexDecode(t, signed.Transaction))))
+	assert.Len(t, tx.TxOut, 3)
+	assert.Equal(t, int64(0), tx.TxOut[0].Value)
+	assert.Equal(t, int64(5000), tx.TxOut[2].Value)
+
+	customTx, decodeErr := defichain.DecodeCustomTx(tx.TxOut[0].PkScript)
+	assert.NoError(t, decodeErr)
+	assert.Equal(t, &defichain.CustomTx{
+		Type: defichain.CustomTxAccountToAccount,
+		Message: &defichain.AccountToAccountMessage{
+			From: "76a91467f6e448a386c2032b1a6fe95ec759654566c42e88ac",
+			To: []*defichain.ScriptBalances{
+				{
+					Script:   "00141d439fad544d8fa2b15048dc60f96bdfa4433c24",
+					Balances: []*defichain.TokenAmount{{TokenID: 2, Amount: 4000}},
+				},
+			},
+		},
+	}, customTx)
+
+	sigHashes := txscript.NewTxSigHashes(&tx)
+	inputAmounts := []int64{100000000, 5000}
+	for i, scriptPubKey := range scriptPubKeys {
+		vm, err := txscript.NewEngine(
+			forceHexDecode(t, scriptPubKey.Hex),
+			&tx,
+			i,
+			txscript.StandardVerifyFlags,
+			nil,
+			sigHashes,
+			inputAmounts[i],
+		)
+		assert.NoError(t, err)
+		assert.NoError(t, vm.Execute())
+	}
+
+	// Test Parse Signed
+	parseSignedResponse, err := servicer.ConstructionParse(ctx, &types.ConstructionParseRequest{
+		NetworkIdentifier: networkIdentifier,
+		Signed:            true,
+		Transaction:       combineResponse.SignedTransaction,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.AccountIdentifier{
+		{Address: segwitAddress},
+		{Address: legacyAddress},
+	}, parseSignedResponse.AccountIdentifierSigners)
+	assert.NoError(t, intentParser.ExpectedOperations(
+		ops,
+		parseSignedResponse.Operations,
+		false,
+		false,
+	))
+
+	mockClient.AssertExpectations(t)
+	mockIndexer.AssertExpectations(t)
+}
+
+func TestConstructionService_FundingAccount(t *testing.T) {
+	networkIdentifier = &types.NetworkIdentifier{
+		Network:    defichain.TestnetNetwork,
+		Blockchain: defichain.Blockchain,
+	}
+
+	cfg := &configuration.Configuration{
+		Mode:     configuration.Online,
+		Network:  networkIdentifier,
+		Params:   defichain.TestnetParams,
+		Currency: defichain.TestnetCurrency,
+	}
+
+	mockIndexer := &mocks.Indexer{}
+	mockClient := &mocks.Client{}
+	servicer := NewConstructionAPIService(cfg, mockClient, mockIndexer)
+	intentParser := parser.New(nil, nil, nil)
+	ctx := context.Background()
+
+	privKey, pubKey := btcec.PrivKeyFromBytes(btcec.S256(), forceHexDecode(
+		t,
+		"8f0a8b1a9f0f9e2a7f3c5b6d4e1a2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c",
+	))
+	publicKey := &types.PublicKey{
+		Bytes:     pubKey.SerializeCompressed(),
+		CurveType: types.Secp256k1,
+	}
+	fundingAccount := &types.AccountIdentifier{
+		Address: "tf1qvlmwgj9rsmpqx2c6dl54a36ev4zkd3pw3ufh4c",
+	}
+	otherAddress := "tf1qr4pelt25fk869v2sfrwxp7ttm7jyx0pyn4dxph"
+
+	ops := []*types.Operation{
+		{
+			OperationIdentifier: &types.OperationIdentifier{
+				Index: 0,
+			},
+			Type: defichain.OutputOpType,
+			Account: &types.AccountIdentifier{
+				Address: otherAddress,
+			},
+			Amount: &types.Amount{
+				Value:    "1000000",
+				Currency: defichain.TestnetCurrency,
+			},
+		},
+	}
+
+	// Test Preprocess
+	preprocessResponse, err := servicer.ConstructionPreprocess(
+		ctx,
+		&types.ConstructionPreprocessRequest{
+			NetworkIdentifier: networkIdentifier,
+			Operations:        ops,
+			Metadata: forceMarshalMap(t, &PreprocessMetadata{
+				FundingAccount: fundingAccount,
+			}),
+		},
+	)
+	assert.Nil(t, err)
+	options := &preprocessOptions{
+		Coins:          []*types.Coin{},
+		EstimatedSize:  41, // 10 + 31
+		FundingAccount: fundingAccount,
+		FundingAmount:  "1000000",
+		CoinSelection:  LargestFirst,
+	}
+	assert.Equal(t, &types.ConstructionPreprocessResponse{
+		Options: forceMarshalMap(t, options),
+	}, preprocessResponse)
+
+	// INPUT operations can't be used with a funding account
+	_, err = servicer.ConstructionPreprocess(
+		ctx,
+		&types.ConstructionPreprocessRequest{
+			NetworkIdentifier: networkIdentifier,
+			Operations: append([]*types.Operation{
+				{
+					OperationIdentifier: &types.OperationIdentifier{
+						Index: 1,
+					},
+					Type:    defichain.InputOpType,
+					Account: fundingAccount,
+					Amount: &types.Amount{
+						Value:    "-2000000",
+						Currency: defichain.TestnetCurrency,
+					},
+					CoinChange: &types.CoinChange{
+						CoinIdentifier: &types.CoinIdentifier{
+							Identifier: "b14157a5c2ef0ce1de1a3ca1e6c3b2b3a0dd1e0a6e8e1d1f2a0e3c4b5a6d7e8f:0",
+						},
+						CoinAction: types.CoinSpent,
+					},
+				},
+			}, ops...),
+			Metadata: forceMarshalMap(t, &PreprocessMetadata{
+				FundingAccount: fundingAccount,
+			}),
+		},
+	)
+	assert.Equal(t, ErrUnclearIntent.Code, err.Code)
+
+	// Unknown coin selections are rejected
+	_, err = servicer.ConstructionPreprocess(
+		ctx,
+		&types.ConstructionPreprocessRequest{
+			NetworkIdentifier: networkIdentifier,
+			Operations:        ops,
+			Metadata: forceMarshalMap(t, &PreprocessMetadata{
+				FundingAccount: fundingAccount,
+				CoinSelection:  CoinSelection("random"),
+			}),
+		},
+	)
+	assert.Equal(t, ErrUnclearIntent.Code, err.Code)
+
+	// Test Metadata
+	coins := []*types.Coin{
+		{
+			CoinIdentifier: &types.CoinIdentifier{
+				Identifier: "b14157a5c2ef0ce1de1a3ca1e6c3b2b3a0dd1e0a6e8e1d1f2a0e3c4b5a6d7e8f:0",
+			},
+			Amount: &types.Amount{
+				Value:    "3000000",
+				Currency: defichain.TestnetCurrency,
+			},
+		},
+		{
+			CoinIdentifier: &types.CoinIdentifier{
+				Identifier: "b14157a5c2ef0ce1de1a3ca1e6c3b2b3a0dd1e0a6e8e1d1f2a0e3c4b5a6d7e8f:1",
+			},
+			Amount: &types.Amount{
+				Value:    "500000",
+				Currency: defichain.TestnetCurrency,
+			},
+		},
+	}
+	spentCoins := make([]*types.Coin, len(coins))
+	for i, coin := range coins {
+		spentCoins[i] = &types.Coin{
+			CoinIdentifier: coin.CoinIdentifier,
+			Amount: &types.Amount{
+				Value:    "-" + coin.Amount.Value,
+				Currency: defichain.TestnetCurrency,
+			},
+		}
+	}
+	scriptPubKey := &defichain.ScriptPubKey{
+		ASM:          "0 67f6e448a386c2032b1a6fe95ec759654566c42e",
+		Hex:          "001467f6e448a386c2032b1a6fe95ec759654566c42e",
+		RequiredSigs: 1,
+		Type:         "witness_v0_keyhash",
+		Addresses:    []string{fundingAccount.Address},
+	}
+	mockIndexer.On(
+		"GetCoins",
+		ctx,
+		fundingAccount,
+	).Return(
+		coins,
+		&types.BlockIdentifier{Index: 20, Hash: "block 20"},
+		nil,
+	).Times(3)
+	mockIndexer.On(
+		"GetMempoolCoins",
+		ctx,
+		fundingAccount,
+		coins,
+	).Return(
+		coins,
+		nil,
+	).Twice()
+	mockIndexer.On(
+		"GetScriptPubKeys",
+		ctx,
+		spentCoins[:1],
+	).Return(
+		[]*defichain.ScriptPubKey{scriptPubKey},
+		nil,
+	).Once()
+	mockClient.On(
+		"SuggestedFeeRate",
+		ctx,
+		defaultConfirmationTarget,
+		defichain.EstimateMode(""),
+	).Return(
+		defichain.MinFeeRate,
+		nil,
+	).Times(3)
+	metadataResponse, err := servicer.ConstructionMetadata(ctx, &types.ConstructionMetadataRequest{
+		NetworkIdentifier: networkIdentifier,
+		Options:           forceMarshalMap(t, options),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, &types.ConstructionMetadataResponse{
+		Metadata: forceMarshalMap(t, &constructionMetadata{
+			ScriptPubKeys:  []*defichain.ScriptPubKey{scriptPubKey},
+			FundingAddress: fundingAccount.Address,
+			FundingCoins:   coins[:1],
+			ChangeAmount:   "1999859", // 3000000 - 1000000 - 141
+
+			FeePerKB:           defichain.MinFeeRate,
+			ConfirmationTarget: defaultConfirmationTarget,
+			FeeRateSource:      SmartFeeRateSource,
+		}),
+		SuggestedFee: []*types.Amount{
+			{
+				Value:    "141", // 41 + 69 (input and segwit flag) + 31 (change)
+				Currency: defichain.TestnetCurrency,
+			},
+		},
+	}, metadataResponse)
+
+	// Oldest coins are selected first
+	oldestOptions := *options
+	oldestOptions.CoinSelection = OldestFirst
+	mockIndexer.On(
+		"GetCoinBlocks",
+		ctx,
+		coins,
+	).Return(
+		[]*types.BlockIdentifier{
+			{Index: 10, Hash: "block 10"},
+			{Index: 2, Hash: "block 2"},
+		},
+		nil,
+	).Once()
+	mockIndexer.On(
+		"GetScriptPubKeys",
+		ctx,
+		[]*types.Coin{spentCoins[1], spentCoins[0]},
+	).Return(
+		[]*defichain.ScriptPubKey{scriptPubKey, scriptPubKey},
+		nil,
+	).Once()
+	oldestResponse, err := servicer.ConstructionMetadata(ctx, &types.ConstructionMetadataRequest{
+		NetworkIdentifier: networkIdentifier,
+		Options:           forceMarshalMap(t, &oldestOptions),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, forceMarshalMap(t, &constructionMetadata{
+		ScriptPubKeys:  []*defichain.ScriptPubKey{scriptPubKey, scriptPubKey},
+		FundingAddress: fundingAccount.Address,
+		FundingCoins:   []*types.Coin{coins[1], coins[0]},
+		ChangeAmount:   "2499791", // 3500000 - 1000000 - 209
+
+		FeePerKB:           defichain.MinFeeRate,
+		ConfirmationTarget: defaultConfirmationTarget,
+		FeeRateSource:      SmartFeeRateSource,
+	}), oldestResponse.Metadata)
+
+	// Coins spent in the mempool are skipped and coins created
+	// in the mempool are not selected
+	spentOptions := *options
+	spentOptions.FundingAmount = "400000"
+	mockIndexer.On(
+		"GetMempoolCoins",
+		ctx,
+		fundingAccount,
+		coins,
+	).Return(
+		[]*types.Coin{
+			coins[1],
+			{
+				CoinIdentifier: &types.CoinIdentifier{
+					Identifier: "c14157a5c2ef0ce1de1a3ca1e6c3b2b3a0dd1e0a6e8e1d1f2a0e3c4b5a6d7e8f:0",
+				},
+				Amount: &types.Amount{
+					Value:    "5000000",
+					Currency: defichain.TestnetCurrency,
+				},
+			},
+		},
+		nil,
+	).Once()
+	mockIndexer.On(
+		"GetScriptPubKeys",
+		ctx,
+		spentCoins[1:],
+	).Return(
+		[]*defichain.ScriptPubKey{scriptPubKey},
+		nil,
+	).Once()
+	spentResponse, err := servicer.ConstructionMetadata(ctx, &types.ConstructionMetadataRequest{
+		NetworkIdentifier: networkIdentifier,
+		Options:           forceMarshalMap(t, &spentOptions),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, forceMarshalMap(t, &constructionMetadata{
+		ScriptPubKeys:  []*defichain.ScriptPubKey{scriptPubKey},
+		FundingAddress: fundingAccount.Address,
+		FundingCoins:   coins[1:],
+		ChangeAmount:   "99859", // 500000 - 400000 - 141
+
+		FeePerKB:           defichain.MinFeeRate,
+		ConfirmationTarget: defaultConfirmationTarget,
+		FeeRateSource:      SmartFeeRateSource,
+	}), spentResponse.Metadata)
+
+	// Test Payloads
+	payloadsResponse, err := servicer.ConstructionPayloads(ctx, &types.ConstructionPayloadsRequest{
+		NetworkIdentifier: networkIdentifier,
+		Operations:        ops,
+		Metadata:          metadataResponse.Metadata,
+	})
+	assert.Nil(t, err)
+	assert.Len(t, payloadsResponse.Payloads, 1)
+	assert.Equal(t, fundingAccount.Address, payloadsResponse.Payloads[0].AccountIdentifier.Address)
+
+	// Test Parse Unsigned
+	parseUnsignedResponse, err := servicer.ConstructionParse(ctx, &types.ConstructionParseRequest{
+		NetworkIdentifier: networkIdentifier,
+		Signed:            false,
+		Transaction:       payloadsResponse.UnsignedTransaction,
+	})
+	assert.Nil(t, err)
+	assert.NoError(t, intentParser.ExpectedOperations(
+		ops,
+		parseUnsignedResponse.Operations,
+		false,
+		false,
+	))
+
+	// Test Combine
+	combineResponse, err := servicer.ConstructionCombine(ctx, &types.ConstructionCombineRequest{
+		NetworkIdentifier:   networkIdentifier,
+		UnsignedTransaction: payloadsResponse.UnsignedTransaction,
+		Signatures: []*types.Signature{
+			{
+				Bytes:          signPayload(t, privKey, payloadsResponse.Payloads[0]),
+				SigningPayload: payloadsResponse.Payloads[0],
+				PublicKey:      publicKey,
+				SignatureType:  types.Ecdsa,
+			},
+		},
+	})
+	assert.Nil(t, err)
+
+	// The change is returned to the funding account after
+	// the outputs and the signed transaction must pass script
+	// validation.
+	var signed signedTransaction
+	assert.NoError(t, json.Unmarshal(
+		forceHexDecode(t, combineResponse.SignedTransaction),
+		&signed,
+	))
+	var tx wire.MsgTx
+	assert.NoError(t, tx.Deserialize(bytes.NewReader(forceHexDecode(t, signed.Transaction))))
+	assert.Len(t, tx.TxIn, 1)
+	assert.Len(t, tx.TxOut, 2)
+	assert.Equal(t, int64(1000000), tx.TxOut[0].Value)
+	assert.Equal(t, int64(1999859), tx.TxOut[1].Value)
+	assert.Equal(t, forceHexDecode(t, scriptPubKey.Hex), tx.TxOut[1].PkScript)
+
+	vm, vmErr := txscript.NewEngine(
+		forceHexDecode(t, scriptPubKey.Hex),
+		&tx,
+		0,
+		txscript.StandardVerifyFlags,
+		nil,
+		txscript.NewTxSigHashes(&tx),
+		3000000,
+	)
+	assert.NoError(t, vmErr)
+	assert.NoError(t, vm.Execute())
+
+	mockClient.AssertExpectations(t)
+	mockIndexer.AssertExpectations(t)
+}
+
+func TestEstimateSize(t *testing.T) {
+	cfg := &configuration.Configuration{
+		Mode:     configuration.Online,
+		Params:   defichain.TestnetParams,
+		Currency: defichain.TestnetCurrency,
+	}
+	servicer := NewConstructionAPIService(cfg, nil, nil).(*ConstructionAPIService)
+
+	keys := make([]*btcec.PrivateKey, 3)
+	addressPubKeys := make([]*btcutil.AddressPubKey, len(keys))
+	for i := range keys {
+		seed := sha256.Sum256([]byte{byte(i)})
+		keys[i], _ = btcec.PrivKeyFromBytes(btcec.S256(), seed[:])
+
+		var err error
+		addressPubKeys[i], err = btcutil.NewAddressPubKey(
+			keys[i].PubKey().SerializeCompressed(),
+			cfg.Params,
+		)
+		assert.NoError(t, err)
+	}
+
+	multisigScript, err := txscript.MultiSigScript(addressPubKeys, 2)
+	assert.NoError(t, err)
+
+	pubKeyHash := btcutil.Hash160(keys[0].PubKey().SerializeCompressed())
+	legacyAddr, err := btcutil.NewAddressPubKeyHash(pubKeyHash, cfg.Params)
+	assert.NoError(t, err)
+	segwitAddr, err := btcutil.NewAddressWitnessPubKeyHash(pubKeyHash, cfg.Params)
+	assert.NoError(t, err)
+	segwitScript, err := txscript.PayToAddrScript(segwitAddr)
+	assert.NoError(t, err)
+	wrappedAddr, err := btcutil.NewAddressScriptHash(segwitScript, cfg.Params)
+	assert.NoError(t, err)
+	multisigAddr, err := btcutil.NewAddressScriptHash(multisigScript, cfg.Params)
+	assert.NoError(t, err)
+	witnessScriptHash := sha256.Sum256(multisigScript)
+	witnessMultisigAddr, err := btcutil.NewAddressWitnessScriptHash(
+		witnessScriptHash[:],
+		cfg.Params,
+	)
+	assert.NoError(t, err)
+
+	customTxScript, err := defichain.EncodeCustomTx(&defichain.CustomTx{
+		Type: defichain.CustomTxUtxosToAccount,
+		Message: &defichain.UtxosToAccountMessage{
+			To: []*defichain.ScriptBalances{
+				{
+					Script:   hex.EncodeToString(segwitScript),
+					Balances: []*defichain.TokenAmount{{TokenID: 0, Amount: 1000}},
+				},
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	// signer signs input i of tx spending amount.
+	type signer func(tx *wire.MsgTx, sigHashes *txscript.TxSigHashes, i int, amount int64)
+
+	type input struct {
+		addr     btcutil.Address
+		metadata map[string]interface{}
+		sign     signer
+	}
+
+	p2pkh := &input{
+		addr: legacyAddr,
+		sign: func(tx *wire.MsgTx, sigHashes *txscript.TxSigHashes, i int, amount int64) {
+			script, _ := txscript.PayToAddrScript(legacyAddr)
+			sigScript, err := txscript.SignatureScript(tx, i, script, txscript.SigHashAll, keys[0], true)
+			assert.NoError(t, err)
+			tx.TxIn[i].SignatureScript = sigScript
+		},
+	}
+	p2wpkh := &input{
+		addr: segwitAddr,
+		sign: func(tx *wire.MsgTx, sigHashes *txscript.TxSigHashes, i int, amount int64) {
+			witness, err := txscript.WitnessSignature(
+				tx, sigHashes, i, amount, segwitScript, txscript.SigHashAll, keys[0], true,
+			)
+			assert.NoError(t, err)
+			tx.TxIn[i].Witness = witness
+		},
+	}
+	p2shp2wpkh := &input{
+		addr: wrappedAddr,
+		sign: func(tx *wire.MsgTx, sigHashes *txscript.TxSigHashes, i int, amount int64) {
+			witness, err := txscript.WitnessSignature(
+				tx, sigHashes, i, amount, segwitScript, txscript.SigHashAll, keys[0], true,
+			)
+			assert.NoError(t, err)
+			sigScript, err := txscript.NewScriptBuilder().AddData(segwitScript).Script()
+			assert.NoError(t, err)
+			tx.TxIn[i].Witness = witness
+			tx.TxIn[i].SignatureScript = sigScript
+		},
+	}
+	p2shMultisig := &input{
+		addr:     multisigAddr,
+		metadata: map[string]interface{}{"redeem_script": hex.EncodeToString(multisigScript)},
+		sign: func(tx *wire.MsgTx, sigHashes *txscript.TxSigHashes, i int, amount int64) {
+			builder := txscript.NewScriptBuilder().AddOp(txscript.OP_0)
+			for _, key := range keys[:2] {
+				sig, err := txscript.RawTxInSignature(tx, i, multisigScript, txscript.SigHashAll, key)
+				assert.NoError(t, err)
+				builder.AddData(sig)
+			}
+			sigScript, err := builder.AddData(multisigScript).Script()
+			assert.NoError(t, err)
+			tx.TxIn[i].SignatureScript = sigScript
+		},
+	}
+	p2wshMultisig := &input{
+		addr:     witnessMultisigAddr,
+		metadata: map[string]interface{}{"witness_script": hex.EncodeToString(multisigScript)},
+		sign: func(tx *wire.MsgTx, sigHashes *txscript.TxSigHashes, i int, amount int64) {
+			witness := wire.TxWitness{nil}
+			for _, key := range keys[:2] {
+				sig, err := txscript.RawTxInWitnessSignature(
+					tx, sigHashes, i, amount, multisigScript, txscript.SigHashAll, key,
+				)
+				assert.NoError(t, err)
+				witness = append(witness, sig)
+			}
+			tx.TxIn[i].Witness = append(witness, multisigScript)
+		},
+	}
+
+	var tests = map[string]struct {
+		inputs       []*input
+		outputs      []btcutil.Address
+		extraOutputs [][]byte
+
+		// tolerance is the largest overestimate in vBytes
+		// (a signature can be 1 byte shorter than estimated).
+		tolerance float64
+	}{
+		"p2wpkh": {
+			inputs:    []*input{p2wpkh},
+			outputs:   []btcutil.Address{segwitAddr, legacyAddr},
+			tolerance: 1,
+		},
+		"p2pkh": {
+			inputs:    []*input{p2pkh},
+			outputs:   []btcutil.Address{legacyAddr},
+			tolerance: 1,
+		},
+		"p2sh-p2wpkh": {
+			inputs:    []*input{p2shp2wpkh, p2shp2wpkh},
+			outputs:   []btcutil.Address{wrappedAddr},
+			tolerance: 1,
+		},
+		"p2sh multisig": {
+			inputs:  []*input{p2shMultisig},
+			outputs: []btcutil.Address{segwitAddr, multisigAddr},
+
+			// The script sig size takes 3 bytes instead of 1
+			// if it is 253 bytes or more.
+			tolerance: 4,
+		},
+		"p2wsh multisig": {
+			inputs:    []*input{p2wshMultisig, p2wpkh},
+			outputs:   []btcutil.Address{witnessMultisigAddr},
+			tolerance: 1,
+		},
+		"mixed with DfTx": {
+			inputs:       []*input{p2pkh, p2wpkh, p2shp2wpkh},
+			outputs:      []btcutil.Address{segwitAddr},
+			extraOutputs: [][]byte{customTxScript},
+			tolerance:    2,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			amount := int64(100000000)
+			operations := []*types.Operation{}
+			tx := wire.NewMsgTx(wire.TxVersion)
+			prevScripts := [][]byte{}
+			for i, input := range test.inputs {
+				operations = append(operations, &types.Operation{
+					Type:     defichain.InputOpType,
+					Account:  &types.AccountIdentifier{Address: input.addr.EncodeAddress()},
+					Metadata: input.metadata,
+				})
+
+				script, err := txscript.PayToAddrScript(input.addr)
+				assert.NoError(t, err)
+				prevScripts = append(prevScripts, script)
+
+				tx.AddTxIn(&wire.TxIn{
+					PreviousOutPoint: wire.OutPoint{Hash: sha256.Sum256([]byte{byte(i)}), Index: uint32(i)},
+					Sequence:         wire.MaxTxInSequenceNum,
+				})
+			}
+
+			for _, script := range test.extraOutputs {
+				tx.AddTxOut(&wire.TxOut{Value: 0, PkScript: script})
+			}
+
+			for _, addr := range test.outputs {
+				operations = append(operations, &types.Operation{
+					Type:    defichain.OutputOpType,
+					Account: &types.AccountIdentifier{Address: addr.EncodeAddress()},
+				})
+
+				script, err := txscript.PayToAddrScript(addr)
+				assert.NoError(t, err)
+				tx.AddTxOut(&wire.TxOut{Value: amount / 2, PkScript: script})
+			}
+
+			sigHashes := txscript.NewTxSigHashes(tx)
+			for i, input := range test.inputs {
+				input.sign(tx, sigHashes, i, amount)
+			}
+
+			// The signed transaction must be valid
+			for i, script := range prevScripts {
+				vm, err := txscript.NewEngine(
+					script,
+					tx,
+					i,
+					txscript.StandardVerifyFlags,
+					nil,
+					sigHashes,
+					amount,
+				)
+				assert.NoError(t, err)
+				assert.NoError(t, vm.Execute())
+			}
+
+			weight := tx.SerializeSizeStripped()*(defichain.WitnessScaleFactor-1) + tx.SerializeSize()
+			actual := float64(vsize(weight))
+
+			estimated, err := servicer.estimateSize(operations, test.extraOutputs...)
+			assert.NoError(t, err)
+			assert.GreaterOrEqual(t, estimated, actual)
+			assert.LessOrEqual(t, estimated-actual, test.tolerance)
+		})
+	}
+
+	// Addresses that can't be decoded are rejected
+	_, err = servicer.estimateSize([]*types.Operation{
+		{
+			Type:    defichain.OutputOpType,
+			Account: &types.AccountIdentifier{Address: "invalid"},
+		},
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,704 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/DeFiCh/rosetta-defichain/defichain"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/coinbase/rosetta-sdk-go/parser"
+	"github.com/coinbase/rosetta-sdk-go/types"
+)
+
+// customTxIntent is the DfTx custom transaction described
+// by the account operations of an intent.
+type customTxIntent struct {
+	customTx *defichain.CustomTx
+
+	// value is the amount of DFI burned in the DfTx output.
+	value int64
+
+	// mintedAmount is the amount of DFI the OUTPUT operations
+	// marked as minted must add up to.
+	mintedAmount int64
+
+	// authAddresses are the debited addresses that are not
+	// spent by any INPUT operation. defid requires a coin of
+	// each debited address to be spent, so one is added to
+	// the transaction for each of them.
+	authAddresses []string
+
+	// currencies are the currencies of the tokens moved
+	// by the custom transaction.
+	currencies []*types.Currency
+}
+
+// accountOperation is a parsed account operation.
+type accountOperation struct {
+	address string
+	script  string
+	balance *defichain.TokenAmount
+}
+
+// isAccountOperation returns a boolean indicating if an
+// operation moves account balances.
+func isAccountOperation(operation *types.Operation) bool {
+	switch operation.Type {
+	case defichain.UtxosToAccountOpType,
+		defichain.AccountToUtxosOpType,
+		defichain.AccountTransferOpType:
+		return true
+	default:
+		return false
+	}
+}
+
+// parseCustomTxIntent separates the account operations of
+// an intent from its INPUT and OUTPUT operations. If there
+// are no account operations, the returned *customTxIntent
+// is nil.
+func (s *ConstructionAPIService) parseCustomTxIntent(
+	operations []*types.Operation,
+) ([]*types.Operation, *customTxIntent, error) {
+	utxoOperations := []*types.Operation{}
+	accountOperations := []*types.Operation{}
+	for _, operation := range operations {
+		if isAccountOperation(operation) {
+			accountOperations = append(accountOperations, operation)
+			continue
+		}
+
+		utxoOperations = append(utxoOperations, operation)
+	}
+
+	if len(accountOperations) == 0 {
+		return utxoOperations, nil, nil
+	}
+
+	opType := accountOperations[0].Type
+	parsed := make([]*accountOperation, len(accountOperations))
+	intent := &customTxIntent{}
+	seenCurrencies := map[string]struct{}{}
+	for i, operation := range accountOperations {
+		if operation.Type != opType {
+			return nil, nil, fmt.Errorf(
+				"%s and %s operations cannot be mixed",
+				opType,
+				operation.Type,
+			)
+		}
+
+		var err error
+		parsed[i], err = s.parseAccountOperation(operation)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Only DFI can be converted between UTXOs and
+		// account balances.
+		if opType != defichain.AccountTransferOpType &&
+			parsed[i].balance.TokenID != defichain.NativeTokenID {
+			return nil, nil, fmt.Errorf(
+				"%s only supports %s",
+				opType,
+				s.config.Currency.Symbol,
+			)
+		}
+
+		if parsed[i].balance.TokenID == defichain.NativeTokenID {
+			continue
+		}
+
+		key := types.Hash(operation.Amount.Currency)
+		if _, ok := seenCurrencies[key]; !ok {
+			seenCurrencies[key] = struct{}{}
+			intent.currencies = append(intent.currencies, operation.Amount.Currency)
+		}
+	}
+
+	switch opType {
+	case defichain.UtxosToAccountOpType:
+		to, err := accountBalances(parsed, opType, false)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, operation := range parsed {
+			intent.value += operation.balance.Amount
+		}
+
+		intent.customTx = &defichain.CustomTx{
+			Type:    defichain.CustomTxUtxosToAccount,
+			Message: &defichain.UtxosToAccountMessage{To: to},
+		}
+	case defichain.AccountToUtxosOpType:
+		if len(parsed) != 1 {
+			return nil, nil, fmt.Errorf("expected 1 %s operation", opType)
+		}
+
+		from, err := accountBalances(parsed, opType, true)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		intent.customTx = &defichain.CustomTx{
+			Type: defichain.CustomTxAccountToUtxos,
+			Message: &defichain.AccountToUtxosMessage{
+				From:     from[0].Script,
+				Balances: from[0].Balances,
+			},
+		}
+		intent.mintedAmount = from[0].Balances[0].Amount
+	case defichain.AccountTransferOpType:
+		debits := []*accountOperation{}
+		credits := []*accountOperation{}
+		for _, operation := range parsed {
+			if operation.balance.Amount < 0 {
+				debits = append(debits, operation)
+				continue
+			}
+
+			credits = append(credits, operation)
+		}
+
+		from, err := accountBalances(debits, opType, true)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		to, err := accountBalances(credits, opType, false)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if err := matchBalances(from, to); err != nil {
+			return nil, nil, err
+		}
+
+		// AnyAccountsToAccounts is only needed to debit
+		// more than one account.
+		if len(from) == 1 {
+			intent.customTx = &defichain.CustomTx{
+				Type: defichain.CustomTxAccountToAccount,
+				Message: &defichain.AccountToAccountMessage{
+					From: from[0].Script,
+					To:   to,
+				},
+			}
+		} else {
+			intent.customTx = &defichain.CustomTx{
+				Type: defichain.CustomTxAnyAccountsToAccounts,
+				Message: &defichain.AnyAccountsToAccountsMessage{
+					From: from,
+					To:   to,
+				},
+			}
+		}
+	}
+
+	// defid requires the transaction to be signed by
+	// the owner of each debited account.
+	seenAddresses := map[string]struct{}{}
+	for _, operation := range parsed {
+		if operation.balance.Amount > 0 || hasInput(utxoOperations, operation.address) {
+			continue
+		}
+
+		if _, ok := seenAddresses[operation.address]; ok {
+			continue
+		}
+
+		seenAddresses[operation.address] = struct{}{}
+		intent.authAddresses = append(intent.authAddresses, operation.address)
+	}
+
+	return utxoOperations, intent, nil
+}
+
+// fundedBy removes address from the addresses that need an
+// auth coin because the coins selected to fund the transaction
+// belong to it.
+func (i *customTxIntent) fundedBy(address string) {
+	if i == nil {
+		return
+	}
+
+	var authAddresses []string
+	for _, authAddress := range i.authAddresses {
+		if authAddress != address {
+			authAddresses = append(authAddresses, authAddress)
+		}
+	}
+	i.authAddresses = authAddresses
+}
+
+// accountBalances groups account operations by script. Debits
+// must have negative amounts and credits positive amounts. The
+// returned balances are always positive.
+func accountBalances(
+	operations []*accountOperation,
+	opType string,
+	debit bool,
+) ([]*defichain.ScriptBalances, error) {
+	if len(operations) == 0 {
+		return nil, fmt.Errorf("%s requires at least 1 debit and 1 credit", opType)
+	}
+
+	accounts := []*defichain.ScriptBalances{}
+	indexes := map[string]int{}
+	seenBalances := map[string]struct{}{}
+	for _, operation := range operations {
+		amount := operation.balance.Amount
+		if debit {
+			amount = -amount
+		}
+
+		if amount <= 0 {
+			if debit {
+				return nil, fmt.Errorf("%s amount must be negative", opType)
+			}
+
+			return nil, fmt.Errorf("%s amount must be positive", opType)
+		}
+
+		balanceKey := fmt.Sprintf("%s:%d", operation.script, operation.balance.TokenID)
+		if _, ok := seenBalances[balanceKey]; ok {
+			verb := "credited"
+			if debit {
+				verb = "debited"
+			}
+
+			return nil, fmt.Errorf(
+				"%s is %s more than once",
+				operation.address,
+				verb,
+			)
+		}
+		seenBalances[balanceKey] = struct{}{}
+
+		i, ok := indexes[operation.script]
+		if !ok {
+			indexes[operation.script] = len(accounts)
+			accounts = append(accounts, &defichain.ScriptBalances{Script: operation.script})
+			i = len(accounts) - 1
+		}
+
+		accounts[i].Balances = append(accounts[i].Balances, &defichain.TokenAmount{
+			TokenID: operation.balance.TokenID,
+			Amount:  amount,
+		})
+	}
+
+	return accounts, nil
+}
+
+// matchBalances ensures the total of each token debited
+// is credited.
+func matchBalances(from []*defichain.ScriptBalances, to []*defichain.ScriptBalances) error {
+	debited := map[uint32]int64{}
+	for _, total := range defichain.SumBalances(from) {
+		debited[total.TokenID] = total.Amount
+	}
+
+	credited := defichain.SumBalances(to)
+	for _, total := range credited {
+		if debited[total.TokenID] != total.Amount {
+			return fmt.Errorf(
+				"%d of token %d is credited but %d is debited",
+				total.Amount,
+				total.TokenID,
+				debited[total.TokenID],
+			)
+		}
+	}
+
+	if len(credited) != len(debited) {
+		return errors.New("every token debited must be credited")
+	}
+
+	return nil
+}
+
+// parseAccountOperation parses the account,
+// currency and amount of an account operation.
+func (s *ConstructionAPIService) parseAccountOperation(
+	operation *types.Operation,
+) (*accountOperation, error) {
+	if operation.Account == nil {
+		return nil, fmt.Errorf("%s account cannot be nil", operation.Type)
+	}
+
+	if operation.Account.SubAccount == nil ||
+		operation.Account.SubAccount.Address != defichain.AccountBalancesSubAccount {
+		return nil, fmt.Errorf(
+			"%s account must use the %s sub-account",
+			operation.Type,
+			defichain.AccountBalancesSubAccount,
+		)
+	}
+
+	if operation.Amount == nil {
+		return nil, fmt.Errorf("%s amount cannot be nil", operation.Type)
+	}
+
+	tokenID, err := s.tokens.TokenID(operation.Amount.Currency)
+	if err != nil {
+		return nil, fmt.Errorf("%w unable to parse %s currency", err, operation.Type)
+	}
+
+	amount, err := types.AmountValue(operation.Amount)
+	if err != nil {
+		return nil, fmt.Errorf("%w unable to parse %s amount", err, operation.Type)
+	}
+
+	if !amount.IsInt64() {
+		return nil, fmt.Errorf("%s amount %s overflows int64", operation.Type, amount)
+	}
+
+	addr, err := btcutil.DecodeAddress(operation.Account.Address, s.config.Params)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"%w unable to decode address %s",
+			err,
+			operation.Account.Address,
+		)
+	}
+
+	script, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		return nil, fmt.Errorf("%w unable to construct payToAddrScript", err)
+	}
+
+	return &accountOperation{
+		address: operation.Account.Address,
+		script:  hex.EncodeToString(script),
+		balance: &defichain.TokenAmount{
+			TokenID: tokenID,
+			Amount:  amount.Int64(),
+		},
+	}, nil
+}
+
+// hasInput returns a boolean indicating if an INPUT
+// operation spends a coin of address.
+func hasInput(operations []*types.Operation, address string) bool {
+	for _, operation := range operations {
+		if operation.Type == defichain.InputOpType &&
+			operation.Account != nil &&
+			operation.Account.Address == address {
+			return true
+		}
+	}
+
+	return false
+}
+
+// authCoins returns the smallest coin of each address in
+// authAddresses. Spending the smallest coin keeps the size
+// of the signed amount (and the exposure of the coin) low.
+func (s *ConstructionAPIService) authCoins(
+	ctx context.Context,
+	authAddresses []string,
+) ([]*authCoin, error) {
+	var authCoins []*authCoin
+	for _, address := range authAddresses {
+		coins, err := s.unspentCoins(ctx, &types.AccountIdentifier{Address: address})
+		if err != nil {
+			return nil, fmt.Errorf("%w unable to get coins of %s", err, address)
+		}
+
+		var smallest *types.Coin
+		var smallestAmount *big.Int
+		for _, coin := range coins {
+			amount, err := types.AmountValue(coin.Amount)
+			if err != nil {
+				return nil, fmt.Errorf("%w unable to parse coin amount", err)
+			}
+
+			if smallest == nil || amount.Cmp(smallestAmount) < 0 {
+				smallest, smallestAmount = coin, amount
+			}
+		}
+
+		if smallest == nil {
+			return nil, fmt.Errorf("%s has no coin", address)
+		}
+
+		authCoins = append(authCoins, &authCoin{
+			Address: address,
+			Coin:    smallest,
+		})
+	}
+
+	return authCoins, nil
+}
+
+// outputLayout returns the indexes of the regular and minted
+// OUTPUT operations and the DfTx output script (nil if there
+// is no custom transaction). In the transaction, the DfTx
+// output comes first, followed by the regular outputs, the
+// authOutputs outputs returning auth coins and the minted
+// outputs.
+func outputLayout(
+	intent *customTxIntent,
+	outputs *parser.Match,
+	authOutputs int,
+) ([]int, []int, []byte, error) {
+	regular := []int{}
+	minted := []int{}
+	mintedAmount := new(big.Int)
+	for i, output := range outputs.Operations {
+		var metadata OutputOperationMetadata
+		if err := types.UnmarshalMap(output.Metadata, &metadata); err != nil {
+			return nil, nil, nil, fmt.Errorf("%w unable to parse output metadata", err)
+		}
+
+		if !metadata.Minted {
+			regular = append(regular, i)
+			continue
+		}
+
+		minted = append(minted, i)
+		mintedAmount.Add(mintedAmount, outputs.Amounts[i])
+	}
+
+	if intent == nil {
+		if len(minted) > 0 {
+			return nil, nil, nil, fmt.Errorf(
+				"minted outputs require an %s operation",
+				defichain.AccountToUtxosOpType,
+			)
+		}
+
+		return regular, minted, nil, nil
+	}
+
+	if mintedAmount.Cmp(big.NewInt(intent.mintedAmount)) != 0 {
+		return nil, nil, nil, fmt.Errorf(
+			"minted outputs add up to %s but %d is expected",
+			mintedAmount,
+			intent.mintedAmount,
+		)
+	}
+
+	if message, ok := intent.customTx.Message.(*defichain.AccountToUtxosMessage); ok {
+		if len(minted) == 0 {
+			return nil, nil, nil, errors.New("at least one minted output is required")
+		}
+
+		// The DfTx output precedes the minted outputs
+		message.MintingOutputsStart = uint32(1 + len(regular) + authOutputs)
+	}
+
+	script, err := defichain.EncodeCustomTx(intent.customTx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return regular, minted, script, nil
+}
+
+// parseOutputOperations returns the operations of the outputs
+// of a transaction. The DfTx output is not returned as an
+// OUTPUT operation but as the account operations it encodes.
+// currencies are the token currencies the custom transaction
+// may move.
+func (s *ConstructionAPIService) parseOutputOperations(
+	tx *wire.MsgTx,
+	startIndex int64,
+	currencies []*types.Currency,
+) ([]*types.Operation, error) {
+	var customTx *defichain.CustomTx
+	customTxIndex := -1
+	for i, output := range tx.TxOut {
+		decoded, err := defichain.DecodeCustomTx(output.PkScript)
+		if errors.Is(err, defichain.ErrNotCustomTx) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		customTx, customTxIndex = decoded, i
+		break
+	}
+
+	mintingOutputsStart := len(tx.TxOut)
+	if customTx != nil {
+		if message, ok := customTx.Message.(*defichain.AccountToUtxosMessage); ok {
+			mintingOutputsStart = int(message.MintingOutputsStart)
+		}
+	}
+
+	ops := []*types.Operation{}
+	for i, output := range tx.TxOut {
+		if i == customTxIndex {
+			continue
+		}
+
+		networkIndex := int64(i)
+		_, addr, err := defichain.ParseSingleAddress(s.config.Params, output.PkScript)
+		if err != nil {
+			return nil, fmt.Errorf("%w unable to parse output address", err)
+		}
+
+		op := &types.Operation{
+			OperationIdentifier: &types.OperationIdentifier{
+				Index:        startIndex + int64(len(ops)),
+				NetworkIndex: &networkIndex,
+			},
+			Type: defichain.OutputOpType,
+			Account: &types.AccountIdentifier{
+				Address: addr.String(),
+			},
+			Amount: &types.Amount{
+				Value:    strconv.FormatInt(output.Value, 10),
+				Currency: s.config.Currency,
+			},
+		}
+
+		if i >= mintingOutputsStart {
+			metadata, err := types.MarshalMap(&OutputOperationMetadata{Minted: true})
+			if err != nil {
+				return nil, err
+			}
+
+			op.Metadata = metadata
+		}
+
+		ops = append(ops, op)
+	}
+
+	if customTx == nil {
+		return ops, nil
+	}
+
+	accountOps, err := s.parseAccountOperations(
+		customTx,
+		startIndex+int64(len(ops)),
+		currencies,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(ops, accountOps...), nil
+}
+
+// parseAccountOperations returns the account operations
+// encoded by a custom transaction.
+func (s *ConstructionAPIService) parseAccountOperations(
+	customTx *defichain.CustomTx,
+	startIndex int64,
+	currencies []*types.Currency,
+) ([]*types.Operation, error) {
+	tokenCurrencies := map[uint32]*types.Currency{
+		defichain.NativeTokenID: s.config.Currency,
+	}
+	for _, currency := range currencies {
+		tokenID, err := s.tokens.TokenID(currency)
+		if err != nil {
+			return nil, err
+		}
+
+		tokenCurrencies[tokenID] = currency
+	}
+
+	ops := []*types.Operation{}
+	add := func(opType string, script string, balance *defichain.TokenAmount, sign int64) error {
+		currency, ok := tokenCurrencies[balance.TokenID]
+		if !ok {
+			return fmt.Errorf("currency of token %d is missing", balance.TokenID)
+		}
+
+		decodedScript, err := hex.DecodeString(script)
+		if err != nil {
+			return err
+		}
+
+		_, addr, err := defichain.ParseSingleAddress(s.config.Params, decodedScript)
+		if err != nil {
+			return fmt.Errorf("%w unable to parse account address", err)
+		}
+
+		ops = append(ops, &types.Operation{
+			OperationIdentifier: &types.OperationIdentifier{
+				Index: startIndex + int64(len(ops)),
+			},
+			Type: opType,
+			Account: &types.AccountIdentifier{
+				Address: addr.String(),
+				SubAccount: &types.SubAccountIdentifier{
+					Address: defichain.AccountBalancesSubAccount,
+				},
+			},
+			Amount: &types.Amount{
+				Value:    strconv.FormatInt(sign*balance.Amount, 10),
+				Currency: currency,
+			},
+		})
+
+		return nil
+	}
+	addAll := func(opType string, accounts []*defichain.ScriptBalances, sign int64) error {
+		for _, account := range accounts {
+			for _, balance := range account.Balances {
+				if err := add(opType, account.Script, balance, sign); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	}
+
+	var err error
+	switch message := customTx.Message.(type) {
+	case *defichain.UtxosToAccountMessage:
+		err = addAll(defichain.UtxosToAccountOpType, message.To, 1)
+	case *defichain.AccountToUtxosMessage:
+		err = addAll(defichain.AccountToUtxosOpType, []*defichain.ScriptBalances{
+			{Script: message.From, Balances: message.Balances},
+		}, -1)
+	case *defichain.AccountToAccountMessage:
+		err = addAll(defichain.AccountTransferOpType, []*defichain.ScriptBalances{
+			{Script: message.From, Balances: defichain.SumBalances(message.To)},
+		}, -1)
+		if err == nil {
+			err = addAll(defichain.AccountTransferOpType, message.To, 1)
+		}
+	case *defichain.AnyAccountsToAccountsMessage:
+		err = addAll(defichain.AccountTransferOpType, message.From, -1)
+		if err == nil {
+			err = addAll(defichain.AccountTransferOpType, message.To, 1)
+		}
+	default:
+		return nil, fmt.Errorf("parsing %s is not supported", customTx.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return ops, nil
+}
@@ -0,0 +1,399 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/DeFiCh/rosetta-defichain/configuration"
+	"github.com/DeFiCh/rosetta-defichain/defichain"
+
+	"github.com/coinbase/rosetta-sdk-go/parser"
+	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCustomTxIntent(t *testing.T) {
+	servicer := NewConstructionAPIService(&configuration.Configuration{
+		Params:   defichain.TestnetParams,
+		Currency: defichain.TestnetCurrency,
+	}, nil, nil).(*ConstructionAPIService)
+
+	address := "tf1qvlmwgj9rsmpqx2c6dl54a36ev4zkd3pw3ufh4c"
+	otherAddress := "tf1qr4pelt25fk869v2sfrwxp7ttm7jyx0pyn4dxph"
+	thirdAddress := "tf1q4mfg3kqm4c7f8j7tyy028fa4uaw7zdzyerq5qx"
+	btc := &types.Currency{
+		Symbol:   "BTC",
+		Decimals: 8,
+		Metadata: map[string]interface{}{defichain.TokenIDMetadataKey: 2},
+	}
+	tokenOp := func(opType string, address string, value string, currency *types.Currency) *types.Operation {
+		return &types.Operation{
+			Type: opType,
+			Account: &types.AccountIdentifier{
+				Address: address,
+				SubAccount: &types.SubAccountIdentifier{
+					Address: defichain.AccountBalancesSubAccount,
+				},
+			},
+			Amount: &types.Amount{
+				Value:    value,
+				Currency: currency,
+			},
+		}
+	}
+	accountOp := func(opType string, address string, value string) *types.Operation {
+		return tokenOp(opType, address, value, defichain.TestnetCurrency)
+	}
+	input := &types.Operation{
+		Type: defichain.InputOpType,
+		Account: &types.AccountIdentifier{
+			Address: address,
+		},
+		Amount: &types.Amount{
+			Value:    "-100",
+			Currency: defichain.TestnetCurrency,
+		},
+	}
+
+	tests := map[string]struct {
+		operations []*types.Operation
+
+		utxoOperations int
+		customTx       *defichain.CustomTx
+		value          int64
+		mintedAmount   int64
+		authAddresses  []string
+		currencies     []*types.Currency
+		err            string
+	}{
+		"no account operations": {
+			operations:     []*types.Operation{input},
+			utxoOperations: 1,
+		},
+		"utxos to account": {
+			operations: []*types.Operation{
+				input,
+				accountOp(defichain.UtxosToAccountOpType, address, "40"),
+				accountOp(defichain.UtxosToAccountOpType, otherAddress, "50"),
+			},
+			utxoOperations: 1,
+			value:          90,
+		},
+		"account to utxos": {
+			operations: []*types.Operation{
+				input,
+				accountOp(defichain.AccountToUtxosOpType, address, "-40"),
+			},
+			utxoOperations: 1,
+			mintedAmount:   40,
+		},
+		"mixed operations": {
+			operations: []*types.Operation{
+				input,
+				accountOp(defichain.UtxosToAccountOpType, address, "40"),
+				accountOp(defichain.AccountToUtxosOpType, address, "-40"),
+			},
+			err: "cannot be mixed",
+		},
+		"duplicate account": {
+			operations: []*types.Operation{
+				input,
+				accountOp(defichain.UtxosToAccountOpType, address, "40"),
+				accountOp(defichain.UtxosToAccountOpType, address, "50"),
+			},
+			err: "is credited more than once",
+		},
+		"negative utxos to account": {
+			operations: []*types.Operation{
+				input,
+				accountOp(defichain.UtxosToAccountOpType, address, "-40"),
+			},
+			err: "amount must be positive",
+		},
+		"positive account to utxos": {
+			operations: []*types.Operation{
+				input,
+				accountOp(defichain.AccountToUtxosOpType, address, "40"),
+			},
+			err: "amount must be negative",
+		},
+		"account to utxos without authorization": {
+			operations: []*types.Operation{
+				input,
+				accountOp(defichain.AccountToUtxosOpType, otherAddress, "-40"),
+			},
+			utxoOperations: 1,
+			mintedAmount:   40,
+			authAddresses:  []string{otherAddress},
+		},
+		"missing sub account": {
+			operations: []*types.Operation{
+				input,
+				{
+					Type: defichain.UtxosToAccountOpType,
+					Account: &types.AccountIdentifier{
+						Address: address,
+					},
+					Amount: &types.Amount{
+						Value:    "40",
+						Currency: defichain.TestnetCurrency,
+					},
+				},
+			},
+			err: "must use the account sub-account",
+		},
+		"token currency": {
+			operations: []*types.Operation{
+				input,
+				tokenOp(defichain.UtxosToAccountOpType, address, "40", btc),
+			},
+			err: "UTXOS_TO_ACCOUNT only supports tDFI",
+		},
+		"currency without token id": {
+			operations: []*types.Operation{
+				input,
+				tokenOp(
+					defichain.AccountTransferOpType,
+					address,
+					"-40",
+					&types.Currency{Symbol: "BTC", Decimals: 8},
+				),
+			},
+			err: "BTC is missing token_id metadata",
+		},
+		"account to account": {
+			operations: []*types.Operation{
+				input,
+				tokenOp(defichain.AccountTransferOpType, otherAddress, "-40", btc),
+				accountOp(defichain.AccountTransferOpType, otherAddress, "-10"),
+				tokenOp(defichain.AccountTransferOpType, address, "40", btc),
+				accountOp(defichain.AccountTransferOpType, address, "10"),
+			},
+			utxoOperations: 1,
+			customTx: &defichain.CustomTx{
+				Type: defichain.CustomTxAccountToAccount,
+				Message: &defichain.AccountToAccountMessage{
+					From: "00141d439fad544d8fa2b15048dc60f96bdfa4433c24",
+					To: []*defichain.ScriptBalances{
+						{
+							Script: "001467f6e448a386c2032b1a6fe95ec759654566c42e",
+							Balances: []*defichain.TokenAmount{
+								{TokenID: 2, Amount: 40},
+								{TokenID: 0, Amount: 10},
+							},
+						},
+					},
+				},
+			},
+			authAddresses: []string{otherAddress},
+			currencies:    []*types.Currency{btc},
+		},
+		"any accounts to accounts": {
+			operations: []*types.Operation{
+				input,
+				tokenOp(defichain.AccountTransferOpType, address, "-40", btc),
+				tokenOp(defichain.AccountTransferOpType, otherAddress, "-10", btc),
+				tokenOp(defichain.AccountTransferOpType, thirdAddress, "50", btc),
+			},
+			utxoOperations: 1,
+			customTx: &defichain.CustomTx{
+				Type: defichain.CustomTxAnyAccountsToAccounts,
+				Message: &defichain.AnyAccountsToAccountsMessage{
+					From: []*defichain.ScriptBalances{
+						{
+							Script:   "001467f6e448a386c2032b1a6fe95ec759654566c42e",
+							Balances: []*defichain.TokenAmount{{TokenID: 2, Amount: 40}},
+						},
+						{
+							Script:   "00141d439fad544d8fa2b15048dc60f96bdfa4433c24",
+							Balances: []*defichain.TokenAmount{{TokenID: 2, Amount: 10}},
+						},
+					},
+					To: []*defichain.ScriptBalances{
+						{
+							Script:   "0014aed288d81bae3c93cbcb211ea3a7b5e75de13444",
+							Balances: []*defichain.TokenAmount{{TokenID: 2, Amount: 50}},
+						},
+					},
+				},
+			},
+			authAddresses: []string{otherAddress},
+			currencies:    []*types.Currency{btc},
+		},
+		"unbalanced account transfer": {
+			operations: []*types.Operation{
+				input,
+				tokenOp(defichain.AccountTransferOpType, address, "-40", btc),
+				tokenOp(defichain.AccountTransferOpType, otherAddress, "30", btc),
+			},
+			err: "30 of token 2 is credited but 40 is debited",
+		},
+		"account transfer of a token that is not credited": {
+			operations: []*types.Operation{
+				input,
+				tokenOp(defichain.AccountTransferOpType, address, "-40", btc),
+				accountOp(defichain.AccountTransferOpType, address, "-40"),
+				accountOp(defichain.AccountTransferOpType, otherAddress, "40"),
+			},
+			err: "every token debited must be credited",
+		},
+		"account transfer without credit": {
+			operations: []*types.Operation{
+				input,
+				tokenOp(defichain.AccountTransferOpType, address, "-40", btc),
+			},
+			err: "ACCOUNT_TRANSFER requires at least 1 debit and 1 credit",
+		},
+		"duplicate debit": {
+			operations: []*types.Operation{
+				input,
+				tokenOp(defichain.AccountTransferOpType, address, "-40", btc),
+				tokenOp(defichain.AccountTransferOpType, address, "-10", btc),
+				tokenOp(defichain.AccountTransferOpType, otherAddress, "50", btc),
+			},
+			err: "is debited more than once",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			utxoOperations, intent, err := servicer.parseCustomTxIntent(test.operations)
+			if test.err != "" {
+				assert.Contains(t, err.Error(), test.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Len(t, utxoOperations, test.utxoOperations)
+			if test.value == 0 && test.mintedAmount == 0 && test.customTx == nil {
+				assert.Nil(t, intent)
+				return
+			}
+
+			if test.customTx != nil {
+				assert.Equal(t, test.customTx, intent.customTx)
+			}
+			assert.Equal(t, test.value, intent.value)
+			assert.Equal(t, test.mintedAmount, intent.mintedAmount)
+			assert.Equal(t, test.authAddresses, intent.authAddresses)
+			assert.Equal(t, test.currencies, intent.currencies)
+		})
+	}
+}
+
+func TestOutputLayout(t *testing.T) {
+	regular := &types.Operation{Type: defichain.OutputOpType}
+	minted := &types.Operation{
+		Type:     defichain.OutputOpType,
+		Metadata: forceMarshalMap(t, &OutputOperationMetadata{Minted: true}),
+	}
+	accountToUtxos := func(amount int64) *customTxIntent {
+		return &customTxIntent{
+			customTx: &defichain.CustomTx{
+				Type: defichain.CustomTxAccountToUtxos,
+				Message: &defichain.AccountToUtxosMessage{
+					From:     "0014aed288d81bae3c93cbcb211ea3a7b5e75de13444",
+					Balances: []*defichain.TokenAmount{{TokenID: 0, Amount: amount}},
+				},
+			},
+			mintedAmount: amount,
+		}
+	}
+
+	tests := map[string]struct {
+		intent  *customTxIntent
+		outputs *parser.Match
+
+		authOutputs         int
+		regular             []int
+		minted              []int
+		mintingOutputsStart uint32
+		err                 string
+	}{
+		"no custom transaction": {
+			outputs: &parser.Match{
+				Operations: []*types.Operation{regular, regular},
+				Amounts:    []*big.Int{big.NewInt(1), big.NewInt(2)},
+			},
+			regular: []int{0, 1},
+			minted:  []int{},
+		},
+		"minted outputs last": {
+			intent: accountToUtxos(5),
+			outputs: &parser.Match{
+				Operations: []*types.Operation{minted, regular, minted},
+				Amounts:    []*big.Int{big.NewInt(2), big.NewInt(1), big.NewInt(3)},
+			},
+			regular:             []int{1},
+			minted:              []int{0, 2},
+			mintingOutputsStart: 2,
+		},
+		"minted outputs after auth outputs": {
+			intent: accountToUtxos(5),
+			outputs: &parser.Match{
+				Operations: []*types.Operation{regular, minted},
+				Amounts:    []*big.Int{big.NewInt(1), big.NewInt(5)},
+			},
+			authOutputs:         2,
+			regular:             []int{0},
+			minted:              []int{1},
+			mintingOutputsStart: 4,
+		},
+		"minted outputs without custom transaction": {
+			outputs: &parser.Match{
+				Operations: []*types.Operation{minted},
+				Amounts:    []*big.Int{big.NewInt(1)},
+			},
+			err: "minted outputs require an ACCOUNT_TO_UTXOS operation",
+		},
+		"minted amount mismatch": {
+			intent: accountToUtxos(5),
+			outputs: &parser.Match{
+				Operations: []*types.Operation{minted},
+				Amounts:    []*big.Int{big.NewInt(4)},
+			},
+			err: "minted outputs add up to 4 but 5 is expected",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			regular, minted, script, err := outputLayout(test.intent, test.outputs, test.authOutputs)
+			if test.err != "" {
+				assert.Nil(t, regular)
+				assert.Contains(t, err.Error(), test.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.regular, regular)
+			assert.Equal(t, test.minted, minted)
+			if test.intent == nil {
+				assert.Nil(t, script)
+				return
+			}
+
+			customTx, err := defichain.DecodeCustomTx(script)
+			assert.NoError(t, err)
+			assert.Equal(
+				t,
+				test.mintingOutputsStart,
+				customTx.Message.(*defichain.AccountToUtxosMessage).MintingOutputsStart,
+			)
+		})
+	}
+}
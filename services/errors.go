@@ -41,6 +41,25 @@ var (
 		ErrTransactionNotFound,
 		ErrCouldNotGetFeeRate,
 		ErrUnableToGetBalance,
+		ErrRedeemScriptMissing,
+		ErrWitnessScriptMissing,
+		ErrAuthCoinMissing,
+		ErrUnableToSelectCoins,
+		ErrFeeTooHigh,
+		ErrUnableToReplace,
+		ErrInvalidSignature,
+		ErrPolicyMaxFee,
+		ErrPolicyMaxFeeRate,
+		ErrPolicyDustOutput,
+		ErrPolicyMaxOutputs,
+		ErrPolicyDestination,
+		ErrCallMethodInvalid,
+		ErrCallParametersInvalid,
+		ErrSearchQueryUnsupported,
+		ErrUnableToSearchTransactions,
+		ErrUnableToGetEvents,
+		ErrUnableToGetMempoolCoins,
+		ErrUnableToParseTransaction,
 	}
 
 	// ErrUnimplemented is returned when an endpoint
@@ -183,6 +202,146 @@ var (
 		Code:    18, //nolint
 		Message: "Unable to get balance",
 	}
+
+	// ErrRedeemScriptMissing is returned when the redeem
+	// script of a P2SH input is not provided in the input
+	// metadata, can't be derived from the public keys
+	// provided or does not match the output.
+	ErrRedeemScriptMissing = &types.Error{
+		Code:    19, //nolint
+		Message: "Redeem script missing",
+	}
+
+	// ErrWitnessScriptMissing is returned when the witness
+	// script of a P2WSH input is not provided in the input
+	// metadata or does not match the output.
+	ErrWitnessScriptMissing = &types.Error{
+		Code:    20, //nolint
+		Message: "Witness script missing",
+	}
+
+	// ErrAuthCoinMissing is returned when an address debited
+	// by a custom transaction has no coin to authorize it.
+	ErrAuthCoinMissing = &types.Error{
+		Code:    21, //nolint
+		Message: "Unable to find a coin to authorize custom transaction",
+	}
+
+	// ErrUnableToSelectCoins is returned when the coins of
+	// the funding account can't cover the outputs and the fee.
+	ErrUnableToSelectCoins = &types.Error{
+		Code:    22, //nolint
+		Message: "Unable to select coins",
+	}
+
+	// ErrFeeTooHigh is returned when the suggested fee
+	// exceeds the max fee of the transaction.
+	ErrFeeTooHigh = &types.Error{
+		Code:    23, //nolint
+		Message: "Suggested fee exceeds max fee",
+	}
+
+	// ErrUnableToReplace is returned when a transaction
+	// can't be replaced by the constructed transaction.
+	ErrUnableToReplace = &types.Error{
+		Code:    24, //nolint
+		Message: "Unable to replace transaction",
+	}
+
+	// ErrInvalidSignature is returned when a signature provided
+	// to ConstructionCombine is not valid for any input of
+	// the transaction.
+	ErrInvalidSignature = &types.Error{
+		Code:    25, //nolint
+		Message: "Invalid signature",
+	}
+
+	// ErrPolicyMaxFee is returned when the fee of a
+	// transaction exceeds the max fee of the policy.
+	ErrPolicyMaxFee = &types.Error{
+		Code:    26, //nolint
+		Message: "Fee exceeds the max fee of the policy",
+	}
+
+	// ErrPolicyMaxFeeRate is returned when the fee rate of
+	// a transaction exceeds the max fee rate of the policy.
+	ErrPolicyMaxFeeRate = &types.Error{
+		Code:    27, //nolint
+		Message: "Fee rate exceeds the max fee rate of the policy",
+	}
+
+	// ErrPolicyDustOutput is returned when an output of a
+	// transaction is below the dust threshold of the policy.
+	ErrPolicyDustOutput = &types.Error{
+		Code:    28, //nolint
+		Message: "Output is below the dust threshold of the policy",
+	}
+
+	// ErrPolicyMaxOutputs is returned when a transaction
+	// has more outputs than the policy allows.
+	ErrPolicyMaxOutputs = &types.Error{
+		Code:    29, //nolint
+		Message: "Transaction has more outputs than the policy allows",
+	}
+
+	// ErrPolicyDestination is returned when a transaction
+	// pays to an address that isn't allowed by the policy.
+	ErrPolicyDestination = &types.Error{
+		Code:    30, //nolint
+		Message: "Destination is not allowed by the policy",
+	}
+
+	// ErrCallMethodInvalid is returned when the method
+	// of a /call request is not supported.
+	ErrCallMethodInvalid = &types.Error{
+		Code:    31, //nolint
+		Message: "Call method is not supported",
+	}
+
+	// ErrCallParametersInvalid is returned when the
+	// parameters of a /call request can't be parsed.
+	ErrCallParametersInvalid = &types.Error{
+		Code:    32, //nolint
+		Message: "Call parameters are invalid",
+	}
+
+	// ErrSearchQueryUnsupported is returned when a
+	// /search/transactions request has no condition
+	// that can be looked up in the transaction index.
+	ErrSearchQueryUnsupported = &types.Error{
+		Code:    33, //nolint
+		Message: "Search query is not supported",
+	}
+
+	// ErrUnableToSearchTransactions is returned when
+	// the indexer can't search transactions.
+	ErrUnableToSearchTransactions = &types.Error{
+		Code:    34, //nolint
+		Message: "Unable to search transactions",
+	}
+
+	// ErrUnableToGetEvents is returned when the
+	// indexer can't get block events.
+	ErrUnableToGetEvents = &types.Error{
+		Code:    35, //nolint
+		Message: "Unable to get block events",
+	}
+
+	// ErrUnableToGetMempoolCoins is returned when the
+	// indexer can't overlay mempool coins (ex: the
+	// mempool hasn't been polled yet).
+	ErrUnableToGetMempoolCoins = &types.Error{
+		Code:      36, //nolint
+		Message:   "Unable to get mempool coins",
+		Retriable: true,
+	}
+
+	// ErrUnableToParseTransaction is returned when
+	// a transaction in the mempool can't be parsed.
+	ErrUnableToParseTransaction = &types.Error{
+		Code:    37, //nolint
+		Message: "Unable to parse transaction",
+	}
 )
 
 // wrapErr adds details to the types.Error provided. We use a function
@@ -0,0 +1,99 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DeFiCh/rosetta-defichain/configuration"
+	mocks "github.com/DeFiCh/rosetta-defichain/mocks/services"
+
+	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventsService_Offline(t *testing.T) {
+	cfg := &configuration.Configuration{
+		Mode: configuration.Offline,
+	}
+	mockIndexer := &mocks.Indexer{}
+	servicer := NewEventsAPIService(cfg, mockIndexer)
+	ctx := context.Background()
+
+	response, err := servicer.EventsBlocks(ctx, &types.EventsBlocksRequest{})
+	assert.Nil(t, response)
+	assert.Equal(t, ErrUnavailableOffline.Code, err.Code)
+
+	mockIndexer.AssertExpectations(t)
+}
+
+func TestEventsService_EventsBlocks(t *testing.T) {
+	cfg := &configuration.Configuration{
+		Mode: configuration.Online,
+	}
+	mockIndexer := &mocks.Indexer{}
+	servicer := NewEventsAPIService(cfg, mockIndexer)
+	ctx := context.Background()
+
+	events := []*types.BlockEvent{
+		{
+			Sequence:        5,
+			BlockIdentifier: &types.BlockIdentifier{Hash: "block 3", Index: 3},
+			Type:            types.REMOVED,
+		},
+	}
+
+	// The limit is capped at maxEventsLimit
+	offset := int64(5)
+	mockIndexer.On(
+		"GetBlockEvents",
+		ctx,
+		&offset,
+		int64(maxEventsLimit),
+	).Return(
+		events,
+		int64(5),
+		nil,
+	).Once()
+	response, err := servicer.EventsBlocks(ctx, &types.EventsBlocksRequest{
+		Offset: &offset,
+		Limit:  types.Int64(1000),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, &types.EventsBlocksResponse{
+		MaxSequence: 5,
+		Events:      events,
+	}, response)
+
+	mockIndexer.On(
+		"GetBlockEvents",
+		ctx,
+		(*int64)(nil),
+		int64(1),
+	).Return(
+		nil,
+		int64(-1),
+		errors.New("unable to get next sequence"),
+	).Once()
+	response, err = servicer.EventsBlocks(ctx, &types.EventsBlocksRequest{
+		Limit: types.Int64(1),
+	})
+	assert.Nil(t, response)
+	assert.Equal(t, ErrUnableToGetEvents.Code, err.Code)
+
+	mockIndexer.AssertExpectations(t)
+}
@@ -0,0 +1,191 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/DeFiCh/rosetta-defichain/defichain"
+
+	"github.com/coinbase/rosetta-sdk-go/types"
+)
+
+const (
+	// maxConfirmationTarget is the largest conf_target
+	// accepted by estimatesmartfee.
+	maxConfirmationTarget = int64(1008) // nolint:gomnd
+)
+
+// FeeRateSource is the source of the fee rate used
+// by /construction/metadata.
+type FeeRateSource string
+
+const (
+	// ExplicitFeeRateSource is a fee_per_kb provided in
+	// /construction/preprocess.
+	ExplicitFeeRateSource FeeRateSource = "explicit"
+
+	// SmartFeeRateSource is estimated by estimatesmartfee.
+	SmartFeeRateSource FeeRateSource = "estimatesmartfee"
+
+	// MempoolFeeRateSource is the minimum fee rate of the
+	// mempool, used when estimatesmartfee has no data.
+	MempoolFeeRateSource FeeRateSource = "mempool"
+)
+
+// feeRate is the fee rate used by /construction/metadata.
+type feeRate struct {
+	feePerKB float64
+	target   int64
+	source   FeeRateSource
+}
+
+// validFeePolicy returns an error if the fee policy of
+// a /construction/preprocess request is invalid.
+func validFeePolicy(metadata *PreprocessMetadata) error {
+	if metadata.FeePerKB != nil {
+		if *metadata.FeePerKB <= 0 {
+			return fmt.Errorf("fee_per_kb %f must be positive", *metadata.FeePerKB)
+		}
+
+		if metadata.ConfirmationTarget != 0 || len(metadata.EstimateMode) > 0 {
+			return errors.New(
+				"fee_per_kb cannot be used with confirmation_target or estimate_mode",
+			)
+		}
+	}
+
+	if metadata.ConfirmationTarget < 0 || metadata.ConfirmationTarget > maxConfirmationTarget {
+		return fmt.Errorf(
+			"confirmation_target %d must be between 1 and %d",
+			metadata.ConfirmationTarget,
+			maxConfirmationTarget,
+		)
+	}
+
+	switch metadata.EstimateMode {
+	case "", defichain.EconomicalEstimateMode, defichain.ConservativeEstimateMode:
+		return nil
+	default:
+		return fmt.Errorf("%s is not a valid estimate_mode", metadata.EstimateMode)
+	}
+}
+
+// maxFee returns the max fee (in satoshis) of a
+// /construction/preprocess request or an empty
+// string if there is none.
+func (s *ConstructionAPIService) maxFee(amounts []*types.Amount) (string, error) {
+	switch len(amounts) {
+	case 0:
+		return "", nil
+	case 1:
+	default:
+		return "", errors.New("only 1 max fee can be provided")
+	}
+
+	if types.Hash(amounts[0].Currency) != types.Hash(s.config.Currency) {
+		return "", fmt.Errorf(
+			"max fee currency %s is not %s",
+			types.PrintStruct(amounts[0].Currency),
+			s.config.Currency.Symbol,
+		)
+	}
+
+	value, err := types.AmountValue(amounts[0])
+	if err != nil {
+		return "", fmt.Errorf("%w unable to parse max fee", err)
+	}
+
+	if value.Sign() < 0 || !value.IsInt64() {
+		return "", fmt.Errorf("max fee %s is invalid", value)
+	}
+
+	return value.String(), nil
+}
+
+// feeRate returns the fee rate of a transaction. Unless it is
+// provided, the rate is estimated by estimatesmartfee (falling
+// back to the minimum fee rate of the mempool) and multiplied
+// by the fee multiplier. It is never below the minimum fee
+// relay rate.
+func (s *ConstructionAPIService) feeRate(
+	ctx context.Context,
+	options *preprocessOptions,
+) (*feeRate, error) {
+	if options.FeePerKB != nil {
+		return &feeRate{
+			feePerKB: minFeeRate(*options.FeePerKB),
+			source:   ExplicitFeeRateSource,
+		}, nil
+	}
+
+	target := options.ConfirmationTarget
+	if target == 0 {
+		target = defaultConfirmationTarget
+	}
+
+	source := SmartFeeRateSource
+	feePerKB, err := s.client.SuggestedFeeRate(ctx, target, options.EstimateMode)
+	if errors.Is(err, defichain.ErrNoFeeEstimate) {
+		source = MempoolFeeRateSource
+		feePerKB, err = s.client.MempoolFeeRate(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if options.FeeMultiplier != nil {
+		feePerKB *= *options.FeeMultiplier
+	}
+
+	return &feeRate{
+		feePerKB: minFeeRate(feePerKB),
+		target:   target,
+		source:   source,
+	}, nil
+}
+
+// exceedsMaxFee returns an error if fee is
+// larger than maxFee.
+func exceedsMaxFee(fee string, maxFee string) error {
+	feeValue, ok := new(big.Int).SetString(fee, 10)
+	if !ok {
+		return fmt.Errorf("fee %s is invalid", fee)
+	}
+
+	maxValue, ok := new(big.Int).SetString(maxFee, 10)
+	if !ok {
+		return fmt.Errorf("max fee %s is invalid", maxFee)
+	}
+
+	if feeValue.Cmp(maxValue) > 0 {
+		return fmt.Errorf("fee %s is larger than max fee %s", fee, maxFee)
+	}
+
+	return nil
+}
+
+// minFeeRate ensures a fee rate is not below the
+// minimum fee relay rate.
+func minFeeRate(feePerKB float64) float64 {
+	if feePerKB < defichain.MinFeeRate {
+		return defichain.MinFeeRate
+	}
+
+	return feePerKB
+}
@@ -0,0 +1,314 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/DeFiCh/rosetta-defichain/configuration"
+	"github.com/DeFiCh/rosetta-defichain/defichain"
+	mocks "github.com/DeFiCh/rosetta-defichain/mocks/services"
+
+	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidFeePolicy(t *testing.T) {
+	feePerKB := 0.0002
+	zero := float64(0)
+
+	var tests = map[string]struct {
+		metadata *PreprocessMetadata
+		err      error
+	}{
+		"default": {
+			metadata: &PreprocessMetadata{},
+		},
+		"estimate": {
+			metadata: &PreprocessMetadata{
+				ConfirmationTarget: 6,
+				EstimateMode:       defichain.ConservativeEstimateMode,
+			},
+		},
+		"explicit": {
+			metadata: &PreprocessMetadata{FeePerKB: &feePerKB},
+		},
+		"explicit with target": {
+			metadata: &PreprocessMetadata{FeePerKB: &feePerKB, ConfirmationTarget: 6},
+			err:      errors.New("fee_per_kb cannot be used with confirmation_target or estimate_mode"),
+		},
+		"zero fee rate": {
+			metadata: &PreprocessMetadata{FeePerKB: &zero},
+			err:      errors.New("fee_per_kb 0.000000 must be positive"),
+		},
+		"invalid target": {
+			metadata: &PreprocessMetadata{ConfirmationTarget: 1009},
+			err:      errors.New("confirmation_target 1009 must be between 1 and 1008"),
+		},
+		"invalid mode": {
+			metadata: &PreprocessMetadata{EstimateMode: defichain.EstimateMode("unset")},
+			err:      errors.New("unset is not a valid estimate_mode"),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := validFeePolicy(test.metadata)
+			if test.err != nil {
+				assert.EqualError(t, err, test.err.Error())
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestFeeRate(t *testing.T) {
+	cfg := &configuration.Configuration{
+		Mode:     configuration.Online,
+		Params:   defichain.TestnetParams,
+		Currency: defichain.TestnetCurrency,
+	}
+	ctx := context.Background()
+	feePerKB := 0.0002
+	lowFeePerKB := 0.000001
+	feeMultiplier := 1.5
+
+	var tests = map[string]struct {
+		options *preprocessOptions
+		mock    func(*mocks.Client)
+
+		rate *feeRate
+		err  error
+	}{
+		"explicit": {
+			options: &preprocessOptions{FeePerKB: &feePerKB, FeeMultiplier: &feeMultiplier},
+			rate:    &feeRate{feePerKB: 0.0002, source: ExplicitFeeRateSource},
+		},
+		"explicit below minimum": {
+			options: &preprocessOptions{FeePerKB: &lowFeePerKB},
+			rate:    &feeRate{feePerKB: defichain.MinFeeRate, source: ExplicitFeeRateSource},
+		},
+		"estimate": {
+			options: &preprocessOptions{
+				ConfirmationTarget: 6,
+				EstimateMode:       defichain.EconomicalEstimateMode,
+				FeeMultiplier:      &feeMultiplier,
+			},
+			mock: func(client *mocks.Client) {
+				client.On(
+					"SuggestedFeeRate",
+					ctx,
+					int64(6),
+					defichain.EconomicalEstimateMode,
+				).Return(0.0002, nil).Once()
+			},
+			rate: &feeRate{feePerKB: 0.0002 * feeMultiplier, target: 6, source: SmartFeeRateSource},
+		},
+		"mempool fallback": {
+			options: &preprocessOptions{},
+			mock: func(client *mocks.Client) {
+				client.On(
+					"SuggestedFeeRate",
+					ctx,
+					defaultConfirmationTarget,
+					defichain.EstimateMode(""),
+				).Return(float64(-1), fmt.Errorf("%w: insufficient data", defichain.ErrNoFeeEstimate)).Once()
+				client.On("MempoolFeeRate", ctx).Return(0.00003, nil).Once()
+			},
+			rate: &feeRate{
+				feePerKB: 0.00003,
+				target:   defaultConfirmationTarget,
+				source:   MempoolFeeRateSource,
+			},
+		},
+		"estimate error": {
+			options: &preprocessOptions{},
+			mock: func(client *mocks.Client) {
+				client.On(
+					"SuggestedFeeRate",
+					ctx,
+					defaultConfirmationTarget,
+					defichain.EstimateMode(""),
+				).Return(float64(-1), errors.New("defid unavailable")).Once()
+			},
+			err: errors.New("defid unavailable"),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockClient := &mocks.Client{}
+			if test.mock != nil {
+				test.mock(mockClient)
+			}
+			servicer := NewConstructionAPIService(cfg, mockClient, &mocks.Indexer{})
+
+			rate, err := servicer.(*ConstructionAPIService).feeRate(ctx, test.options)
+			if test.err != nil {
+				assert.EqualError(t, err, test.err.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, test.rate, rate)
+			}
+
+			mockClient.AssertExpectations(t)
+		})
+	}
+}
+
+func TestConstructionService_MaxFee(t *testing.T) {
+	networkIdentifier = &types.NetworkIdentifier{
+		Network:    defichain.TestnetNetwork,
+		Blockchain: defichain.Blockchain,
+	}
+
+	cfg := &configuration.Configuration{
+		Mode:     configuration.Online,
+		Network:  networkIdentifier,
+		Params:   defichain.TestnetParams,
+		Currency: defichain.TestnetCurrency,
+	}
+
+	mockIndexer := &mocks.Indexer{}
+	mockClient := &mocks.Client{}
+	servicer := NewConstructionAPIService(cfg, mockClient, mockIndexer)
+	ctx := context.Background()
+
+	ops := []*types.Operation{
+		{
+			OperationIdentifier: &types.OperationIdentifier{
+				Index: 0,
+			},
+			Type: defichain.InputOpType,
+			Account: &types.AccountIdentifier{
+				Address: "tf1qvlmwgj9rsmpqx2c6dl54a36ev4zkd3pw3ufh4c",
+			},
+			Amount: &types.Amount{
+				Value:    "-1000000",
+				Currency: defichain.TestnetCurrency,
+			},
+			CoinChange: &types.CoinChange{
+				CoinIdentifier: &types.CoinIdentifier{
+					Identifier: "b14157a5c2ef0ce1de1a3ca1e6c3b2b3a0dd1e0a6e8e1d1f2a0e3c4b5a6d7e8f:0",
+				},
+				CoinAction: types.CoinSpent,
+			},
+		},
+		{
+			OperationIdentifier: &types.OperationIdentifier{
+				Index: 1,
+			},
+			Type: defichain.OutputOpType,
+			Account: &types.AccountIdentifier{
+				Address: "tf1qr4pelt25fk869v2sfrwxp7ttm7jyx0pyn4dxph",
+			},
+			Amount: &types.Amount{
+				Value:    "990000",
+				Currency: defichain.TestnetCurrency,
+			},
+		},
+	}
+	feePerKB := 0.0002
+
+	// Preprocess
+	preprocessResponse, err := servicer.ConstructionPreprocess(
+		ctx,
+		&types.ConstructionPreprocessRequest{
+			NetworkIdentifier: networkIdentifier,
+			Operations:        ops,
+			Metadata:          forceMarshalMap(t, &PreprocessMetadata{FeePerKB: &feePerKB}),
+			MaxFee: []*types.Amount{
+				{
+					Value:    "2000",
+					Currency: defichain.TestnetCurrency,
+				},
+			},
+		},
+	)
+	assert.Nil(t, err)
+	var options preprocessOptions
+	assert.NoError(t, types.UnmarshalMap(preprocessResponse.Options, &options))
+	assert.Equal(t, "2000", options.MaxFee)
+	assert.Equal(t, &feePerKB, options.FeePerKB)
+
+	// The max fee must be DFI
+	_, err = servicer.ConstructionPreprocess(
+		ctx,
+		&types.ConstructionPreprocessRequest{
+			NetworkIdentifier: networkIdentifier,
+			Operations:        ops,
+			MaxFee: []*types.Amount{
+				{
+					Value:    "2000",
+					Currency: &types.Currency{Symbol: "BTC", Decimals: 8},
+				},
+			},
+		},
+	)
+	assert.Equal(t, ErrUnclearIntent.Code, err.Code)
+
+	// 110 * 20 = 2200 exceeds the max fee
+	_, err = servicer.ConstructionMetadata(ctx, &types.ConstructionMetadataRequest{
+		NetworkIdentifier: networkIdentifier,
+		Options:           preprocessResponse.Options,
+	})
+	assert.Equal(t, ErrFeeTooHigh.Code, err.Code)
+
+	// Below the max fee
+	options.MaxFee = "2200"
+	scriptPubKeys := []*defichain.ScriptPubKey{
+		{
+			ASM:          "0 67f6e448a386c2032b1a6fe95ec759654566c42e",
+			Hex:          "001467f6e448a386c2032b1a6fe95ec759654566c42e",
+			RequiredSigs: 1,
+			Type:         "witness_v0_keyhash",
+			Addresses:    []string{"tf1qvlmwgj9rsmpqx2c6dl54a36ev4zkd3pw3ufh4c"},
+		},
+	}
+	mockIndexer.On(
+		"GetScriptPubKeys",
+		ctx,
+		options.Coins,
+	).Return(
+		scriptPubKeys,
+		nil,
+	).Once()
+	metadataResponse, err := servicer.ConstructionMetadata(ctx, &types.ConstructionMetadataRequest{
+		NetworkIdentifier: networkIdentifier,
+		Options:           forceMarshalMap(t, &options),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, &types.ConstructionMetadataResponse{
+		Metadata: forceMarshalMap(t, &constructionMetadata{
+			ScriptPubKeys: scriptPubKeys,
+			FeePerKB:      feePerKB,
+			FeeRateSource: ExplicitFeeRateSource,
+		}),
+		SuggestedFee: []*types.Amount{
+			{
+				Value:    "2200",
+				Currency: defichain.TestnetCurrency,
+			},
+		},
+	}, metadataResponse)
+
+	mockClient.AssertExpectations(t)
+	mockIndexer.AssertExpectations(t)
+}
@@ -16,9 +16,12 @@ package services
 
 import (
 	"context"
-	"github.com/DeFiCh/rosetta-defichain/defichain"
+	"encoding/json"
+	"fmt"
+	"strconv"
 
 	"github.com/DeFiCh/rosetta-defichain/configuration"
+	"github.com/DeFiCh/rosetta-defichain/defichain"
 
 	"github.com/coinbase/rosetta-sdk-go/server"
 	"github.com/coinbase/rosetta-sdk-go/types"
@@ -28,16 +31,19 @@ import (
 type MempoolAPIService struct {
 	config *configuration.Configuration
 	client Client
+	i      Indexer
 }
 
 // NewMempoolAPIService creates a new instance of a MempoolAPIService.
 func NewMempoolAPIService(
 	config *configuration.Configuration,
 	client Client,
+	i Indexer,
 ) server.MempoolAPIServicer {
 	return &MempoolAPIService{
 		config: config,
 		client: client,
+		i:      i,
 	}
 }
 
@@ -82,49 +88,137 @@ func (s *MempoolAPIService) MempoolTransaction(
 		return nil, wrapErr(ErrTransactionNotFound, nil)
 	}
 
+	// getrawtransaction also returns mined transactions
+	// if defid maintains a transaction index.
+	entry, err := s.client.MempoolEntry(ctx, txHash)
+	if err != nil || entry == nil {
+		return nil, wrapErr(ErrTransactionNotFound, nil)
+	}
+
 	tx, err := s.client.GetRawTransaction(ctx, txHash, "")
 	if err != nil || tx == nil {
 		return nil, wrapErr(ErrTransactionNotFound, nil)
 	}
 
-	var (
-		inputsLen     = len(tx.Inputs)
-		operationsLen = inputsLen + len(tx.Outputs)
-
-		operations     = make([]*types.Operation, 0, operationsLen)
-		operationIndex int
-	)
-	for ; operationIndex < inputsLen; operationIndex++ {
-		operation := &types.Operation{
-			OperationIdentifier: &types.OperationIdentifier{
-				Index:        int64(operationIndex),
-				NetworkIndex: &tx.Inputs[operationIndex].Vout,
-			},
-			Type: defichain.InputOpType,
+	coins, err := s.i.GetInputCoins(ctx, tx)
+	if err != nil {
+		return nil, wrapErr(ErrUnableToGetCoins, err)
+	}
+
+	transaction, err := s.client.ParseTransaction(ctx, tx, coins)
+	if err != nil {
+		return nil, wrapErr(ErrUnableToParseTransaction, err)
+	}
+
+	fee, err := mempoolFee(transaction, s.config.Currency)
+	if err != nil {
+		return nil, wrapErr(ErrUnableToParseTransaction, err)
+	}
+
+	vsize := tx.Vsize
+	if vsize == 0 {
+		vsize = tx.Size
+	}
+
+	feePerKB := float64(0)
+	if vsize > 0 {
+		feePerKB = float64(fee) * bytesInKb / float64(vsize) / defichain.SatoshisInDFI
+	}
+
+	entryMetadata, err := mempoolEntryMetadata(entry)
+	if err != nil {
+		return nil, wrapErr(ErrUnableToParseIntermediateResult, err)
+	}
+
+	metadata, err := types.MarshalMap(&MempoolTransactionMetadata{
+		Fee: &types.Amount{
+			Value:    strconv.FormatInt(fee, 10),
+			Currency: s.config.Currency,
+		},
+		FeePerKB:     feePerKB,
+		MempoolEntry: entryMetadata,
+	})
+	if err != nil {
+		return nil, wrapErr(ErrUnableToParseIntermediateResult, err)
+	}
+
+	return &types.MempoolTransactionResponse{
+		Transaction: transaction,
+		Metadata:    metadata,
+	}, nil
+}
+
+// mempoolFee returns the fee (in satoshis) of a parsed
+// transaction. The DFI minted from account balances by an
+// ACCOUNT_TO_UTXOS operation funds outputs like an input.
+func mempoolFee(transaction *types.Transaction, currency *types.Currency) (int64, error) {
+	fee := int64(0)
+	for _, op := range transaction.Operations {
+		switch op.Type {
+		case defichain.InputOpType, defichain.OutputOpType, defichain.AccountToUtxosOpType:
+		default:
+			continue
 		}
-		operations = append(operations, operation)
-	}
-	for ; operationIndex < operationsLen; operationIndex++ {
-		operation := &types.Operation{
-			OperationIdentifier: &types.OperationIdentifier{
-				Index: int64(operationIndex),
-			},
-			Type: defichain.OutputOpType,
+
+		if op.Amount == nil || types.Hash(op.Amount.Currency) != types.Hash(currency) {
+			continue
+		}
+
+		value, err := strconv.ParseInt(op.Amount.Value, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: unable to parse amount %s", err, op.Amount.Value)
 		}
-		operations = append(operations, operation)
+
+		fee -= value
 	}
 
-	resp := &types.MempoolTransactionResponse{
-		Transaction: &types.Transaction{
-			TransactionIdentifier: &types.TransactionIdentifier{
-				Hash: tx.Hash,
-			},
-			Operations: operations,
-		},
+	return fee, nil
+}
+
+// mempoolEntryMetadata converts a *defichain.MempoolEntry
+// to *MempoolEntryMetadata.
+func mempoolEntryMetadata(entry *defichain.MempoolEntry) (*MempoolEntryMetadata, error) {
+	vsize := entry.Vsize
+	if vsize == 0 {
+		vsize = entry.Size
+	}
+
+	metadata := &MempoolEntryMetadata{
+		Vsize:             vsize,
+		Time:              entry.Time,
+		Height:            entry.Height,
+		AncestorCount:     entry.AncestorCount,
+		AncestorSize:      entry.AncestorSize,
+		DescendantCount:   entry.DescendantCount,
+		DescendantSize:    entry.DescendantSize,
+		Depends:           entry.Depends,
+		SpentBy:           entry.SpentBy,
+		Bip125Replaceable: entry.Bip125Replaceable,
 	}
 
-	metadata, _ := tx.Metadata()
-	resp.Metadata = metadata
+	if fees := entry.Fees; fees != nil {
+		for _, fee := range []struct {
+			amount json.Number
+			value  *int64
+		}{
+			{amount: fees.Base, value: &metadata.Fee},
+			{amount: fees.Modified, value: &metadata.ModifiedFee},
+			{amount: fees.Ancestor, value: &metadata.AncestorFees},
+			{amount: fees.Descendant, value: &metadata.DescendantFees},
+		} {
+			value, err := defichain.ParseAmount(fee.amount)
+			if err != nil {
+				return nil, fmt.Errorf("%w: unable to parse mempool entry fee", err)
+			}
+
+			*fee.value = value
+		}
+	}
+
+	if metadata.AncestorSize > 0 {
+		metadata.AncestorFeePerKB = float64(metadata.AncestorFees) * bytesInKb /
+			float64(metadata.AncestorSize) / defichain.SatoshisInDFI
+	}
 
-	return resp, nil
+	return metadata, nil
 }
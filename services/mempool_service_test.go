@@ -16,6 +16,7 @@ package services
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"github.com/DeFiCh/rosetta-defichain/defichain"
@@ -32,7 +33,8 @@ func TestMempoolEndpoints_Offline(t *testing.T) {
 		Mode: configuration.Offline,
 	}
 	mockClient := &mocks.Client{}
-	servicer := NewMempoolAPIService(cfg, mockClient)
+	mockIndexer := &mocks.Indexer{}
+	servicer := NewMempoolAPIService(cfg, mockClient, mockIndexer)
 	ctx := context.Background()
 	mem, err := servicer.Mempool(ctx, nil)
 	assert.Nil(t, mem)
@@ -44,15 +46,18 @@ func TestMempoolEndpoints_Offline(t *testing.T) {
 	assert.Equal(t, ErrUnavailableOffline.Code, err.Code)
 	assert.Equal(t, ErrUnavailableOffline.Message, err.Message)
 	mockClient.AssertExpectations(t)
+	mockIndexer.AssertExpectations(t)
 }
 
 func TestMempoolEndpoints_Online(t *testing.T) {
 	cfg := &configuration.Configuration{
-		Mode: configuration.Online,
+		Mode:     configuration.Online,
+		Currency: defichain.MainnetCurrency,
 	}
 
 	mockClient := &mocks.Client{}
-	servicer := NewMempoolAPIService(cfg, mockClient)
+	mockIndexer := &mocks.Indexer{}
+	servicer := NewMempoolAPIService(cfg, mockClient, mockIndexer)
 	ctx := context.Background()
 
 	mockClient.On("RawMempool", ctx).Return([]string{
@@ -72,48 +77,229 @@ func TestMempoolEndpoints_Online(t *testing.T) {
 		},
 	}, mem)
 
-	mockClient.On("GetRawTransaction", ctx, "tx_hash", "").Return(&defichain.Transaction{
-		Hash: "tx_hash",
+	rawTransaction := &defichain.Transaction{
+		Hash:  "tx_hash",
+		Vsize: 200,
 		Inputs: []*defichain.Input{
 			{
 				TxHash: "input_tx_hash",
-				Vout:   0,
+				Vout:   1,
 			},
 		},
 		Outputs: []*defichain.Output{
 			{
-				Value: 1000000000,
+				Value: "10",
 				Index: 0,
 			},
 		},
-	}, nil)
+	}
+	coins := map[string]*types.AccountCoin{
+		"input_tx_hash:1": {
+			Account: &types.AccountIdentifier{Address: "addr 1"},
+			Coin: &types.Coin{
+				CoinIdentifier: &types.CoinIdentifier{Identifier: "input_tx_hash:1"},
+				Amount: &types.Amount{
+					Value:    "1000005000",
+					Currency: defichain.MainnetCurrency,
+				},
+			},
+		},
+	}
+	transaction := &types.Transaction{
+		TransactionIdentifier: &types.TransactionIdentifier{
+			Hash: "tx_hash",
+		},
+		Operations: []*types.Operation{
+			{
+				OperationIdentifier: &types.OperationIdentifier{
+					Index:        0,
+					NetworkIndex: types.Int64(0),
+				},
+				Type:    defichain.InputOpType,
+				Status:  types.String(defichain.SuccessStatus),
+				Account: &types.AccountIdentifier{Address: "addr 1"},
+				Amount: &types.Amount{
+					Value:    "-1000005000",
+					Currency: defichain.MainnetCurrency,
+				},
+				CoinChange: &types.CoinChange{
+					CoinIdentifier: &types.CoinIdentifier{Identifier: "input_tx_hash:1"},
+					CoinAction:     types.CoinSpent,
+				},
+			},
+			{
+				OperationIdentifier: &types.OperationIdentifier{
+					Index:        1,
+					NetworkIndex: types.Int64(0),
+				},
+				Type:    defichain.OutputOpType,
+				Status:  types.String(defichain.SuccessStatus),
+				Account: &types.AccountIdentifier{Address: "addr 2"},
+				Amount: &types.Amount{
+					Value:    "1000000000",
+					Currency: defichain.MainnetCurrency,
+				},
+				CoinChange: &types.CoinChange{
+					CoinIdentifier: &types.CoinIdentifier{Identifier: "tx_hash:0"},
+					CoinAction:     types.CoinCreated,
+				},
+			},
+		},
+	}
+	entry := &defichain.MempoolEntry{
+		Size:            200,
+		Time:            1604671830,
+		Height:          520001,
+		DescendantCount: 1,
+		DescendantSize:  200,
+		AncestorCount:   2,
+		AncestorSize:    400,
+		Fees: &defichain.MempoolEntryFees{
+			Base:       "0.00005",
+			Modified:   "0.00005",
+			Ancestor:   "0.00006",
+			Descendant: "0.00005",
+		},
+		Depends:           []string{"input_tx_hash"},
+		SpentBy:           []string{},
+		Bip125Replaceable: true,
+	}
+	mockClient.On("MempoolEntry", ctx, "tx_hash").Return(entry, nil)
+	mockClient.On("GetRawTransaction", ctx, "tx_hash", "").Return(rawTransaction, nil)
+	mockIndexer.On("GetInputCoins", ctx, rawTransaction).Return(coins, nil).Once()
+	mockClient.On(
+		"ParseTransaction",
+		ctx,
+		rawTransaction,
+		coins,
+	).Return(transaction, nil).Once()
 	memTransaction, err := servicer.MempoolTransaction(ctx, &types.MempoolTransactionRequest{
 		TransactionIdentifier: &types.TransactionIdentifier{
 			Hash: "tx_hash",
 		},
 	})
+	assert.Nil(t, err)
+	assert.Equal(t, &types.MempoolTransactionResponse{
+		Transaction: transaction,
+		Metadata: forceMarshalMap(t, &MempoolTransactionMetadata{
+			Fee: &types.Amount{
+				Value:    "5000",
+				Currency: defichain.MainnetCurrency,
+			},
+			FeePerKB: 0.00025,
+			MempoolEntry: &MempoolEntryMetadata{
+				Vsize:             200,
+				Time:              1604671830,
+				Height:            520001,
+				Fee:               5000,
+				ModifiedFee:       5000,
+				AncestorCount:     2,
+				AncestorSize:      400,
+				AncestorFees:      6000,
+				AncestorFeePerKB:  0.00015,
+				DescendantCount:   1,
+				DescendantSize:    200,
+				DescendantFees:    5000,
+				Depends:           []string{"input_tx_hash"},
+				SpentBy:           []string{},
+				Bip125Replaceable: true,
+			},
+		}),
+	}, memTransaction)
 
-	var vout int64 = 0
-	assert.Equal(t, &types.Transaction{
+	// Coins spent by the transaction can't be found.
+	mockIndexer.On(
+		"GetInputCoins",
+		ctx,
+		rawTransaction,
+	).Return(nil, errors.New("unable to find coin")).Once()
+	memTransaction, err = servicer.MempoolTransaction(ctx, &types.MempoolTransactionRequest{
 		TransactionIdentifier: &types.TransactionIdentifier{
 			Hash: "tx_hash",
 		},
+	})
+	assert.Nil(t, memTransaction)
+	assert.Equal(t, ErrUnableToGetCoins.Code, err.Code)
+
+	// Mined transactions aren't in the mempool.
+	mockClient.On(
+		"MempoolEntry",
+		ctx,
+		"mined_tx_hash",
+	).Return(nil, errors.New("Transaction not in mempool")).Once()
+	memTransaction, err = servicer.MempoolTransaction(ctx, &types.MempoolTransactionRequest{
+		TransactionIdentifier: &types.TransactionIdentifier{
+			Hash: "mined_tx_hash",
+		},
+	})
+	assert.Nil(t, memTransaction)
+	assert.Equal(t, ErrTransactionNotFound.Code, err.Code)
+
+	mockClient.AssertExpectations(t)
+	mockIndexer.AssertExpectations(t)
+}
+
+func TestMempoolFee(t *testing.T) {
+	// The DFI minted from account balances
+	// funds the outputs.
+	transaction := &types.Transaction{
 		Operations: []*types.Operation{
 			{
-				OperationIdentifier: &types.OperationIdentifier{
-					Index:        0,
-					NetworkIndex: &vout,
-				},
 				Type: defichain.InputOpType,
+				Amount: &types.Amount{
+					Value:    "-1000",
+					Currency: defichain.MainnetCurrency,
+				},
 			},
 			{
-				OperationIdentifier: &types.OperationIdentifier{
-					Index: 1,
-				},
 				Type: defichain.OutputOpType,
+				Amount: &types.Amount{
+					Value:    "1400",
+					Currency: defichain.MainnetCurrency,
+				},
+			},
+			{
+				Type: defichain.AccountToUtxosOpType,
+				Amount: &types.Amount{
+					Value:    "-500",
+					Currency: defichain.MainnetCurrency,
+				},
+			},
+			{
+				Type: defichain.AccountTransferOpType,
+				Amount: &types.Amount{
+					Value:    "-700",
+					Currency: defichain.MainnetCurrency,
+				},
 			},
 		},
-	}, memTransaction.Transaction)
+	}
+	fee, err := mempoolFee(transaction, defichain.MainnetCurrency)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100), fee)
+}
 
-	mockClient.AssertExpectations(t)
+func TestMempoolEntryMetadata(t *testing.T) {
+	metadata, err := mempoolEntryMetadata(&defichain.MempoolEntry{Vsize: 100})
+	assert.NoError(t, err)
+	assert.Equal(t, &MempoolEntryMetadata{Vsize: 100}, metadata)
+
+	metadata, err = mempoolEntryMetadata(&defichain.MempoolEntry{
+		Vsize: 100,
+		Fees: &defichain.MempoolEntryFees{
+			Base:       "0.12345678",
+			Modified:   "0.12345678",
+			Ancestor:   "0.12345678",
+			Descendant: "1e-8",
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(12345678), metadata.Fee)
+	assert.Equal(t, int64(1), metadata.DescendantFees)
+
+	metadata, err = mempoolEntryMetadata(&defichain.MempoolEntry{
+		Fees: &defichain.MempoolEntryFees{Base: "0.000000001"},
+	})
+	assert.Nil(t, metadata)
+	assert.Error(t, err)
 }
@@ -0,0 +1,277 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/DeFiCh/rosetta-defichain/defichain"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/coinbase/rosetta-sdk-go/types"
+)
+
+// multisigPublicKeys returns the public keys of a multisig
+// script (in script order) and the number of signatures
+// it requires.
+func multisigPublicKeys(script []byte) ([][]byte, int, error) {
+	if txscript.GetScriptClass(script) != txscript.MultiSigTy {
+		return nil, 0, fmt.Errorf("%x is not a multisig script", script)
+	}
+
+	_, requiredSigs, err := txscript.CalcMultiSigStats(script)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w unable to parse multisig script", err)
+	}
+
+	publicKeys, err := txscript.PushedData(script)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w unable to parse multisig script", err)
+	}
+
+	return publicKeys, requiredSigs, nil
+}
+
+// multisigSigners returns the public keys that will sign
+// a multisig script in script order. If no signers are
+// provided, the first required public keys of the script
+// are used.
+func multisigSigners(script []byte, signers []string) ([][]byte, error) {
+	publicKeys, requiredSigs, err := multisigPublicKeys(script)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(signers) == 0 {
+		return publicKeys[:requiredSigs], nil
+	}
+
+	if len(signers) != requiredSigs {
+		return nil, fmt.Errorf(
+			"expected %d signers but got %d",
+			requiredSigs,
+			len(signers),
+		)
+	}
+
+	indexes := make([]int, len(signers))
+	for i, signer := range signers {
+		publicKey, err := hex.DecodeString(signer)
+		if err != nil {
+			return nil, fmt.Errorf("%w unable to decode signer %s", err, signer)
+		}
+
+		indexes[i] = publicKeyIndex(publicKeys, publicKey)
+		if indexes[i] < 0 {
+			return nil, fmt.Errorf("signer %s is not part of the multisig script", signer)
+		}
+	}
+
+	sort.Ints(indexes)
+	selected := make([][]byte, len(indexes))
+	for i, index := range indexes {
+		if i > 0 && indexes[i-1] == index {
+			return nil, fmt.Errorf("signer %x is duplicated", publicKeys[index])
+		}
+
+		selected[i] = publicKeys[index]
+	}
+
+	return selected, nil
+}
+
+// orderSignatures returns the normalized signatures of a
+// multisig input sorted in the order of their public keys
+// in the script, as required by OP_CHECKMULTISIG.
+func orderSignatures(script []byte, signatures []*types.Signature) ([][]byte, error) {
+	publicKeys, _, err := multisigPublicKeys(script)
+	if err != nil {
+		return nil, err
+	}
+
+	indexes := make([]int, len(signatures))
+	for i, signature := range signatures {
+		indexes[i] = publicKeyIndex(publicKeys, signature.PublicKey.Bytes)
+		if indexes[i] < 0 {
+			return nil, fmt.Errorf(
+				"public key %x is not part of the multisig script",
+				signature.PublicKey.Bytes,
+			)
+		}
+	}
+
+	ordered := make([]int, len(signatures))
+	for i := range ordered {
+		ordered[i] = i
+	}
+	sort.Slice(ordered, func(i, j int) bool { return indexes[ordered[i]] < indexes[ordered[j]] })
+
+	fullsigs := make([][]byte, len(signatures))
+	for i, signatureIndex := range ordered {
+		if i > 0 && indexes[ordered[i-1]] == indexes[signatureIndex] {
+			return nil, fmt.Errorf(
+				"public key %x signed more than once",
+				signatures[signatureIndex].PublicKey.Bytes,
+			)
+		}
+
+		fullsigs[i] = normalizeSignature(signatures[signatureIndex].Bytes)
+	}
+
+	return fullsigs, nil
+}
+
+// multisigSignatureKeys returns the public keys that produced
+// the signatures of a multisig input. Like OP_CHECKMULTISIG,
+// signatures must be in the order of the public keys in the
+// script.
+func multisigSignatureKeys(
+	script []byte,
+	signatures [][]byte,
+	sigHash func(txscript.SigHashType) ([]byte, error),
+) ([][]byte, error) {
+	publicKeys, _, err := multisigPublicKeys(script)
+	if err != nil {
+		return nil, err
+	}
+
+	signers := [][]byte{}
+	keyIndex := 0
+	for _, fullsig := range signatures {
+		if len(fullsig) == 0 {
+			return nil, errors.New("signature is empty")
+		}
+
+		hashType := txscript.SigHashType(fullsig[len(fullsig)-1])
+		signature, err := btcec.ParseDERSignature(fullsig[:len(fullsig)-1], btcec.S256())
+		if err != nil {
+			return nil, fmt.Errorf("%w unable to parse signature", err)
+		}
+
+		hash, err := sigHash(hashType)
+		if err != nil {
+			return nil, err
+		}
+
+		found := false
+		for ; keyIndex < len(publicKeys) && !found; keyIndex++ {
+			publicKey, err := btcec.ParsePubKey(publicKeys[keyIndex], btcec.S256())
+			if err != nil {
+				continue
+			}
+
+			found = signature.Verify(hash, publicKey)
+			if found {
+				signers = append(signers, publicKeys[keyIndex])
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("signature %x does not match any public key", fullsig)
+		}
+	}
+
+	return signers, nil
+}
+
+// witnessScriptHashScript returns the P2WSH script of a
+// witness script.
+func witnessScriptHashScript(witnessScript []byte) []byte {
+	scriptHash := sha256.Sum256(witnessScript)
+	script, _ := txscript.NewScriptBuilder().
+		AddOp(txscript.OP_0).
+		AddData(scriptHash[:]).
+		Script()
+
+	return script
+}
+
+// witnessScript returns the decoded witness script of
+// utxo i and ensures it hashes to the P2WSH script.
+func witnessScript(i int, hexScript string, script []byte) ([]byte, error) {
+	if len(hexScript) == 0 {
+		return nil, fmt.Errorf("witness script for utxo %d is missing", i)
+	}
+
+	decodedScript, err := hex.DecodeString(hexScript)
+	if err != nil {
+		return nil, fmt.Errorf("%w unable to decode witness script for utxo %d", err, i)
+	}
+
+	if !bytes.Equal(witnessScriptHashScript(decodedScript), script) {
+		return nil, fmt.Errorf("witness script for utxo %d does not match %x", i, script)
+	}
+
+	return decodedScript, nil
+}
+
+// multisigInputWeight returns the estimated weight of an
+// input spending a multisig script (P2WSH if witness,
+// P2SH otherwise).
+func multisigInputWeight(script []byte, witness bool) (int, error) {
+	_, requiredSigs, err := multisigPublicKeys(script)
+	if err != nil {
+		return 0, err
+	}
+
+	// 1 push per signature
+	signaturesSize := requiredSigs * (1 + defichain.SignatureSize)
+	if witness {
+		// 1 item count, 1 dummy item, signatures, witness script
+		witnessSize := 2 + signaturesSize +
+			wire.VarIntSerializeSize(uint64(len(script))) + len(script)
+
+		// empty script sig
+		return defichain.WitnessScaleFactor*(defichain.InputOverhead+1) + witnessSize, nil
+	}
+
+	// OP_0, signatures, redeem script
+	sigScriptSize := 1 + signaturesSize + pushDataSize(len(script)) + len(script)
+
+	return defichain.WitnessScaleFactor * (defichain.InputOverhead +
+		wire.VarIntSerializeSize(uint64(sigScriptSize)) + sigScriptSize), nil
+}
+
+// pushDataSize returns the size of the opcode pushing
+// length bytes of data.
+func pushDataSize(length int) int {
+	switch {
+	case length < txscript.OP_PUSHDATA1:
+		return 1
+	case length <= 0xff: // nolint:gomnd
+		return 2 // nolint:gomnd
+	default:
+		return 3 // nolint:gomnd
+	}
+}
+
+// publicKeyIndex returns the index of a public key
+// or -1 if it is not found.
+func publicKeyIndex(publicKeys [][]byte, publicKey []byte) int {
+	for i, key := range publicKeys {
+		if bytes.Equal(key, publicKey) {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,86 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	multisigKey1 = "0340414284b0f51a3dc8d8bf6f6b1002012b75778f296e935d7493d7cee2a63b83"
+	multisigKey2 = "03d3d13e8180b10dfed0db4db9fb9013a5dcbdab64dff45d16310313c2929e71ac"
+	multisigKey3 = "02f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9"
+)
+
+func TestMultisigSigners(t *testing.T) {
+	// OP_2 <key1> <key2> <key3> OP_3 OP_CHECKMULTISIG
+	script := forceHexDecode(
+		t,
+		"52"+"21"+multisigKey1+"21"+multisigKey2+"21"+multisigKey3+"53"+"ae",
+	)
+
+	tests := map[string]struct {
+		script  []byte
+		signers []string
+
+		expected [][]byte
+		err      string
+	}{
+		"default signers": {
+			script:   script,
+			expected: [][]byte{forceHexDecode(t, multisigKey1), forceHexDecode(t, multisigKey2)},
+		},
+		"signers in script order": {
+			script:   script,
+			signers:  []string{multisigKey3, multisigKey1},
+			expected: [][]byte{forceHexDecode(t, multisigKey1), forceHexDecode(t, multisigKey3)},
+		},
+		"too few signers": {
+			script:  script,
+			signers: []string{multisigKey1},
+			err:     "expected 2 signers but got 1",
+		},
+		"unknown signer": {
+			script:  script,
+			signers: []string{multisigKey1, "02" + multisigKey1[2:64] + "00"},
+			err:     "is not part of the multisig script",
+		},
+		"duplicate signer": {
+			script:  script,
+			signers: []string{multisigKey2, multisigKey2},
+			err:     "is duplicated",
+		},
+		"not multisig": {
+			script: forceHexDecode(t, "0014aed288d81bae3c93cbcb211ea3a7b5e75de13444"),
+			err:    "is not a multisig script",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			signers, err := multisigSigners(test.script, test.signers)
+			if test.err != "" {
+				assert.Nil(t, signers)
+				assert.Contains(t, err.Error(), test.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, signers)
+		})
+	}
+}
@@ -88,6 +88,12 @@ func (s *NetworkAPIService) NetworkOptions(
 	ctx context.Context,
 	request *types.NetworkRequest,
 ) (*types.NetworkOptionsResponse, *types.Error) {
+	// Exemptions of main accounts have no balance exemption.
+	var balanceExemptions []*types.BalanceExemption
+	if exemptions := defichain.BalanceExemptions(s.config.Exemptions); len(exemptions) > 0 {
+		balanceExemptions = exemptions
+	}
+
 	return &types.NetworkOptionsResponse{
 		Version: &types.Version{
 			RosettaVersion:    types.RosettaAPIVersion,
@@ -100,6 +106,8 @@ func (s *NetworkAPIService) NetworkOptions(
 			Errors:                  Errors,
 			HistoricalBalanceLookup: HistoricalBalanceLookup,
 			MempoolCoins:            MempoolCoins,
+			CallMethods:             CallMethods,
+			BalanceExemptions:       balanceExemptions,
 		},
 	}, nil
 }
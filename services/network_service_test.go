@@ -39,6 +39,8 @@ var (
 			OperationTypes:          defichain.OperationTypes,
 			Errors:                  Errors,
 			HistoricalBalanceLookup: HistoricalBalanceLookup,
+			CallMethods:             CallMethods,
+			MempoolCoins:            MempoolCoins,
 		},
 	}
 
@@ -0,0 +1,303 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/DeFiCh/rosetta-defichain/defichain"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/coinbase/rosetta-sdk-go/types"
+)
+
+// checkPolicy ensures a transaction complies with the safety
+// policy of the configuration. inputScripts and inputAmounts
+// (in satoshis) describe the coins spent by the transaction,
+// the outputs from mintingOutputsStart on are minted from
+// account balances and vsize returns its (estimated) virtual
+// size.
+func (s *ConstructionAPIService) checkPolicy(
+	tx *wire.MsgTx,
+	inputScripts [][]byte,
+	inputAmounts []int64,
+	mintingOutputsStart int,
+	vsize func() (int, error),
+) *types.Error {
+	policy := s.config.Policy
+	if policy == nil {
+		return nil
+	}
+
+	if policy.MaxOutputs > 0 && len(tx.TxOut) > policy.MaxOutputs {
+		return wrapErr(ErrPolicyMaxOutputs, fmt.Errorf(
+			"transaction has %d outputs but the max is %d",
+			len(tx.TxOut),
+			policy.MaxOutputs,
+		))
+	}
+
+	allowedScripts, err := s.allowedScripts()
+	if err != nil {
+		return wrapErr(ErrUnableToDecodeAddress, err)
+	}
+
+	for i, output := range tx.TxOut {
+		// The DfTx output of a custom transaction
+		// can't be spent.
+		if txscript.GetScriptClass(output.PkScript) == txscript.NullDataTy {
+			continue
+		}
+
+		if output.Value < policy.DustThreshold {
+			return wrapErr(ErrPolicyDustOutput, fmt.Errorf(
+				"output %d of %d is below the dust threshold %d",
+				i,
+				output.Value,
+				policy.DustThreshold,
+			))
+		}
+
+		if allowedScripts == nil || containsScript(inputScripts, output.PkScript) ||
+			containsScript(allowedScripts, output.PkScript) {
+			continue
+		}
+
+		destination := fmt.Sprintf("%x", output.PkScript)
+		if _, addr, err := defichain.ParseSingleAddress(s.config.Params, output.PkScript); err == nil {
+			destination = addr.EncodeAddress()
+		}
+
+		return wrapErr(
+			ErrPolicyDestination,
+			fmt.Errorf("output %d pays to %s", i, destination),
+		)
+	}
+
+	fee := transactionFee(tx, inputAmounts, mintingOutputsStart)
+	if policy.MaxFee > 0 && fee > policy.MaxFee {
+		return wrapErr(ErrPolicyMaxFee, fmt.Errorf(
+			"fee %d is larger than max fee %d",
+			fee,
+			policy.MaxFee,
+		))
+	}
+
+	if policy.MaxFeeRate > 0 {
+		size, err := vsize()
+		if err != nil {
+			return wrapErr(ErrUnclearIntent, fmt.Errorf("%w unable to estimate vsize", err))
+		}
+
+		// The fee rate is in DFI per kB (like fee_per_kb)
+		feeRate := float64(fee) * bytesInKb / float64(size) / defichain.SatoshisInDFI
+		if feeRate > policy.MaxFeeRate {
+			return wrapErr(ErrPolicyMaxFeeRate, fmt.Errorf(
+				"fee rate %.8f is larger than max fee rate %.8f",
+				feeRate,
+				policy.MaxFeeRate,
+			))
+		}
+	}
+
+	return nil
+}
+
+// checkSignedPolicy ensures a signed transaction
+// complies with the safety policy of the configuration.
+func (s *ConstructionAPIService) checkSignedPolicy(signed *signedTransaction) *types.Error {
+	if s.config.Policy == nil {
+		return nil
+	}
+
+	tx, inputAmounts, err := decodeSignedMsgTx(signed)
+	if err != nil {
+		return wrapErr(ErrUnableToParseIntermediateResult, err)
+	}
+
+	inputScripts := make([][]byte, len(tx.TxIn))
+	for i, input := range tx.TxIn {
+		inputScripts[i], err = computePkScript(input)
+		if err != nil {
+			return wrapErr(
+				ErrUnableToComputePkScript,
+				fmt.Errorf("%w: unable to compute pk script", err),
+			)
+		}
+	}
+
+	mintingStart, err := mintingOutputsStart(tx)
+	if err != nil {
+		return wrapErr(ErrUnableToParseIntermediateResult, err)
+	}
+
+	return s.checkPolicy(tx, inputScripts, inputAmounts, mintingStart, func() (int, error) {
+		return signedVsize(tx), nil
+	})
+}
+
+// decodeSignedMsgTx returns the transaction of a signed
+// transaction and the amounts (in satoshis) of its inputs.
+func decodeSignedMsgTx(signed *signedTransaction) (*wire.MsgTx, []int64, error) {
+	serializedTx, err := hex.DecodeString(signed.Transaction)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w unable to decode hex transaction", err)
+	}
+
+	var tx wire.MsgTx
+	if err := tx.Deserialize(bytes.NewReader(serializedTx)); err != nil {
+		return nil, nil, fmt.Errorf("%w unable to decode msgTx", err)
+	}
+
+	if len(signed.InputAmounts) != len(tx.TxIn) {
+		return nil, nil, fmt.Errorf("expected %d input amounts", len(tx.TxIn))
+	}
+
+	inputAmounts := make([]int64, len(tx.TxIn))
+	for i, inputAmount := range signed.InputAmounts {
+		amount, err := strconv.ParseInt(inputAmount, 10, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w unable to parse input amount %s", err, inputAmount)
+		}
+
+		if amount < 0 {
+			amount = -amount
+		}
+		inputAmounts[i] = amount
+	}
+
+	return &tx, inputAmounts, nil
+}
+
+// transactionFee returns the fee (in satoshis) of a
+// transaction spending inputAmounts. The outputs from
+// mintingOutputsStart on are paid from account balances
+// (not the inputs), so they don't reduce the fee.
+func transactionFee(tx *wire.MsgTx, inputAmounts []int64, mintingOutputsStart int) int64 {
+	fee := int64(0)
+	for _, amount := range inputAmounts {
+		fee += amount
+	}
+
+	for i, output := range tx.TxOut {
+		if i >= mintingOutputsStart {
+			break
+		}
+
+		fee -= output.Value
+	}
+
+	return fee
+}
+
+// mintingOutputsStart returns the index of the first output
+// minted by the AccountToUtxos DfTx of a transaction (the
+// number of outputs if it doesn't mint any).
+func mintingOutputsStart(tx *wire.MsgTx) (int, error) {
+	for _, output := range tx.TxOut {
+		customTx, err := defichain.DecodeCustomTx(output.PkScript)
+		if errors.Is(err, defichain.ErrNotCustomTx) {
+			continue
+		}
+		if err != nil {
+			return -1, fmt.Errorf("%w: unable to decode custom transaction", err)
+		}
+
+		if message, ok := customTx.Message.(*defichain.AccountToUtxosMessage); ok {
+			return int(message.MintingOutputsStart), nil
+		}
+
+		break
+	}
+
+	return len(tx.TxOut), nil
+}
+
+// allowedScripts returns the scripts of the allowed
+// destinations of the policy or nil if all
+// destinations are allowed.
+func (s *ConstructionAPIService) allowedScripts() ([][]byte, error) {
+	if len(s.config.Policy.AllowedDestinations) == 0 {
+		return nil, nil
+	}
+
+	scripts := make([][]byte, len(s.config.Policy.AllowedDestinations))
+	for i, address := range s.config.Policy.AllowedDestinations {
+		addr, err := btcutil.DecodeAddress(address, s.config.Params)
+		if err != nil {
+			return nil, fmt.Errorf("%w unable to decode address %s", err, address)
+		}
+
+		scripts[i], err = txscript.PayToAddrScript(addr)
+		if err != nil {
+			return nil, fmt.Errorf("%w unable to construct payToAddrScript", err)
+		}
+	}
+
+	return scripts, nil
+}
+
+// containsScript returns whether script is
+// one of scripts.
+func containsScript(scripts [][]byte, script []byte) bool {
+	for _, s := range scripts {
+		if bytes.Equal(s, script) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// unsignedVsize returns the estimated virtual size of an
+// unsigned transaction once its inputs are signed.
+func (s *ConstructionAPIService) unsignedVsize(
+	tx *wire.MsgTx,
+	inputs []*types.Operation,
+) (int, error) {
+	weight := defichain.WitnessScaleFactor * tx.SerializeSizeStripped()
+	witness := false
+	for _, input := range inputs {
+		inputWeight, inputWitness, err := s.inputWeight(input)
+		if err != nil {
+			return 0, err
+		}
+
+		// The unsigned input is already counted with
+		// an empty script sig.
+		weight += inputWeight - defichain.WitnessScaleFactor*(defichain.InputOverhead+1)
+		witness = witness || inputWitness
+	}
+
+	if witness {
+		weight += defichain.SegwitFlagWeight
+	}
+
+	return vsize(weight), nil
+}
+
+// signedVsize returns the virtual size of a
+// signed transaction.
+func signedVsize(tx *wire.MsgTx) int {
+	return vsize(
+		(defichain.WitnessScaleFactor-1)*tx.SerializeSizeStripped() + tx.SerializeSize(),
+	)
+}
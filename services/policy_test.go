@@ -0,0 +1,317 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/DeFiCh/rosetta-defichain/configuration"
+	"github.com/DeFiCh/rosetta-defichain/defichain"
+	mocks "github.com/DeFiCh/rosetta-defichain/mocks/services"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckPolicy(t *testing.T) {
+	inputScript := forceHexDecode(t, "001467f6e448a386c2032b1a6fe95ec759654566c42e")
+	allowedScript := forceHexDecode(t, "0014d88413b340d04dd9f19dc92a5c6836c6c6c69b8d")
+	otherScript := forceHexDecode(t, "00141d439fad544d8fa2b15048dc60f96bdfa4433c24")
+	nullDataScript := forceHexDecode(t, "6a0444665478")
+
+	// 1,000,000 in, 990,000 out (fee 10,000)
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(0, nullDataScript))
+	tx.AddTxOut(wire.NewTxOut(600000, allowedScript))
+	tx.AddTxOut(wire.NewTxOut(390000, inputScript))
+
+	withOther := tx.Copy()
+	withOther.TxOut[1].PkScript = otherScript
+
+	withDust := tx.Copy()
+	withDust.TxOut[1].Value = 500
+	withDust.TxOut[2].Value = 989500
+
+	// 1,000,000 in, 900,000 out (fee 100,000) and 200,000
+	// minted from the account balance of the input script
+	accountToUtxos, err := defichain.EncodeCustomTx(&defichain.CustomTx{
+		Type: defichain.CustomTxAccountToUtxos,
+		Message: &defichain.AccountToUtxosMessage{
+			From:                "001467f6e448a386c2032b1a6fe95ec759654566c42e",
+			Balances:            []*defichain.TokenAmount{{TokenID: 0, Amount: 200000}},
+			MintingOutputsStart: 2,
+		},
+	})
+	assert.NoError(t, err)
+
+	withMinted := wire.NewMsgTx(wire.TxVersion)
+	withMinted.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, nil, nil))
+	withMinted.AddTxOut(wire.NewTxOut(0, accountToUtxos))
+	withMinted.AddTxOut(wire.NewTxOut(900000, inputScript))
+	withMinted.AddTxOut(wire.NewTxOut(200000, inputScript))
+
+	vsize := func() (int, error) { return 250, nil }
+	tests := map[string]struct {
+		policy *configuration.PolicyConfiguration
+		tx     *wire.MsgTx
+		vsize  func() (int, error)
+
+		err *types.Error
+	}{
+		"no policy": {
+			tx: withDust,
+		},
+		"within policy": {
+			policy: &configuration.PolicyConfiguration{
+				MaxFee:              10000,
+				MaxFeeRate:          0.0004,
+				DustThreshold:       546,
+				MaxOutputs:          3,
+				AllowedDestinations: []string{"tf1qmzzp8v6q6pxanuvaey49c6pkcmrvdxudun0v8j"},
+			},
+			tx: tx,
+		},
+		"too many outputs": {
+			policy: &configuration.PolicyConfiguration{MaxOutputs: 2},
+			tx:     tx,
+			err:    ErrPolicyMaxOutputs,
+		},
+		"dust output": {
+			policy: &configuration.PolicyConfiguration{DustThreshold: 546},
+			tx:     withDust,
+			err:    ErrPolicyDustOutput,
+		},
+		"destination not allowed": {
+			policy: &configuration.PolicyConfiguration{
+				AllowedDestinations: []string{"tf1qmzzp8v6q6pxanuvaey49c6pkcmrvdxudun0v8j"},
+			},
+			tx:  withOther,
+			err: ErrPolicyDestination,
+		},
+		"fee above max fee": {
+			policy: &configuration.PolicyConfiguration{MaxFee: 9999},
+			tx:     tx,
+			err:    ErrPolicyMaxFee,
+		},
+		"minted outputs within max fee": {
+			policy: &configuration.PolicyConfiguration{MaxFee: 100000},
+			tx:     withMinted,
+		},
+		"minted outputs above max fee": {
+			policy: &configuration.PolicyConfiguration{MaxFee: 99999},
+			tx:     withMinted,
+			err:    ErrPolicyMaxFee,
+		},
+		"fee rate above max fee rate": {
+			policy: &configuration.PolicyConfiguration{MaxFeeRate: 0.00039},
+			tx:     tx,
+			err:    ErrPolicyMaxFeeRate,
+		},
+		"unable to estimate vsize": {
+			policy: &configuration.PolicyConfiguration{MaxFeeRate: 0.001},
+			tx:     tx,
+			vsize:  func() (int, error) { return 0, errors.New("unknown input") },
+			err:    ErrUnclearIntent,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			servicer := &ConstructionAPIService{
+				config: &configuration.Configuration{
+					Params: defichain.TestnetParams,
+					Policy: test.policy,
+				},
+			}
+
+			if test.vsize == nil {
+				test.vsize = vsize
+			}
+
+			mintingStart, err := mintingOutputsStart(test.tx)
+			assert.NoError(t, err)
+
+			rErr := servicer.checkPolicy(
+				test.tx,
+				[][]byte{inputScript},
+				[]int64{1000000},
+				mintingStart,
+				test.vsize,
+			)
+			if test.err == nil {
+				assert.Nil(t, rErr)
+				return
+			}
+
+			assert.Equal(t, test.err.Code, rErr.Code)
+		})
+	}
+}
+
+func TestConstructionService_Policy(t *testing.T) {
+	networkIdentifier = &types.NetworkIdentifier{
+		Network:    defichain.TestnetNetwork,
+		Blockchain: defichain.Blockchain,
+	}
+
+	cfg := &configuration.Configuration{
+		Mode:     configuration.Online,
+		Network:  networkIdentifier,
+		Params:   defichain.TestnetParams,
+		Currency: defichain.TestnetCurrency,
+		Policy:   &configuration.PolicyConfiguration{},
+	}
+
+	mockClient := &mocks.Client{}
+	servicer := NewConstructionAPIService(cfg, mockClient, &mocks.Indexer{})
+	ctx := context.Background()
+
+	privKey, pubKey := btcec.PrivKeyFromBytes(btcec.S256(), forceHexDecode(
+		t,
+		"8f0a8b1a9f0f9e2a7f3c5b6d4e1a2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c",
+	))
+	segwitAddress := "tf1qvlmwgj9rsmpqx2c6dl54a36ev4zkd3pw3ufh4c"
+
+	// 100,000,000 in, 90,000,000 out (fee 10,000,000)
+	ops := []*types.Operation{
+		{
+			OperationIdentifier: &types.OperationIdentifier{Index: 0},
+			Type:                defichain.InputOpType,
+			Account:             &types.AccountIdentifier{Address: segwitAddress},
+			Amount: &types.Amount{
+				Value:    "-100000000",
+				Currency: defichain.TestnetCurrency,
+			},
+			CoinChange: &types.CoinChange{
+				CoinIdentifier: &types.CoinIdentifier{
+					Identifier: strings.Repeat("11", 32) + ":0",
+				},
+				CoinAction: types.CoinSpent,
+			},
+		},
+		{
+			OperationIdentifier: &types.OperationIdentifier{Index: 1},
+			Type:                defichain.OutputOpType,
+			Account: &types.AccountIdentifier{
+				Address: "tf1qmzzp8v6q6pxanuvaey49c6pkcmrvdxudun0v8j",
+			},
+			Amount: &types.Amount{
+				Value:    "90000000",
+				Currency: defichain.TestnetCurrency,
+			},
+		},
+	}
+	metadata := forceMarshalMap(t, &constructionMetadata{
+		ScriptPubKeys: []*defichain.ScriptPubKey{
+			{Hex: "001467f6e448a386c2032b1a6fe95ec759654566c42e"},
+		},
+		FeePerKB: defichain.MinFeeRate,
+	})
+
+	payloadsResponse, rErr := servicer.ConstructionPayloads(ctx, &types.ConstructionPayloadsRequest{
+		NetworkIdentifier: networkIdentifier,
+		Operations:        ops,
+		Metadata:          metadata,
+	})
+	assert.Nil(t, rErr)
+
+	combineResponse, rErr := servicer.ConstructionCombine(ctx, &types.ConstructionCombineRequest{
+		NetworkIdentifier:   networkIdentifier,
+		UnsignedTransaction: payloadsResponse.UnsignedTransaction,
+		Signatures: []*types.Signature{
+			{
+				Bytes:          signPayload(t, privKey, payloadsResponse.Payloads[0]),
+				SigningPayload: payloadsResponse.Payloads[0],
+				PublicKey: &types.PublicKey{
+					Bytes:     pubKey.SerializeCompressed(),
+					CurveType: types.Secp256k1,
+				},
+				SignatureType: types.Ecdsa,
+			},
+		},
+	})
+	assert.Nil(t, rErr)
+
+	// The fat-fingered fee is rejected when the transaction
+	// is built and when it is submitted
+	cfg.Policy.MaxFee = 1000000
+	payloadsResponse, rErr = servicer.ConstructionPayloads(ctx, &types.ConstructionPayloadsRequest{
+		NetworkIdentifier: networkIdentifier,
+		Operations:        ops,
+		Metadata:          metadata,
+	})
+	assert.Nil(t, payloadsResponse)
+	assert.Equal(t, ErrPolicyMaxFee.Code, rErr.Code)
+
+	submitResponse, rErr := servicer.ConstructionSubmit(ctx, &types.ConstructionSubmitRequest{
+		NetworkIdentifier: networkIdentifier,
+		SignedTransaction: combineResponse.SignedTransaction,
+	})
+	assert.Nil(t, submitResponse)
+	assert.Equal(t, ErrPolicyMaxFee.Code, rErr.Code)
+
+	// The fee rate of the signed transaction (~0.909 DFI/kB)
+	// is computed from its actual vsize
+	cfg.Policy.MaxFee = 0
+	cfg.Policy.MaxFeeRate = 0.9
+	submitResponse, rErr = servicer.ConstructionSubmit(ctx, &types.ConstructionSubmitRequest{
+		NetworkIdentifier: networkIdentifier,
+		SignedTransaction: combineResponse.SignedTransaction,
+	})
+	assert.Nil(t, submitResponse)
+	assert.Equal(t, ErrPolicyMaxFeeRate.Code, rErr.Code)
+
+	cfg.Policy.MaxFeeRate = 0
+	cfg.Policy.AllowedDestinations = []string{segwitAddress}
+	submitResponse, rErr = servicer.ConstructionSubmit(ctx, &types.ConstructionSubmitRequest{
+		NetworkIdentifier: networkIdentifier,
+		SignedTransaction: combineResponse.SignedTransaction,
+	})
+	assert.Nil(t, submitResponse)
+	assert.Equal(t, ErrPolicyDestination.Code, rErr.Code)
+
+	cfg.Policy.AllowedDestinations = []string{"tf1qmzzp8v6q6pxanuvaey49c6pkcmrvdxudun0v8j"}
+	mockClient.On(
+		"SendRawTransaction",
+		ctx,
+		mockSignedTransaction(t, combineResponse.SignedTransaction),
+	).Return(
+		strings.Repeat("22", 32),
+		nil,
+	).Once()
+	submitResponse, rErr = servicer.ConstructionSubmit(ctx, &types.ConstructionSubmitRequest{
+		NetworkIdentifier: networkIdentifier,
+		SignedTransaction: combineResponse.SignedTransaction,
+	})
+	assert.Nil(t, rErr)
+	assert.Equal(t, strings.Repeat("22", 32), submitResponse.TransactionIdentifier.Hash)
+
+	mockClient.AssertExpectations(t)
+}
+
+// mockSignedTransaction returns the serialized transaction
+// of a signed transaction.
+func mockSignedTransaction(t *testing.T, raw string) string {
+	signed, err := decodeSignedTransaction(raw)
+	assert.NoError(t, err)
+
+	return signed.Transaction
+}
@@ -0,0 +1,442 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/DeFiCh/rosetta-defichain/defichain"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil/hdkeychain"
+	"github.com/coinbase/rosetta-sdk-go/types"
+)
+
+// TransactionEncoding is the encoding of the transactions
+// returned by /construction/payloads and /construction/combine.
+type TransactionEncoding string
+
+const (
+	// JSONTransactionEncoding is a hex-encoded JSON object
+	// only readable by rosetta-defichain (default).
+	JSONTransactionEncoding TransactionEncoding = "json"
+
+	// PsbtTransactionEncoding is a base64-encoded partially
+	// signed transaction (BIP174).
+	PsbtTransactionEncoding TransactionEncoding = "psbt"
+)
+
+const (
+	// psbtPrefix is the base64 encoding of the start of
+	// defichain.PsbtMagic. It is never valid hex.
+	psbtPrefix = "cHNidP"
+
+	// psbtIdentifier prefixes the proprietary
+	// PSBT fields of rosetta-defichain.
+	psbtIdentifier = "defi"
+
+	// psbtCurrenciesSubtype is the proprietary global field
+	// holding the token currencies of a custom transaction.
+	psbtCurrenciesSubtype = 0
+)
+
+// DerivationPath is the BIP32 derivation of a public key
+// included in PSBT inputs and outputs. MasterFingerprint is
+// the hex-encoded fingerprint of the master key and Path is
+// in the m/84'/1'/0'/0/0 notation.
+type DerivationPath struct {
+	PublicKey         string `json:"public_key"`
+	MasterFingerprint string `json:"master_fingerprint"`
+	Path              string `json:"path"`
+}
+
+// validEncoding returns an error if a transaction
+// encoding is not supported.
+func validEncoding(encoding TransactionEncoding) error {
+	switch encoding {
+	case "", JSONTransactionEncoding, PsbtTransactionEncoding:
+		return nil
+	default:
+		return fmt.Errorf("%s is not a valid encoding", encoding)
+	}
+}
+
+// isPsbt returns true if a transaction returned by
+// /construction/payloads or /construction/combine
+// is a PSBT.
+func isPsbt(raw string) bool {
+	return strings.HasPrefix(raw, psbtPrefix)
+}
+
+// parseDerivationPaths returns the BIP32 derivations
+// of DerivationPaths.
+func parseDerivationPaths(paths []*DerivationPath) ([]*defichain.Bip32Derivation, error) {
+	derivations := make([]*defichain.Bip32Derivation, len(paths))
+	for i, path := range paths {
+		publicKey, err := hex.DecodeString(path.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("%w unable to decode public key %s", err, path.PublicKey)
+		}
+
+		if _, err := btcec.ParsePubKey(publicKey, btcec.S256()); err != nil {
+			return nil, fmt.Errorf("%w unable to parse public key %s", err, path.PublicKey)
+		}
+
+		fingerprint, err := hex.DecodeString(path.MasterFingerprint)
+		if err != nil || len(fingerprint) != 4 { // nolint:gomnd
+			return nil, fmt.Errorf("%s is not a valid master fingerprint", path.MasterFingerprint)
+		}
+
+		indexes, err := parsePath(path.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		derivations[i] = &defichain.Bip32Derivation{
+			PublicKey:            publicKey,
+			MasterKeyFingerprint: binary.LittleEndian.Uint32(fingerprint),
+			Path:                 indexes,
+		}
+	}
+
+	return derivations, nil
+}
+
+// parsePath returns the indexes of a BIP32 path. Hardened
+// indexes are marked by ', h or H.
+func parsePath(path string) ([]uint32, error) {
+	elements := strings.Split(path, "/")
+	if elements[0] != "m" {
+		return nil, fmt.Errorf("%s is not a valid path", path)
+	}
+
+	indexes := []uint32{}
+	for _, element := range elements[1:] {
+		offset := uint32(0)
+		if trimmed := strings.TrimRight(element, "'hH"); trimmed != element {
+			if len(element)-len(trimmed) != 1 {
+				return nil, fmt.Errorf("%s is not a valid path", path)
+			}
+
+			element, offset = trimmed, hdkeychain.HardenedKeyStart
+		}
+
+		index, err := strconv.ParseUint(element, 10, 32)
+		if err != nil || index >= hdkeychain.HardenedKeyStart {
+			return nil, fmt.Errorf("%s is not a valid path", path)
+		}
+
+		indexes = append(indexes, uint32(index)+offset)
+	}
+
+	return indexes, nil
+}
+
+// encodeUnsignedPsbt returns the base64-encoded PSBT of an
+// unsigned transaction. Every input carries its witness utxo
+// (amount and script), the scripts required to sign it and
+// the SIGHASH_ALL sighash type. The BIP32 derivations of the
+// INPUT and OUTPUT operations are included (outputs without
+// an operation are nil).
+func encodeUnsignedPsbt(
+	tx *wire.MsgTx,
+	unsigned *unsignedTransaction,
+	inputs []*types.Operation,
+	outputs []*types.Operation,
+) (string, error) {
+	packet, err := defichain.NewPsbt(tx)
+	if err != nil {
+		return "", err
+	}
+
+	for i, input := range packet.Inputs {
+		script, err := hex.DecodeString(unsigned.ScriptPubKeys[i].Hex)
+		if err != nil {
+			return "", fmt.Errorf("%w unable to decode script for utxo %d", err, i)
+		}
+
+		amount, err := strconv.ParseInt(unsigned.InputAmounts[i], 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("%w unable to parse amount for utxo %d", err, i)
+		}
+
+		metadata, err := parseInputMetadata(inputs[i])
+		if err != nil {
+			return "", err
+		}
+
+		input.WitnessUtxo = wire.NewTxOut(-amount, script)
+		input.SighashType = txscript.SigHashAll
+		input.Bip32Derivations, err = parseDerivationPaths(metadata.Bip32Derivations)
+		if err != nil {
+			return "", fmt.Errorf("%w: invalid derivation for utxo %d", err, i)
+		}
+
+		if len(metadata.PreviousTransaction) > 0 {
+			input.NonWitnessUtxo, err = previousTransaction(
+				metadata.PreviousTransaction,
+				&tx.TxIn[i].PreviousOutPoint,
+				input.WitnessUtxo,
+			)
+			if err != nil {
+				return "", fmt.Errorf("%w: invalid previous transaction for utxo %d", err, i)
+			}
+		}
+
+		if hexScript := scriptAt(unsigned.RedeemScripts, i); len(hexScript) > 0 {
+			if input.RedeemScript, err = hex.DecodeString(hexScript); err != nil {
+				return "", fmt.Errorf("%w unable to decode redeem script for utxo %d", err, i)
+			}
+		}
+
+		if hexScript := scriptAt(unsigned.WitnessScripts, i); len(hexScript) > 0 {
+			if input.WitnessScript, err = hex.DecodeString(hexScript); err != nil {
+				return "", fmt.Errorf("%w unable to decode witness script for utxo %d", err, i)
+			}
+		}
+	}
+
+	for i, output := range outputs {
+		if output == nil {
+			continue
+		}
+
+		var metadata OutputOperationMetadata
+		if err := types.UnmarshalMap(output.Metadata, &metadata); err != nil {
+			return "", fmt.Errorf("%w unable to parse output metadata", err)
+		}
+
+		packet.Outputs[i].Bip32Derivations, err = parseDerivationPaths(metadata.Bip32Derivations)
+		if err != nil {
+			return "", fmt.Errorf("%w: invalid derivation for output %d", err, i)
+		}
+	}
+
+	if len(unsigned.Currencies) > 0 {
+		currencies, err := json.Marshal(unsigned.Currencies)
+		if err != nil {
+			return "", err
+		}
+
+		packet.Unknowns = append(packet.Unknowns, &defichain.PsbtUnknown{
+			Key:   defichain.ProprietaryKey(psbtIdentifier, psbtCurrenciesSubtype, nil),
+			Value: currencies,
+		})
+	}
+
+	return encodePsbt(packet)
+}
+
+// previousTransaction returns the decoded transaction spent
+// by an input and ensures it matches the witness utxo.
+func previousTransaction(
+	hexTx string,
+	outpoint *wire.OutPoint,
+	utxo *wire.TxOut,
+) (*wire.MsgTx, error) {
+	rawTx, err := hex.DecodeString(hexTx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx wire.MsgTx
+	if err := tx.Deserialize(bytes.NewReader(rawTx)); err != nil {
+		return nil, err
+	}
+
+	if tx.TxHash() != outpoint.Hash || int(outpoint.Index) >= len(tx.TxOut) {
+		return nil, fmt.Errorf("transaction %s does not match %s", tx.TxHash(), outpoint)
+	}
+
+	output := tx.TxOut[outpoint.Index]
+	if output.Value != utxo.Value || !bytes.Equal(output.PkScript, utxo.PkScript) {
+		return nil, fmt.Errorf("output %s does not match the coin", outpoint)
+	}
+
+	return &tx, nil
+}
+
+// decodeUnsignedPsbt returns the PSBT of an unsigned
+// transaction and the unsignedTransaction it carries.
+func (s *ConstructionAPIService) decodeUnsignedPsbt(
+	raw string,
+) (*unsignedTransaction, *defichain.Psbt, error) {
+	packet, err := decodePsbt(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	currencies, err := psbtCurrencies(packet)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var tx bytes.Buffer
+	if err := packet.UnsignedTx.Serialize(&tx); err != nil {
+		return nil, nil, err
+	}
+
+	count := len(packet.Inputs)
+	unsigned := &unsignedTransaction{
+		Transaction:    hex.EncodeToString(tx.Bytes()),
+		ScriptPubKeys:  make([]*defichain.ScriptPubKey, count),
+		InputAmounts:   make([]string, count),
+		InputAddresses: make([]string, count),
+		Currencies:     currencies,
+	}
+	redeemScripts := make([]string, count)
+	witnessScripts := make([]string, count)
+	for i, input := range packet.Inputs {
+		if input.WitnessUtxo == nil {
+			return nil, nil, fmt.Errorf("witness utxo for utxo %d is missing", i)
+		}
+
+		_, addr, err := defichain.ParseSingleAddress(s.config.Params, input.WitnessUtxo.PkScript)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w unable to parse address for utxo %d", err, i)
+		}
+
+		unsigned.ScriptPubKeys[i] = &defichain.ScriptPubKey{
+			Hex: hex.EncodeToString(input.WitnessUtxo.PkScript),
+		}
+		unsigned.InputAmounts[i] = strconv.FormatInt(-input.WitnessUtxo.Value, 10)
+		unsigned.InputAddresses[i] = addr.EncodeAddress()
+		redeemScripts[i] = hex.EncodeToString(input.RedeemScript)
+		witnessScripts[i] = hex.EncodeToString(input.WitnessScript)
+	}
+	unsigned.RedeemScripts = compactScripts(redeemScripts)
+	unsigned.WitnessScripts = compactScripts(witnessScripts)
+
+	return unsigned, packet, nil
+}
+
+// finalizePsbt returns the base64-encoded PSBT of a signed
+// transaction. Like a BIP174 finalizer, the signatures of
+// every input are moved to its final scripts and the fields
+// only needed to sign it are removed.
+func finalizePsbt(packet *defichain.Psbt, tx *wire.MsgTx) (string, error) {
+	for i, input := range packet.Inputs {
+		input.FinalScriptSig, input.FinalScriptWitness = nil, nil
+		if len(tx.TxIn[i].SignatureScript) > 0 {
+			input.FinalScriptSig = tx.TxIn[i].SignatureScript
+		}
+		if len(tx.TxIn[i].Witness) > 0 {
+			input.FinalScriptWitness = tx.TxIn[i].Witness
+		}
+		if input.FinalScriptSig == nil && input.FinalScriptWitness == nil {
+			return "", fmt.Errorf("utxo %d is not signed", i)
+		}
+
+		input.PartialSigs = nil
+		input.SighashType = 0
+		input.RedeemScript = nil
+		input.WitnessScript = nil
+		input.Bip32Derivations = nil
+	}
+
+	return encodePsbt(packet)
+}
+
+// decodeSignedPsbt returns the signedTransaction
+// carried by the PSBT of a signed transaction.
+func decodeSignedPsbt(raw string) (*signedTransaction, error) {
+	packet, err := decodePsbt(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := packet.Extract()
+	if err != nil {
+		return nil, err
+	}
+
+	currencies, err := psbtCurrencies(packet)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := tx.Serialize(&buf); err != nil {
+		return nil, err
+	}
+
+	signed := &signedTransaction{
+		Transaction:  hex.EncodeToString(buf.Bytes()),
+		InputAmounts: make([]string, len(packet.Inputs)),
+		Currencies:   currencies,
+	}
+	for i, input := range packet.Inputs {
+		if input.WitnessUtxo == nil {
+			return nil, fmt.Errorf("witness utxo for utxo %d is missing", i)
+		}
+
+		signed.InputAmounts[i] = strconv.FormatInt(-input.WitnessUtxo.Value, 10)
+	}
+
+	return signed, nil
+}
+
+// psbtCurrencies returns the token currencies
+// stored in a PSBT.
+func psbtCurrencies(packet *defichain.Psbt) ([]*types.Currency, error) {
+	value := packet.Unknown(defichain.ProprietaryKey(psbtIdentifier, psbtCurrenciesSubtype, nil))
+	if value == nil {
+		return nil, nil
+	}
+
+	var currencies []*types.Currency
+	if err := json.Unmarshal(value, &currencies); err != nil {
+		return nil, fmt.Errorf("%w unable to unmarshal currencies", err)
+	}
+
+	return currencies, nil
+}
+
+func encodePsbt(packet *defichain.Psbt) (string, error) {
+	b, err := defichain.EncodePsbt(packet)
+	if err != nil {
+		return "", fmt.Errorf("%w unable to encode psbt", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+func decodePsbt(raw string) (*defichain.Psbt, error) {
+	b, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w psbt cannot be decoded", err)
+	}
+
+	packet, err := defichain.DecodePsbt(b)
+	if err != nil {
+		return nil, fmt.Errorf("%w unable to decode psbt", err)
+	}
+
+	if len(packet.Inputs) == 0 {
+		return nil, errors.New("psbt has no inputs")
+	}
+
+	return packet, nil
+}
@@ -0,0 +1,540 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/DeFiCh/rosetta-defichain/configuration"
+	"github.com/DeFiCh/rosetta-defichain/defichain"
+	mocks "github.com/DeFiCh/rosetta-defichain/mocks/services"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDerivationPaths(t *testing.T) {
+	_, pubKey := btcec.PrivKeyFromBytes(btcec.S256(), forceHexDecode(
+		t,
+		"8f0a8b1a9f0f9e2a7f3c5b6d4e1a2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c",
+	))
+	publicKey := hex.EncodeToString(pubKey.SerializeCompressed())
+
+	var tests = map[string]struct {
+		path *DerivationPath
+
+		derivation *defichain.Bip32Derivation
+		err        error
+	}{
+		"valid": {
+			path: &DerivationPath{
+				PublicKey:         publicKey,
+				MasterFingerprint: "d34db33f",
+				Path:              "m/84'/1h/0H/0/7",
+			},
+			derivation: &defichain.Bip32Derivation{
+				PublicKey:            forceHexDecode(t, publicKey),
+				MasterKeyFingerprint: 0x3fb34dd3,
+				Path:                 []uint32{0x80000054, 0x80000001, 0x80000000, 0, 7},
+			},
+		},
+		"master key": {
+			path: &DerivationPath{
+				PublicKey:         publicKey,
+				MasterFingerprint: "00000000",
+				Path:              "m",
+			},
+			derivation: &defichain.Bip32Derivation{
+				PublicKey: forceHexDecode(t, publicKey),
+				Path:      []uint32{},
+			},
+		},
+		"invalid public key": {
+			path: &DerivationPath{
+				PublicKey:         "02" + strings.Repeat("00", 32),
+				MasterFingerprint: "d34db33f",
+				Path:              "m/0",
+			},
+			err: errors.New(
+				"invalid square root unable to parse public key 02" + strings.Repeat("00", 32),
+			),
+		},
+		"invalid fingerprint": {
+			path: &DerivationPath{
+				PublicKey:         publicKey,
+				MasterFingerprint: "d34db3",
+				Path:              "m/0",
+			},
+			err: errors.New("d34db3 is not a valid master fingerprint"),
+		},
+		"relative path": {
+			path: &DerivationPath{
+				PublicKey:         publicKey,
+				MasterFingerprint: "d34db33f",
+				Path:              "84'/0",
+			},
+			err: errors.New("84'/0 is not a valid path"),
+		},
+		"invalid hardened index": {
+			path: &DerivationPath{
+				PublicKey:         publicKey,
+				MasterFingerprint: "d34db33f",
+				Path:              "m/84''",
+			},
+			err: errors.New("m/84'' is not a valid path"),
+		},
+		"index out of range": {
+			path: &DerivationPath{
+				PublicKey:         publicKey,
+				MasterFingerprint: "d34db33f",
+				Path:              "m/2147483648",
+			},
+			err: errors.New("m/2147483648 is not a valid path"),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			derivations, err := parseDerivationPaths([]*DerivationPath{test.path})
+			if test.err != nil {
+				assert.EqualError(t, err, test.err.Error())
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, []*defichain.Bip32Derivation{test.derivation}, derivations)
+		})
+	}
+}
+
+func TestUnsignedPsbt(t *testing.T) {
+	cfg := &configuration.Configuration{
+		Mode:     configuration.Offline,
+		Params:   defichain.TestnetParams,
+		Currency: defichain.TestnetCurrency,
+	}
+	servicer := NewConstructionAPIService(cfg, &mocks.Client{}, &mocks.Indexer{})
+
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 1}, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(1000, forceHexDecode(t, "001467f6e448a386c2032b1a6fe95ec759654566c42e")))
+	_, pubKey := btcec.PrivKeyFromBytes(btcec.S256(), forceHexDecode(
+		t,
+		"8f0a8b1a9f0f9e2a7f3c5b6d4e1a2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c",
+	))
+	witnessScript := "5121" + hex.EncodeToString(pubKey.SerializeCompressed()) + "51ae"
+	scriptHash := sha256.Sum256(forceHexDecode(t, witnessScript))
+	unsigned := &unsignedTransaction{
+		ScriptPubKeys: []*defichain.ScriptPubKey{
+			{Hex: "0020" + hex.EncodeToString(scriptHash[:])},
+		},
+		InputAmounts:   []string{"-5000"},
+		InputAddresses: []string{"unused"},
+		WitnessScripts: []string{witnessScript},
+		Currencies: []*types.Currency{
+			{
+				Symbol:   "BTC",
+				Decimals: 8,
+				Metadata: map[string]interface{}{"token_id": float64(2)},
+			},
+		},
+	}
+
+	raw, err := encodeUnsignedPsbt(
+		tx,
+		unsigned,
+		[]*types.Operation{{}},
+		[]*types.Operation{nil},
+	)
+	assert.NoError(t, err)
+	assert.True(t, isPsbt(raw))
+
+	decoded, packet, err := servicer.(*ConstructionAPIService).decodeUnsignedPsbt(raw)
+	assert.NoError(t, err)
+	assert.Equal(t, unsigned.ScriptPubKeys, decoded.ScriptPubKeys)
+	assert.Equal(t, unsigned.InputAmounts, decoded.InputAmounts)
+	assert.Nil(t, decoded.RedeemScripts)
+	assert.Equal(t, unsigned.WitnessScripts, decoded.WitnessScripts)
+	assert.Equal(t, unsigned.Currencies, decoded.Currencies)
+	assert.Len(t, decoded.InputAddresses, 1)
+	assert.True(t, strings.HasPrefix(decoded.InputAddresses[0], "tf1q"))
+	assert.Equal(t, txscript.SigHashAll, packet.Inputs[0].SighashType)
+
+	// Signed PSBTs must be finalized
+	_, err = decodeSignedPsbt(raw)
+	assert.EqualError(t, err, "input 0 is not finalized")
+
+	// A PSBT must be valid base64
+	_, _, err = servicer.(*ConstructionAPIService).decodeUnsignedPsbt(psbtPrefix + "!")
+	assert.Error(t, err)
+}
+
+func TestConstructionService_Psbt(t *testing.T) {
+	networkIdentifier = &types.NetworkIdentifier{
+		Network:    defichain.TestnetNetwork,
+		Blockchain: defichain.Blockchain,
+	}
+
+	cfg := &configuration.Configuration{
+		Mode:     configuration.Online,
+		Network:  networkIdentifier,
+		Params:   defichain.TestnetParams,
+		Currency: defichain.TestnetCurrency,
+	}
+
+	mockIndexer := &mocks.Indexer{}
+	mockClient := &mocks.Client{}
+	servicer := NewConstructionAPIService(cfg, mockClient, mockIndexer)
+	ctx := context.Background()
+
+	privKey, pubKey := btcec.PrivKeyFromBytes(btcec.S256(), forceHexDecode(
+		t,
+		"8f0a8b1a9f0f9e2a7f3c5b6d4e1a2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c",
+	))
+	publicKey := &types.PublicKey{
+		Bytes:     pubKey.SerializeCompressed(),
+		CurveType: types.Secp256k1,
+	}
+	hexPublicKey := hex.EncodeToString(publicKey.Bytes)
+	legacyAddress := "7CYm8j6Jphjf6ghZHtsNfroacCgVdPZF3D"
+	legacyScript := "76a91467f6e448a386c2032b1a6fe95ec759654566c42e88ac"
+	segwitAddress := "tf1qvlmwgj9rsmpqx2c6dl54a36ev4zkd3pw3ufh4c"
+	segwitScript := "001467f6e448a386c2032b1a6fe95ec759654566c42e"
+
+	// The transaction creating the legacy coin
+	previousTx := wire.NewMsgTx(wire.TxVersion)
+	previousTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, []byte{txscript.OP_TRUE}, nil))
+	previousTx.AddTxOut(wire.NewTxOut(100000000, forceHexDecode(t, legacyScript)))
+	var previousBuf bytes.Buffer
+	assert.NoError(t, previousTx.Serialize(&previousBuf))
+
+	derivation := func(path string) []*DerivationPath {
+		return []*DerivationPath{
+			{PublicKey: hexPublicKey, MasterFingerprint: "d34db33f", Path: path},
+		}
+	}
+	ops := []*types.Operation{
+		{
+			OperationIdentifier: &types.OperationIdentifier{
+				Index: 0,
+			},
+			Type: defichain.InputOpType,
+			Account: &types.AccountIdentifier{
+				Address: legacyAddress,
+			},
+			Amount: &types.Amount{
+				Value:    "-100000000",
+				Currency: defichain.TestnetCurrency,
+			},
+			CoinChange: &types.CoinChange{
+				CoinIdentifier: &types.CoinIdentifier{
+					Identifier: previousTx.TxHash().String() + ":0",
+				},
+				CoinAction: types.CoinSpent,
+			},
+			Metadata: forceMarshalMap(t, &InputOperationMetadata{
+				Bip32Derivations:    derivation("m/44'/1'/0'/0/0"),
+				PreviousTransaction: hex.EncodeToString(previousBuf.Bytes()),
+			}),
+		},
+		{
+			OperationIdentifier: &types.OperationIdentifier{
+				Index: 1,
+			},
+			Type: defichain.InputOpType,
+			Account: &types.AccountIdentifier{
+				Address: segwitAddress,
+			},
+			Amount: &types.Amount{
+				Value:    "-50000000",
+				Currency: defichain.TestnetCurrency,
+			},
+			CoinChange: &types.CoinChange{
+				CoinIdentifier: &types.CoinIdentifier{
+					Identifier: "d435e59999faffb36890651bd0cfd9795bb06bfe96d5ce62f1acd9cc1ce12a37:1",
+				},
+				CoinAction: types.CoinSpent,
+			},
+			Metadata: forceMarshalMap(t, &InputOperationMetadata{
+				Bip32Derivations: derivation("m/84'/1'/0'/0/0"),
+			}),
+		},
+		{
+			OperationIdentifier: &types.OperationIdentifier{
+				Index: 2,
+			},
+			Type: defichain.OutputOpType,
+			Account: &types.AccountIdentifier{
+				Address: segwitAddress,
+			},
+			Amount: &types.Amount{
+				Value:    "149990000",
+				Currency: defichain.TestnetCurrency,
+			},
+			Metadata: forceMarshalMap(t, &OutputOperationMetadata{
+				Bip32Derivations: derivation("m/84'/1'/0'/1/0"),
+			}),
+		},
+	}
+
+	// Preprocess
+	preprocessResponse, err := servicer.ConstructionPreprocess(
+		ctx,
+		&types.ConstructionPreprocessRequest{
+			NetworkIdentifier: networkIdentifier,
+			Operations:        ops,
+			Metadata:          forceMarshalMap(t, &PreprocessMetadata{Encoding: PsbtTransactionEncoding}),
+		},
+	)
+	assert.Nil(t, err)
+	var options preprocessOptions
+	assert.NoError(t, types.UnmarshalMap(preprocessResponse.Options, &options))
+	assert.Equal(t, PsbtTransactionEncoding, options.Encoding)
+
+	_, err = servicer.ConstructionPreprocess(
+		ctx,
+		&types.ConstructionPreprocessRequest{
+			NetworkIdentifier: networkIdentifier,
+			Operations:        ops,
+			Metadata: forceMarshalMap(t, &PreprocessMetadata{
+				Encoding: TransactionEncoding("base58"),
+			}),
+		},
+	)
+	assert.Equal(t, ErrUnclearIntent.Code, err.Code)
+
+	// Payloads (the JSON encoding signs the same transaction)
+	metadata := &constructionMetadata{
+		ScriptPubKeys: []*defichain.ScriptPubKey{
+			{Hex: legacyScript, Addresses: []string{legacyAddress}},
+			{Hex: segwitScript, Addresses: []string{segwitAddress}},
+		},
+		Encoding: PsbtTransactionEncoding,
+	}
+	payloadsResponse, err := servicer.ConstructionPayloads(ctx, &types.ConstructionPayloadsRequest{
+		NetworkIdentifier: networkIdentifier,
+		Operations:        ops,
+		Metadata:          forceMarshalMap(t, metadata),
+	})
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(payloadsResponse.UnsignedTransaction, "cHNidP8B"))
+
+	metadata.Encoding = ""
+	jsonPayloadsResponse, err := servicer.ConstructionPayloads(ctx, &types.ConstructionPayloadsRequest{
+		NetworkIdentifier: networkIdentifier,
+		Operations:        ops,
+		Metadata:          forceMarshalMap(t, metadata),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, jsonPayloadsResponse.Payloads, payloadsResponse.Payloads)
+
+	// The PSBT carries everything required to sign it
+	rawPsbt, decodeErr := base64.StdEncoding.DecodeString(payloadsResponse.UnsignedTransaction)
+	assert.NoError(t, decodeErr)
+	packet, decodeErr := defichain.DecodePsbt(rawPsbt)
+	assert.NoError(t, decodeErr)
+	assert.Equal(t, wire.NewTxOut(100000000, forceHexDecode(t, legacyScript)), packet.Inputs[0].WitnessUtxo)
+	assert.Equal(t, previousTx.TxHash(), packet.Inputs[0].NonWitnessUtxo.TxHash())
+	assert.Equal(t, wire.NewTxOut(50000000, forceHexDecode(t, segwitScript)), packet.Inputs[1].WitnessUtxo)
+	assert.Nil(t, packet.Inputs[1].NonWitnessUtxo)
+	for _, input := range packet.Inputs {
+		assert.Equal(t, txscript.SigHashAll, input.SighashType)
+		assert.Len(t, input.Bip32Derivations, 1)
+	}
+	assert.Equal(t, &defichain.Bip32Derivation{
+		PublicKey:            publicKey.Bytes,
+		MasterKeyFingerprint: 0x3fb34dd3,
+		Path:                 []uint32{0x80000054, 0x80000001, 0x80000000, 1, 0},
+	}, packet.Outputs[0].Bip32Derivations[0])
+
+	// The payload of each input can be computed from the PSBT
+	sigHashes := txscript.NewTxSigHashes(packet.UnsignedTx)
+	legacyHash, hashErr := txscript.CalcSignatureHash(
+		packet.Inputs[0].WitnessUtxo.PkScript,
+		packet.Inputs[0].SighashType,
+		packet.UnsignedTx,
+		0,
+	)
+	assert.NoError(t, hashErr)
+	assert.Equal(t, legacyHash, payloadsResponse.Payloads[0].Bytes)
+	segwitHash, hashErr := txscript.CalcWitnessSigHash(
+		packet.Inputs[1].WitnessUtxo.PkScript,
+		sigHashes,
+		packet.Inputs[1].SighashType,
+		packet.UnsignedTx,
+		1,
+		packet.Inputs[1].WitnessUtxo.Value,
+	)
+	assert.NoError(t, hashErr)
+	assert.Equal(t, segwitHash, payloadsResponse.Payloads[1].Bytes)
+
+	// Parse Unsigned
+	parseUnsignedResponse, err := servicer.ConstructionParse(ctx, &types.ConstructionParseRequest{
+		NetworkIdentifier: networkIdentifier,
+		Signed:            false,
+		Transaction:       payloadsResponse.UnsignedTransaction,
+	})
+	assert.Nil(t, err)
+	jsonParseUnsignedResponse, err := servicer.ConstructionParse(ctx, &types.ConstructionParseRequest{
+		NetworkIdentifier: networkIdentifier,
+		Signed:            false,
+		Transaction:       jsonPayloadsResponse.UnsignedTransaction,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, jsonParseUnsignedResponse, parseUnsignedResponse)
+
+	// Combine
+	signatures := make([]*types.Signature, len(payloadsResponse.Payloads))
+	for i, payload := range payloadsResponse.Payloads {
+		signatures[i] = &types.Signature{
+			Bytes:          signPayload(t, privKey, payload),
+			SigningPayload: payload,
+			PublicKey:      publicKey,
+			SignatureType:  types.Ecdsa,
+		}
+	}
+	combineResponse, err := servicer.ConstructionCombine(ctx, &types.ConstructionCombineRequest{
+		NetworkIdentifier:   networkIdentifier,
+		UnsignedTransaction: payloadsResponse.UnsignedTransaction,
+		Signatures:          signatures,
+	})
+	assert.Nil(t, err)
+	assert.True(t, isPsbt(combineResponse.SignedTransaction))
+	jsonCombineResponse, err := servicer.ConstructionCombine(ctx, &types.ConstructionCombineRequest{
+		NetworkIdentifier:   networkIdentifier,
+		UnsignedTransaction: jsonPayloadsResponse.UnsignedTransaction,
+		Signatures:          signatures,
+	})
+	assert.Nil(t, err)
+
+	// The PSBT is finalized and the extracted
+	// transaction passes script validation
+	rawPsbt, decodeErr = base64.StdEncoding.DecodeString(combineResponse.SignedTransaction)
+	assert.NoError(t, decodeErr)
+	packet, decodeErr = defichain.DecodePsbt(rawPsbt)
+	assert.NoError(t, decodeErr)
+	assert.NotEmpty(t, packet.Inputs[0].FinalScriptSig)
+	assert.Nil(t, packet.Inputs[0].FinalScriptWitness)
+	assert.Nil(t, packet.Inputs[1].FinalScriptSig)
+	assert.Len(t, packet.Inputs[1].FinalScriptWitness, 2)
+	for _, input := range packet.Inputs {
+		assert.NotNil(t, input.WitnessUtxo)
+		assert.Zero(t, input.SighashType)
+		assert.Nil(t, input.Bip32Derivations)
+	}
+
+	tx, extractErr := packet.Extract()
+	assert.NoError(t, extractErr)
+	sigHashes = txscript.NewTxSigHashes(tx)
+	for i, input := range packet.Inputs {
+		vm, err := txscript.NewEngine(
+			input.WitnessUtxo.PkScript,
+			tx,
+			i,
+			txscript.StandardVerifyFlags,
+			nil,
+			sigHashes,
+			input.WitnessUtxo.Value,
+		)
+		assert.NoError(t, err)
+		assert.NoError(t, vm.Execute())
+	}
+
+	var signed signedTransaction
+	assert.NoError(t, json.Unmarshal(
+		forceHexDecode(t, jsonCombineResponse.SignedTransaction),
+		&signed,
+	))
+	var buf bytes.Buffer
+	assert.NoError(t, tx.Serialize(&buf))
+	assert.Equal(t, signed.Transaction, hex.EncodeToString(buf.Bytes()))
+
+	// Parse Signed
+	parseSignedResponse, err := servicer.ConstructionParse(ctx, &types.ConstructionParseRequest{
+		NetworkIdentifier: networkIdentifier,
+		Signed:            true,
+		Transaction:       combineResponse.SignedTransaction,
+	})
+	assert.Nil(t, err)
+	jsonParseSignedResponse, err := servicer.ConstructionParse(ctx, &types.ConstructionParseRequest{
+		NetworkIdentifier: networkIdentifier,
+		Signed:            true,
+		Transaction:       jsonCombineResponse.SignedTransaction,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, jsonParseSignedResponse, parseSignedResponse)
+	assert.Equal(t, []*types.AccountIdentifier{
+		{Address: legacyAddress},
+		{Address: segwitAddress},
+	}, parseSignedResponse.AccountIdentifierSigners)
+
+	// Hash
+	hashResponse, err := servicer.ConstructionHash(ctx, &types.ConstructionHashRequest{
+		NetworkIdentifier: networkIdentifier,
+		SignedTransaction: combineResponse.SignedTransaction,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, tx.TxHash().String(), hashResponse.TransactionIdentifier.Hash)
+
+	// An unsigned PSBT can't be hashed
+	_, err = servicer.ConstructionHash(ctx, &types.ConstructionHashRequest{
+		NetworkIdentifier: networkIdentifier,
+		SignedTransaction: payloadsResponse.UnsignedTransaction,
+	})
+	assert.Equal(t, ErrUnableToParseIntermediateResult.Code, err.Code)
+
+	// Submit
+	mockClient.On(
+		"SendRawTransaction",
+		ctx,
+		signed.Transaction,
+	).Return(
+		tx.TxHash().String(),
+		nil,
+	).Once()
+	submitResponse, err := servicer.ConstructionSubmit(ctx, &types.ConstructionSubmitRequest{
+		NetworkIdentifier: networkIdentifier,
+		SignedTransaction: combineResponse.SignedTransaction,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, hashResponse.TransactionIdentifier, submitResponse.TransactionIdentifier)
+
+	// The previous transaction must create the coin
+	ops[0].Metadata = forceMarshalMap(t, &InputOperationMetadata{
+		PreviousTransaction: hex.EncodeToString(previousBuf.Bytes()),
+	})
+	ops[0].CoinChange.CoinIdentifier.Identifier = previousTx.TxHash().String() + ":1"
+	metadata.Encoding = PsbtTransactionEncoding
+	_, err = servicer.ConstructionPayloads(ctx, &types.ConstructionPayloadsRequest{
+		NetworkIdentifier: networkIdentifier,
+		Operations:        ops,
+		Metadata:          forceMarshalMap(t, metadata),
+	})
+	assert.Equal(t, ErrUnclearIntent.Code, err.Code)
+
+	mockClient.AssertExpectations(t)
+	mockIndexer.AssertExpectations(t)
+}
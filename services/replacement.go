@@ -0,0 +1,255 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/DeFiCh/rosetta-defichain/defichain"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/coinbase/rosetta-sdk-go/types"
+)
+
+const (
+	// replaceableSequence is the largest sequence signaling
+	// BIP125 opt-in replace-by-fee.
+	replaceableSequence = wire.MaxTxInSequenceNum - 2
+
+	// lockTimeSequence is the largest sequence that
+	// enables the lock time of a transaction.
+	lockTimeSequence = wire.MaxTxInSequenceNum - 1
+)
+
+// validReplacement returns an error if the replacement
+// options of a /construction/preprocess request are invalid.
+func validReplacement(metadata *PreprocessMetadata, inputs []*types.Operation) error {
+	if len(metadata.Replaces) == 0 {
+		return nil
+	}
+
+	if _, err := chainhash.NewHashFromStr(metadata.Replaces); err != nil ||
+		len(metadata.Replaces) != defichain.TransactionHashLength {
+		return fmt.Errorf("%s is not a valid transaction hash", metadata.Replaces)
+	}
+
+	if metadata.FundingAccount != nil {
+		return errors.New("a replacement cannot be funded by a funding account")
+	}
+
+	if len(inputs) == 0 {
+		return errors.New("a replacement must spend the inputs of the replaced transaction")
+	}
+
+	return nil
+}
+
+// inputSequence returns the sequence of an input. Unless it is
+// provided, the sequence signals replaceability if replaceable
+// and enables the lock time if it is populated.
+func inputSequence(metadata *InputOperationMetadata, replaceable bool, lockTime uint32) uint32 {
+	switch {
+	case metadata != nil && metadata.Sequence != nil:
+		return *metadata.Sequence
+	case replaceable:
+		return replaceableSequence
+	case lockTime != 0:
+		return lockTimeSequence
+	default:
+		return wire.MaxTxInSequenceNum
+	}
+}
+
+// signalsReplacement returns true if a transaction
+// signals BIP125 opt-in replace-by-fee.
+func signalsReplacement(tx *wire.MsgTx) bool {
+	for _, input := range tx.TxIn {
+		if input.Sequence <= replaceableSequence {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validSequences returns an error if the sequences of a
+// transaction don't signal replaceability or disable its
+// lock time.
+func validSequences(tx *wire.MsgTx, replaceable bool) error {
+	if replaceable && !signalsReplacement(tx) {
+		return errors.New("no input sequence signals replaceability")
+	}
+
+	if tx.LockTime == 0 {
+		return nil
+	}
+
+	for _, input := range tx.TxIn {
+		if input.Sequence != wire.MaxTxInSequenceNum {
+			return nil
+		}
+	}
+
+	return errors.New("the lock time is disabled by the final sequence of every input")
+}
+
+// parseMetadata returns the lock time and replaceability
+// of a transaction for /construction/parse.
+func parseMetadata(tx *wire.MsgTx) (map[string]interface{}, error) {
+	return types.MarshalMap(&ParseMetadata{
+		LockTime:    tx.LockTime,
+		Replaceable: signalsReplacement(tx),
+	})
+}
+
+// sequenceMetadata returns the metadata of an
+// INPUT operation for /construction/parse.
+func sequenceMetadata(input *wire.TxIn) (map[string]interface{}, error) {
+	sequence := input.Sequence
+
+	return types.MarshalMap(&InputOperationMetadata{Sequence: &sequence})
+}
+
+// replacementFee returns the smallest fee of a transaction
+// replacing options.Replaces (BIP125) and the fees of the
+// transactions it evicts (the replaced transaction and all of
+// its descendants in the mempool). The replacement must spend
+// all inputs of the replaced transaction, pay a higher fee rate
+// than the replaced transaction and pay for its own relay on
+// top of the evicted fees.
+func (s *ConstructionAPIService) replacementFee(
+	ctx context.Context,
+	options *preprocessOptions,
+) (int64, int64, error) {
+	// Only mempool transactions can be replaced. defid also
+	// reports transactions replaceable through an unconfirmed
+	// ancestor signaling replaceability (inherited signaling).
+	// The descendant fees of a mempool entry include the
+	// (modified) fee of the transaction itself.
+	entry, err := s.client.MempoolEntry(ctx, options.Replaces)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w unable to get mempool entry %s", err, options.Replaces)
+	}
+
+	if !entry.Bip125Replaceable {
+		return 0, 0, fmt.Errorf("transaction %s is not replaceable", options.Replaces)
+	}
+
+	replaced, err := s.client.GetRawTransaction(ctx, options.Replaces, "")
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w unable to get transaction %s", err, options.Replaces)
+	}
+
+	amounts := map[string]int64{}
+	for _, coin := range options.Coins {
+		amount, err := types.AmountValue(coin.Amount)
+		if err != nil || !amount.IsInt64() {
+			return 0, 0, fmt.Errorf("coin %s has an invalid amount", coin.CoinIdentifier.Identifier)
+		}
+
+		amounts[coin.CoinIdentifier.Identifier] = -amount.Int64()
+	}
+
+	replacedFee := int64(0)
+	for _, input := range replaced.Inputs {
+		identifier := fmt.Sprintf("%s:%d", input.TxHash, input.Vout)
+		amount, ok := amounts[identifier]
+		if !ok {
+			return 0, 0, fmt.Errorf(
+				"input %s of transaction %s is not spent",
+				identifier,
+				options.Replaces,
+			)
+		}
+
+		replacedFee += amount
+	}
+
+	// The outputs minted from account balances
+	// are not paid by the inputs.
+	mintingStart := int64(len(replaced.Outputs))
+	if customTx, err := replaced.CustomTx(); err == nil {
+		if message, ok := customTx.Message.(*defichain.AccountToUtxosMessage); ok {
+			mintingStart = int64(message.MintingOutputsStart)
+		}
+	}
+
+	for _, output := range replaced.Outputs {
+		if output.Index >= mintingStart {
+			continue
+		}
+
+		amount, err := defichain.ParseAmount(output.Value)
+		if err != nil {
+			return 0, 0, fmt.Errorf("%w unable to parse output amount", err)
+		}
+
+		replacedFee -= amount
+	}
+
+	if replacedFee < 0 || replaced.Vsize <= 0 {
+		return 0, 0, fmt.Errorf("unable to compute the fee of transaction %s", options.Replaces)
+	}
+
+	evictedFee := replacedFee
+	if entry.Fees != nil {
+		descendantFee, err := defichain.ParseAmount(entry.Fees.Descendant)
+		if err != nil {
+			return 0, 0, fmt.Errorf("%w unable to parse descendant fees", err)
+		}
+
+		if descendantFee > evictedFee {
+			evictedFee = descendantFee
+		}
+	}
+
+	// The replacement pays the incremental relay fee (the
+	// minimum fee rate) for its size and a fee rate higher
+	// than the replaced transaction.
+	relayFeePerKB := int64(math.Round(defichain.MinFeeRate * defichain.SatoshisInDFI))
+	relayFee := (relayFeePerKB*int64(options.EstimatedSize) + int64(bytesInKb) - 1) / int64(bytesInKb)
+	rateFee := replacedFee*int64(options.EstimatedSize)/replaced.Vsize + 1
+
+	if evictedFee+relayFee > rateFee {
+		return evictedFee + relayFee, evictedFee, nil
+	}
+
+	return rateFee, evictedFee, nil
+}
+
+// validReplacementFee returns an error if the fee of a
+// transaction is below the replacement fee returned by
+// /construction/metadata.
+func validReplacementFee(fee int64, replacementFee string) error {
+	if len(replacementFee) == 0 {
+		return nil
+	}
+
+	minimum, err := strconv.ParseInt(replacementFee, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: unable to parse replacement fee %s", err, replacementFee)
+	}
+
+	if fee < minimum {
+		return fmt.Errorf("fee %d is below the replacement fee %d", fee, minimum)
+	}
+
+	return nil
+}
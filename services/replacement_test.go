@@ -0,0 +1,621 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/DeFiCh/rosetta-defichain/configuration"
+	"github.com/DeFiCh/rosetta-defichain/defichain"
+	mocks "github.com/DeFiCh/rosetta-defichain/mocks/services"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	replacedHash = "b14157a5c2ef0ce1de1a3ca1e6c3b2b3a0dd1e0a6e8e1d1f2a0e3c4b5a6d7e8f"
+	replacedCoin = "b14157a5c2ef0ce1de1a3ca1e6c3b2b3a0dd1e0a6e8e1d1f2a0e3c4b5a6d7e8f:0"
+	replacedTx   = "5a0e1f4fe0a7b1fa1cdb0e4f0b7e0d5c2b3a4f6e8d7c6b5a4f3e2d1c0b9a8f7e"
+)
+
+func TestValidReplacement(t *testing.T) {
+	inputs := []*types.Operation{{Type: defichain.InputOpType}}
+
+	var tests = map[string]struct {
+		metadata *PreprocessMetadata
+		inputs   []*types.Operation
+		err      error
+	}{
+		"no replacement": {
+			metadata: &PreprocessMetadata{Replaceable: true},
+		},
+		"replacement": {
+			metadata: &PreprocessMetadata{Replaces: replacedTx},
+			inputs:   inputs,
+		},
+		"invalid hash": {
+			metadata: &PreprocessMetadata{Replaces: "abc"},
+			inputs:   inputs,
+			err:      errors.New("abc is not a valid transaction hash"),
+		},
+		"funding account": {
+			metadata: &PreprocessMetadata{
+				Replaces:       replacedTx,
+				FundingAccount: &types.AccountIdentifier{Address: "address"},
+			},
+			inputs: inputs,
+			err:    errors.New("a replacement cannot be funded by a funding account"),
+		},
+		"no inputs": {
+			metadata: &PreprocessMetadata{Replaces: replacedTx},
+			err:      errors.New("a replacement must spend the inputs of the replaced transaction"),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := validReplacement(test.metadata, test.inputs)
+			if test.err != nil {
+				assert.EqualError(t, err, test.err.Error())
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestInputSequence(t *testing.T) {
+	sequence := uint32(10)
+
+	var tests = map[string]struct {
+		metadata    *InputOperationMetadata
+		replaceable bool
+		lockTime    uint32
+
+		sequence uint32
+	}{
+		"final": {
+			metadata: &InputOperationMetadata{},
+			sequence: wire.MaxTxInSequenceNum,
+		},
+		"replaceable": {
+			replaceable: true,
+			lockTime:    800000,
+			sequence:    0xfffffffd,
+		},
+		"lock time": {
+			lockTime: 800000,
+			sequence: 0xfffffffe,
+		},
+		"provided": {
+			metadata:    &InputOperationMetadata{Sequence: &sequence},
+			replaceable: true,
+			sequence:    10,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(
+				t,
+				test.sequence,
+				inputSequence(test.metadata, test.replaceable, test.lockTime),
+			)
+		})
+	}
+}
+
+func TestValidSequences(t *testing.T) {
+	tx := func(lockTime uint32, sequences ...uint32) *wire.MsgTx {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.LockTime = lockTime
+		for _, sequence := range sequences {
+			tx.AddTxIn(&wire.TxIn{Sequence: sequence})
+		}
+
+		return tx
+	}
+
+	var tests = map[string]struct {
+		tx          *wire.MsgTx
+		replaceable bool
+		err         error
+	}{
+		"final": {
+			tx: tx(0, wire.MaxTxInSequenceNum),
+		},
+		"replaceable": {
+			tx:          tx(0, wire.MaxTxInSequenceNum, 0xfffffffd),
+			replaceable: true,
+		},
+		"not replaceable": {
+			tx:          tx(0, wire.MaxTxInSequenceNum, 0xfffffffe),
+			replaceable: true,
+			err:         errors.New("no input sequence signals replaceability"),
+		},
+		"lock time": {
+			tx: tx(800000, wire.MaxTxInSequenceNum, 0xfffffffe),
+		},
+		"disabled lock time": {
+			tx:  tx(800000, wire.MaxTxInSequenceNum, wire.MaxTxInSequenceNum),
+			err: errors.New("the lock time is disabled by the final sequence of every input"),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := validSequences(test.tx, test.replaceable)
+			if test.err != nil {
+				assert.EqualError(t, err, test.err.Error())
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestReplacementFee(t *testing.T) {
+	cfg := &configuration.Configuration{
+		Mode:     configuration.Online,
+		Params:   defichain.TestnetParams,
+		Currency: defichain.TestnetCurrency,
+	}
+	ctx := context.Background()
+	options := &preprocessOptions{
+		Coins: []*types.Coin{
+			{
+				CoinIdentifier: &types.CoinIdentifier{Identifier: replacedCoin},
+				Amount: &types.Amount{
+					Value:    "-1000000",
+					Currency: defichain.TestnetCurrency,
+				},
+			},
+		},
+		EstimatedSize: 110,
+		Replaces:      replacedTx,
+	}
+	replaced := func(sequence int64, vout int64, value string, vsize int64) *defichain.Transaction {
+		return &defichain.Transaction{
+			Hash:  replacedTx,
+			Vsize: vsize,
+			Inputs: []*defichain.Input{
+				{TxHash: replacedHash, Vout: vout, Sequence: sequence},
+			},
+			Outputs: []*defichain.Output{
+				{Value: json.Number(value), Index: 0},
+			},
+		}
+	}
+
+	// The replaced transaction also mints 0.5
+	// from an account balance
+	accountToUtxos, err := defichain.EncodeCustomTx(&defichain.CustomTx{
+		Type: defichain.CustomTxAccountToUtxos,
+		Message: &defichain.AccountToUtxosMessage{
+			From:                "001467f6e448a386c2032b1a6fe95ec759654566c42e",
+			Balances:            []*defichain.TokenAmount{{TokenID: 0, Amount: 50000000}},
+			MintingOutputsStart: 2,
+		},
+	})
+	assert.NoError(t, err)
+
+	replacedMinted := replaced(0xfffffffd, 0, "0.00999", 110)
+	replacedMinted.Outputs = []*defichain.Output{
+		{
+			Value: "0",
+			Index: 0,
+			ScriptPubKey: &defichain.ScriptPubKey{
+				Hex:  hex.EncodeToString(accountToUtxos),
+				Type: defichain.NullData,
+			},
+		},
+		{Value: "0.00999", Index: 1},
+		{Value: "0.5", Index: 2},
+	}
+
+	entry := func(descendant string) *defichain.MempoolEntry {
+		return &defichain.MempoolEntry{
+			Bip125Replaceable: true,
+			Fees: &defichain.MempoolEntryFees{
+				Base:       "0.00001",
+				Modified:   "0.00001",
+				Ancestor:   "0.00001",
+				Descendant: json.Number(descendant),
+			},
+		}
+	}
+
+	var tests = map[string]struct {
+		tx       *defichain.Transaction
+		txErr    error
+		entry    *defichain.MempoolEntry
+		entryErr error
+
+		fee         int64
+		replacedFee int64
+		err         error
+	}{
+		"relay fee": {
+			tx:          replaced(0xfffffffd, 0, "0.00999", 110),
+			entry:       entry("0.00001"),
+			fee:         1110,
+			replacedFee: 1000,
+		},
+		"descendant fees": {
+			tx:          replaced(0xfffffffd, 0, "0.00999", 110),
+			entry:       entry("0.00003"),
+			fee:         3110,
+			replacedFee: 3000,
+		},
+		"descendant fee rate": {
+			tx:          replaced(0, 0, "0.00999", 55),
+			entry:       entry("0.000025"),
+			fee:         2610,
+			replacedFee: 2500,
+		},
+		"minted outputs": {
+			tx:          replacedMinted,
+			entry:       entry("0.00001"),
+			fee:         1110,
+			replacedFee: 1000,
+		},
+		"inherited replaceability": {
+			tx:          replaced(0xfffffffe, 0, "0.00999", 110),
+			entry:       entry("0.00001"),
+			fee:         1110,
+			replacedFee: 1000,
+		},
+		"not in mempool": {
+			entryErr: errors.New("Transaction not in mempool"),
+			err: errors.New(
+				"Transaction not in mempool unable to get mempool entry " + replacedTx,
+			),
+		},
+		"invalid descendant fees": {
+			tx:    replaced(0xfffffffd, 0, "0.00999", 110),
+			entry: entry("0.000000001"),
+			err:   errors.New("0.000000001 has more than 8 decimals unable to parse descendant fees"),
+		},
+		"fee rate": {
+			tx:          replaced(0, 0, "0.00999", 55),
+			entry:       entry("0.00001"),
+			fee:         2001,
+			replacedFee: 1000,
+		},
+		"not replaceable": {
+			entry: &defichain.MempoolEntry{Bip125Replaceable: false},
+			err:   errors.New("transaction " + replacedTx + " is not replaceable"),
+		},
+		"input not spent": {
+			tx:    replaced(0xfffffffd, 1, "0.00999", 110),
+			entry: entry("0.00001"),
+			err: errors.New(
+				"input " + replacedHash + ":1 of transaction " + replacedTx + " is not spent",
+			),
+		},
+		"negative fee": {
+			tx:    replaced(0xfffffffd, 0, "0.02", 110),
+			entry: entry("0.00001"),
+			err:   errors.New("unable to compute the fee of transaction " + replacedTx),
+		},
+		"unknown transaction": {
+			entry: entry("0.00001"),
+			txErr: errors.New("no such mempool or blockchain transaction"),
+			err: errors.New(
+				"no such mempool or blockchain transaction unable to get transaction " + replacedTx,
+			),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockClient := &mocks.Client{}
+			mockClient.On(
+				"MempoolEntry",
+				ctx,
+				replacedTx,
+			).Return(test.entry, test.entryErr).Once()
+			if test.entry != nil && test.entry.Bip125Replaceable {
+				mockClient.On(
+					"GetRawTransaction",
+					ctx,
+					replacedTx,
+					"",
+				).Return(test.tx, test.txErr).Once()
+			}
+			servicer := NewConstructionAPIService(cfg, mockClient, &mocks.Indexer{})
+
+			fee, replacedFee, err := servicer.(*ConstructionAPIService).replacementFee(ctx, options)
+			if test.err != nil {
+				assert.EqualError(t, err, test.err.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, test.fee, fee)
+				assert.Equal(t, test.replacedFee, replacedFee)
+			}
+
+			mockClient.AssertExpectations(t)
+		})
+	}
+}
+
+func TestConstructionService_Replacement(t *testing.T) {
+	networkIdentifier = &types.NetworkIdentifier{
+		Network:    defichain.TestnetNetwork,
+		Blockchain: defichain.Blockchain,
+	}
+
+	cfg := &configuration.Configuration{
+		Mode:     configuration.Online,
+		Network:  networkIdentifier,
+		Params:   defichain.TestnetParams,
+		Currency: defichain.TestnetCurrency,
+	}
+
+	mockIndexer := &mocks.Indexer{}
+	mockClient := &mocks.Client{}
+	servicer := NewConstructionAPIService(cfg, mockClient, mockIndexer)
+	ctx := context.Background()
+
+	ops := []*types.Operation{
+		{
+			OperationIdentifier: &types.OperationIdentifier{
+				Index: 0,
+			},
+			Type: defichain.InputOpType,
+			Account: &types.AccountIdentifier{
+				Address: "tf1qvlmwgj9rsmpqx2c6dl54a36ev4zkd3pw3ufh4c",
+			},
+			Amount: &types.Amount{
+				Value:    "-1000000",
+				Currency: defichain.TestnetCurrency,
+			},
+			CoinChange: &types.CoinChange{
+				CoinIdentifier: &types.CoinIdentifier{
+					Identifier: replacedCoin,
+				},
+				CoinAction: types.CoinSpent,
+			},
+		},
+		{
+			OperationIdentifier: &types.OperationIdentifier{
+				Index: 1,
+			},
+			Type: defichain.OutputOpType,
+			Account: &types.AccountIdentifier{
+				Address: "tf1qr4pelt25fk869v2sfrwxp7ttm7jyx0pyn4dxph",
+			},
+			Amount: &types.Amount{
+				Value:    "998890",
+				Currency: defichain.TestnetCurrency,
+			},
+		},
+	}
+	feePerKB := defichain.MinFeeRate
+
+	// Preprocess
+	preprocessResponse, err := servicer.ConstructionPreprocess(
+		ctx,
+		&types.ConstructionPreprocessRequest{
+			NetworkIdentifier: networkIdentifier,
+			Operations:        ops,
+			Metadata: forceMarshalMap(t, &PreprocessMetadata{
+				FeePerKB:    &feePerKB,
+				Replaceable: true,
+				LockTime:    800000,
+				Replaces:    replacedTx,
+			}),
+		},
+	)
+	assert.Nil(t, err)
+	var options preprocessOptions
+	assert.NoError(t, types.UnmarshalMap(preprocessResponse.Options, &options))
+	assert.True(t, options.Replaceable)
+	assert.Equal(t, uint32(800000), options.LockTime)
+	assert.Equal(t, replacedTx, options.Replaces)
+
+	// A replacement must spend the inputs of the replaced transaction
+	_, err = servicer.ConstructionPreprocess(
+		ctx,
+		&types.ConstructionPreprocessRequest{
+			NetworkIdentifier: networkIdentifier,
+			Operations:        ops[1:],
+			Metadata:          forceMarshalMap(t, &PreprocessMetadata{Replaces: replacedTx}),
+		},
+	)
+	assert.Equal(t, ErrUnclearIntent.Code, err.Code)
+
+	// Metadata
+	scriptPubKeys := []*defichain.ScriptPubKey{
+		{
+			ASM:          "0 67f6e448a386c2032b1a6fe95ec759654566c42e",
+			Hex:          "001467f6e448a386c2032b1a6fe95ec759654566c42e",
+			RequiredSigs: 1,
+			Type:         "witness_v0_keyhash",
+			Addresses:    []string{"tf1qvlmwgj9rsmpqx2c6dl54a36ev4zkd3pw3ufh4c"},
+		},
+	}
+	mockIndexer.On(
+		"GetScriptPubKeys",
+		ctx,
+		options.Coins,
+	).Return(
+		scriptPubKeys,
+		nil,
+	).Once()
+	replaced := &defichain.Transaction{
+		Hash:  replacedTx,
+		Vsize: 110,
+		Inputs: []*defichain.Input{
+			{TxHash: replacedHash, Vout: 0, Sequence: 0xfffffffd},
+		},
+		Outputs: []*defichain.Output{
+			{Value: json.Number("0.00999"), Index: 0},
+		},
+	}
+	mockClient.On(
+		"GetRawTransaction",
+		ctx,
+		replacedTx,
+		"",
+	).Return(replaced, nil).Once()
+	entry := &defichain.MempoolEntry{
+		Bip125Replaceable: true,
+		Fees: &defichain.MempoolEntryFees{
+			Base:       "0.00001",
+			Modified:   "0.00001",
+			Ancestor:   "0.00001",
+			Descendant: "0.00001",
+		},
+	}
+	mockClient.On("MempoolEntry", ctx, replacedTx).Return(entry, nil).Twice()
+	metadataResponse, err := servicer.ConstructionMetadata(ctx, &types.ConstructionMetadataRequest{
+		NetworkIdentifier: networkIdentifier,
+		Options:           preprocessResponse.Options,
+	})
+	assert.Nil(t, err)
+
+	// The replaced fee (1000) and the relay fee
+	// of the replacement (110)
+	assert.Equal(t, &types.ConstructionMetadataResponse{
+		Metadata: forceMarshalMap(t, &constructionMetadata{
+			ScriptPubKeys:  scriptPubKeys,
+			FeePerKB:       feePerKB,
+			FeeRateSource:  ExplicitFeeRateSource,
+			Replaceable:    true,
+			LockTime:       800000,
+			ReplacedFee:    "1000",
+			ReplacementFee: "1110",
+		}),
+		SuggestedFee: []*types.Amount{
+			{
+				Value:    "1110",
+				Currency: defichain.TestnetCurrency,
+			},
+		},
+	}, metadataResponse)
+
+	// The replacement fee is checked against the max fee
+	options.MaxFee = "1000"
+	mockClient.On(
+		"GetRawTransaction",
+		ctx,
+		replacedTx,
+		"",
+	).Return(replaced, nil).Once()
+	_, err = servicer.ConstructionMetadata(ctx, &types.ConstructionMetadataRequest{
+		NetworkIdentifier: networkIdentifier,
+		Options:           forceMarshalMap(t, &options),
+	})
+	assert.Equal(t, ErrFeeTooHigh.Code, err.Code)
+
+	// Payloads
+	payloadsResponse, err := servicer.ConstructionPayloads(ctx, &types.ConstructionPayloadsRequest{
+		NetworkIdentifier: networkIdentifier,
+		Operations:        ops,
+		Metadata:          metadataResponse.Metadata,
+	})
+	assert.Nil(t, err)
+
+	// The fee of the replacement can't be
+	// below the replacement fee
+	lowFeeOutput := *ops[1]
+	lowFeeOutput.Amount = &types.Amount{
+		Value:    "998891",
+		Currency: defichain.TestnetCurrency,
+	}
+	lowFeeOps := []*types.Operation{ops[0], &lowFeeOutput}
+	_, err = servicer.ConstructionPayloads(ctx, &types.ConstructionPayloadsRequest{
+		NetworkIdentifier: networkIdentifier,
+		Operations:        lowFeeOps,
+		Metadata:          metadataResponse.Metadata,
+	})
+	assert.Equal(t, ErrUnableToReplace.Code, err.Code)
+	assert.Contains(t, err.Details["context"], "fee 1109 is below the replacement fee 1110")
+
+	// Parse
+	parseResponse, err := servicer.ConstructionParse(ctx, &types.ConstructionParseRequest{
+		NetworkIdentifier: networkIdentifier,
+		Signed:            false,
+		Transaction:       payloadsResponse.UnsignedTransaction,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, forceMarshalMap(t, &ParseMetadata{
+		LockTime:    800000,
+		Replaceable: true,
+	}), parseResponse.Metadata)
+	replaceableSequence := uint32(0xfffffffd)
+	assert.Equal(
+		t,
+		forceMarshalMap(t, &InputOperationMetadata{Sequence: &replaceableSequence}),
+		parseResponse.Operations[0].Metadata,
+	)
+
+	// The sequence of an input can be provided
+	var metadata constructionMetadata
+	assert.NoError(t, types.UnmarshalMap(metadataResponse.Metadata, &metadata))
+	metadata.Replaceable = false
+	lockTimeSequence := uint32(0xfffffffe)
+	sequenceOps := []*types.Operation{
+		{
+			OperationIdentifier: ops[0].OperationIdentifier,
+			Type:                ops[0].Type,
+			Account:             ops[0].Account,
+			Amount:              ops[0].Amount,
+			CoinChange:          ops[0].CoinChange,
+			Metadata: forceMarshalMap(
+				t,
+				&InputOperationMetadata{Sequence: &lockTimeSequence},
+			),
+		},
+		ops[1],
+	}
+	payloadsResponse, err = servicer.ConstructionPayloads(ctx, &types.ConstructionPayloadsRequest{
+		NetworkIdentifier: networkIdentifier,
+		Operations:        sequenceOps,
+		Metadata:          forceMarshalMap(t, &metadata),
+	})
+	assert.Nil(t, err)
+	parseResponse, err = servicer.ConstructionParse(ctx, &types.ConstructionParseRequest{
+		NetworkIdentifier: networkIdentifier,
+		Signed:            false,
+		Transaction:       payloadsResponse.UnsignedTransaction,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, forceMarshalMap(t, &ParseMetadata{
+		LockTime: 800000,
+	}), parseResponse.Metadata)
+	assert.Equal(t, sequenceOps[0].Metadata, parseResponse.Operations[0].Metadata)
+
+	// A provided sequence can't disable replaceability
+	metadata.Replaceable = true
+	_, err = servicer.ConstructionPayloads(ctx, &types.ConstructionPayloadsRequest{
+		NetworkIdentifier: networkIdentifier,
+		Operations:        sequenceOps,
+		Metadata:          forceMarshalMap(t, &metadata),
+	})
+	assert.Equal(t, ErrUnclearIntent.Code, err.Code)
+
+	mockClient.AssertExpectations(t)
+	mockIndexer.AssertExpectations(t)
+}
@@ -55,17 +55,38 @@ func NewBlockchainRouter(
 		asserter,
 	)
 
-	mempoolAPIService := NewMempoolAPIService(config, client)
+	mempoolAPIService := NewMempoolAPIService(config, client, i)
 	mempoolAPIController := server.NewMempoolAPIController(
 		mempoolAPIService,
 		asserter,
 	)
 
+	callAPIService := NewCallAPIService(config, client)
+	callAPIController := server.NewCallAPIController(
+		callAPIService,
+		asserter,
+	)
+
+	searchAPIService := NewSearchAPIService(config, i)
+	searchAPIController := server.NewSearchAPIController(
+		searchAPIService,
+		asserter,
+	)
+
+	eventsAPIService := NewEventsAPIService(config, i)
+	eventsAPIController := server.NewEventsAPIController(
+		eventsAPIService,
+		asserter,
+	)
+
 	return server.NewRouter(
 		networkAPIController,
 		blockAPIController,
 		accountAPIController,
 		constructionAPIController,
 		mempoolAPIController,
+		callAPIController,
+		searchAPIController,
+		eventsAPIController,
 	)
 }
@@ -0,0 +1,110 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/DeFiCh/rosetta-defichain/configuration"
+
+	"github.com/coinbase/rosetta-sdk-go/server"
+	"github.com/coinbase/rosetta-sdk-go/types"
+)
+
+// SearchAPIService implements the server.SearchAPIServicer interface.
+type SearchAPIService struct {
+	config *configuration.Configuration
+	i      Indexer
+}
+
+// NewSearchAPIService creates a new instance of a SearchAPIService.
+func NewSearchAPIService(
+	config *configuration.Configuration,
+	i Indexer,
+) server.SearchAPIServicer {
+	return &SearchAPIService{
+		config: config,
+		i:      i,
+	}
+}
+
+// SearchTransactions implements the /search/transactions endpoint.
+func (s *SearchAPIService) SearchTransactions(
+	ctx context.Context,
+	request *types.SearchTransactionsRequest,
+) (*types.SearchTransactionsResponse, *types.Error) {
+	if s.config.Mode != configuration.Online {
+		return nil, wrapErr(ErrUnavailableOffline, nil)
+	}
+
+	if err := checkSearchQuery(request); err != nil {
+		return nil, wrapErr(ErrSearchQueryUnsupported, err)
+	}
+
+	query := *request
+	offset := int64(0)
+	if query.Offset != nil {
+		offset = *query.Offset
+	}
+	query.Offset = &offset
+
+	limit := int64(maxSearchLimit)
+	if query.Limit != nil && *query.Limit > 0 && *query.Limit < limit {
+		limit = *query.Limit
+	}
+	query.Limit = &limit
+
+	transactions, totalCount, err := s.i.SearchTransactions(ctx, &query)
+	if err != nil {
+		return nil, wrapErr(ErrUnableToSearchTransactions, err)
+	}
+
+	response := &types.SearchTransactionsResponse{
+		Transactions: transactions,
+		TotalCount:   totalCount,
+	}
+
+	if nextOffset := offset + int64(len(transactions)); nextOffset < totalCount {
+		response.NextOffset = &nextOffset
+	}
+
+	return response, nil
+}
+
+// checkSearchQuery ensures a search can be answered from
+// the transaction index, which is keyed by address, coin
+// and transaction identifier.
+func checkSearchQuery(request *types.SearchTransactionsRequest) error {
+	indexed := request.Address != nil || request.AccountIdentifier != nil ||
+		request.CoinIdentifier != nil || request.TransactionIdentifier != nil
+	if !indexed {
+		return errors.New(
+			"an address, account_identifier, coin_identifier or transaction_identifier is required",
+		)
+	}
+
+	// With the OR operator, every condition must be
+	// indexed or matching transactions could be missed.
+	unindexed := request.Currency != nil || request.Type != nil ||
+		request.Status != nil || request.Success != nil
+	if request.Operator != nil && *request.Operator == types.OR && unindexed {
+		return errors.New(
+			"currency, type, status and success can't be used with the or operator",
+		)
+	}
+
+	return nil
+}
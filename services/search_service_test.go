@@ -0,0 +1,180 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DeFiCh/rosetta-defichain/configuration"
+	"github.com/DeFiCh/rosetta-defichain/defichain"
+	mocks "github.com/DeFiCh/rosetta-defichain/mocks/services"
+
+	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchService_Offline(t *testing.T) {
+	cfg := &configuration.Configuration{
+		Mode: configuration.Offline,
+	}
+	mockIndexer := &mocks.Indexer{}
+	servicer := NewSearchAPIService(cfg, mockIndexer)
+	ctx := context.Background()
+
+	response, err := servicer.SearchTransactions(ctx, &types.SearchTransactionsRequest{})
+	assert.Nil(t, response)
+	assert.Equal(t, ErrUnavailableOffline.Code, err.Code)
+
+	mockIndexer.AssertExpectations(t)
+}
+
+func TestSearchService_SearchTransactions(t *testing.T) {
+	cfg := &configuration.Configuration{
+		Mode: configuration.Online,
+	}
+	ctx := context.Background()
+
+	blockTransaction := &types.BlockTransaction{
+		BlockIdentifier: &types.BlockIdentifier{Hash: "block 1", Index: 1},
+		Transaction: &types.Transaction{
+			TransactionIdentifier: &types.TransactionIdentifier{Hash: "tx"},
+			Operations:            []*types.Operation{},
+		},
+	}
+	or := types.OR
+
+	tests := map[string]struct {
+		request *types.SearchTransactionsRequest
+
+		expectedQuery *types.SearchTransactionsRequest
+		transactions  []*types.BlockTransaction
+		totalCount    int64
+		indexerErr    error
+
+		expectedResponse *types.SearchTransactionsResponse
+		expectedErr      *types.Error
+	}{
+		"first page": {
+			request: &types.SearchTransactionsRequest{
+				Address: types.String("address"),
+				Limit:   types.Int64(1),
+			},
+			expectedQuery: &types.SearchTransactionsRequest{
+				Address: types.String("address"),
+				Offset:  types.Int64(0),
+				Limit:   types.Int64(1),
+			},
+			transactions: []*types.BlockTransaction{blockTransaction},
+			totalCount:   3,
+			expectedResponse: &types.SearchTransactionsResponse{
+				Transactions: []*types.BlockTransaction{blockTransaction},
+				TotalCount:   3,
+				NextOffset:   types.Int64(1),
+			},
+		},
+		"last page": {
+			request: &types.SearchTransactionsRequest{
+				Address: types.String("address"),
+				Offset:  types.Int64(2),
+				Limit:   types.Int64(1000),
+			},
+			expectedQuery: &types.SearchTransactionsRequest{
+				Address: types.String("address"),
+				Offset:  types.Int64(2),
+				Limit:   types.Int64(maxSearchLimit),
+			},
+			transactions: []*types.BlockTransaction{blockTransaction},
+			totalCount:   3,
+			expectedResponse: &types.SearchTransactionsResponse{
+				Transactions: []*types.BlockTransaction{blockTransaction},
+				TotalCount:   3,
+			},
+		},
+		"coin and operation type": {
+			request: &types.SearchTransactionsRequest{
+				CoinIdentifier: &types.CoinIdentifier{Identifier: "tx:0"},
+				Type:           types.String(defichain.OutputOpType),
+			},
+			expectedQuery: &types.SearchTransactionsRequest{
+				CoinIdentifier: &types.CoinIdentifier{Identifier: "tx:0"},
+				Type:           types.String(defichain.OutputOpType),
+				Offset:         types.Int64(0),
+				Limit:          types.Int64(maxSearchLimit),
+			},
+			transactions: []*types.BlockTransaction{},
+			expectedResponse: &types.SearchTransactionsResponse{
+				Transactions: []*types.BlockTransaction{},
+			},
+		},
+		"indexer error": {
+			request: &types.SearchTransactionsRequest{
+				TransactionIdentifier: &types.TransactionIdentifier{Hash: "tx"},
+			},
+			expectedQuery: &types.SearchTransactionsRequest{
+				TransactionIdentifier: &types.TransactionIdentifier{Hash: "tx"},
+				Offset:                types.Int64(0),
+				Limit:                 types.Int64(maxSearchLimit),
+			},
+			indexerErr:  errors.New("unable to scan"),
+			expectedErr: ErrUnableToSearchTransactions,
+		},
+		"no indexed condition": {
+			request: &types.SearchTransactionsRequest{
+				Type: types.String(defichain.OutputOpType),
+			},
+			expectedErr: ErrSearchQueryUnsupported,
+		},
+		"unindexed condition with or operator": {
+			request: &types.SearchTransactionsRequest{
+				Operator: &or,
+				Address:  types.String("address"),
+				Success:  types.Bool(true),
+			},
+			expectedErr: ErrSearchQueryUnsupported,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockIndexer := &mocks.Indexer{}
+			servicer := NewSearchAPIService(cfg, mockIndexer)
+
+			if test.expectedQuery != nil {
+				mockIndexer.On(
+					"SearchTransactions",
+					ctx,
+					test.expectedQuery,
+				).Return(
+					test.transactions,
+					test.totalCount,
+					test.indexerErr,
+				).Once()
+			}
+
+			response, err := servicer.SearchTransactions(ctx, test.request)
+			if test.expectedErr != nil {
+				assert.Nil(t, response)
+				assert.Equal(t, test.expectedErr.Code, err.Code)
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, test.expectedResponse, response)
+			}
+
+			mockIndexer.AssertExpectations(t)
+		})
+	}
+}
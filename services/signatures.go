@@ -0,0 +1,336 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/DeFiCh/rosetta-defichain/defichain"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/coinbase/rosetta-sdk-go/types"
+)
+
+// signingInput is an input of an unsigned transaction
+// and the signatures matched to it by ConstructionCombine.
+type signingInput struct {
+	class   txscript.ScriptClass
+	address string
+
+	// script is the redeem script of a P2SH input or the
+	// witness script of a P2WSH input.
+	script []byte
+
+	// hash is the signature hash of the input.
+	hash []byte
+
+	// publicKeyHash is the hash of the public key that
+	// signs a single-sig input.
+	publicKeyHash []byte
+
+	// publicKeys and requiredSigs describe the signers
+	// of a multisig input.
+	publicKeys   [][]byte
+	requiredSigs int
+
+	signatures []*types.Signature
+}
+
+// multisig returns whether the input spends a multisig
+// script.
+func (in *signingInput) multisig() bool {
+	return len(in.publicKeys) > 0
+}
+
+// signed returns whether the input has all the signatures
+// it requires.
+func (in *signingInput) signed() bool {
+	if in.multisig() {
+		return len(in.signatures) == in.requiredSigs
+	}
+
+	return len(in.signatures) == 1
+}
+
+// signedBy returns whether the input already has a
+// signature of a public key.
+func (in *signingInput) signedBy(publicKey []byte) bool {
+	for _, signature := range in.signatures {
+		if bytes.Equal(signature.PublicKey.Bytes, publicKey) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// canSign returns whether a public key can sign
+// the input.
+func (in *signingInput) canSign(publicKey []byte) bool {
+	if in.multisig() {
+		return publicKeyIndex(in.publicKeys, publicKey) >= 0
+	}
+
+	return bytes.Equal(btcutil.Hash160(publicKey), in.publicKeyHash)
+}
+
+// signingInputs recomputes the signature hash and the
+// allowed signers of each input of an unsigned transaction.
+func (s *ConstructionAPIService) signingInputs(
+	unsigned *unsignedTransaction,
+	tx *wire.MsgTx,
+) ([]*signingInput, *types.Error) {
+	if len(unsigned.ScriptPubKeys) != len(tx.TxIn) ||
+		len(unsigned.InputAmounts) != len(tx.TxIn) {
+		return nil, wrapErr(
+			ErrUnableToParseIntermediateResult,
+			fmt.Errorf("expected %d script pub keys and input amounts", len(tx.TxIn)),
+		)
+	}
+
+	inputs := make([]*signingInput, len(tx.TxIn))
+	sigHashes := txscript.NewTxSigHashes(tx)
+	for i := range tx.TxIn {
+		script, err := hex.DecodeString(unsigned.ScriptPubKeys[i].Hex)
+		if err != nil {
+			return nil, wrapErr(ErrUnableToDecodeScriptPubKey, err)
+		}
+
+		class, _, err := defichain.ParseSingleAddress(s.config.Params, script)
+		if err != nil {
+			return nil, wrapErr(
+				ErrUnableToDecodeAddress,
+				fmt.Errorf("%w unable to parse address for script", err),
+			)
+		}
+
+		amount, ok := new(big.Int).SetString(unsigned.InputAmounts[i], 10) // nolint:gomnd
+		if !ok {
+			return nil, wrapErr(
+				ErrUnableToParseIntermediateResult,
+				fmt.Errorf("unable to parse input amount %s", unsigned.InputAmounts[i]),
+			)
+		}
+
+		input := &signingInput{class: class}
+		if i < len(unsigned.InputAddresses) {
+			input.address = unsigned.InputAddresses[i]
+		}
+
+		// The script committed to by the signature hash and
+		// whether the input is signed using BIP143.
+		var signingScript []byte
+		var witness bool
+		switch class {
+		case txscript.WitnessV0PubKeyHashTy:
+			signingScript, witness = script, true
+			input.publicKeyHash = script[2:]
+		case txscript.PubKeyHashTy:
+			signingScript = script
+			input.publicKeyHash = script[3:23]
+		case txscript.ScriptHashTy:
+			redeemScript, err := redeemScript(i, scriptAt(unsigned.RedeemScripts, i), script)
+			if err != nil {
+				return nil, wrapErr(ErrRedeemScriptMissing, err)
+			}
+			input.script = redeemScript
+
+			if txscript.GetScriptClass(redeemScript) == txscript.WitnessV0PubKeyHashTy {
+				signingScript, witness = redeemScript, true
+				input.publicKeyHash = redeemScript[2:]
+				break
+			}
+
+			input.publicKeys, input.requiredSigs, err = multisigPublicKeys(redeemScript)
+			if err != nil {
+				return nil, wrapErr(ErrUnsupportedScriptType, err)
+			}
+
+			signingScript = redeemScript
+		case txscript.WitnessV0ScriptHashTy:
+			witnessScript, err := witnessScript(i, scriptAt(unsigned.WitnessScripts, i), script)
+			if err != nil {
+				return nil, wrapErr(ErrWitnessScriptMissing, err)
+			}
+			input.script = witnessScript
+
+			input.publicKeys, input.requiredSigs, err = multisigPublicKeys(witnessScript)
+			if err != nil {
+				return nil, wrapErr(ErrUnsupportedScriptType, err)
+			}
+
+			signingScript, witness = witnessScript, true
+		default:
+			return nil, wrapErr(
+				ErrUnsupportedScriptType,
+				fmt.Errorf("unupported script type: %s", class),
+			)
+		}
+
+		if witness {
+			input.hash, err = txscript.CalcWitnessSigHash(
+				signingScript,
+				sigHashes,
+				txscript.SigHashAll,
+				tx,
+				i,
+				new(big.Int).Abs(amount).Int64(),
+			)
+		} else {
+			input.hash, err = txscript.CalcSignatureHash(
+				signingScript,
+				txscript.SigHashAll,
+				tx,
+				i,
+			)
+		}
+		if err != nil {
+			return nil, wrapErr(ErrUnableToCalculateSignatureHash, err)
+		}
+
+		inputs[i] = input
+	}
+
+	return inputs, nil
+}
+
+// matchSignatures verifies each signature and assigns it
+// to the input it signs. Signatures are matched by their
+// signing payload and public key, so they may be provided
+// in any order.
+func (s *ConstructionAPIService) matchSignatures(
+	inputs []*signingInput,
+	signatures []*types.Signature,
+) *types.Error {
+	for j, signature := range signatures {
+		i, err := s.matchSignature(inputs, signature)
+		if err != nil {
+			return wrapErr(ErrInvalidSignature, fmt.Errorf("%w: signature %d", err, j))
+		}
+
+		inputs[i].signatures = append(inputs[i].signatures, signature)
+	}
+
+	for i, input := range inputs {
+		if !input.signed() {
+			return wrapErr(ErrUnclearIntent, fmt.Errorf("missing signatures for utxo %d", i))
+		}
+	}
+
+	return nil
+}
+
+// matchSignature returns the index of the input signed
+// by a signature.
+func (s *ConstructionAPIService) matchSignature(
+	inputs []*signingInput,
+	signature *types.Signature,
+) (int, error) {
+	if signature.PublicKey == nil {
+		return -1, errors.New("public key cannot be nil")
+	}
+
+	if signature.SignatureType != types.Ecdsa {
+		return -1, fmt.Errorf("unsupported signature type %s", signature.SignatureType)
+	}
+
+	if len(signature.Bytes) != 64 { // nolint:gomnd
+		return -1, fmt.Errorf("expected 64 signature bytes but got %d", len(signature.Bytes))
+	}
+
+	publicKey, err := btcec.ParsePubKey(signature.PublicKey.Bytes, btcec.S256())
+	if err != nil {
+		return -1, fmt.Errorf("%w unable to parse public key", err)
+	}
+
+	sig := &btcec.Signature{ // signature is in form of R || S
+		R: new(big.Int).SetBytes(signature.Bytes[:32]),
+		S: new(big.Int).SetBytes(signature.Bytes[32:64]),
+	}
+
+	var payload *types.SigningPayload
+	if signature.SigningPayload != nil && len(signature.SigningPayload.Bytes) > 0 {
+		payload = signature.SigningPayload
+	}
+
+	var mismatch error
+	for i, input := range inputs {
+		if payload != nil && !bytes.Equal(payload.Bytes, input.hash) {
+			continue
+		}
+
+		switch {
+		case !input.canSign(signature.PublicKey.Bytes):
+			mismatch = fmt.Errorf(
+				"public key %x cannot sign utxo %d",
+				signature.PublicKey.Bytes,
+				i,
+			)
+		case !sig.Verify(input.hash, publicKey):
+			mismatch = fmt.Errorf("signature is not valid for utxo %d", i)
+		case input.signedBy(signature.PublicKey.Bytes) || input.signed():
+			mismatch = fmt.Errorf("utxo %d is already signed", i)
+		default:
+			if err := s.checkSigner(input, signature); err != nil {
+				return -1, fmt.Errorf("%w for utxo %d", err, i)
+			}
+
+			return i, nil
+		}
+	}
+
+	if mismatch != nil {
+		return -1, mismatch
+	}
+
+	if payload != nil {
+		return -1, errors.New("signing payload does not match any utxo")
+	}
+
+	return -1, errors.New("signature does not match any utxo")
+}
+
+// checkSigner ensures the account of the signing payload
+// of a signature (if any) is the account of its signer.
+func (s *ConstructionAPIService) checkSigner(
+	input *signingInput,
+	signature *types.Signature,
+) error {
+	if signature.SigningPayload == nil || signature.SigningPayload.AccountIdentifier == nil {
+		return nil
+	}
+
+	expected := input.address
+	if input.multisig() {
+		var err error
+		expected, err = s.deriveAddress(signature.PublicKey.Bytes)
+		if err != nil {
+			return fmt.Errorf("%w unable to derive address", err)
+		}
+	}
+
+	if address := signature.SigningPayload.AccountIdentifier.Address; address != expected {
+		return fmt.Errorf("signing payload account %s is not the signer %s", address, expected)
+	}
+
+	return nil
+}
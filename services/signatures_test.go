@@ -0,0 +1,238 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/DeFiCh/rosetta-defichain/configuration"
+	"github.com/DeFiCh/rosetta-defichain/defichain"
+	mocks "github.com/DeFiCh/rosetta-defichain/mocks/services"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConstructionService_CombineSignatures(t *testing.T) {
+	networkIdentifier = &types.NetworkIdentifier{
+		Network:    defichain.TestnetNetwork,
+		Blockchain: defichain.Blockchain,
+	}
+
+	cfg := &configuration.Configuration{
+		Mode:     configuration.Online,
+		Network:  networkIdentifier,
+		Params:   defichain.TestnetParams,
+		Currency: defichain.TestnetCurrency,
+	}
+
+	servicer := NewConstructionAPIService(cfg, &mocks.Client{}, &mocks.Indexer{})
+	ctx := context.Background()
+
+	privKey, pubKey := btcec.PrivKeyFromBytes(btcec.S256(), forceHexDecode(
+		t,
+		"8f0a8b1a9f0f9e2a7f3c5b6d4e1a2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c",
+	))
+	otherPrivKey, otherPubKey := btcec.PrivKeyFromBytes(btcec.S256(), forceHexDecode(
+		t,
+		"1d2c3b4a5968778695a4b3c2d1e0f1e2d3c4b5a69788796a5b4c3d2e1f0e1d2c",
+	))
+	legacyAddress := "7CYm8j6Jphjf6ghZHtsNfroacCgVdPZF3D"
+	segwitAddress := "tf1qvlmwgj9rsmpqx2c6dl54a36ev4zkd3pw3ufh4c"
+
+	// A segwit input and a legacy input of the same key
+	hash, err := chainhash.NewHash(forceHexDecode(t, strings.Repeat("11", 32)))
+	assert.NoError(t, err)
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(hash, 0), nil, nil))
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(hash, 1), nil, nil))
+	tx.AddTxOut(wire.NewTxOut(
+		140000000,
+		forceHexDecode(t, "0014"+strings.Repeat("22", 20)),
+	))
+
+	buf := bytes.NewBuffer(make([]byte, 0, tx.SerializeSize()))
+	assert.NoError(t, tx.Serialize(buf))
+	rawTx, err := json.Marshal(&unsignedTransaction{
+		Transaction: hex.EncodeToString(buf.Bytes()),
+		ScriptPubKeys: []*defichain.ScriptPubKey{
+			{Hex: "001467f6e448a386c2032b1a6fe95ec759654566c42e"},
+			{Hex: "76a91467f6e448a386c2032b1a6fe95ec759654566c42e88ac"},
+		},
+		InputAmounts:   []string{"-100000000", "-50000000"},
+		InputAddresses: []string{segwitAddress, legacyAddress},
+	})
+	assert.NoError(t, err)
+	unsignedRaw := hex.EncodeToString(rawTx)
+
+	unsigned, decodedTx, _, err := servicer.(*ConstructionAPIService).decodeUnsignedTransaction(
+		unsignedRaw,
+	)
+	assert.NoError(t, err)
+	inputs, rErr := servicer.(*ConstructionAPIService).signingInputs(unsigned, decodedTx)
+	assert.Nil(t, rErr)
+	assert.Len(t, inputs, 2)
+
+	sign := func(
+		key *btcec.PrivateKey,
+		publicKey *btcec.PublicKey,
+		hash []byte,
+		address string,
+	) *types.Signature {
+		payload := &types.SigningPayload{
+			AccountIdentifier: &types.AccountIdentifier{Address: address},
+			Bytes:             hash,
+			SignatureType:     types.Ecdsa,
+		}
+
+		return &types.Signature{
+			Bytes:          signPayload(t, key, payload),
+			SigningPayload: payload,
+			PublicKey: &types.PublicKey{
+				Bytes:     publicKey.SerializeCompressed(),
+				CurveType: types.Secp256k1,
+			},
+			SignatureType: types.Ecdsa,
+		}
+	}
+	segwitSignature := sign(privKey, pubKey, inputs[0].hash, segwitAddress)
+	legacySignature := sign(privKey, pubKey, inputs[1].hash, legacyAddress)
+
+	tamperedSignature := sign(privKey, pubKey, inputs[0].hash, segwitAddress)
+	tamperedSignature.Bytes[10] ^= 0x01
+
+	// Signatures without a signing payload are matched by
+	// verifying them against each input
+	accountlessSignature := sign(privKey, pubKey, inputs[1].hash, legacyAddress)
+	accountlessSignature.SigningPayload = nil
+
+	tests := map[string]struct {
+		signatures []*types.Signature
+		err        *types.Error
+	}{
+		"in input order": {
+			signatures: []*types.Signature{segwitSignature, legacySignature},
+		},
+		"out of input order": {
+			signatures: []*types.Signature{legacySignature, segwitSignature},
+		},
+		"without signing payload": {
+			signatures: []*types.Signature{accountlessSignature, segwitSignature},
+		},
+		"tampered signature": {
+			signatures: []*types.Signature{tamperedSignature, legacySignature},
+			err:        ErrInvalidSignature,
+		},
+		"wrong key": {
+			signatures: []*types.Signature{
+				segwitSignature,
+				sign(otherPrivKey, otherPubKey, inputs[1].hash, legacyAddress),
+			},
+			err: ErrInvalidSignature,
+		},
+		"signature of another payload": {
+			signatures: []*types.Signature{
+				segwitSignature,
+				{
+					Bytes:          legacySignature.Bytes,
+					SigningPayload: segwitSignature.SigningPayload,
+					PublicKey:      legacySignature.PublicKey,
+					SignatureType:  types.Ecdsa,
+				},
+			},
+			err: ErrInvalidSignature,
+		},
+		"wrong account": {
+			signatures: []*types.Signature{
+				segwitSignature,
+				sign(privKey, pubKey, inputs[1].hash, segwitAddress),
+			},
+			err: ErrInvalidSignature,
+		},
+		"unknown payload": {
+			signatures: []*types.Signature{
+				segwitSignature,
+				legacySignature,
+				sign(privKey, pubKey, forceHexDecode(t, strings.Repeat("33", 32)), segwitAddress),
+			},
+			err: ErrInvalidSignature,
+		},
+		"duplicate signature": {
+			signatures: []*types.Signature{segwitSignature, segwitSignature, legacySignature},
+			err:        ErrInvalidSignature,
+		},
+		"missing signature": {
+			signatures: []*types.Signature{legacySignature},
+			err:        ErrUnclearIntent,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			combineResponse, rErr := servicer.ConstructionCombine(
+				ctx,
+				&types.ConstructionCombineRequest{
+					NetworkIdentifier:   networkIdentifier,
+					UnsignedTransaction: unsignedRaw,
+					Signatures:          test.signatures,
+				},
+			)
+			if test.err != nil {
+				assert.Nil(t, combineResponse)
+				assert.Equal(t, test.err.Code, rErr.Code)
+				return
+			}
+
+			assert.Nil(t, rErr)
+
+			// The signed transaction must pass script validation
+			var signed signedTransaction
+			assert.NoError(t, json.Unmarshal(
+				forceHexDecode(t, combineResponse.SignedTransaction),
+				&signed,
+			))
+			var signedTx wire.MsgTx
+			assert.NoError(t, signedTx.Deserialize(
+				bytes.NewReader(forceHexDecode(t, signed.Transaction)),
+			))
+			assert.Len(t, signedTx.TxIn[0].Witness, 2)
+			assert.NotEmpty(t, signedTx.TxIn[1].SignatureScript)
+
+			sigHashes := txscript.NewTxSigHashes(&signedTx)
+			for i, scriptPubKey := range unsigned.ScriptPubKeys {
+				vm, err := txscript.NewEngine(
+					forceHexDecode(t, scriptPubKey.Hex),
+					&signedTx,
+					i,
+					txscript.StandardVerifyFlags,
+					nil,
+					sigHashes,
+					[]int64{100000000, 50000000}[i],
+				)
+				assert.NoError(t, err)
+				assert.NoError(t, vm.Execute())
+			}
+		})
+	}
+}
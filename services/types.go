@@ -32,13 +32,31 @@ const (
 
 	// MempoolCoins indicates that
 	// including mempool coins in the /account/coins
-	// response is not supported.
-	MempoolCoins = false
+	// response is supported.
+	MempoolCoins = true
+
+	// TestMempoolAcceptMethod is the /call method
+	// that tests if defid would accept a signed
+	// transaction without broadcasting it.
+	TestMempoolAcceptMethod = "testmempoolaccept"
+
+	// RawMempoolMethod is the /call method that
+	// returns the mempool entry of each transaction
+	// in the mempool of defid.
+	RawMempoolMethod = "getrawmempool"
 
 	// inlineFetchLimit is the maximum number
 	// of transactions to fetch inline.
 	inlineFetchLimit = 100
 
+	// maxSearchLimit is the maximum number of
+	// transactions returned by /search/transactions.
+	maxSearchLimit = 100
+
+	// maxEventsLimit is the maximum number of
+	// events returned by /events/blocks.
+	maxEventsLimit = 100
+
 	// MiddlewareVersion is the version
 	// of rosetta-defichain. We set this as a
 	// variable instead of a constant because
@@ -47,14 +65,30 @@ const (
 	MiddlewareVersion = "0.0.9"
 )
 
+// CallMethods are the methods supported
+// by /call.
+var CallMethods = []string{
+	TestMempoolAcceptMethod,
+	RawMempoolMethod,
+}
+
 // Client is used by the servicers to get Peer information
 // and to submit transactions.
 type Client interface {
 	GetPeers(context.Context) ([]*types.Peer, error)
 	SendRawTransaction(context.Context, string) (string, error)
-	SuggestedFeeRate(context.Context, int64) (float64, error)
+	TestMempoolAccept(context.Context, string) (*defichain.MempoolAcceptResult, error)
+	SuggestedFeeRate(context.Context, int64, defichain.EstimateMode) (float64, error)
+	MempoolFeeRate(context.Context) (float64, error)
 	RawMempool(context.Context) ([]string, error)
+	VerboseRawMempool(context.Context) (map[string]*defichain.MempoolEntry, error)
+	MempoolEntry(context.Context, string) (*defichain.MempoolEntry, error)
 	GetRawTransaction(context.Context, string, string) (*defichain.Transaction, error)
+	ParseTransaction(
+		context.Context,
+		*defichain.Transaction,
+		map[string]*types.AccountCoin,
+	) (*types.Transaction, error)
 }
 
 // Indexer is used by the servicers to get block and account data.
@@ -72,16 +106,38 @@ type Indexer interface {
 		context.Context,
 		*types.AccountIdentifier,
 	) ([]*types.Coin, *types.BlockIdentifier, error)
+	GetMempoolCoins(
+		context.Context,
+		*types.AccountIdentifier,
+		[]*types.Coin,
+	) ([]*types.Coin, error)
+	GetInputCoins(
+		context.Context,
+		*defichain.Transaction,
+	) (map[string]*types.AccountCoin, error)
 	GetScriptPubKeys(
 		context.Context,
 		[]*types.Coin,
 	) ([]*defichain.ScriptPubKey, error)
-	GetBalance(
+	GetCoinBlocks(
+		context.Context,
+		[]*types.Coin,
+	) ([]*types.BlockIdentifier, error)
+	GetBalances(
 		context.Context,
 		*types.AccountIdentifier,
-		*types.Currency,
+		[]*types.Currency,
 		*types.PartialBlockIdentifier,
-	) (*types.Amount, *types.BlockIdentifier, error)
+	) ([]*types.Amount, *types.BlockIdentifier, error)
+	SearchTransactions(
+		context.Context,
+		*types.SearchTransactionsRequest,
+	) ([]*types.BlockTransaction, int64, error)
+	GetBlockEvents(
+		context.Context,
+		*int64,
+		int64,
+	) ([]*types.BlockEvent, int64, error)
 }
 
 type unsignedTransaction struct {
@@ -89,21 +145,180 @@ type unsignedTransaction struct {
 	ScriptPubKeys  []*defichain.ScriptPubKey `json:"scriptPubKeys"`
 	InputAmounts   []string                  `json:"input_amounts"`
 	InputAddresses []string                  `json:"input_addresses"`
+	RedeemScripts  []string                  `json:"redeem_scripts,omitempty"`
+	WitnessScripts []string                  `json:"witness_scripts,omitempty"`
+
+	// Currencies are the token currencies moved by the
+	// custom transaction (ConstructionParse can't look
+	// them up offline).
+	Currencies []*types.Currency `json:"currencies,omitempty"`
 }
 
 type preprocessOptions struct {
 	Coins         []*types.Coin `json:"coins"`
 	EstimatedSize float64       `json:"estimated_size"`
 	FeeMultiplier *float64      `json:"fee_multiplier,omitempty"`
+	RedeemScripts []string      `json:"redeem_scripts,omitempty"`
+
+	// AuthAddresses are the addresses debited by a custom
+	// transaction that need an auth coin.
+	AuthAddresses []string `json:"auth_addresses,omitempty"`
+
+	// FundingAccount is populated if the coins spent by the
+	// transaction are selected in /construction/metadata. The
+	// selected coins must cover FundingAmount and the fee.
+	FundingAccount *types.AccountIdentifier `json:"funding_account,omitempty"`
+	FundingAmount  string                   `json:"funding_amount,omitempty"`
+	CoinSelection  CoinSelection            `json:"coin_selection,omitempty"`
+
+	ConfirmationTarget int64                  `json:"confirmation_target,omitempty"`
+	EstimateMode       defichain.EstimateMode `json:"estimate_mode,omitempty"`
+	FeePerKB           *float64               `json:"fee_per_kb,omitempty"`
+
+	// MaxFee is the largest fee (in satoshis) the
+	// transaction can pay.
+	MaxFee string `json:"max_fee,omitempty"`
+
+	Replaceable bool   `json:"replaceable,omitempty"`
+	LockTime    uint32 `json:"lock_time,omitempty"`
+
+	// Replaces is the hash of the transaction replaced
+	// by the transaction.
+	Replaces string `json:"replaces,omitempty"`
+
+	Encoding TransactionEncoding `json:"encoding,omitempty"`
 }
 
 type constructionMetadata struct {
+	// ScriptPubKeys are the scripts of the coins spent by
+	// the INPUT operations followed by the auth coins.
 	ScriptPubKeys []*defichain.ScriptPubKey `json:"script_pub_keys"`
+
+	// RedeemScripts are the hex-encoded redeem scripts of
+	// P2SH inputs (empty for all other inputs).
+	RedeemScripts []string `json:"redeem_scripts,omitempty"`
+
+	AuthCoins []*authCoin `json:"auth_coins,omitempty"`
+
+	// FundingCoins are the coins of FundingAddress selected
+	// to fund the transaction. They are spent after the coins
+	// of the INPUT operations. If ChangeAmount is populated,
+	// it is returned to FundingAddress after the OUTPUT
+	// operations.
+	FundingAddress string        `json:"funding_address,omitempty"`
+	FundingCoins   []*types.Coin `json:"funding_coins,omitempty"`
+	ChangeAmount   string        `json:"change_amount,omitempty"`
+
+	// FeePerKB is the fee rate (in DFI per kB) of the
+	// suggested fee. ConfirmationTarget is only populated
+	// if the fee rate was estimated.
+	FeePerKB           float64       `json:"fee_per_kb"`
+	ConfirmationTarget int64         `json:"confirmation_target,omitempty"`
+	FeeRateSource      FeeRateSource `json:"fee_rate_source"`
+
+	Replaceable bool   `json:"replaceable,omitempty"`
+	LockTime    uint32 `json:"lock_time,omitempty"`
+
+	// ReplacedFee is the fee (in satoshis) of the
+	// transaction replaced by the transaction and all
+	// of its descendants in the mempool. ReplacementFee
+	// is the smallest fee (in satoshis) of a transaction
+	// replacing them (BIP125).
+	ReplacedFee    string `json:"replaced_fee,omitempty"`
+	ReplacementFee string `json:"replacement_fee,omitempty"`
+
+	Encoding TransactionEncoding `json:"encoding,omitempty"`
+}
+
+// authCoin is a coin spent to authorize a custom transaction
+// debiting the account of its address. Its whole amount is
+// returned to the same address.
+type authCoin struct {
+	Address string      `json:"address"`
+	Coin    *types.Coin `json:"coin"`
 }
 
 type signedTransaction struct {
-	Transaction  string   `json:"transaction"`
-	InputAmounts []string `json:"input_amounts"`
+	Transaction  string            `json:"transaction"`
+	InputAmounts []string          `json:"input_amounts"`
+	Currencies   []*types.Currency `json:"currencies,omitempty"`
+}
+
+// InputOperationMetadata is the optional metadata of an
+// INPUT operation in /construction/preprocess and
+// /construction/payloads. It is required to spend P2SH
+// and P2WSH multisig outputs.
+type InputOperationMetadata struct {
+	RedeemScript  string `json:"redeem_script,omitempty"`
+	WitnessScript string `json:"witness_script,omitempty"`
+
+	// Signers are the hex-encoded public keys that will
+	// sign a multisig input. If empty, the first required
+	// public keys of the script are used.
+	Signers []string `json:"signers,omitempty"`
+
+	// Sequence overrides the sequence of the input
+	// (returned by /construction/parse).
+	Sequence *uint32 `json:"sequence,omitempty"`
+
+	// Bip32Derivations and PreviousTransaction (the hex-encoded
+	// transaction creating the coin, required by some signers
+	// of non-witness inputs) are only included in PSBTs.
+	Bip32Derivations    []*DerivationPath `json:"bip32_derivations,omitempty"`
+	PreviousTransaction string            `json:"previous_transaction,omitempty"`
+}
+
+// PreprocessMetadata is the optional metadata of a
+// /construction/preprocess request. If FundingAccount is
+// populated, the intent must not contain INPUT operations:
+// /construction/metadata selects the coins of FundingAccount
+// using CoinSelection (LargestFirst by default) and returns
+// any change to FundingAccount.
+//
+// The fee rate is estimated for ConfirmationTarget blocks
+// (2 by default) using EstimateMode, unless FeePerKB (in
+// DFI per kB) is provided.
+//
+// If Replaceable, the inputs signal BIP125 opt-in
+// replace-by-fee. LockTime is the block height (below
+// 500000000) or the UNIX time before which the transaction
+// can't be mined. If Replaces is populated, the fee is
+// bumped to replace the transaction with this hash, which
+// must only spend INPUT operations of the intent.
+//
+// Encoding is the encoding of the unsigned and signed
+// transactions (JSONTransactionEncoding by default).
+type PreprocessMetadata struct {
+	FundingAccount *types.AccountIdentifier `json:"funding_account,omitempty"`
+	CoinSelection  CoinSelection            `json:"coin_selection,omitempty"`
+
+	ConfirmationTarget int64                  `json:"confirmation_target,omitempty"`
+	EstimateMode       defichain.EstimateMode `json:"estimate_mode,omitempty"`
+	FeePerKB           *float64               `json:"fee_per_kb,omitempty"`
+
+	Replaceable bool   `json:"replaceable,omitempty"`
+	LockTime    uint32 `json:"lock_time,omitempty"`
+	Replaces    string `json:"replaces,omitempty"`
+
+	Encoding TransactionEncoding `json:"encoding,omitempty"`
+}
+
+// ParseMetadata is the metadata returned by
+// /construction/parse.
+type ParseMetadata struct {
+	LockTime    uint32 `json:"lock_time"`
+	Replaceable bool   `json:"replaceable"`
+}
+
+// OutputOperationMetadata is the optional metadata of an
+// OUTPUT operation. Minted outputs are funded by the
+// ACCOUNT_TO_UTXOS operation of the intent instead of
+// its INPUT operations.
+type OutputOperationMetadata struct {
+	Minted bool `json:"minted,omitempty"`
+
+	// Bip32Derivations are only included in PSBTs.
+	Bip32Derivations []*DerivationPath `json:"bip32_derivations,omitempty"`
 }
 
 // ParseOperationMetadata is returned from
@@ -111,3 +326,67 @@ type signedTransaction struct {
 type ParseOperationMetadata struct {
 	ScriptPubKey *defichain.ScriptPubKey `json:"scriptPubKey"`
 }
+
+// TestMempoolAcceptParameters are the parameters of
+// the TestMempoolAcceptMethod. SignedTransaction is
+// the signed transaction of /construction/submit.
+type TestMempoolAcceptParameters struct {
+	SignedTransaction string `json:"signed_transaction"`
+}
+
+// TestMempoolAcceptResult is the result of the
+// TestMempoolAcceptMethod. Fee is the fee (in
+// satoshis) and Vsize the virtual size of the
+// transaction.
+type TestMempoolAcceptResult struct {
+	TransactionIdentifier *types.TransactionIdentifier `json:"transaction_identifier"`
+	Allowed               bool                         `json:"allowed"`
+	RejectReason          string                       `json:"reject_reason,omitempty"`
+	Fee                   *types.Amount                `json:"fee"`
+	Vsize                 int64                        `json:"vsize"`
+}
+
+// MempoolTransactionMetadata is the metadata of a
+// /mempool/transaction response. Fee is the fee (in
+// satoshis) and FeePerKB the fee rate (in DFI per kB)
+// of the transaction.
+type MempoolTransactionMetadata struct {
+	Fee          *types.Amount         `json:"fee"`
+	FeePerKB     float64               `json:"fee_per_kb"`
+	MempoolEntry *MempoolEntryMetadata `json:"mempool_entry"`
+}
+
+// MempoolEntryMetadata describes a transaction in the mempool
+// of defid. Fees are in satoshis and sizes in virtual bytes.
+// Time is the UNIX time and Height the block height at which
+// the transaction entered the mempool. Ancestor and descendant
+// counts, sizes and fees include the transaction itself, so
+// AncestorFeePerKB (in DFI per kB) is the fee rate a miner
+// gets by including the transaction with its ancestors.
+type MempoolEntryMetadata struct {
+	Vsize  int64 `json:"vsize"`
+	Time   int64 `json:"time"`
+	Height int64 `json:"height"`
+
+	Fee         int64 `json:"fee"`
+	ModifiedFee int64 `json:"modified_fee"`
+
+	AncestorCount    int64   `json:"ancestor_count"`
+	AncestorSize     int64   `json:"ancestor_size"`
+	AncestorFees     int64   `json:"ancestor_fees"`
+	AncestorFeePerKB float64 `json:"ancestor_fee_per_kb"`
+
+	DescendantCount int64 `json:"descendant_count"`
+	DescendantSize  int64 `json:"descendant_size"`
+	DescendantFees  int64 `json:"descendant_fees"`
+
+	Depends           []string `json:"depends"`
+	SpentBy           []string `json:"spent_by"`
+	Bip125Replaceable bool     `json:"bip125_replaceable"`
+}
+
+// RawMempoolResult is the result of the RawMempoolMethod.
+// Transactions are keyed by hash.
+type RawMempoolResult struct {
+	Transactions map[string]*MempoolEntryMetadata `json:"transactions"`
+}